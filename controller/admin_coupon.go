@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"billing3/database"
+	"billing3/database/types"
+	"billing3/service"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/shopspring/decimal"
+)
+
+type couponReq struct {
+	Code           string          `json:"code" validate:"required,max=100"`
+	Type           string          `json:"type" validate:"required,oneof=PERCENTAGE FIXED"`
+	Value          decimal.Decimal `json:"value"`
+	Currency       string          `json:"currency"`    // currency of fixed discounts, empty for the default currency
+	ProductIds     []int32         `json:"product_ids"` // empty for all products
+	Durations      []int32         `json:"durations"`   // empty for all billing cycles
+	Recurring      bool            `json:"recurring"`
+	MaxUses        int32           `json:"max_uses" validate:"min=0"`          // 0 for unlimited
+	MaxUsesPerUser int32           `json:"max_uses_per_user" validate:"min=0"` // 0 for unlimited
+	ValidFrom      types.Timestamp `json:"valid_from"`
+	ValidUntil     types.Timestamp `json:"valid_until"`
+	Enabled        bool            `json:"enabled"`
+}
+
+// validateCoupon validates the request and returns an error message, or empty string if valid
+func validateCoupon(req *couponReq) string {
+	if strings.ContainsAny(req.Code, " \t\r\n") {
+		return "coupon code must not contain spaces"
+	}
+	if req.Value.LessThanOrEqual(decimal.Zero) {
+		return "value must be positive"
+	}
+	if req.Type == service.CouponPercentage && req.Value.GreaterThan(decimal.NewFromInt(100)) {
+		return "percentage must not be greater than 100"
+	}
+	if req.Currency != "" && !service.ValidCurrency(req.Currency) {
+		return "invalid currency"
+	}
+	if req.ValidFrom.Valid && req.ValidUntil.Valid && req.ValidUntil.Time.Before(req.ValidFrom.Time) {
+		return "valid until must be after valid from"
+	}
+	if req.ProductIds == nil {
+		req.ProductIds = []int32{}
+	}
+	if req.Durations == nil {
+		req.Durations = []int32{}
+	}
+	return ""
+}
+
+func adminCouponList(w http.ResponseWriter, r *http.Request) {
+	coupons, err := database.Q.ListCoupons(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("admin list coupon", "err", err)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{
+		"coupons": coupons,
+	})
+}
+
+func adminCouponCreate(w http.ResponseWriter, r *http.Request) {
+	req, err := decode[couponReq](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if msg := validateCoupon(req); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	id, err := database.Q.CreateCoupon(r.Context(), database.CreateCouponParams{
+		Code:           req.Code,
+		Type:           req.Type,
+		Value:          req.Value,
+		Currency:       req.Currency,
+		ProductIds:     req.ProductIds,
+		Durations:      req.Durations,
+		Recurring:      req.Recurring,
+		MaxUses:        req.MaxUses,
+		MaxUsesPerUser: req.MaxUsesPerUser,
+		ValidFrom:      req.ValidFrom,
+		ValidUntil:     req.ValidUntil,
+		Enabled:        req.Enabled,
+	})
+	if err != nil {
+		if err, ok := err.(*pgconn.PgError); ok && err.Code == database.PGErrorUniqueViolation {
+			writeError(w, http.StatusBadRequest, "coupon code already exists")
+			return
+		}
+		slog.Error("admin create coupon", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{
+		"id": id,
+	})
+}
+
+func adminCouponUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	req, err := decode[couponReq](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if msg := validateCoupon(req); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	// discounts already persisted on services are not affected
+	err = database.Q.UpdateCoupon(r.Context(), database.UpdateCouponParams{
+		Code:           req.Code,
+		Type:           req.Type,
+		Value:          req.Value,
+		Currency:       req.Currency,
+		ProductIds:     req.ProductIds,
+		Durations:      req.Durations,
+		Recurring:      req.Recurring,
+		MaxUses:        req.MaxUses,
+		MaxUsesPerUser: req.MaxUsesPerUser,
+		ValidFrom:      req.ValidFrom,
+		ValidUntil:     req.ValidUntil,
+		Enabled:        req.Enabled,
+		ID:             int32(id),
+	})
+	if err != nil {
+		if err, ok := err.(*pgconn.PgError); ok && err.Code == database.PGErrorUniqueViolation {
+			writeError(w, http.StatusBadRequest, "coupon code already exists")
+			return
+		}
+		slog.Error("admin update coupon", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{})
+}
+
+func adminCouponGet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	coupon, err := database.Q.FindCouponById(r.Context(), int32(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("admin coupon get", "err", err)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"coupon": coupon})
+}
+
+func adminCouponDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = database.Q.DeleteCoupon(r.Context(), int32(id))
+	if err != nil {
+		slog.Error("admin delete coupon", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{})
+}
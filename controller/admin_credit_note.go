@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"billing3/database"
+	"billing3/service"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+func adminCreditNoteList(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(r.URL.Query().Get("user"))
+	if err != nil {
+		userId = 0
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	totalPages, creditNotes, err := service.SearchCreditNotes(r.Context(), int32(userId), page, itemPerPage)
+	if err != nil {
+		slog.Error("admin list credit notes", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"credit_notes": creditNotes, "total_pages": totalPages})
+}
+
+func adminCreditNoteGet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	creditNote, err := database.Q.FindCreditNoteById(r.Context(), int32(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.Error("admin get credit note", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	items, err := database.Q.ListCreditNoteItems(r.Context(), creditNote.ID)
+	if err != nil {
+		slog.Error("admin get credit note", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"credit_note": creditNote, "items": items})
+}
+
+func adminInvoiceListCreditNotes(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	creditNotes, err := database.Q.ListCreditNotesByInvoice(r.Context(), int32(id))
+	if err != nil {
+		slog.Error("admin list invoice credit notes", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"credit_notes": creditNotes})
+}
+
+// adminInvoiceCreateCreditNote issues a credit note for a paid invoice manually
+func adminInvoiceCreateCreditNote(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	type reqStruct struct {
+		Reason string                   `json:"reason" validate:"required"`
+		Items  []service.CreditNoteItem `json:"items" validate:"required,min=1,dive"`
+	}
+	req, err := decode[reqStruct](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	total := decimal.Zero
+	for _, item := range req.Items {
+		if item.Amount.LessThanOrEqual(decimal.Zero) {
+			writeError(w, http.StatusBadRequest, "amount must be greater than zero")
+			return
+		}
+		total = total.Add(item.Amount)
+	}
+
+	tx, err := database.Conn.Begin(r.Context())
+	if err != nil {
+		slog.Error("admin create credit note", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer rollbackTx(r.Context(), tx)
+	qtx := database.Q.WithTx(tx)
+
+	invoice, err := qtx.SelectInvoiceForUpdate(r.Context(), int32(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.Error("admin create credit note", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if !service.InvoiceIsPaid(invoice.Status) {
+		writeError(w, http.StatusBadRequest, "credit notes can only be issued for paid invoices")
+		return
+	}
+
+	// the invoice must not be credited more than its amount
+	credited, err := qtx.SumCreditNotesByInvoice(r.Context(), invoice.ID)
+	if err != nil {
+		slog.Error("admin create credit note", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_, _, creditTotal := service.TaxFromInvoice(&invoice).Apply(total)
+	if credited.Add(creditTotal).GreaterThan(invoice.Amount) {
+		writeError(w, http.StatusBadRequest, "credit notes must not exceed the invoice amount")
+		return
+	}
+
+	creditNoteId, err := service.CreateCreditNote(r.Context(), qtx, &invoice, req.Reason, req.Items)
+	if err != nil {
+		slog.Error("admin create credit note", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit(r.Context())
+	if err != nil {
+		slog.Error("admin create credit note", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"id": creditNoteId})
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"billing3/service"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+type exportFunc func(ctx context.Context, w io.Writer, r service.ExportRange) error
+
+func adminExportInvoices(w http.ResponseWriter, r *http.Request) {
+	adminExport(w, r, "invoices", service.ExportInvoicesCSV)
+}
+
+func adminExportInvoiceItems(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Query().Get("format") {
+	case "", "csv":
+		adminExport(w, r, "invoice-items", service.ExportInvoiceItemsCSV)
+	case "xero":
+		adminExport(w, r, "invoice-items-xero", service.ExportInvoiceItemsXero)
+	default:
+		writeError(w, http.StatusBadRequest, "invalid format")
+	}
+}
+
+func adminExportPayments(w http.ResponseWriter, r *http.Request) {
+	adminExport(w, r, "payments", service.ExportPaymentsCSV)
+}
+
+func adminExportJournal(w http.ResponseWriter, r *http.Request) {
+	adminExport(w, r, "journal", service.ExportJournalCSV)
+}
+
+// adminExport streams an export as a CSV download. The range is given by the from and to query parameters as for
+// reports, and the basis query parameter, which defaults to accrual.
+//
+// Errors after the response has started can not be reported to the client, so they are only logged, and the download
+// is truncated.
+func adminExport(w http.ResponseWriter, r *http.Request, name string, export exportFunc) {
+	from, to, ok := reportDateRange(w, r)
+	if !ok {
+		return
+	}
+
+	basis := r.URL.Query().Get("basis")
+	if basis == "" {
+		basis = service.ExportBasisAccrual
+	}
+	if !service.ValidExportBasis(basis) {
+		writeError(w, http.StatusBadRequest, "invalid basis")
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s-%s.csv", name, from.Format(time.DateOnly), to.AddDate(0, 0, -1).Format(time.DateOnly))
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.WriteHeader(http.StatusOK)
+
+	err := export(r.Context(), w, service.ExportRange{Basis: basis, From: from, To: to})
+	if err != nil {
+		slog.Error("admin export", "err", err, "export", name)
+	}
+}
@@ -146,7 +146,7 @@ func adminGatewayUpdate(w http.ResponseWriter, r *http.Request) {
 		Name:        gateway.Name,
 	})
 	if err != nil {
-		if err, ok := err.(*pgconn.PgError); ok && err.Code == PGErrorUniqueViolation {
+		if err, ok := err.(*pgconn.PgError); ok && err.Code == database.PGErrorUniqueViolation {
 			writeError(w, http.StatusForbidden, "duplicated display name")
 			return
 		}
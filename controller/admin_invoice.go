@@ -4,7 +4,10 @@ import (
 	"billing3/database"
 	"billing3/database/types"
 	"billing3/service"
+	"billing3/service/gateways"
+	"context"
 	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
@@ -16,7 +19,8 @@ import (
 
 func adminInvoiceList(w http.ResponseWriter, r *http.Request) {
 	status := r.URL.Query().Get("status")
-	if status != service.InvoiceUnpaid && status != service.InvoicePaid && status != service.InvoiceCancelled {
+	if status != service.InvoiceUnpaid && status != service.InvoicePaid && status != service.InvoiceCancelled &&
+		status != service.InvoiceRefunded && status != service.InvoicePartiallyRefunded {
 		status = ""
 	}
 
@@ -68,6 +72,34 @@ func adminInvoiceGet(w http.ResponseWriter, r *http.Request) {
 	writeResp(w, http.StatusOK, D{"invoice": invoice, "items": items})
 }
 
+func adminInvoicePDF(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	invoice, err := database.Q.FindInvoiceById(r.Context(), int32(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.Error("admin invoice pdf", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	data, err := service.RenderInvoicePDF(r.Context(), invoice.ID)
+	if err != nil {
+		slog.Error("admin invoice pdf", "err", err, "invoice", invoice.ID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writePDF(w, invoicePDFFilename(&invoice), data)
+}
+
 func adminInvoiceEdit(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
@@ -76,7 +108,7 @@ func adminInvoiceEdit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type reqStruct struct {
-		Status             string          `json:"status" validate:"required,oneof=PAID UNPAID CANCELLED"`
+		Status             string          `json:"status" validate:"required,oneof=PAID UNPAID CANCELLED REFUNDED PARTIALLY_REFUNDED"`
 		CancellationReason pgtype.Text     `json:"cancellation_reason" `
 		PaidAt             types.Timestamp `json:"paid_at"`
 		DueAt              types.Timestamp `json:"due_at" validate:"required"`
@@ -87,8 +119,28 @@ func adminInvoiceEdit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	tx, err := database.Conn.Begin(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("admin update invoice", "err", err)
+		return
+	}
+	defer rollbackTx(r.Context(), tx)
+	qtx := database.Q.WithTx(tx)
+
+	invoice, err := qtx.SelectInvoiceForUpdate(r.Context(), int32(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("admin update invoice", "err", err)
+		return
+	}
+
 	// update invoice
-	err = database.Q.UpdateInvoice(r.Context(), database.UpdateInvoiceParams{
+	err = qtx.UpdateInvoice(r.Context(), database.UpdateInvoiceParams{
 		Status:             req.Status,
 		CancellationReason: req.CancellationReason,
 		PaidAt:             req.PaidAt,
@@ -101,6 +153,37 @@ func adminInvoiceEdit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// cancelling a paid invoice credits the amount that has not been credited yet
+	if req.Status == service.InvoiceCancelled && service.InvoiceIsPaid(invoice.Status) {
+		reason := "Invoice cancelled"
+		if req.CancellationReason.Valid && req.CancellationReason.String != "" {
+			reason = req.CancellationReason.String
+		}
+		err = service.CreditRemainingInvoiceAmount(r.Context(), qtx, &invoice, reason)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			slog.Error("admin update invoice", "err", err)
+			return
+		}
+	}
+
+	// invoices marked as PAID by admins are numbered too
+	if req.Status == service.InvoicePaid {
+		err = service.AssignInvoiceNumber(r.Context(), qtx, int32(id))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			slog.Error("admin update invoice", "err", err)
+			return
+		}
+	}
+
+	err = tx.Commit(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("admin update invoice", "err", err)
+		return
+	}
+
 	writeResp(w, http.StatusOK, D{})
 }
 
@@ -125,6 +208,23 @@ func adminInvoiceAddItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	invoice, err := database.Q.FindInvoiceById(r.Context(), int32(invoiceId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.Error("admin invoice add item", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// the amount of paid invoices is fixed, changes are made with credit notes
+	if service.InvoiceIsPaid(invoice.Status) {
+		writeError(w, http.StatusBadRequest, "items cannot be added to paid invoices")
+		return
+	}
+
 	err = database.Q.CreateInvoiceItem(r.Context(), database.CreateInvoiceItemParams{
 		InvoiceID:   int32(invoiceId),
 		Description: req.Description,
@@ -138,7 +238,7 @@ func adminInvoiceAddItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = database.Q.UpdateInvoiceAmount(r.Context(), int32(invoiceId))
+	err = service.RecalculateInvoiceAmount(r.Context(), database.Q, int32(invoiceId))
 	if err != nil {
 		slog.Error("admin invoice add item", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -161,17 +261,53 @@ func adminInvoiceRemoveItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = database.Q.DeleteInvoiceItem(r.Context(), database.DeleteInvoiceItemParams{
-		ID:        int32(id),
-		InvoiceID: int32(invoiceId),
-	})
+	tx, err := database.Conn.Begin(r.Context())
 	if err != nil {
 		slog.Error("admin invoice remove item", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	defer rollbackTx(r.Context(), tx)
+	qtx := database.Q.WithTx(tx)
 
-	err = database.Q.UpdateInvoiceAmount(r.Context(), int32(invoiceId))
+	invoice, item, ok := adminLockInvoiceItem(w, r, qtx, int32(invoiceId), int32(id))
+	if !ok {
+		return
+	}
+
+	if service.InvoiceIsPaid(invoice.Status) {
+		// paid invoices are not changed, removing an item is documented by a credit note
+		if item.Amount.GreaterThan(decimal.Zero) {
+			_, err = service.CreateCreditNote(r.Context(), qtx, invoice, adjustmentReason(r.URL.Query().Get("reason")), []service.CreditNoteItem{{
+				Description: "Removed: " + item.Description,
+				Amount:      item.Amount,
+			}})
+			if err != nil {
+				slog.Error("admin invoice remove item", "err", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+	} else {
+		err = qtx.DeleteInvoiceItem(r.Context(), database.DeleteInvoiceItemParams{
+			ID:        int32(id),
+			InvoiceID: int32(invoiceId),
+		})
+		if err != nil {
+			slog.Error("admin invoice remove item", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		err = service.RecalculateInvoiceAmount(r.Context(), qtx, int32(invoiceId))
+		if err != nil {
+			slog.Error("admin invoice remove item", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err = tx.Commit(r.Context())
 	if err != nil {
 		slog.Error("admin invoice remove item", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -197,6 +333,7 @@ func adminInvoiceUpdateItem(w http.ResponseWriter, r *http.Request) {
 	type reqStruct struct {
 		Description string          `json:"description" validate:"required"`
 		Amount      decimal.Decimal `json:"amount"`
+		Reason      string          `json:"reason"` // reason of the credit note if the invoice has been paid
 	}
 	req, err := decode[reqStruct](r)
 	if err != nil {
@@ -208,21 +345,62 @@ func adminInvoiceUpdateItem(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = database.Q.UpdateInvoiceItem(r.Context(), database.UpdateInvoiceItemParams{
-		Description: req.Description,
-		Amount:      req.Amount,
-		ID:          int32(id),
-		InvoiceID:   int32(invoiceId),
-	})
+	tx, err := database.Conn.Begin(r.Context())
 	if err != nil {
 		slog.Error("admin invoice update item", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	defer rollbackTx(r.Context(), tx)
+	qtx := database.Q.WithTx(tx)
+
+	invoice, item, ok := adminLockInvoiceItem(w, r, qtx, int32(invoiceId), int32(id))
+	if !ok {
+		return
+	}
+
+	if service.InvoiceIsPaid(invoice.Status) {
+		// paid invoices are not changed, reducing an item is documented by a credit note
+		reduction := item.Amount.Sub(req.Amount)
+		if reduction.LessThan(decimal.Zero) {
+			writeError(w, http.StatusBadRequest, "items of paid invoices cannot be increased")
+			return
+		}
+		if reduction.GreaterThan(decimal.Zero) {
+			_, err = service.CreateCreditNote(r.Context(), qtx, invoice, adjustmentReason(req.Reason), []service.CreditNoteItem{{
+				Description: "Adjusted: " + item.Description,
+				Amount:      reduction,
+			}})
+			if err != nil {
+				slog.Error("admin invoice update item", "err", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+	} else {
+		err = qtx.UpdateInvoiceItem(r.Context(), database.UpdateInvoiceItemParams{
+			Description: req.Description,
+			Amount:      req.Amount,
+			ID:          int32(id),
+			InvoiceID:   int32(invoiceId),
+		})
+		if err != nil {
+			slog.Error("admin invoice update item", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		err = service.RecalculateInvoiceAmount(r.Context(), qtx, int32(invoiceId))
+		if err != nil {
+			slog.Error("admin invoice update item", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
 
-	err = database.Q.UpdateInvoiceAmount(r.Context(), int32(invoiceId))
+	err = tx.Commit(r.Context())
 	if err != nil {
-		slog.Error("admin invoice remove item", "err", err)
+		slog.Error("admin invoice update item", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
@@ -230,6 +408,45 @@ func adminInvoiceUpdateItem(w http.ResponseWriter, r *http.Request) {
 	writeResp(w, http.StatusOK, D{})
 }
 
+// adminLockInvoiceItem locks the invoice and finds the item in the transaction qtx. It writes the
+// error response and returns false if either does not exist.
+func adminLockInvoiceItem(w http.ResponseWriter, r *http.Request, qtx *database.Queries, invoiceId int32, itemId int32) (*database.Invoice, *database.InvoiceItem, bool) {
+	invoice, err := qtx.SelectInvoiceForUpdate(r.Context(), invoiceId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return nil, nil, false
+		}
+		slog.Error("admin lock invoice", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	item, err := qtx.FindInvoiceItem(r.Context(), database.FindInvoiceItemParams{
+		ID:        itemId,
+		InvoiceID: invoiceId,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return nil, nil, false
+		}
+		slog.Error("admin find invoice item", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	return &invoice, &item, true
+}
+
+// adjustmentReason returns the reason of a credit note for an adjustment of a paid invoice.
+func adjustmentReason(reason string) string {
+	if reason == "" {
+		return "Invoice adjusted"
+	}
+	return reason
+}
+
 func adminListInvoicePayment(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
@@ -292,3 +509,326 @@ func adminInvoiceListByService(w http.ResponseWriter, r *http.Request) {
 	writeResp(w, http.StatusOK, D{"invoices": invoices})
 
 }
+
+func adminRefundInvoicePayment(w http.ResponseWriter, r *http.Request) {
+	invoiceId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	paymentId, err := strconv.Atoi(chi.URLParam(r, "payment_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	type reqStruct struct {
+		Amount   decimal.Decimal `json:"amount"` // zero for a full refund
+		ToCredit bool            `json:"to_credit"`
+		Reason   string          `json:"reason"`
+	}
+	req, err := decode[reqStruct](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Amount.LessThan(decimal.Zero) {
+		writeError(w, http.StatusBadRequest, "amount must not be negative")
+		return
+	}
+
+	tx, err := database.Conn.Begin(r.Context())
+	if err != nil {
+		slog.Error("begin tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer rollbackTx(r.Context(), tx)
+
+	qtx := database.Q.WithTx(tx)
+
+	// lock the invoice so that the same payment cannot be refunded concurrently
+	_, err = qtx.SelectInvoiceForUpdate(r.Context(), int32(invoiceId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.Error("admin refund invoice payment", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	payment, err := qtx.FindInvoicePayment(r.Context(), database.FindInvoicePaymentParams{
+		ID:        int32(paymentId),
+		InvoiceID: int32(invoiceId),
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.Error("admin refund invoice payment", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	refundable, err := service.RefundableAmount(r.Context(), qtx, &payment)
+	if err != nil {
+		slog.Error("admin refund invoice payment", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	amount := req.Amount
+	if amount.IsZero() {
+		amount = refundable
+	}
+	if amount.LessThanOrEqual(decimal.Zero) || amount.GreaterThan(refundable) {
+		writeError(w, http.StatusBadRequest, service.ErrRefundExceedsPayment.Error())
+		return
+	}
+
+	description := "Refund"
+	if req.Reason != "" {
+		description = "Refund: " + req.Reason
+	}
+
+	var refundId int32
+	gateway, ok := gateways.Gateways[payment.Gateway]
+	switch {
+	case req.ToCredit || payment.Gateway == service.GatewayCredit:
+		refundId, err = service.RefundToCredit(r.Context(), qtx, &payment, amount, description)
+	case !ok:
+		// manually added payments, the money is assumed to be sent back manually
+		refundId, err = service.RecordRefund(r.Context(), qtx, &payment, amount, description, "", payment.Gateway)
+	default:
+		refunder, ok := gateway.(gateways.Refunder)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "payment gateway does not support refunds")
+			return
+		}
+
+		// the refund is recorded as pending, and the gateway is called after the transaction is commited
+		var gatewayRefundId int32
+		gatewayRefundId, err = service.StartGatewayRefund(r.Context(), qtx, &payment, amount, description)
+		if err == nil {
+			err = tx.Commit(r.Context())
+			if err != nil {
+				slog.Error("commit tx", "err", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			refundThroughGateway(w, r, refunder, &payment, gatewayRefundId, amount)
+			return
+		}
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrRefundExceedsPayment) || errors.Is(err, service.ErrPaymentAlreadyRecorded) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Error("admin refund invoice payment", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit(r.Context())
+	if err != nil {
+		slog.Error("commit tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"id": refundId})
+}
+
+// refundThroughGateway sends a pending gateway refund of the payment through the gateway, and records it once the
+// gateway has carried it out. If the refund cannot be recorded, it is left pending with the reference id of the
+// gateway, to be completed by an admin.
+func refundThroughGateway(w http.ResponseWriter, r *http.Request, refunder gateways.Refunder, payment *database.InvoicePayment, gatewayRefundId int32, amount decimal.Decimal) {
+	referenceId, err := refunder.Refund(payment, amount)
+	if err != nil {
+		slog.Error("admin refund invoice payment", "gateway", payment.Gateway, "payment_id", payment.ID, "gateway_refund_id", gatewayRefundId, "err", err)
+		if err := service.FailGatewayRefund(r.Context(), database.Q, gatewayRefundId, err.Error()); err != nil {
+			slog.Error("admin refund invoice payment: fail gateway refund", "gateway_refund_id", gatewayRefundId, "err", err)
+		}
+		writeError(w, http.StatusBadRequest, "gateway refund failed: "+err.Error())
+		return
+	}
+
+	refundId, err := completeGatewayRefund(r.Context(), payment.InvoiceID, gatewayRefundId, referenceId)
+	if err != nil {
+		// the money has been sent back, keep the reference id of the gateway on the pending refund
+		slog.Error("admin refund invoice payment: gateway refund succeeded but not recorded", "gateway", payment.Gateway, "payment_id", payment.ID, "gateway_refund_id", gatewayRefundId, "reference_id", referenceId, "amount", amount, "err", err)
+		err = database.Q.UpdateGatewayRefund(r.Context(), database.UpdateGatewayRefundParams{
+			Status:      service.GatewayRefundPending,
+			ReferenceID: referenceId,
+			Error:       err.Error(),
+			ID:          gatewayRefundId,
+		})
+		if err != nil {
+			slog.Error("admin refund invoice payment: update gateway refund", "gateway_refund_id", gatewayRefundId, "reference_id", referenceId, "err", err)
+		}
+		writeError(w, http.StatusInternalServerError, "the refund has been sent through the gateway, but could not be recorded. Complete the pending gateway refund of the invoice.")
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"id": refundId})
+}
+
+// completeGatewayRefund completes the pending gateway refund in a new transaction.
+func completeGatewayRefund(ctx context.Context, invoiceId int32, gatewayRefundId int32, referenceId string) (int32, error) {
+	tx, err := database.Conn.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer rollbackTx(ctx, tx)
+
+	refundId, err := service.CompleteGatewayRefund(ctx, database.Q.WithTx(tx), invoiceId, gatewayRefundId, referenceId)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("commit tx: %w", err)
+	}
+
+	return refundId, nil
+}
+
+func adminListInvoiceGatewayRefunds(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	refunds, err := database.Q.ListInvoiceGatewayRefunds(r.Context(), int32(id))
+	if err != nil {
+		slog.Error("admin list invoice gateway refunds", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"gateway_refunds": refunds})
+}
+
+// adminResolveGatewayRefund resolves a gateway refund left pending, after the admin has checked its outcome at the
+// gateway. COMPLETED records the refund, FAILED makes its amount refundable again.
+func adminResolveGatewayRefund(w http.ResponseWriter, r *http.Request) {
+	invoiceId, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	gatewayRefundId, err := strconv.Atoi(chi.URLParam(r, "refund_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	type reqStruct struct {
+		Status      string `json:"status" validate:"oneof=COMPLETED FAILED"`
+		ReferenceID string `json:"reference_id"` // defaults to the reference id kept on the gateway refund
+	}
+	req, err := decode[reqStruct](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	refund, err := database.Q.FindGatewayRefund(r.Context(), database.FindGatewayRefundParams{
+		ID:        int32(gatewayRefundId),
+		InvoiceID: int32(invoiceId),
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.Error("admin resolve gateway refund", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if refund.Status != service.GatewayRefundPending {
+		writeError(w, http.StatusBadRequest, service.ErrGatewayRefundNotPending.Error())
+		return
+	}
+
+	if req.Status == service.GatewayRefundFailed {
+		err = service.FailGatewayRefund(r.Context(), database.Q, refund.ID, "marked as failed by admin")
+		if err != nil {
+			slog.Error("admin resolve gateway refund", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeResp(w, http.StatusOK, D{})
+		return
+	}
+
+	referenceId := req.ReferenceID
+	if referenceId == "" {
+		referenceId = refund.ReferenceID
+	}
+
+	refundId, err := completeGatewayRefund(r.Context(), int32(invoiceId), refund.ID, referenceId)
+	if err != nil {
+		if errors.Is(err, service.ErrGatewayRefundNotPending) || errors.Is(err, service.ErrRefundExceedsPayment) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Error("admin resolve gateway refund", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"id": refundId})
+}
+
+func adminInvoiceMerge(w http.ResponseWriter, r *http.Request) {
+	type reqStruct struct {
+		InvoiceIds []int32 `json:"invoice_ids" validate:"min=2"`
+	}
+	req, err := decode[reqStruct](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx, err := database.Conn.Begin(r.Context())
+	if err != nil {
+		slog.Error("begin tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer rollbackTx(r.Context(), tx)
+
+	invoiceId, err := service.MergeInvoices(r.Context(), database.Q.WithTx(tx), req.InvoiceIds)
+	if err != nil {
+		if errors.Is(err, service.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "invoice not found")
+			return
+		}
+		if errors.Is(err, service.ErrInvoicesNotMergeable) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Error("admin merge invoices", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit(r.Context())
+	if err != nil {
+		slog.Error("commit tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"invoice": invoiceId})
+}
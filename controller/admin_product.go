@@ -3,12 +3,14 @@ package controller
 import (
 	"billing3/database"
 	"billing3/database/types"
+	"billing3/service"
 	"billing3/service/extension"
 	"database/sql"
 	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/shopspring/decimal"
 	"log/slog"
 	"net/http"
@@ -19,16 +21,17 @@ import (
 )
 
 type adminProductReqStruct struct {
-	Name         string              `json:"name" validate:"required"`
-	Description  string              `json:"description"`
-	CategoryId   int32               `json:"category_id" validate:"required"`
-	Extension    string              `json:"extension" validate:"required"`
-	Enabled      bool                `json:"enabled"`
-	Pricing      types.ProductPrices `json:"pricing"`
-	Settings     map[string]string   `json:"settings"`
-	Stock        int32               `json:"stock" validate:"min=0"`
-	StockControl int32               `json:"stock_control" validate:"oneof=1 2"`
-	Options      []struct {
+	Name           string              `json:"name" validate:"required"`
+	Description    string              `json:"description"`
+	CategoryId     int32               `json:"category_id" validate:"required"`
+	Extension      string              `json:"extension" validate:"required"`
+	Enabled        bool                `json:"enabled"`
+	Pricing        types.ProductPrices `json:"pricing"`
+	MeteredPricing types.MeteredPrices `json:"metered_pricing"`
+	Settings       map[string]string   `json:"settings"`
+	Stock          int32               `json:"stock" validate:"min=0"`
+	StockControl   int32               `json:"stock_control" validate:"oneof=1 2"`
+	Options        []struct {
 		DisplayName string                    `json:"display_name" validate:"required"`
 		Name        string                    `json:"name" validate:"required"`
 		Description string                    `json:"description"`
@@ -36,6 +39,23 @@ type adminProductReqStruct struct {
 		Type        string                    `json:"type" validate:"required,oneof=select textarea password text"`
 		Values      types.ProductOptionValues `json:"values"`
 	} `json:"options" validate:"dive"`
+
+	// lifecycle policy overrides, the settings are used if nil
+	InvoiceDaysBeforeExpiry      *int32 `json:"invoice_days_before_expiry" validate:"omitempty,min=0"`
+	SuspendDaysAfterDue          *int32 `json:"suspend_days_after_due" validate:"omitempty,min=0"`
+	TerminateDaysAfterSuspension *int32 `json:"terminate_days_after_suspension" validate:"omitempty,min=0"`
+
+	// day of month on which services with calendar billing cycles renew, nil to renew on the day they are ordered
+	BillingAnchorDay *int32 `json:"billing_anchor_day" validate:"omitempty,min=1,max=31"`
+
+	// free trial, no trial if TrialDays is zero
+	TrialDays                  int32 `json:"trial_days" validate:"min=0"`
+	TrialRequiresPaymentMethod bool  `json:"trial_requires_payment_method"`
+	TrialOncePerUser           *bool `json:"trial_once_per_user"` // true if not present
+
+	// affiliate commission in percent of the first invoice of services, or of all invoices if recurring
+	CommissionPercent   decimal.Decimal `json:"commission_percent"`
+	CommissionRecurring bool            `json:"commission_recurring"`
 }
 
 func adminProductList(w http.ResponseWriter, r *http.Request) {
@@ -98,13 +118,24 @@ func adminProductReqValidate(req *adminProductReqStruct) (map[string]string, err
 		return nil, fmt.Errorf("at least one pricing is required")
 	}
 
-	pricingDisplayNames := make(map[string]bool) // set of pricing display names
-	pricingDurations := make(map[int32]bool)     // set of pricing durations
+	// a product may be priced in several currencies, so display names and durations
+	// need to be unique per currency
+	type pricingDuration struct {
+		currency string
+		duration int32
+	}
+	pricingDisplayNames := make(map[string]bool)       // set of pricing currencies and display names
+	pricingDurations := make(map[pricingDuration]bool) // set of pricing currencies and durations
+	pricingMonths := make(map[int32]int32)             // calendar months of each duration
 	for _, p := range req.Pricing {
 		if p.DisplayName == "" {
 			return nil, fmt.Errorf("pricing display name is required")
 		}
 
+		if p.Currency != "" && !service.ValidCurrency(p.Currency) {
+			return nil, fmt.Errorf("invalid currency: %s", p.Currency)
+		}
+
 		if !p.Price.GreaterThanOrEqual(decimal.NewFromInt(0)) {
 			return nil, fmt.Errorf("price must not be negative")
 		}
@@ -113,18 +144,40 @@ func adminProductReqValidate(req *adminProductReqStruct) (map[string]string, err
 			return nil, fmt.Errorf("setup fee must not be negative")
 		}
 
+		if p.Months < 0 {
+			return nil, fmt.Errorf("months must not be negative")
+		}
+
+		// the duration identifies the billing cycle, so it must have the same length in all currencies
+		if months, ok := pricingMonths[p.Duration]; ok && months != p.Months {
+			return nil, fmt.Errorf("inconsistent months of duration: %s", p.DisplayName)
+		}
+		pricingMonths[p.Duration] = p.Months
+
 		// pricing display names must be unique
-		if _, ok := pricingDisplayNames[p.DisplayName]; ok {
+		if _, ok := pricingDisplayNames[p.Currency+" "+p.DisplayName]; ok {
 			return nil, fmt.Errorf("duplicated pricing: %s", p.DisplayName)
 		}
 
 		// pricing duration must be unique
-		if _, ok := pricingDurations[p.Duration]; ok {
+		if _, ok := pricingDurations[pricingDuration{p.Currency, p.Duration}]; ok {
 			return nil, fmt.Errorf("duplicated duration: %s", p.DisplayName)
 		}
 
-		pricingDurations[p.Duration] = true
-		pricingDisplayNames[p.DisplayName] = true
+		pricingDurations[pricingDuration{p.Currency, p.Duration}] = true
+		pricingDisplayNames[p.Currency+" "+p.DisplayName] = true
+	}
+
+	if req.CommissionPercent.LessThan(decimal.Zero) || req.CommissionPercent.GreaterThan(decimal.NewFromInt(100)) {
+		return nil, fmt.Errorf("commission percent must be between 0 and 100")
+	}
+
+	if req.MeteredPricing == nil {
+		req.MeteredPricing = make(types.MeteredPrices, 0)
+	}
+	err := service.ValidateMeteredPrices(req.MeteredPricing)
+	if err != nil {
+		return nil, err
 	}
 
 	// validating product settings
@@ -199,6 +252,10 @@ func adminProductReqValidate(req *adminProductReqStruct) (map[string]string, err
 						return nil, fmt.Errorf("price and setup fee must not be negative")
 					}
 
+					if price.Currency != "" && !service.ValidCurrency(price.Currency) {
+						return nil, fmt.Errorf("invalid currency: %s", price.Currency)
+					}
+
 					found := false
 					for _, productPrice := range req.Pricing {
 						if productPrice.Duration == price.Duration {
@@ -253,9 +310,20 @@ func adminProductCreate(w http.ResponseWriter, r *http.Request) {
 		Settings:     cleanedProductSettings,
 		Stock:        req.Stock,
 		StockControl: req.StockControl,
+
+		InvoiceDaysBeforeExpiry:      optionalInt4(req.InvoiceDaysBeforeExpiry),
+		SuspendDaysAfterDue:          optionalInt4(req.SuspendDaysAfterDue),
+		TerminateDaysAfterSuspension: optionalInt4(req.TerminateDaysAfterSuspension),
+		BillingAnchorDay:             optionalInt4(req.BillingAnchorDay),
+		MeteredPricing:               req.MeteredPricing,
+		TrialDays:                    req.TrialDays,
+		TrialRequiresPaymentMethod:   req.TrialRequiresPaymentMethod,
+		TrialOncePerUser:             req.TrialOncePerUser == nil || *req.TrialOncePerUser,
+		CommissionPercent:            req.CommissionPercent,
+		CommissionRecurring:          req.CommissionRecurring,
 	})
 	if err != nil {
-		if err, ok := err.(*pgconn.PgError); ok && err.Code == PGErrorUniqueViolation {
+		if err, ok := err.(*pgconn.PgError); ok && err.Code == database.PGErrorUniqueViolation {
 			writeError(w, http.StatusForbidden, "duplicated product name")
 			return
 		}
@@ -276,7 +344,7 @@ func adminProductCreate(w http.ResponseWriter, r *http.Request) {
 			Values:      option.Values,
 		})
 		if err != nil {
-			if err, ok := err.(*pgconn.PgError); ok && err.Code == PGErrorUniqueViolation {
+			if err, ok := err.(*pgconn.PgError); ok && err.Code == database.PGErrorUniqueViolation {
 				writeError(w, http.StatusBadRequest, "duplicated option name: "+option.Name)
 				return
 			}
@@ -337,9 +405,20 @@ func adminProductUpdate(w http.ResponseWriter, r *http.Request) {
 		Settings:     cleanedProductSettings,
 		Stock:        req.Stock,
 		StockControl: req.StockControl,
+
+		InvoiceDaysBeforeExpiry:      optionalInt4(req.InvoiceDaysBeforeExpiry),
+		SuspendDaysAfterDue:          optionalInt4(req.SuspendDaysAfterDue),
+		TerminateDaysAfterSuspension: optionalInt4(req.TerminateDaysAfterSuspension),
+		BillingAnchorDay:             optionalInt4(req.BillingAnchorDay),
+		MeteredPricing:               req.MeteredPricing,
+		TrialDays:                    req.TrialDays,
+		TrialRequiresPaymentMethod:   req.TrialRequiresPaymentMethod,
+		TrialOncePerUser:             req.TrialOncePerUser == nil || *req.TrialOncePerUser,
+		CommissionPercent:            req.CommissionPercent,
+		CommissionRecurring:          req.CommissionRecurring,
 	})
 	if err != nil {
-		if err, ok := err.(*pgconn.PgError); ok && err.Code == PGErrorUniqueViolation {
+		if err, ok := err.(*pgconn.PgError); ok && err.Code == database.PGErrorUniqueViolation {
 			writeError(w, http.StatusForbidden, "Duplicated product name")
 			return
 		}
@@ -368,7 +447,7 @@ func adminProductUpdate(w http.ResponseWriter, r *http.Request) {
 			Values:      option.Values,
 		})
 		if err != nil {
-			if err, ok := err.(*pgconn.PgError); ok && err.Code == PGErrorUniqueViolation {
+			if err, ok := err.(*pgconn.PgError); ok && err.Code == database.PGErrorUniqueViolation {
 				writeError(w, http.StatusBadRequest, "duplicated option name: "+option.Name)
 				return
 			}
@@ -492,3 +571,11 @@ func adminProductExtensionList(w http.ResponseWriter, r *http.Request) {
 
 	writeResp(w, http.StatusOK, D{"extensions": list})
 }
+
+// optionalInt4 converts an optional request field to a nullable column value.
+func optionalInt4(i *int32) pgtype.Int4 {
+	if i == nil {
+		return pgtype.Int4{Valid: false}
+	}
+	return pgtype.Int4{Valid: true, Int32: *i}
+}
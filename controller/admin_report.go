@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"billing3/database"
+	"billing3/service"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+// reportDateRange parses the from and to query parameters, which are dates in the format 2006-01-02. to is
+// inclusive, and the returned end time is the start of the day after it. The range defaults to the last 12 months.
+func reportDateRange(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	to := today
+	if s := r.URL.Query().Get("to"); s != "" {
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid to date")
+			return time.Time{}, time.Time{}, false
+		}
+		to = t
+	}
+
+	from := to.AddDate(-1, 0, 1)
+	if s := r.URL.Query().Get("from"); s != "" {
+		t, err := time.Parse(time.DateOnly, s)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid from date")
+			return time.Time{}, time.Time{}, false
+		}
+		from = t
+	}
+
+	if from.After(to) {
+		writeError(w, http.StatusBadRequest, "from must not be after to")
+		return time.Time{}, time.Time{}, false
+	}
+
+	return from, to.AddDate(0, 0, 1), true
+}
+
+func adminReportRevenue(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := reportDateRange(w, r)
+	if !ok {
+		return
+	}
+
+	group := r.URL.Query().Get("group")
+	if group == "" {
+		group = service.ReportGroupDay
+	}
+	if group != service.ReportGroupDay && group != service.ReportGroupMonth {
+		writeError(w, http.StatusBadRequest, "invalid group")
+		return
+	}
+
+	revenue, err := service.RevenueByPeriod(r.Context(), group, from, to)
+	if err != nil {
+		slog.Error("admin report revenue", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"revenue": revenue})
+}
+
+func adminReportRevenueByProduct(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := reportDateRange(w, r)
+	if !ok {
+		return
+	}
+
+	revenue, err := database.Q.RevenueByProduct(r.Context(), database.RevenueByProductParams{
+		StartAt: service.Timestamp(from),
+		EndAt:   service.Timestamp(to),
+	})
+	if err != nil {
+		slog.Error("admin report revenue by product", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"revenue": revenue})
+}
+
+func adminReportRevenueByGateway(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := reportDateRange(w, r)
+	if !ok {
+		return
+	}
+
+	revenue, err := database.Q.RevenueByGateway(r.Context(), database.RevenueByGatewayParams{
+		StartAt: service.Timestamp(from),
+		EndAt:   service.Timestamp(to),
+	})
+	if err != nil {
+		slog.Error("admin report revenue by gateway", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"revenue": revenue})
+}
+
+func adminReportMRR(w http.ResponseWriter, r *http.Request) {
+	revenue, err := service.MonthlyRecurringRevenue(r.Context())
+	if err != nil {
+		slog.Error("admin report mrr", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"recurring_revenue": revenue})
+}
+
+func adminReportChurn(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := reportDateRange(w, r)
+	if !ok {
+		return
+	}
+
+	churn, err := service.Churn(r.Context(), from, to)
+	if err != nil {
+		slog.Error("admin report churn", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"churn": churn})
+}
+
+func adminReportReceivables(w http.ResponseWriter, r *http.Request) {
+	receivables, err := database.Q.OutstandingReceivables(r.Context())
+	if err != nil {
+		slog.Error("admin report receivables", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"receivables": receivables})
+}
+
+func adminReportStatement(w http.ResponseWriter, r *http.Request) {
+	userId, err := strconv.Atoi(chi.URLParam(r, "user_id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	from, to, ok := reportDateRange(w, r)
+	if !ok {
+		return
+	}
+
+	_, err = database.Q.FindUserById(r.Context(), int32(userId))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.Error("admin report statement", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	statement, err := service.AccountStatement(r.Context(), int32(userId), from, to)
+	if err != nil {
+		slog.Error("admin report statement", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"statement": statement})
+}
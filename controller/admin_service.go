@@ -101,10 +101,12 @@ func adminServiceUpdate(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type reqStruct struct {
-		Label        string          `json:"label" validate:"required"`
-		BillingCycle int             `json:"billing_cycle" validate:"min=1"`
-		Price        decimal.Decimal `json:"price"`
-		ExpiresAt    types.Timestamp `json:"expires_at" validate:"required"`
+		Label              string          `json:"label" validate:"required"`
+		BillingCycle       int             `json:"billing_cycle" validate:"min=1"`
+		BillingCycleMonths int             `json:"billing_cycle_months" validate:"min=0"`
+		BillingDay         int             `json:"billing_day" validate:"min=0,max=31"`
+		Price              decimal.Decimal `json:"price"`
+		ExpiresAt          types.Timestamp `json:"expires_at" validate:"required"`
 	}
 	req, err := decode[reqStruct](r)
 	if err != nil {
@@ -129,6 +131,9 @@ func adminServiceUpdate(w http.ResponseWriter, r *http.Request) {
 		Price:        req.Price,
 		ExpiresAt:    req.ExpiresAt,
 		ID:           int32(id),
+
+		BillingCycleMonths: int32(req.BillingCycleMonths),
+		BillingDay:         int32(req.BillingDay),
 	})
 	if err != nil {
 		slog.Error("admin update service", "err", err)
@@ -192,6 +197,13 @@ func adminServiceGenerateInvoice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	paid, err := service.AutoApplyCredit(r.Context(), qtx, invoiceId)
+	if err != nil {
+		slog.Error("apply credit to invoice", "err", err, "invoice_id", invoiceId)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
 	err = tx.Commit(r.Context())
 	if err != nil {
 		slog.Error("commit tx", "err", err)
@@ -199,6 +211,10 @@ func adminServiceGenerateInvoice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if paid {
+		service.OnInvoicePaid(invoiceId)
+	}
+
 	writeResp(w, http.StatusOK, D{"invoice": invoiceId})
 }
 
@@ -303,7 +319,7 @@ func adminServiceUpdateStatus(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type reqStruct struct {
-		Status             string      `json:"status" validate:"required,oneof=PENDING ACTIVE CANCELLED SUSPENDED UNPAID"`
+		Status             string      `json:"status" validate:"required,oneof=PENDING ACTIVE CANCELLED SUSPENDED UNPAID PENDING_REVIEW"`
 		Action             bool        `json:"action"`
 		CancellationReason pgtype.Text `json:"cancellation_reason"`
 	}
@@ -384,6 +400,108 @@ func adminServiceUpdateStatus(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// adminServiceApprove approves a service held for review by the fraud checks, and provisions it.
+func adminServiceApprove(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	tx, err := database.Conn.Begin(r.Context())
+	if err != nil {
+		slog.Error("begin tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer rollbackTx(r.Context(), tx)
+
+	s, err := service.ApproveService(r.Context(), database.Q.WithTx(tx), int32(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, service.ErrServiceNotPendingReview) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Error("admin approve service", "err", err, "service_id", id)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit(r.Context())
+	if err != nil {
+		slog.Error("commit tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = service.ProvisionService(r.Context(), s)
+	if err != nil {
+		slog.Error("provision service", "err", err, "service_id", s.ID, "extension", s.Extension)
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{})
+}
+
+// adminServiceReject rejects a service held for review by the fraud checks, and cancels it.
+func adminServiceReject(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	type reqStruct struct {
+		Reason string `json:"reason" validate:"max=1000"`
+	}
+
+	req, err := decode[reqStruct](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = "order rejected"
+	}
+
+	tx, err := database.Conn.Begin(r.Context())
+	if err != nil {
+		slog.Error("begin tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer rollbackTx(r.Context(), tx)
+
+	err = service.RejectService(r.Context(), database.Q.WithTx(tx), int32(id), req.Reason)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, service.ErrServiceNotPendingReview) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Error("admin reject service", "err", err, "service_id", id)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit(r.Context())
+	if err != nil {
+		slog.Error("commit tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{})
+}
+
 func adminServiceGetJobs(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
 	if err != nil {
@@ -434,3 +552,73 @@ func adminServiceGetJobs(w http.ResponseWriter, r *http.Request) {
 
 	writeResp(w, http.StatusOK, D{"jobs": jobsResp})
 }
+
+func adminServiceUsage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	s, err := database.Q.FindServiceById(r.Context(), int32(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.Error("admin service usage", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeServiceUsage(w, r, &s)
+}
+
+// adminServiceRecordUsage records usage of a metered resource, e.g. reported by an external monitoring system.
+func adminServiceRecordUsage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	type reqStruct struct {
+		Metric    string          `json:"metric" validate:"required,max=100"`
+		Quantity  decimal.Decimal `json:"quantity"`
+		Timestamp types.Timestamp `json:"timestamp"` // now if not present
+	}
+	req, err := decode[reqStruct](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Quantity.LessThan(decimal.Zero) {
+		writeError(w, http.StatusBadRequest, "quantity must not be negative")
+		return
+	}
+
+	_, err = database.Q.FindServiceById(r.Context(), int32(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.Error("admin record usage", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	timestamp := time.Now()
+	if req.Timestamp.Valid {
+		timestamp = req.Timestamp.Time
+	}
+
+	err = extension.RecordUsage(r.Context(), int32(id), req.Metric, req.Quantity, timestamp)
+	if err != nil {
+		slog.Error("admin record usage", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{})
+}
@@ -23,6 +23,17 @@ func adminSettingsUpdate(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// only changed settings are validated, as some settings cannot be changed once in use
+	for _, s := range service.Settings {
+		if v, ok := (*req)[s.Key()]; ok && v != s.Get(r.Context()) {
+			err := s.Validate(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+	}
+
 	for _, s := range service.Settings {
 		if v, ok := (*req)[s.Key()]; ok {
 			s.Set(r.Context(), v)
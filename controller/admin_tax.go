@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"billing3/database"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+type taxRuleReq struct {
+	Name          string          `json:"name" validate:"required,max=200"`
+	Country       string          `json:"country" validate:"required,max=200"`
+	State         string          `json:"state" validate:"max=200"` // empty for the whole country
+	Rate          decimal.Decimal `json:"rate"`                     // percentage
+	Inclusive     bool            `json:"inclusive"`
+	ReverseCharge bool            `json:"reverse_charge"`
+}
+
+// validateTaxRule validates the request and returns an error message, or empty string if valid
+func validateTaxRule(req *taxRuleReq) string {
+	if req.Rate.LessThan(decimal.Zero) || req.Rate.GreaterThan(decimal.NewFromInt(100)) {
+		return "tax rate must be between 0 and 100"
+	}
+	if req.Rate.Exponent() < -3 {
+		return "tax rate must have at most 3 decimal places"
+	}
+	return ""
+}
+
+func adminTaxList(w http.ResponseWriter, r *http.Request) {
+	rules, err := database.Q.ListTaxRules(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("admin list tax rules", "err", err)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{
+		"rules": rules,
+	})
+}
+
+func adminTaxCreate(w http.ResponseWriter, r *http.Request) {
+	req, err := decode[taxRuleReq](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if msg := validateTaxRule(req); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	id, err := database.Q.CreateTaxRule(r.Context(), database.CreateTaxRuleParams{
+		Name:          req.Name,
+		Country:       req.Country,
+		State:         req.State,
+		Rate:          req.Rate,
+		Inclusive:     req.Inclusive,
+		ReverseCharge: req.ReverseCharge,
+	})
+	if err != nil {
+		slog.Error("admin create tax rule", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{
+		"id": id,
+	})
+}
+
+func adminTaxUpdate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	req, err := decode[taxRuleReq](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if msg := validateTaxRule(req); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	// existing invoices keep their tax snapshot
+	err = database.Q.UpdateTaxRule(r.Context(), database.UpdateTaxRuleParams{
+		Name:          req.Name,
+		Country:       req.Country,
+		State:         req.State,
+		Rate:          req.Rate,
+		Inclusive:     req.Inclusive,
+		ReverseCharge: req.ReverseCharge,
+		ID:            int32(id),
+	})
+	if err != nil {
+		slog.Error("admin update tax rule", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{})
+}
+
+func adminTaxGet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	rule, err := database.Q.FindTaxRuleById(r.Context(), int32(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("admin tax rule get", "err", err)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"rule": rule})
+}
+
+func adminTaxDelete(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = database.Q.DeleteTaxRule(r.Context(), int32(id))
+	if err != nil {
+		slog.Error("admin delete tax rule", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{})
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"billing3/database"
+	"billing3/service"
 	"billing3/utils"
 	"errors"
 	"log/slog"
@@ -13,6 +14,7 @@ import (
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
 )
 
 func adminUserList(w http.ResponseWriter, r *http.Request) {
@@ -63,15 +65,19 @@ func adminUserEdit(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type reqStruct struct {
-		Email    string `json:"email" validate:"required"`
-		Name     string `json:"name" validate:"required"`
-		Password string `json:"password" validate:"printascii,max=72"`
-		Role     string `json:"role" validate:"required"`
-		Address  string `json:"address"`
-		City     string `json:"city"`
-		State    string `json:"state"`
-		Country  string `json:"country"`
-		ZipCode  string `json:"zip_code"`
+		Email         string `json:"email" validate:"required"`
+		Name          string `json:"name" validate:"required"`
+		Password      string `json:"password" validate:"printascii,max=72"`
+		Role          string `json:"role" validate:"required"`
+		Address       string `json:"address"`
+		City          string `json:"city"`
+		State         string `json:"state"`
+		Country       string `json:"country"`
+		ZipCode       string `json:"zip_code"`
+		LateFeeExempt *bool  `json:"late_fee_exempt"` // unchanged if not present
+
+		// day of month on which services with calendar billing cycles renew, unchanged if not present, 0 to remove
+		BillingAnchorDay *int32 `json:"billing_anchor_day" validate:"omitempty,min=0,max=31"`
 	}
 	req, err := decode[reqStruct](r)
 	if err != nil {
@@ -109,6 +115,30 @@ func adminUserEdit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.LateFeeExempt != nil {
+		err = database.Q.UpdateUserLateFeeExempt(r.Context(), database.UpdateUserLateFeeExemptParams{
+			ID:            int32(id),
+			LateFeeExempt: *req.LateFeeExempt,
+		})
+		if err != nil {
+			slog.Error("admin user edit", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.BillingAnchorDay != nil {
+		err = database.Q.UpdateUserBillingAnchorDay(r.Context(), database.UpdateUserBillingAnchorDayParams{
+			ID:               int32(id),
+			BillingAnchorDay: pgtype.Int4{Valid: *req.BillingAnchorDay > 0, Int32: *req.BillingAnchorDay},
+		})
+		if err != nil {
+			slog.Error("admin user edit", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
 	writeResp(w, http.StatusOK, D{})
 }
 
@@ -165,7 +195,7 @@ func adminUserCreate(w http.ResponseWriter, r *http.Request) {
 		ZipCode:  pgtype.Text{Valid: req.ZipCode != "", String: req.ZipCode},
 	})
 	if err != nil {
-		if err, ok := err.(*pgconn.PgError); ok && err.Code == PGErrorUniqueViolation {
+		if err, ok := err.(*pgconn.PgError); ok && err.Code == database.PGErrorUniqueViolation {
 			writeError(w, http.StatusForbidden, "Duplicated email")
 			return
 		}
@@ -178,3 +208,92 @@ func adminUserCreate(w http.ResponseWriter, r *http.Request) {
 		"id": id,
 	})
 }
+
+func adminUserCreditGet(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	user, err := database.Q.FindUserById(r.Context(), int32(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.Error("admin user credit get", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	totalPages, transactions, err := service.ListCreditTransactions(r.Context(), user.ID, page, itemPerPage)
+	if err != nil {
+		slog.Error("admin user credit get", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"balance": user.Credit, "transactions": transactions, "total_pages": totalPages})
+}
+
+func adminUserCreditAdd(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	type reqStruct struct {
+		Type        string          `json:"type" validate:"required,oneof=DEPOSIT ADJUSTMENT"`
+		Amount      decimal.Decimal `json:"amount" validate:"required"`
+		Description string          `json:"description" validate:"required"`
+	}
+	req, err := decode[reqStruct](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Amount.IsZero() {
+		writeError(w, http.StatusBadRequest, "amount must not be zero")
+		return
+	}
+	if req.Type == service.CreditDeposit && req.Amount.LessThan(decimal.Zero) {
+		writeError(w, http.StatusBadRequest, "deposit must be positive")
+		return
+	}
+
+	tx, err := database.Conn.Begin(r.Context())
+	if err != nil {
+		slog.Error("begin tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer rollbackTx(r.Context(), tx)
+
+	transactionId, err := service.AddCredit(r.Context(), database.Q.WithTx(tx), int32(id), req.Amount, req.Type, req.Description, pgtype.Int4{Valid: false})
+	if err != nil {
+		if errors.Is(err, service.ErrInsufficientCredit) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Error("admin user credit add", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit(r.Context())
+	if err != nil {
+		slog.Error("commit tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"id": transactionId})
+}
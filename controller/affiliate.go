@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"billing3/controller/middlewares"
+	"billing3/database"
+	"billing3/service"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+func getAffiliate(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.MustGetUser(r)
+
+	stats, err := service.GetAffiliateStats(r.Context(), user)
+	if err != nil {
+		slog.Error("get affiliate", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"affiliate": stats})
+}
+
+func listAffiliateCommissions(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.MustGetUser(r)
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	totalPages, commissions, err := service.ListCommissions(r.Context(), user.ID, page, itemPerPage)
+	if err != nil {
+		slog.Error("list affiliate commissions", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"commissions": commissions, "total_pages": totalPages})
+}
+
+func affiliatePayout(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.MustGetUser(r)
+
+	tx, err := database.Conn.Begin(r.Context())
+	if err != nil {
+		slog.Error("begin tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer rollbackTx(r.Context(), tx)
+
+	amount, err := service.PayoutCommissions(r.Context(), database.Q.WithTx(tx), user.ID)
+	if err != nil {
+		if errors.Is(err, service.ErrNoCommissionPayable) || errors.Is(err, service.ErrCommissionBelowMinimum) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Error("affiliate payout", "err", err, "user_id", user.ID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	err = tx.Commit(r.Context())
+	if err != nil {
+		slog.Error("commit tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"amount": amount})
+}
@@ -0,0 +1,339 @@
+package controller
+
+import (
+	"billing3/controller/middlewares"
+	"billing3/database"
+	"billing3/service"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/shopspring/decimal"
+)
+
+// guests identify their cart with the token returned when the cart is created
+const cartTokenHeader = "X-Cart-Token"
+
+// findCart returns the cart of the request. If there is no cart, a new one is created if create is true, otherwise
+// nil is returned. If findCart fails, an error response is written and ok is false.
+func findCart(w http.ResponseWriter, r *http.Request, create bool) (*database.Cart, bool) {
+	cart, err := service.FindCart(r.Context(), middlewares.GetUser(r), r.Header.Get(cartTokenHeader), create)
+	if err != nil {
+		slog.Error("find cart", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return nil, false
+	}
+	return cart, true
+}
+
+// cartToken returns the token of a guest cart. Carts of users are found by the user, so their token is not exposed.
+func cartToken(cart *database.Cart) string {
+	if cart == nil || cart.UserID.Valid {
+		return ""
+	}
+	return cart.Token
+}
+
+func getCart(w http.ResponseWriter, r *http.Request) {
+	cart, ok := findCart(w, r, false)
+	if !ok {
+		return
+	}
+	if cart == nil {
+		writeResp(w, http.StatusOK, D{"items": []database.CartItem{}, "token": ""})
+		return
+	}
+
+	items, err := service.ListCartItems(r.Context(), cart.ID)
+	if err != nil {
+		slog.Error("list cart items", "err", err, "cart", cart.ID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"items": items, "token": cartToken(cart)})
+}
+
+func calculateCartPrice(w http.ResponseWriter, r *http.Request) {
+	type reqStruct struct {
+		Currency string `json:"currency"` // empty for the default currency
+	}
+
+	req, err := decode[reqStruct](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cart, ok := findCart(w, r, false)
+	if !ok {
+		return
+	}
+	if cart == nil {
+		writeError(w, http.StatusBadRequest, service.ErrCartEmpty.Error())
+		return
+	}
+
+	items, err := database.Q.ListCartItems(r.Context(), cart.ID)
+	if err != nil {
+		slog.Error("list cart items", "err", err, "cart", cart.ID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// tax can only be shown to logged in users
+	pricing, err := service.CalculateCartPricing(r.Context(), items, req.Currency, middlewares.GetUser(r))
+	if err != nil {
+		if errors.Is(err, service.ErrInternalError) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"pricing": pricing})
+}
+
+func addCartItem(w http.ResponseWriter, r *http.Request) {
+	req, err := decode[service.CartItemRequest](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cart, ok := findCart(w, r, true)
+	if !ok {
+		return
+	}
+
+	id, err := service.AddCartItem(r.Context(), cart, middlewares.GetUser(r), *req)
+	if err != nil {
+		if errors.Is(err, service.ErrInternalError) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"id": id, "token": cartToken(cart)})
+}
+
+func updateCartItem(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	req, err := decode[service.CartItemRequest](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cart, ok := findCart(w, r, false)
+	if !ok {
+		return
+	}
+	if cart == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = service.UpdateCartItem(r.Context(), cart, middlewares.GetUser(r), int32(id), *req)
+	if err != nil {
+		if errors.Is(err, service.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, service.ErrInternalError) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{})
+}
+
+func removeCartItem(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	cart, ok := findCart(w, r, false)
+	if !ok {
+		return
+	}
+	if cart == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	err = service.RemoveCartItem(r.Context(), cart, int32(id))
+	if err != nil {
+		if errors.Is(err, service.ErrNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.Error("remove cart item", "err", err, "cart", cart.ID, "item", id)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{})
+}
+
+func clearCart(w http.ResponseWriter, r *http.Request) {
+	cart, ok := findCart(w, r, false)
+	if !ok {
+		return
+	}
+
+	if cart != nil {
+		err := database.Q.DeleteCartItems(r.Context(), cart.ID)
+		if err != nil {
+			slog.Error("clear cart", "err", err, "cart", cart.ID)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	writeResp(w, http.StatusOK, D{})
+}
+
+// checkoutCart orders all items in the cart in one transaction. A service is created for each item, and all of them
+// are billed on a single invoice. The cart is emptied if the checkout succeeds.
+func checkoutCart(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.MustGetUser(r)
+
+	type reqStruct struct {
+		Currency string `json:"currency"`
+	}
+
+	req, err := decode[reqStruct](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// charge in the user's currency if not specified
+	if req.Currency == "" {
+		req.Currency = user.Currency
+	}
+
+	cart, ok := findCart(w, r, false)
+	if !ok {
+		return
+	}
+	if cart == nil {
+		writeError(w, http.StatusBadRequest, service.ErrCartEmpty.Error())
+		return
+	}
+
+	// start transaction
+	tx, err := database.Conn.Begin(r.Context())
+	if err != nil {
+		slog.Error("begin tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer rollbackTx(r.Context(), tx)
+
+	qtx := database.Q.WithTx(tx)
+
+	// the cart is locked so that it is not checked out twice
+	_, err = qtx.FindCartByIdForUpdate(r.Context(), cart.ID)
+	if err != nil {
+		slog.Error("lock cart", "err", err, "cart", cart.ID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	items, err := qtx.ListCartItems(r.Context(), cart.ID)
+	if err != nil {
+		slog.Error("list cart items", "err", err, "cart", cart.ID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	// calculate price
+	pricing, err := service.CalculateCartPricing(r.Context(), items, req.Currency, user)
+	if err != nil {
+		if errors.Is(err, service.ErrInternalError) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// create services
+	serviceIds := make([]int32, 0, len(pricing.Items))
+	setupFees := make([]decimal.Decimal, 0, len(pricing.Items))
+	for _, item := range pricing.Items {
+		if !decreaseProductStock(w, r, qtx, item.Product) {
+			return
+		}
+
+		serviceId, err := qtx.CreateService(r.Context(), orderServiceParams(r, user, item.Product, item.Options, item.Pricing))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			slog.Error("create service", "err", err, "product", item.ProductID)
+			return
+		}
+
+		serviceIds = append(serviceIds, serviceId)
+		setupFees = append(setupFees, item.Pricing.SetupFee)
+	}
+
+	// create the combined invoice
+	invoiceId, err := service.CreateOrderInvoice(r.Context(), qtx, serviceIds, setupFees)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("create order invoice", "err", err, "services", serviceIds)
+		return
+	}
+
+	for i, item := range pricing.Items {
+		if !addOrderAdjustments(w, r, qtx, user, item.Product, item.Pricing, invoiceId, serviceIds[i]) {
+			return
+		}
+	}
+
+	paid, ok := applyOrderCredit(w, r, qtx, invoiceId)
+	if !ok {
+		return
+	}
+
+	err = qtx.DeleteCartItems(r.Context(), cart.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("clear cart", "err", err, "cart", cart.ID)
+		return
+	}
+
+	err = tx.Commit(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("commit tx", "err", err)
+		return
+	}
+
+	if paid {
+		service.OnInvoicePaid(invoiceId)
+	}
+
+	for i, item := range pricing.Items {
+		slog.Info("new order", "product", item.ProductID, "label", item.Product.Name, "duration", item.Pricing.Duration, "billing cycle", item.Pricing.BillingCycle, "billing day", item.Pricing.BillingDay, "proration", item.Pricing.Proration, "options", item.Redacted, "recurring fee", item.Pricing.RecurringFee, "setup fee", item.Pricing.SetupFee, "currency", item.Pricing.Currency, "coupon", item.Pricing.Coupon, "discount", item.Pricing.Discount, "user", user.ID, "service id", serviceIds[i], "invoice id", invoiceId, "cart", cart.ID)
+	}
+
+	writeResp(w, http.StatusOK, D{"invoice": invoiceId, "services": serviceIds})
+}
@@ -1,11 +1,13 @@
 package controller
 
 import (
+	"billing3/service"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"reflect"
 	"strings"
@@ -15,8 +17,6 @@ import (
 	"github.com/go-playground/validator/v10"
 )
 
-const PGErrorUniqueViolation = "23505"
-
 const itemPerPage = 20
 
 var publicDomain string
@@ -41,6 +41,14 @@ func writeResp(w http.ResponseWriter, code int, msg D) {
 	json.NewEncoder(w).Encode(msg)
 }
 
+// writePDF sends a PDF file as a download.
+func writePDF(w http.ResponseWriter, filename string, data []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
 // decode decodes and validates request body to type T. Request body must be in JSON.
 // Validation is skipped if T is a map.
 func decode[T any](r *http.Request) (*T, error) {
@@ -99,3 +107,27 @@ func rollbackTx(ctx context.Context, tx pgx.Tx) {
 		slog.Error("rollback tx", "err", err)
 	}
 }
+
+// clientIP returns the IP address of the client. The CF-Connecting-IP header set by Cloudflare is only trusted if
+// the site is behind Cloudflare.
+func clientIP(r *http.Request) string {
+	if service.SettingBehindCloudflare.Get(r.Context()) == "true" {
+		if ip := r.Header.Get("CF-Connecting-IP"); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// clientCountry returns the country of the IP address of the client provided by Cloudflare, or an empty string if the
+// site is not behind Cloudflare.
+func clientCountry(r *http.Request) string {
+	if service.SettingBehindCloudflare.Get(r.Context()) != "true" {
+		return ""
+	}
+	return r.Header.Get("CF-IPCountry")
+}
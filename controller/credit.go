@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"billing3/controller/middlewares"
+	"billing3/service"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+func getCredit(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.MustGetUser(r)
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	totalPages, transactions, err := service.ListCreditTransactions(r.Context(), user.ID, page, itemPerPage)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("get credit", "err", err)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"balance": user.Credit, "transactions": transactions, "total_pages": totalPages})
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"billing3/controller/middlewares"
+	"billing3/database"
+	"billing3/service"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+)
+
+func listCreditNotes(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.MustGetUser(r)
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	totalPages, creditNotes, err := service.SearchCreditNotes(r.Context(), user.ID, page, itemPerPage)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("list credit notes", "err", err)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"total_pages": totalPages, "credit_notes": creditNotes})
+}
+
+func getCreditNote(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	user := middlewares.MustGetUser(r)
+
+	creditNote, err := database.Q.FindCreditNoteById(r.Context(), int32(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("get credit note", "err", err)
+		return
+	}
+
+	if creditNote.UserID != user.ID {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	items, err := database.Q.ListCreditNoteItems(r.Context(), creditNote.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("get credit note", "err", err)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"credit_note": creditNote, "items": items})
+}
@@ -7,14 +7,14 @@ import (
 	"billing3/service"
 	"billing3/service/gateways"
 	"errors"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5"
 	"github.com/shopspring/decimal"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
-	"strings"
-	"time"
 )
 
 func getInvoice(w http.ResponseWriter, r *http.Request) {
@@ -52,6 +52,49 @@ func getInvoice(w http.ResponseWriter, r *http.Request) {
 	writeResp(w, http.StatusOK, D{"invoice": invoice, "items": items})
 }
 
+func getInvoicePDF(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	user := middlewares.MustGetUser(r)
+
+	invoice, err := database.Q.FindInvoiceById(r.Context(), int32(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("get invoice pdf", "err", err)
+		return
+	}
+
+	if invoice.UserID != user.ID {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	data, err := service.RenderInvoicePDF(r.Context(), invoice.ID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("get invoice pdf", "err", err, "invoice", invoice.ID)
+		return
+	}
+
+	writePDF(w, invoicePDFFilename(&invoice), data)
+}
+
+// invoicePDFFilename returns the file name of the invoice PDF, which contains the invoice number if assigned.
+func invoicePDFFilename(invoice *database.Invoice) string {
+	if invoice.Number != "" {
+		return "invoice-" + invoice.Number + ".pdf"
+	}
+	return fmt.Sprintf("invoice-%d.pdf", invoice.ID)
+}
+
 func listInvoices(w http.ResponseWriter, r *http.Request) {
 	user := middlewares.MustGetUser(r)
 
@@ -78,6 +121,15 @@ func getAvailablePaymentGateways(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// hide gateways that cannot charge the currency of the invoice
+	currency := r.URL.Query().Get("currency")
+	if currency != "" {
+		dbGateways = slices.DeleteFunc(dbGateways, func(g database.ListEnabledGatewaysRow) bool {
+			gateway, ok := gateways.Gateways[g.Name]
+			return !ok || !gateways.SupportsCurrency(gateway, currency)
+		})
+	}
+
 	writeResp(w, http.StatusOK, D{"gateways": dbGateways})
 }
 
@@ -139,38 +191,52 @@ func makePayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// invoice must be unpaid and not overdue
-	if invoice.Status != service.InvoiceUnpaid || invoice.DueAt.Time.Before(time.Now()) {
+	// invoice must be unpaid. Overdue invoices remain payable until they are cancelled, so that suspended services can
+	// be unsuspended by paying their renewal invoice.
+	if invoice.Status != service.InvoiceUnpaid {
 		writeError(w, http.StatusBadRequest, "invoice is not payable")
 		return
 	}
 
-	// calculate total amount
-	total := invoice.Amount
-	percentage := strings.HasSuffix(dbGateway.Fee.String, "%")
-	fee, err := decimal.NewFromString(strings.TrimSuffix(dbGateway.Fee.String, "%"))
+	if !gateways.SupportsCurrency(gateway, invoice.Currency) {
+		writeError(w, http.StatusBadRequest, "gateway does not support the currency of the invoice")
+		return
+	}
+
+	// only the outstanding amount is paid, as part of the invoice may have been paid with credit
+	paid, err := database.Q.TotalInvoicePayment(r.Context(), invoice.ID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		slog.Error("invalid gateway fee", "err", err, "fee", fee, "gateway", gatewayName)
+		slog.Error("make payment", "err", err)
+		return
+	}
+	outstanding := invoice.Amount.Sub(paid)
+	if outstanding.LessThanOrEqual(decimal.Zero) {
+		writeError(w, http.StatusBadRequest, "invoice is not payable")
 		return
 	}
 
-	if !percentage {
-		total = total.Add(fee)
-	} else {
-		total = total.Add(total.Mul(fee.Div(decimal.NewFromInt(100))))
+	// calculate total amount
+	total, err := service.GatewayTotal(r.Context(), outstanding, dbGateway.Fee.String, invoice.Currency)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("gateway total", "err", err, "fee", dbGateway.Fee.String, "gateway", gatewayName, "currency", invoice.Currency)
+		return
 	}
-	total = total.RoundUp(2)
 
 	// start payment
-	paymentUrl, err := gateway.Pay(&invoice, user, total)
+	paymentUrl, err := gateway.Pay(r.Context(), &invoice, user, total, invoice.Currency)
 	if err != nil {
+		if errors.Is(err, service.ErrInsufficientCredit) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		w.WriteHeader(http.StatusInternalServerError)
 		slog.Error("make payment", "err", err, "gateway", gatewayName, "invoice_id", invoice.ID, "total", total.String(), "user_id", user.ID)
 		return
 	}
 
-	slog.Info("payment start", "invoice_id", invoice.ID, "total", total.String(), "user_id", user.ID, "payment_url", paymentUrl, "gateway", gatewayName, "gateway_fee", dbGateway.Fee.String)
+	slog.Info("payment start", "invoice_id", invoice.ID, "total", total.String(), "currency", invoice.Currency, "user_id", user.ID, "payment_url", paymentUrl, "gateway", gatewayName, "gateway_fee", dbGateway.Fee.String)
 
 	writeResp(w, http.StatusOK, D{"payment_url": paymentUrl})
 }
@@ -3,10 +3,13 @@ package controller
 import (
 	"billing3/controller/middlewares"
 	"billing3/database"
+	"billing3/service"
+	"errors"
 	"fmt"
 	"github.com/jackc/pgx/v5/pgtype"
 	"log/slog"
 	"net/http"
+	"slices"
 )
 
 // returns the authenticated user
@@ -18,16 +21,27 @@ func me(w http.ResponseWriter, r *http.Request) {
 		address = "unknown"
 	}
 
+	// display currency
+	currency := user.Currency
+	if currency == "" {
+		currency = service.DefaultCurrency(r.Context())
+	}
+
 	writeResp(w, http.StatusOK, D{
-		"email":        user.Email,
-		"name":         user.Name,
-		"role":         user.Role,
-		"full_address": address,
-		"address":      user.Address,
-		"city":         user.City,
-		"state":        user.State,
-		"country":      user.Country,
-		"zip_code":     user.ZipCode,
+		"email":           user.Email,
+		"name":            user.Name,
+		"role":            user.Role,
+		"full_address":    address,
+		"address":         user.Address,
+		"city":            user.City,
+		"state":           user.State,
+		"country":         user.Country,
+		"zip_code":        user.ZipCode,
+		"credit":          user.Credit,
+		"currency":        currency,
+		"vat_id":          user.VatID,
+		"vat_id_valid":    user.VatIDValid,
+		"email_reminders": user.EmailReminders,
 	})
 }
 
@@ -48,12 +62,15 @@ func updateProfile(w http.ResponseWriter, r *http.Request) {
 	user := middlewares.MustGetUser(r)
 
 	type reqStruct struct {
-		Name    string `json:"name" valid:"required"`
-		Address string `json:"address"`
-		City    string `json:"city"`
-		State   string `json:"state"`
-		Country string `json:"country"`
-		ZipCode string `json:"zip_code"`
+		Name           string  `json:"name" valid:"required"`
+		Address        string  `json:"address"`
+		City           string  `json:"city"`
+		State          string  `json:"state"`
+		Country        string  `json:"country"`
+		ZipCode        string  `json:"zip_code"`
+		Currency       string  `json:"currency"`        // display currency, unchanged if empty
+		VatID          *string `json:"vat_id"`          // unchanged if not present, removed if empty
+		EmailReminders *bool   `json:"email_reminders"` // opt-out of non-critical invoice reminders, unchanged if not present
 	}
 	req, err := decode[reqStruct](r)
 	if err != nil {
@@ -61,6 +78,39 @@ func updateProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Currency != "" {
+		currencies, err := service.Currencies(r.Context())
+		if err != nil {
+			slog.Error("update user profile", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !slices.Contains(currencies, req.Currency) {
+			writeError(w, http.StatusBadRequest, "unsupported currency")
+			return
+		}
+	}
+
+	// the VAT ID is validated when it changes, reverse charge applies to businesses with a valid VAT ID
+	vatIdChanged := false
+	vatId := ""
+	if req.VatID != nil {
+		vatId = service.NormalizeVatID(*req.VatID)
+		vatIdChanged = vatId != user.VatID
+	}
+	if vatIdChanged && vatId != "" {
+		err = service.ValidateVatID(r.Context(), vatId)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidVatID) || errors.Is(err, service.ErrVatIDValidationUnavailable) {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			slog.Error("validate vat id", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
 	err = database.Q.UpdateUserProfile(r.Context(), database.UpdateUserProfileParams{
 		Name:    req.Name,
 		Address: pgtype.Text{String: req.Address, Valid: req.Address != ""},
@@ -76,5 +126,42 @@ func updateProfile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if req.Currency != "" {
+		err = database.Q.UpdateUserCurrency(r.Context(), database.UpdateUserCurrencyParams{
+			ID:       user.ID,
+			Currency: req.Currency,
+		})
+		if err != nil {
+			slog.Error("update user currency", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if vatIdChanged {
+		err = database.Q.UpdateUserVatID(r.Context(), database.UpdateUserVatIDParams{
+			ID:         user.ID,
+			VatID:      vatId,
+			VatIDValid: vatId != "",
+		})
+		if err != nil {
+			slog.Error("update user vat id", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if req.EmailReminders != nil {
+		err = database.Q.UpdateUserEmailReminders(r.Context(), database.UpdateUserEmailRemindersParams{
+			ID:             user.ID,
+			EmailReminders: *req.EmailReminders,
+		})
+		if err != nil {
+			slog.Error("update user email reminders", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
 	writeResp(w, http.StatusOK, D{})
 }
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
 )
 
 func calculatePrice(w http.ResponseWriter, r *http.Request) {
@@ -20,7 +21,8 @@ func calculatePrice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, _, _, pricing, err := service.CalculatePricing(r.Context(), *req)
+	// tax can only be shown to logged in users
+	_, _, _, pricing, err := service.CalculatePricing(r.Context(), *req, middlewares.GetUser(r))
 	if err != nil {
 		if errors.Is(err, service.ErrInternalError) {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -42,8 +44,13 @@ func order(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// charge in the user's currency if not specified
+	if req.Currency == "" {
+		req.Currency = user.Currency
+	}
+
 	// calculate price
-	product, options, redactedOptions, pricing, err := service.CalculatePricing(r.Context(), *req)
+	product, options, redactedOptions, pricing, err := service.CalculatePricing(r.Context(), *req, user)
 	if err != nil {
 		if errors.Is(err, service.ErrInternalError) {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -53,32 +60,125 @@ func order(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// start transaction
+	tx, err := database.Conn.Begin(r.Context())
+	if err != nil {
+		slog.Error("begin tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer rollbackTx(r.Context(), tx)
+
+	qtx := database.Q.WithTx(tx)
+
 	// stock
+	if !decreaseProductStock(w, r, qtx, product) {
+		return
+	}
+
+	if pricing.Trial {
+		err = service.CheckTrialEligibility(r.Context(), qtx, user, product)
+		if err != nil {
+			if errors.Is(err, service.ErrTrialNotAvailable) || errors.Is(err, service.ErrTrialUsed) || errors.Is(err, service.ErrTrialPaymentMethodRequired) {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			slog.Error("check trial eligibility", "err", err, "product", product.ID)
+			return
+		}
+	}
+
+	// create service
+	serviceId, err := qtx.CreateService(r.Context(), orderServiceParams(r, user, product, options, pricing))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("create service", "err", err, "product", req.ProductID)
+		return
+	}
+
+	var invoiceId int32
+	held, paid := false, false
+	if pricing.Trial {
+		err = service.RecordTrial(r.Context(), qtx, user, product, serviceId)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			slog.Error("record trial", "err", err, "product", product.ID)
+			return
+		}
 
-	if product.StockControl == service.StockControlEnabled {
-		rows, err := database.Q.AttemptDecreaseProductStock(r.Context(), int32(product.ID))
+		// trials are screened when ordered, other orders when the first invoice is paid
+		s, err := qtx.FindServiceById(r.Context(), serviceId)
+		if err == nil {
+			held, err = service.ScreenOrder(r.Context(), qtx, &s)
+		}
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			slog.Error("decrease product stock", "err", err, "product", product.ID)
+			slog.Error("screen order", "err", err, "service_id", serviceId)
 			return
 		}
-		if rows == 0 {
-			writeError(w, http.StatusBadRequest, "product is out of stock")
+	} else {
+		var ok bool
+		invoiceId, ok = createOrderInvoice(w, r, qtx, user, product, pricing, serviceId)
+		if !ok {
+			return
+		}
+
+		paid, ok = applyOrderCredit(w, r, qtx, invoiceId)
+		if !ok {
 			return
 		}
 	}
 
-	// start transaction
-	tx, err := database.Conn.Begin(r.Context())
+	err = tx.Commit(r.Context())
 	if err != nil {
-		slog.Error("begin tx", "err", err)
 		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("commit tx", "err", err)
 		return
 	}
-	defer rollbackTx(r.Context(), tx)
 
-	qtx := database.Q.WithTx(tx)
+	if paid {
+		service.OnInvoicePaid(invoiceId)
+	}
+
+	if pricing.Trial && !held {
+		s, err := database.Q.FindServiceById(r.Context(), serviceId)
+		if err == nil {
+			err = service.ProvisionService(r.Context(), &s)
+		}
+		if err != nil {
+			slog.Error("provision trial service", "err", err, "service_id", serviceId)
+		}
+	}
+
+	slog.Info("new order", "product", product.ID, "label", product.Name, "duration", pricing.Duration, "billing cycle", pricing.BillingCycle, "billing day", pricing.BillingDay, "proration", pricing.Proration, "trial", pricing.Trial, "held for review", held, "options", redactedOptions, "product settings", product.Settings, "recurring fee", pricing.RecurringFee, "setup fee", pricing.SetupFee, "currency", pricing.Currency, "coupon", pricing.Coupon, "discount", pricing.Discount, "user", user.ID, "service id", serviceId, "invoice id", invoiceId)
+
+	writeResp(w, http.StatusOK, D{"invoice": invoiceId, "service": serviceId})
+}
+
+// decreaseProductStock takes one unit of the product from stock, if the product has stock control. If the product is
+// out of stock or decreaseProductStock fails, an error response is written and false is returned. The stock is
+// restored if the transaction of qtx is rolled back.
+func decreaseProductStock(w http.ResponseWriter, r *http.Request, qtx *database.Queries, product *database.Product) bool {
+	if product.StockControl != service.StockControlEnabled {
+		return true
+	}
 
+	rows, err := qtx.AttemptDecreaseProductStock(r.Context(), int32(product.ID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		slog.Error("decrease product stock", "err", err, "product", product.ID)
+		return false
+	}
+	if rows == 0 {
+		writeError(w, http.StatusBadRequest, product.Name+" is out of stock")
+		return false
+	}
+	return true
+}
+
+// orderServiceParams returns the service to create for an order of the product.
+func orderServiceParams(r *http.Request, user *database.User, product *database.Product, options map[string]string, pricing *service.Pricing) database.CreateServiceParams {
 	// service settings
 	serviceSettings := make(map[string]string)
 
@@ -91,40 +191,113 @@ func order(w http.ResponseWriter, r *http.Request) {
 		serviceSettings[k] = v
 	}
 
-	// create service
-	serviceId, err := qtx.CreateService(r.Context(), database.CreateServiceParams{
+	// the first billing period of prorated services starts before the order, so that paying the first invoice
+	// extends the service until the end of the prorated period
+	cycle := service.BillingCycle{Seconds: int32(pricing.Duration), Months: pricing.Months, Day: pricing.BillingDay}
+	expiresAt := time.Now().UTC()
+	if pricing.FirstPeriodEnd != nil {
+		expiresAt = cycle.Previous(*pricing.FirstPeriodEnd)
+	}
+
+	// trials are provisioned without an invoice, and expire when the trial ends. The first invoice is created
+	// before the trial ends, like renewal invoices.
+	status := service.ServiceUnpaid
+	if pricing.Trial {
+		status = service.ServicePending
+		expiresAt = *pricing.TrialEndsAt
+	}
+
+	return database.CreateServiceParams{
 		Label:        product.Name,
 		UserID:       user.ID,
-		Status:       service.ServiceUnpaid,
+		Status:       status,
 		BillingCycle: int32(pricing.Duration),
 		Price:        pricing.RecurringFee,
 		Extension:    product.Extension,
 		Settings:     serviceSettings,
-		ExpiresAt:    types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: time.Now().UTC()}},
-	})
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		slog.Error("create service", "err", err, "product", req.ProductID)
-		return
+		ExpiresAt:    types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: expiresAt}},
+		Currency:     pricing.Currency,
+		Discount:     pricing.RecurringDiscount,
+		DiscountRate: pricing.RecurringDiscountRate,
+		ProductID:    pgtype.Int4{Valid: true, Int32: product.ID},
+
+		BillingCycleMonths: pricing.Months,
+		BillingDay:         pricing.BillingDay,
+		AffiliateID:        user.ReferredBy,
+		OrderIp:            clientIP(r),
+		OrderCountry:       clientCountry(r),
 	}
+}
 
+// createOrderInvoice creates the first invoice of an ordered service, with the setup fee, the proration and the
+// coupon discount. If createOrderInvoice fails, an error response is written and ok is false.
+func createOrderInvoice(w http.ResponseWriter, r *http.Request, qtx *database.Queries, user *database.User, product *database.Product, pricing *service.Pricing, serviceId int32) (int32, bool) {
 	// create invoice
 	invoiceId, err := service.CreateRenewalInvoice(r.Context(), qtx, serviceId, pricing.SetupFee)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		slog.Error("create invoice", "err", err)
-		return
+		return 0, false
 	}
 	slog.Debug("invoice created", "id", invoiceId)
 
-	err = tx.Commit(r.Context())
+	if !addOrderAdjustments(w, r, qtx, user, product, pricing, invoiceId, serviceId) {
+		return 0, false
+	}
+
+	return invoiceId, true
+}
+
+// applyOrderCredit pays the invoice of an order with the credit balance of the user if credit is applied automatically.
+// paid is true if the invoice becomes PAID, the caller should call OnInvoicePaid after the transaction is commited. If
+// applyOrderCredit fails, an error response is written and ok is false.
+func applyOrderCredit(w http.ResponseWriter, r *http.Request, qtx *database.Queries, invoiceId int32) (paid bool, ok bool) {
+	paid, err := service.AutoApplyCredit(r.Context(), qtx, invoiceId)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
-		slog.Error("commit tx", "err", err)
-		return
+		slog.Error("apply credit to invoice", "err", err, "invoice", invoiceId)
+		return false, false
 	}
+	return paid, true
+}
 
-	slog.Info("new order", "product", product.ID, "label", product.Name, "duration", pricing.Duration, "billing cycle", pricing.BillingCycle, "options", redactedOptions, "product settings", product.Settings, "recurring fee", pricing.RecurringFee, "setup fee", pricing.SetupFee, "user", user.ID, "service id", serviceId, "invoice id", invoiceId)
+// addOrderAdjustments adds the proration and the coupon discount of an ordered service to its first invoice, and
+// redeems the coupon. If addOrderAdjustments fails, an error response is written and false is returned.
+func addOrderAdjustments(w http.ResponseWriter, r *http.Request, qtx *database.Queries, user *database.User, product *database.Product, pricing *service.Pricing, invoiceId int32, serviceId int32) bool {
+	// proration
+	if pricing.FirstPeriodEnd != nil && pricing.Proration.LessThan(decimal.Zero) {
+		err := service.AddInvoiceProration(r.Context(), qtx, invoiceId, serviceId, *pricing.FirstPeriodEnd, pricing.Proration)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			slog.Error("add invoice proration", "err", err, "invoice", invoiceId)
+			return false
+		}
+	}
+
+	// coupon
+	if pricing.CouponID != 0 {
+		err := service.RedeemCoupon(r.Context(), qtx, pricing.CouponID, int32(product.ID), int32(pricing.Duration), user.ID, serviceId)
+		if err != nil {
+			if service.IsCouponError(err) {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return false
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			slog.Error("redeem coupon", "err", err, "coupon", pricing.CouponID)
+			return false
+		}
+
+		// the recurring discount is already applied by the renewal invoice
+		oneTimeDiscount := pricing.Discount.Sub(pricing.RecurringDiscount)
+		if oneTimeDiscount.GreaterThan(decimal.Zero) {
+			err = service.AddInvoiceDiscount(r.Context(), qtx, invoiceId, "Coupon "+pricing.Coupon, oneTimeDiscount)
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				slog.Error("add invoice discount", "err", err, "invoice", invoiceId)
+				return false
+			}
+		}
+	}
 
-	writeResp(w, http.StatusOK, D{"invoice": invoiceId})
+	return true
 }
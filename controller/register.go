@@ -11,6 +11,7 @@ import (
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
 func register(w http.ResponseWriter, r *http.Request) {
@@ -53,6 +54,8 @@ func registerStep2(w http.ResponseWriter, r *http.Request) {
 		Token    string `json:"token" validate:"required"`
 		Name     string `json:"name" validate:"required,max=100"`
 		Password string `json:"password" validate:"required,printascii,max=32"`
+
+		ReferralCode string `json:"referral_code" validate:"max=32"`
 	}
 	req, err := decode[reqStruct](r)
 	if err != nil {
@@ -66,7 +69,21 @@ func registerStep2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	slog.Info("register", "email", email, "name", req.Name)
+	var affiliate *database.User
+	if req.ReferralCode != "" {
+		affiliate, err = service.FindAffiliateByReferralCode(r.Context(), req.ReferralCode)
+		if err != nil {
+			if errors.Is(err, service.ErrInvalidReferralCode) {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			slog.Error("register find affiliate", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+	}
+
+	slog.Info("register", "email", email, "name", req.Name, "referral_code", req.ReferralCode)
 
 	userId, err := database.Q.CreateUser(r.Context(), database.CreateUserParams{
 		Email:    email,
@@ -75,7 +92,7 @@ func registerStep2(w http.ResponseWriter, r *http.Request) {
 		Password: utils.HashPassword(req.Password),
 	})
 	if err != nil {
-		if err, ok := err.(*pgconn.PgError); ok && err.Code == PGErrorUniqueViolation {
+		if err, ok := err.(*pgconn.PgError); ok && err.Code == database.PGErrorUniqueViolation {
 			// user with same email already exists
 			writeError(w, http.StatusForbidden, "Invalid token")
 			return
@@ -85,6 +102,16 @@ func registerStep2(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if affiliate != nil {
+		err = database.Q.UpdateUserReferredBy(r.Context(), database.UpdateUserReferredByParams{
+			ID:         userId,
+			ReferredBy: pgtype.Int4{Valid: true, Int32: affiliate.ID},
+		})
+		if err != nil {
+			slog.Error("register update referred by", "err", err, "user_id", userId, "affiliate_id", affiliate.ID)
+		}
+	}
+
 	authToken, err := service.NewSessionToken(r.Context(), userId)
 	if err != nil {
 		slog.Error("register", "err", err)
@@ -48,6 +48,8 @@ func Route(r *chi.Mux) {
 		r.Post("/admin/user", adminUserCreate)
 		r.Put("/admin/user/{id}", adminUserEdit)
 		r.Get("/admin/user/{id}", adminUserGet)
+		r.Get("/admin/user/{id}/credit", adminUserCreditGet)
+		r.Post("/admin/user/{id}/credit", adminUserCreditAdd)
 
 		r.Get("/admin/category", adminCategoryList)
 		r.Post("/admin/category", adminCategoryCreate)
@@ -55,6 +57,18 @@ func Route(r *chi.Mux) {
 		r.Get("/admin/category/{id}", adminCategoryGet)
 		r.Delete("/admin/category/{id}", adminCategoryDelete)
 
+		r.Get("/admin/tax", adminTaxList)
+		r.Post("/admin/tax", adminTaxCreate)
+		r.Put("/admin/tax/{id}", adminTaxUpdate)
+		r.Get("/admin/tax/{id}", adminTaxGet)
+		r.Delete("/admin/tax/{id}", adminTaxDelete)
+
+		r.Get("/admin/coupon", adminCouponList)
+		r.Post("/admin/coupon", adminCouponCreate)
+		r.Put("/admin/coupon/{id}", adminCouponUpdate)
+		r.Get("/admin/coupon/{id}", adminCouponGet)
+		r.Delete("/admin/coupon/{id}", adminCouponDelete)
+
 		r.Get("/admin/product", adminProductList)
 		r.Get("/admin/product/extension-list", adminProductExtensionList)
 		r.Post("/admin/product/extension-settings", adminProductExtensionSettings)
@@ -64,13 +78,23 @@ func Route(r *chi.Mux) {
 		r.Delete("/admin/product/{id}", adminProductDelete)
 
 		r.Get("/admin/invoice", adminInvoiceList)
+		r.Post("/admin/invoice/merge", adminInvoiceMerge)
 		r.Get("/admin/invoice/{id}", adminInvoiceGet)
+		r.Get("/admin/invoice/{id}/pdf", adminInvoicePDF)
 		r.Put("/admin/invoice/{id}", adminInvoiceEdit)
 		r.Post("/admin/invoice/{id}/item", adminInvoiceAddItem)
 		r.Delete("/admin/invoice/{id}/item/{item_id}", adminInvoiceRemoveItem)
 		r.Put("/admin/invoice/{id}/item/{item_id}", adminInvoiceUpdateItem)
 		r.Get("/admin/invoice/{id}/payment", adminListInvoicePayment)
 		r.Post("/admin/invoice/{id}/payment", adminAddInvoicePayment)
+		r.Post("/admin/invoice/{id}/payment/{payment_id}/refund", adminRefundInvoicePayment)
+		r.Get("/admin/invoice/{id}/gateway-refund", adminListInvoiceGatewayRefunds)
+		r.Put("/admin/invoice/{id}/gateway-refund/{refund_id}", adminResolveGatewayRefund)
+		r.Get("/admin/invoice/{id}/credit-note", adminInvoiceListCreditNotes)
+		r.Post("/admin/invoice/{id}/credit-note", adminInvoiceCreateCreditNote)
+
+		r.Get("/admin/credit-note", adminCreditNoteList)
+		r.Get("/admin/credit-note/{id}", adminCreditNoteGet)
 
 		r.Get("/admin/gateway", adminListGateways)
 		r.Get("/admin/gateway/{id}", adminGatewayGet)
@@ -87,8 +111,12 @@ func Route(r *chi.Mux) {
 		r.Get("/admin/service/{id}/info", adminServiceInfoPage)
 		r.Post("/admin/service/{id}/info", adminServiceInfoPage)
 		r.Put("/admin/service/{id}/status", adminServiceUpdateStatus)
+		r.Post("/admin/service/{id}/approve", adminServiceApprove)
+		r.Post("/admin/service/{id}/reject", adminServiceReject)
 		r.Put("/admin/service/{id}/settings", adminServiceUpdateSettings)
 		r.Get("/admin/service/{id}/jobs", adminServiceGetJobs)
+		r.Get("/admin/service/{id}/usage", adminServiceUsage)
+		r.Post("/admin/service/{id}/usage", adminServiceRecordUsage)
 
 		r.Get("/admin/server", adminServerList)
 		r.Get("/admin/server/{id}", adminServerGet)
@@ -97,6 +125,19 @@ func Route(r *chi.Mux) {
 		r.Delete("/admin/server/{id}", adminServerDelete)
 		r.Get("/admin/server/extension-settings", adminExtensionServerSettings)
 
+		r.Get("/admin/report/revenue", adminReportRevenue)
+		r.Get("/admin/report/revenue/product", adminReportRevenueByProduct)
+		r.Get("/admin/report/revenue/gateway", adminReportRevenueByGateway)
+		r.Get("/admin/report/mrr", adminReportMRR)
+		r.Get("/admin/report/churn", adminReportChurn)
+		r.Get("/admin/report/receivables", adminReportReceivables)
+		r.Get("/admin/report/statement/{user_id}", adminReportStatement)
+
+		r.Get("/admin/export/invoices", adminExportInvoices)
+		r.Get("/admin/export/invoice-items", adminExportInvoiceItems)
+		r.Get("/admin/export/payments", adminExportPayments)
+		r.Get("/admin/export/journal", adminExportJournal)
+
 		r.Get("/admin/setting", adminSettingsList)
 		r.Put("/admin/setting", adminSettingsUpdate)
 	})
@@ -110,6 +151,15 @@ func Route(r *chi.Mux) {
 		r.Get("/store/product/{id}/options", getProductOptions)
 		r.Post("/store/calculate-price", calculatePrice)
 		r.With(middlewares.CloudflareTurnstile).With(middlewares.MustAuth).Post("/store/order", order)
+
+		// carts of guests are identified by the X-Cart-Token header
+		r.Get("/store/cart", getCart)
+		r.Delete("/store/cart", clearCart)
+		r.Post("/store/cart/item", addCartItem)
+		r.Put("/store/cart/item/{id}", updateCartItem)
+		r.Delete("/store/cart/item/{id}", removeCartItem)
+		r.Post("/store/cart/calculate-price", calculateCartPrice)
+		r.With(middlewares.CloudflareTurnstile).With(middlewares.MustAuth).Post("/store/cart/checkout", checkoutCart)
 	})
 
 	// user
@@ -118,10 +168,20 @@ func Route(r *chi.Mux) {
 
 		r.Get("/invoice", listInvoices)
 		r.Get("/invoice/{id}", getInvoice)
+		r.Get("/invoice/{id}/pdf", getInvoicePDF)
 		r.Get("/invoice/gateways", getAvailablePaymentGateways)
 		r.Post("/invoice/{id}/pay", makePayment)
 		r.Get("/invoice/{id}/payments", getInvoicePayments)
 
+		r.Get("/credit", getCredit)
+
+		r.Get("/affiliate", getAffiliate)
+		r.Get("/affiliate/commission", listAffiliateCommissions)
+		r.Post("/affiliate/payout", affiliatePayout)
+
+		r.Get("/credit-note", listCreditNotes)
+		r.Get("/credit-note/{id}", getCreditNote)
+
 		r.Get("/service", getServices)
 		r.Get("/service/{id}", getService)
 		r.Get("/service/{id}/action", serviceClientActions)
@@ -129,6 +189,10 @@ func Route(r *chi.Mux) {
 		r.Post("/service/{id}/info", serviceInfoPage)
 		r.Post("/service/{id}/action", servicePerformAction)
 		r.Get("/service/{id}/jobs", serviceGetJobs)
+		r.Get("/service/{id}/upgrade", serviceUpgradeTargets)
+		r.Post("/service/{id}/upgrade/calculate", serviceUpgradeCalculate)
+		r.Post("/service/{id}/upgrade", serviceUpgrade)
+		r.Get("/service/{id}/usage", serviceUsage)
 	})
 
 	for name, gateway := range gateways.Gateways {
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/riverqueue/river"
 	"github.com/shopspring/decimal"
@@ -83,16 +84,18 @@ func getService(w http.ResponseWriter, r *http.Request) {
 	}
 
 	writeResp(w, http.StatusOK, D{"service": D{
-		"id":                  s.ID,
-		"label":               s.Label,
-		"user_id":             s.UserID,
-		"status":              s.Status,
-		"cancellation_reason": s.CancellationReason,
-		"billing_cycle":       s.BillingCycle,
-		"price":               s.Price,
-		"expires_at":          s.ExpiresAt,
-		"created_at":          s.CreatedAt,
-		"cancelled_at":        s.CancelledAt,
+		"id":                   s.ID,
+		"label":                s.Label,
+		"user_id":              s.UserID,
+		"status":               s.Status,
+		"cancellation_reason":  s.CancellationReason,
+		"billing_cycle":        s.BillingCycle,
+		"billing_cycle_months": s.BillingCycleMonths,
+		"billing_day":          s.BillingDay,
+		"price":                s.Price,
+		"expires_at":           s.ExpiresAt,
+		"created_at":           s.CreatedAt,
+		"cancelled_at":         s.CancelledAt,
 	}})
 }
 
@@ -301,3 +304,217 @@ func serviceGetJobs(w http.ResponseWriter, r *http.Request) {
 
 	writeResp(w, http.StatusOK, D{"jobs": jobsResp})
 }
+
+func serviceUpgradeTargets(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.MustGetUser(r)
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	s, err := database.Q.FindServiceById(r.Context(), int32(id))
+	if err != nil {
+		slog.Error("get service", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if s.UserID != user.ID {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if s.Status != service.ServiceActive {
+		writeError(w, http.StatusBadRequest, "service is not active")
+		return
+	}
+
+	products, err := service.UpgradeTargets(r.Context(), &s)
+	if err != nil {
+		if errors.Is(err, service.ErrUpgradeNotAvailable) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Error("upgrade targets", "err", err, "service", s.ID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	type productStruct struct {
+		ID          int32               `json:"id"`
+		Name        string              `json:"name"`
+		Description string              `json:"description"`
+		Pricing     types.ProductPrices `json:"pricing"`
+		InStock     bool                `json:"in_stock"`
+	}
+
+	resp := make([]productStruct, 0)
+	for _, p := range products {
+		resp = append(resp, productStruct{
+			ID:          p.ID,
+			Name:        p.Name,
+			Description: p.Description,
+			Pricing:     p.Pricing,
+			InStock:     p.StockControl == service.StockControlDisabled || p.Stock > 0,
+		})
+	}
+
+	// current values of the options, passwords are not returned
+	options, err := database.Q.FindProductOptionsByProduct(r.Context(), s.ProductID.Int32)
+	if err != nil {
+		slog.Error("get product options", "err", err, "product", s.ProductID.Int32)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	currentOptions := make(map[string]string)
+	for _, option := range options {
+		if option.Type == "password" {
+			continue
+		}
+		currentOptions[option.Name] = s.Settings[option.Name]
+	}
+
+	writeResp(w, http.StatusOK, D{"products": resp, "current_product": s.ProductID.Int32, "current_options": currentOptions, "billing_cycle": s.BillingCycle})
+}
+
+func serviceUpgradeCalculate(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.MustGetUser(r)
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	req, err := decode[service.UpgradeRequest](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s, err := database.Q.FindServiceById(r.Context(), int32(id))
+	if err != nil {
+		slog.Error("get service", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if s.UserID != user.ID {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	quote, err := service.CalculateUpgrade(r.Context(), &s, *req, user)
+	if err != nil {
+		if errors.Is(err, service.ErrInternalError) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"upgrade": quote})
+}
+
+func serviceUpgrade(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.MustGetUser(r)
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	req, err := decode[service.UpgradeRequest](r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	owner, err := service.IsServiceOwner(r.Context(), user.ID, int32(id))
+	if err != nil {
+		slog.Error("is service owner", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if !owner {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	tx, err := database.Conn.Begin(r.Context())
+	if err != nil {
+		slog.Error("begin tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer rollbackTx(r.Context(), tx)
+
+	invoiceId, credit, err := service.UpgradeService(r.Context(), tx, int32(id), *req, user)
+	if err != nil {
+		if errors.Is(err, service.ErrInternalError) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = tx.Commit(r.Context())
+	if err != nil {
+		slog.Error("commit tx", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{"invoice": invoiceId, "credit": credit})
+}
+
+func serviceUsage(w http.ResponseWriter, r *http.Request) {
+	user := middlewares.MustGetUser(r)
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	s, err := database.Q.FindServiceById(r.Context(), int32(id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		slog.Error("get service", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if s.UserID != user.ID {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	writeServiceUsage(w, r, &s)
+}
+
+// writeServiceUsage writes the usage of metered resources by the service in the current billing period.
+func writeServiceUsage(w http.ResponseWriter, r *http.Request, s *database.Service) {
+	from, to, ok := service.CurrentUsagePeriod(s)
+	if !ok {
+		writeResp(w, http.StatusOK, D{"usage": []service.MeteredUsage{}, "period_start": nil, "period_end": nil})
+		return
+	}
+
+	usage, err := service.ServiceUsage(r.Context(), database.Q, s, from, to)
+	if err != nil {
+		slog.Error("service usage", "err", err, "service", s.ID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeResp(w, http.StatusOK, D{
+		"usage":        usage,
+		"period_start": types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: from}},
+		"period_end":   types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: to}},
+	})
+}
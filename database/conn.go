@@ -21,6 +21,8 @@ var sqls embed.FS
 var Q *Queries
 var Conn *pgxpool.Pool
 
+const PGErrorUniqueViolation = "23505"
+
 func Init() {
 	ctx := context.Background()
 
@@ -10,12 +10,100 @@ import (
 	"github.com/shopspring/decimal"
 )
 
+type Cart struct {
+	ID        int32           `json:"id"`
+	Token     string          `json:"token"`
+	UserID    pgtype.Int4     `json:"user_id"`
+	UpdatedAt types.Timestamp `json:"updated_at"`
+}
+
+type CartItem struct {
+	ID        int32                 `json:"id"`
+	CartID    int32                 `json:"cart_id"`
+	ProductID int32                 `json:"product_id"`
+	Duration  int32                 `json:"duration"`
+	Options   types.CartItemOptions `json:"options"`
+	Coupon    string                `json:"coupon"`
+	CreatedAt types.Timestamp       `json:"created_at"`
+}
+
 type Category struct {
 	ID          int32  `json:"id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
 }
 
+type Coupon struct {
+	ID             int32           `json:"id"`
+	Code           string          `json:"code"`
+	Type           string          `json:"type"`
+	Value          decimal.Decimal `json:"value"`
+	Currency       string          `json:"currency"`
+	ProductIds     []int32         `json:"product_ids"`
+	Durations      []int32         `json:"durations"`
+	Recurring      bool            `json:"recurring"`
+	MaxUses        int32           `json:"max_uses"`
+	MaxUsesPerUser int32           `json:"max_uses_per_user"`
+	Uses           int32           `json:"uses"`
+	ValidFrom      types.Timestamp `json:"valid_from"`
+	ValidUntil     types.Timestamp `json:"valid_until"`
+	Enabled        bool            `json:"enabled"`
+	CreatedAt      types.Timestamp `json:"created_at"`
+}
+
+type CouponUse struct {
+	ID        int32           `json:"id"`
+	CouponID  int32           `json:"coupon_id"`
+	UserID    int32           `json:"user_id"`
+	ServiceID pgtype.Int4     `json:"service_id"`
+	CreatedAt types.Timestamp `json:"created_at"`
+}
+
+type Commission struct {
+	ID          int32           `json:"id"`
+	AffiliateID int32           `json:"affiliate_id"`
+	InvoiceID   int32           `json:"invoice_id"`
+	Amount      decimal.Decimal `json:"amount"`
+	Reversed    decimal.Decimal `json:"reversed"`
+	PaidOut     decimal.Decimal `json:"paid_out"`
+	CreatedAt   types.Timestamp `json:"created_at"`
+}
+
+type CreditNote struct {
+	ID        int32           `json:"id"`
+	Number    string          `json:"number"`
+	InvoiceID int32           `json:"invoice_id"`
+	UserID    int32           `json:"user_id"`
+	Reason    string          `json:"reason"`
+	Subtotal  decimal.Decimal `json:"subtotal"`
+	Tax       decimal.Decimal `json:"tax"`
+	Amount    decimal.Decimal `json:"amount"`
+	Currency  string          `json:"currency"`
+	CreatedAt types.Timestamp `json:"created_at"`
+}
+
+type CreditNoteItem struct {
+	ID           int32           `json:"id"`
+	CreditNoteID int32           `json:"credit_note_id"`
+	Description  string          `json:"description"`
+	Amount       decimal.Decimal `json:"amount"`
+}
+
+type CreditNoteNumberSequence struct {
+	Period int32 `json:"period"`
+	Last   int32 `json:"last"`
+}
+
+type CreditTransaction struct {
+	ID          int32           `json:"id"`
+	UserID      int32           `json:"user_id"`
+	Type        string          `json:"type"`
+	Amount      decimal.Decimal `json:"amount"`
+	Description string          `json:"description"`
+	InvoiceID   pgtype.Int4     `json:"invoice_id"`
+	CreatedAt   types.Timestamp `json:"created_at"`
+}
+
 type Gateway struct {
 	ID          int32                 `json:"id"`
 	DisplayName string                `json:"display_name"`
@@ -25,6 +113,26 @@ type Gateway struct {
 	Fee         pgtype.Text           `json:"fee"`
 }
 
+type GatewayOrder struct {
+	ID        int32           `json:"id"`
+	Gateway   string          `json:"gateway"`
+	OrderID   string          `json:"order_id"`
+	InvoiceID int32           `json:"invoice_id"`
+	Status    string          `json:"status"`
+	CreatedAt types.Timestamp `json:"created_at"`
+}
+
+type GatewayRefund struct {
+	ID          int32           `json:"id"`
+	PaymentID   int32           `json:"payment_id"`
+	Amount      decimal.Decimal `json:"amount"`
+	Description string          `json:"description"`
+	Status      string          `json:"status"`
+	ReferenceID string          `json:"reference_id"`
+	Error       string          `json:"error"`
+	CreatedAt   types.Timestamp `json:"created_at"`
+}
+
 type Invoice struct {
 	ID                 int32           `json:"id"`
 	UserID             int32           `json:"user_id"`
@@ -34,6 +142,14 @@ type Invoice struct {
 	DueAt              types.Timestamp `json:"due_at"`
 	Amount             decimal.Decimal `json:"amount"`
 	CreatedAt          types.Timestamp `json:"created_at"`
+	Currency           string          `json:"currency"`
+	Subtotal           decimal.Decimal `json:"subtotal"`
+	Tax                decimal.Decimal `json:"tax"`
+	TaxRate            decimal.Decimal `json:"tax_rate"`
+	TaxName            string          `json:"tax_name"`
+	TaxInclusive       bool            `json:"tax_inclusive"`
+	ReverseCharge      bool            `json:"reverse_charge"`
+	Number             string          `json:"number"`
 }
 
 type InvoiceItem struct {
@@ -46,6 +162,17 @@ type InvoiceItem struct {
 	CreatedAt   types.Timestamp `json:"created_at"`
 }
 
+type InvoiceReminder struct {
+	InvoiceID int32           `json:"invoice_id"`
+	Stage     string          `json:"stage"`
+	SentAt    types.Timestamp `json:"sent_at"`
+}
+
+type InvoiceNumberSequence struct {
+	Period int32 `json:"period"`
+	Last   int32 `json:"last"`
+}
+
 type InvoicePayment struct {
 	ID          int32           `json:"id"`
 	InvoiceID   int32           `json:"invoice_id"`
@@ -54,19 +181,31 @@ type InvoicePayment struct {
 	Amount      decimal.Decimal `json:"amount"`
 	ReferenceID string          `json:"reference_id"`
 	Gateway     string          `json:"gateway"`
+	RefundOf    pgtype.Int4     `json:"refund_of"`
+	Credited    decimal.Decimal `json:"credited"`
 }
 
 type Product struct {
-	ID           int32                 `json:"id"`
-	Name         string                `json:"name"`
-	Description  string                `json:"description"`
-	CategoryID   int32                 `json:"category_id"`
-	Extension    string                `json:"extension"`
-	Enabled      bool                  `json:"enabled"`
-	Pricing      types.ProductPrices   `json:"pricing"`
-	Settings     types.ProductSettings `json:"settings"`
-	Stock        int32                 `json:"stock"`
-	StockControl int32                 `json:"stock_control"`
+	ID                           int32                 `json:"id"`
+	Name                         string                `json:"name"`
+	Description                  string                `json:"description"`
+	CategoryID                   int32                 `json:"category_id"`
+	Extension                    string                `json:"extension"`
+	Enabled                      bool                  `json:"enabled"`
+	Pricing                      types.ProductPrices   `json:"pricing"`
+	Settings                     types.ProductSettings `json:"settings"`
+	Stock                        int32                 `json:"stock"`
+	StockControl                 int32                 `json:"stock_control"`
+	InvoiceDaysBeforeExpiry      pgtype.Int4           `json:"invoice_days_before_expiry"`
+	SuspendDaysAfterDue          pgtype.Int4           `json:"suspend_days_after_due"`
+	TerminateDaysAfterSuspension pgtype.Int4           `json:"terminate_days_after_suspension"`
+	BillingAnchorDay             pgtype.Int4           `json:"billing_anchor_day"`
+	MeteredPricing               types.MeteredPrices   `json:"metered_pricing"`
+	TrialDays                    int32                 `json:"trial_days"`
+	TrialRequiresPaymentMethod   bool                  `json:"trial_requires_payment_method"`
+	TrialOncePerUser             bool                  `json:"trial_once_per_user"`
+	CommissionPercent            decimal.Decimal       `json:"commission_percent"`
+	CommissionRecurring          bool                  `json:"commission_recurring"`
 }
 
 type ProductOption struct {
@@ -99,6 +238,30 @@ type Service struct {
 	ExpiresAt          types.Timestamp       `json:"expires_at"`
 	CreatedAt          types.Timestamp       `json:"created_at"`
 	CancelledAt        types.Timestamp       `json:"cancelled_at"`
+	Currency           string                `json:"currency"`
+	Discount           decimal.Decimal       `json:"discount"`
+	ProductID          pgtype.Int4           `json:"product_id"`
+	SuspensionReason   pgtype.Text           `json:"suspension_reason"`
+	BillingCycleMonths int32                 `json:"billing_cycle_months"`
+	BillingDay         int32                 `json:"billing_day"`
+	UsageBilledUntil   types.Timestamp       `json:"usage_billed_until"`
+	AffiliateID        pgtype.Int4           `json:"affiliate_id"`
+	OrderIp            string                `json:"order_ip"`
+	OrderCountry       string                `json:"order_country"`
+	ReviewReason       pgtype.Text           `json:"review_reason"`
+	DiscountRate       decimal.Decimal       `json:"discount_rate"`
+}
+
+type ServiceUpgrade struct {
+	ID        int32                 `json:"id"`
+	ServiceID int32                 `json:"service_id"`
+	InvoiceID pgtype.Int4           `json:"invoice_id"`
+	ProductID int32                 `json:"product_id"`
+	Settings  types.ServiceSettings `json:"settings"`
+	Price     decimal.Decimal       `json:"price"`
+	Amount    decimal.Decimal       `json:"amount"`
+	Status    string                `json:"status"`
+	CreatedAt types.Timestamp       `json:"created_at"`
 }
 
 type Session struct {
@@ -115,15 +278,34 @@ type Setting struct {
 	Value string `json:"value"`
 }
 
+type TaxRule struct {
+	ID            int32           `json:"id"`
+	Name          string          `json:"name"`
+	Country       string          `json:"country"`
+	State         string          `json:"state"`
+	Rate          decimal.Decimal `json:"rate"`
+	Inclusive     bool            `json:"inclusive"`
+	ReverseCharge bool            `json:"reverse_charge"`
+}
+
 type User struct {
-	ID       int32       `json:"id"`
-	Email    string      `json:"email"`
-	Name     string      `json:"name"`
-	Role     string      `json:"role"`
-	Password string      `json:"-"`
-	Address  pgtype.Text `json:"address"`
-	City     pgtype.Text `json:"city"`
-	State    pgtype.Text `json:"state"`
-	Country  pgtype.Text `json:"country"`
-	ZipCode  pgtype.Text `json:"zip_code"`
+	ID               int32           `json:"id"`
+	Email            string          `json:"email"`
+	Name             string          `json:"name"`
+	Role             string          `json:"role"`
+	Password         string          `json:"-"`
+	Address          pgtype.Text     `json:"address"`
+	City             pgtype.Text     `json:"city"`
+	State            pgtype.Text     `json:"state"`
+	Country          pgtype.Text     `json:"country"`
+	ZipCode          pgtype.Text     `json:"zip_code"`
+	Credit           decimal.Decimal `json:"credit"`
+	Currency         string          `json:"currency"`
+	VatID            string          `json:"vat_id"`
+	VatIDValid       bool            `json:"vat_id_valid"`
+	EmailReminders   bool            `json:"email_reminders"`
+	LateFeeExempt    bool            `json:"late_fee_exempt"`
+	BillingAnchorDay pgtype.Int4     `json:"billing_anchor_day"`
+	ReferralCode     pgtype.Text     `json:"referral_code"`
+	ReferredBy       pgtype.Int4     `json:"referred_by"`
 }
@@ -6,6 +6,9 @@ SELECT * FROM users ORDER BY id;
 -- name: FindUserById :one
 SELECT * FROM users WHERE id = $1;
 
+-- name: FindUserByIdForUpdate :one
+SELECT * FROM users WHERE id = $1 FOR UPDATE;
+
 -- name: FindUserByEmail :one
 SELECT * FROM users WHERE email = $1;
 
@@ -27,12 +30,42 @@ UPDATE users SET name = $1, address = $2, city = $3, state = $4, country = $5, z
 -- name: UpdateUser :exec
 UPDATE users SET email = $2, name = $3, role = $4, address = $5, city = $6, state = $7, country = $8, zip_code = $9 WHERE id = $1;
 
+-- name: UpdateUserCurrency :exec
+UPDATE users SET currency = $2 WHERE id = $1;
+
+-- name: UpdateUserVatID :exec
+UPDATE users SET vat_id = $2, vat_id_valid = $3 WHERE id = $1;
+
+-- name: UpdateUserEmailReminders :exec
+UPDATE users SET email_reminders = $2 WHERE id = $1;
+
+-- name: UpdateUserLateFeeExempt :exec
+UPDATE users SET late_fee_exempt = $2 WHERE id = $1;
+
+-- name: UpdateUserBillingAnchorDay :exec
+UPDATE users SET billing_anchor_day = $2 WHERE id = $1;
+
+-- name: FindUserByReferralCode :one
+SELECT * FROM users WHERE referral_code = $1;
+
+-- name: UpdateUserReferralCode :exec
+UPDATE users SET referral_code = $2 WHERE id = $1 AND referral_code IS NULL;
+
+-- name: UpdateUserReferredBy :exec
+UPDATE users SET referred_by = $2 WHERE id = $1;
+
+-- name: CountReferredUsers :one
+SELECT COUNT(*) FROM users WHERE referred_by = $1;
+
 -- name: UpdateUserPassword :exec
 UPDATE users SET password = $2 WHERE id = $1;
 
 -- name: CountUsers :one
 SELECT COUNT(id) FROM users;
 
+-- name: UpdateUserCredit :one
+UPDATE users SET credit = credit + @amount::decimal WHERE id = @id AND credit + @amount::decimal >= 0 RETURNING credit;
+
 -- SESSIONS --
 
 -- name: FindSessionByToken :one
@@ -77,7 +110,7 @@ SELECT * FROM products WHERE category_id = $1 AND enabled = TRUE;
 SELECT * FROM products ORDER BY id;
 
 -- name: SearchProduct :many
-SELECT products.id as id, products.name, products.description, products.category_id, products.extension, products.enabled, products.pricing, products.settings, products.stock, products.stock_control, categories.name AS category_name FROM products INNER JOIN categories ON categories.id = products.category_id  WHERE (category_id = $1 OR $1 < 1) ORDER BY products.id;
+SELECT products.id as id, products.name, products.description, products.category_id, products.extension, products.enabled, products.pricing, products.settings, products.stock, products.stock_control, products.invoice_days_before_expiry, products.suspend_days_after_due, products.terminate_days_after_suspension, products.billing_anchor_day, products.metered_pricing, products.trial_days, products.trial_requires_payment_method, products.trial_once_per_user, products.commission_percent, products.commission_recurring, categories.name AS category_name FROM products INNER JOIN categories ON categories.id = products.category_id  WHERE (category_id = $1 OR $1 < 1) ORDER BY products.id;
 
 -- name: ListEnabledProducts :many
 SELECT * FROM products WHERE enabled ORDER BY id;
@@ -92,10 +125,10 @@ SELECT * FROM products WHERE id = $1;
 SELECT * FROM products WHERE category_id = $1 ORDER BY id;
 
 -- name: UpdateProduct :exec
-UPDATE products SET name = $1, description = $2, category_id = $3, extension = $4, enabled = $5, pricing = $6, settings = $7, stock = $8, stock_control = $9 WHERE id = $10;
+UPDATE products SET name = $1, description = $2, category_id = $3, extension = $4, enabled = $5, pricing = $6, settings = $7, stock = $8, stock_control = $9, invoice_days_before_expiry = $10, suspend_days_after_due = $11, terminate_days_after_suspension = $12, billing_anchor_day = $13, metered_pricing = $14, trial_days = $15, trial_requires_payment_method = $16, trial_once_per_user = $17, commission_percent = $18, commission_recurring = $19 WHERE id = $20;
 
 -- name: CreateProduct :one
-INSERT INTO products (name, description, category_id, extension, enabled, pricing, settings, stock, stock_control) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id;
+INSERT INTO products (name, description, category_id, extension, enabled, pricing, settings, stock, stock_control, invoice_days_before_expiry, suspend_days_after_due, terminate_days_after_suspension, billing_anchor_day, metered_pricing, trial_days, trial_requires_payment_method, trial_once_per_user, commission_percent, commission_recurring) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19) RETURNING id;
 
 -- name: DeleteProduct :exec
 DELETE FROM products WHERE id = $1;
@@ -132,14 +165,26 @@ SELECT * FROM invoices WHERE id = $1 FOR UPDATE;
 -- name: UpdateInvoice :exec
 UPDATE invoices SET status = $1, cancellation_reason = $2, paid_at = $3, due_at = $4 WHERE id = $5;
 
--- name: UpdateInvoiceAmount :exec
-UPDATE invoices SET amount = (SELECT SUM(amount) FROM invoice_items WHERE invoice_id = $1) WHERE id = $1;
+-- name: SumInvoiceItems :one
+SELECT COALESCE(SUM(amount), 0)::decimal FROM invoice_items WHERE invoice_id = $1;
+
+-- name: UpdateInvoiceDueAt :exec
+UPDATE invoices SET due_at = $1 WHERE id = $2;
+
+-- name: UpdateInvoiceTotals :exec
+UPDATE invoices SET subtotal = $1, tax = $2, amount = $3 WHERE id = $4;
+
+-- name: NextInvoiceNumber :one
+INSERT INTO invoice_number_sequences (period, last) VALUES ($1, 1) ON CONFLICT (period) DO UPDATE SET last = invoice_number_sequences.last + 1 RETURNING last;
+
+-- name: UpdateInvoiceNumber :exec
+UPDATE invoices SET number = $1 WHERE id = $2;
 
 -- name: UpdateInvoicePaid :exec
 UPDATE invoices SET status = 'PAID', paid_at = CURRENT_TIMESTAMP WHERE id = $1;
 
 -- name: CreateInvoice :one
-INSERT INTO invoices (user_id, status, cancellation_reason, paid_at, due_at, amount) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;
+INSERT INTO invoices (user_id, status, cancellation_reason, paid_at, due_at, amount, currency, tax_rate, tax_name, tax_inclusive, reverse_charge) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id;
 
 -- name: ListInvoiceItems :many
 SELECT * FROM invoice_items WHERE invoice_id = $1 ORDER BY id;
@@ -153,6 +198,9 @@ DELETE FROM invoice_items WHERE id = $1 AND invoice_id = $2;
 -- name: DeleteAllInvoiceItems :exec
 DELETE FROM invoice_items WHERE invoice_id = $1;
 
+-- name: MoveInvoiceItems :exec
+UPDATE invoice_items SET invoice_id = $1 WHERE invoice_id = $2;
+
 -- name: UpdateInvoiceItem :exec
 UPDATE invoice_items SET description = $1, amount = $2 WHERE id = $3 AND invoice_id = $4;
 
@@ -160,20 +208,67 @@ UPDATE invoice_items SET description = $1, amount = $2 WHERE id = $3 AND invoice
 SELECT invoices.* FROM invoices INNER JOIN invoice_items ON invoices.id = invoice_items.invoice_id WHERE invoice_items.item_id = $1 AND invoice_items.type = 'service' ORDER BY invoices.id DESC;
 
 -- name: AddInvoicePayment :one
-INSERT INTO invoice_payments (invoice_id, description, amount, reference_id, gateway) VALUES ($1, $2, $3, $4, $5) RETURNING id;
+INSERT INTO invoice_payments (invoice_id, description, amount, reference_id, gateway) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (gateway, reference_id) WHERE reference_id <> '' DO NOTHING RETURNING id;
 
 -- name: ListInvoicePayments :many
 SELECT * FROM invoice_payments WHERE invoice_id = $1 ORDER BY id ASC;
 
+-- name: FindInvoicePayment :one
+SELECT * FROM invoice_payments WHERE id = $1 AND invoice_id = $2;
+
+-- name: FindInvoicePaymentByReference :one
+SELECT * FROM invoice_payments WHERE gateway = $1 AND reference_id = $2 ORDER BY id ASC LIMIT 1;
+
+-- name: UpdateInvoicePaymentCredited :exec
+UPDATE invoice_payments SET credited = $1 WHERE id = $2;
+
+-- name: AddInvoiceRefund :one
+INSERT INTO invoice_payments (invoice_id, description, amount, reference_id, gateway, refund_of) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (gateway, reference_id) WHERE reference_id <> '' DO NOTHING RETURNING id;
+
+-- name: TotalPaymentRefund :one
+SELECT COALESCE(-SUM(amount), 0)::decimal FROM invoice_payments WHERE refund_of = $1;
+
+-- name: SumInvoicePaymentsAndRefunds :one
+SELECT COALESCE(SUM(amount) FILTER (WHERE refund_of IS NULL), 0)::decimal AS paid, COALESCE(-SUM(amount) FILTER (WHERE refund_of IS NOT NULL), 0)::decimal AS refunded, COALESCE(SUM(credited), 0)::decimal AS credited FROM invoice_payments WHERE invoice_id = $1;
+
 -- name: TotalInvoicePayment :one
-SELECT SUM(amount::decimal)::decimal FROM invoice_payments WHERE invoice_id = $1;
+SELECT COALESCE(SUM(amount), 0)::decimal FROM invoice_payments WHERE invoice_id = $1;
 
 -- name: FindOverdueInvoices :many
 SELECT * FROM invoices WHERE status = 'UNPAID' AND due_at <= CURRENT_TIMESTAMP ORDER BY id;
 
+-- name: CountInvoiceItemsByType :one
+SELECT COUNT(*) FROM invoice_items WHERE invoice_id = $1 AND type = $2;
+
+-- name: FindInvoicesForLateFee :many
+SELECT invoices.* FROM invoices INNER JOIN users ON invoices.user_id = users.id WHERE invoices.status = 'UNPAID' AND invoices.due_at <= CURRENT_TIMESTAMP - make_interval(days => @grace_days::integer) AND NOT users.late_fee_exempt AND EXISTS (SELECT 1 FROM invoice_items INNER JOIN services ON invoice_items.item_id = services.id WHERE invoice_items.invoice_id = invoices.id AND invoice_items.type = 'service' AND services.status NOT IN ('UNPAID', 'PENDING')) AND NOT EXISTS (SELECT 1 FROM invoice_items WHERE invoice_items.invoice_id = invoices.id AND invoice_items.type = 'late_fee') ORDER BY invoices.id;
+
+-- name: UpdateInvoiceStatus :exec
+UPDATE invoices SET status = $1 WHERE id = $2;
+
 -- name: UpdateInvoiceCancelled :exec
 UPDATE invoices SET status = 'CANCELLED', cancellation_reason = $1 WHERE id = $2;
 
+-- name: CancelUnpaidInvoicesForService :exec
+UPDATE invoices SET status = 'CANCELLED', cancellation_reason = $1 WHERE status = 'UNPAID' AND id IN (SELECT invoice_id FROM invoice_items WHERE invoice_items.type = 'service' AND invoice_items.item_id = $2);
+
+-- INVOICE REMINDERS --
+
+-- name: FindNewInvoicesWithoutReminder :many
+SELECT * FROM invoices WHERE status = 'UNPAID' AND created_at >= CURRENT_TIMESTAMP - interval '1 day' AND NOT EXISTS (SELECT 1 FROM invoice_reminders WHERE invoice_reminders.invoice_id = invoices.id AND invoice_reminders.stage = 'created') ORDER BY id;
+
+-- name: FindUpcomingInvoicesWithoutReminder :many
+SELECT * FROM invoices WHERE status = 'UNPAID' AND due_at > CURRENT_TIMESTAMP AND due_at <= CURRENT_TIMESTAMP + make_interval(days => @days::integer) AND created_at < due_at - make_interval(days => @days::integer) AND NOT EXISTS (SELECT 1 FROM invoice_reminders WHERE invoice_reminders.invoice_id = invoices.id AND invoice_reminders.stage = 'upcoming') ORDER BY id;
+
+-- name: FindDueInvoicesWithoutReminder :many
+SELECT * FROM invoices WHERE status = 'UNPAID' AND due_at <= CURRENT_TIMESTAMP AND due_at > CURRENT_TIMESTAMP - interval '1 day' AND NOT EXISTS (SELECT 1 FROM invoice_reminders WHERE invoice_reminders.invoice_id = invoices.id AND invoice_reminders.stage = 'due') ORDER BY id;
+
+-- name: FindSuspendedInvoicesWithoutReminder :many
+SELECT * FROM invoices WHERE status = 'UNPAID' AND EXISTS (SELECT 1 FROM invoice_items INNER JOIN services ON invoice_items.item_id = services.id WHERE invoice_items.invoice_id = invoices.id AND invoice_items.type = 'service' AND services.status = 'SUSPENDED' AND services.suspension_reason = 'overdue') AND NOT EXISTS (SELECT 1 FROM invoice_reminders WHERE invoice_reminders.invoice_id = invoices.id AND invoice_reminders.stage = 'suspended') ORDER BY id;
+
+-- name: CreateInvoiceReminder :execrows
+INSERT INTO invoice_reminders (invoice_id, stage) VALUES ($1, $2) ON CONFLICT DO NOTHING;
+
 -- SERVICES --
 
 -- name: FindServiceByUser :many
@@ -195,7 +290,7 @@ SELECT services.*, users.name FROM services INNER JOIN users ON services.user_id
 SELECT * FROM services WHERE id = $1;
 
 -- name: CreateService :one
-INSERT INTO services (label, user_id, status, billing_cycle, price, extension, settings, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;
+INSERT INTO services (label, user_id, status, billing_cycle, price, extension, settings, expires_at, currency, discount, product_id, billing_cycle_months, billing_day, affiliate_id, order_ip, order_country, discount_rate) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17) RETURNING id;
 
 -- name: UpdateServiceLabel :exec
 UPDATE services SET label = $1 WHERE id = $2;
@@ -207,7 +302,7 @@ UPDATE services SET settings = $1 WHERE id = $2;
 UPDATE services SET status = $1 WHERE id = $2;
 
 -- name: UpdateService :exec
-UPDATE services SET label = $1, billing_cycle = $2, price = $3, expires_at = $4 WHERE id = $5;
+UPDATE services SET label = $1, billing_cycle = $2, price = $3, expires_at = $4, billing_cycle_months = $5, billing_day = $6 WHERE id = $7;
 
 -- name: DeleteService :exec
 DELETE FROM services WHERE id = $1;
@@ -216,18 +311,25 @@ DELETE FROM services WHERE id = $1;
 UPDATE services SET expires_at = $2 WHERE id = $1;
 
 -- name: CountServicesByServer :one
-SELECT COUNT(id) FROM services WHERE (status = 'PENDING' OR status = 'ACTIVE' OR status = 'SUSPENDED' OR status = 'UNPAID') AND (settings::jsonb ? 'server' AND (settings->>'server')::integer = @server::integer);
+SELECT COUNT(id) FROM services WHERE (status = 'PENDING' OR status = 'PENDING_REVIEW' OR status = 'ACTIVE' OR status = 'SUSPENDED' OR status = 'UNPAID') AND (settings::jsonb ? 'server' AND (settings->>'server')::integer = @server::integer);
 
 -- name: UpdateServiceCancelled :exec
 UPDATE services SET cancellation_reason = $1, cancelled_at = $2 WHERE id = $3;
 
+-- name: CountUserServicesSince :one
+SELECT COUNT(*) FROM services WHERE user_id = $1 AND created_at >= $2;
+
+-- name: UpdateServiceReviewReason :exec
+UPDATE services SET review_reason = $1 WHERE id = $2;
+
 -- name: FindOverdueServices :many
 SELECT * FROM services WHERE (status = 'SUSPENDED' OR status = 'ACTIVE' OR status = 'PENDING') AND expires_at <= CURRENT_TIMESTAMP ORDER BY id;
 
 -- name: FindServicesForRenewal :many
-SELECT * FROM services 
-WHERE (status = 'ACTIVE' OR status = 'SUSPENDED' OR status = 'PENDING') 
-AND expires_at <= (CURRENT_TIMESTAMP + interval '7 days') AND expires_at > CURRENT_TIMESTAMP
+SELECT services.* FROM services
+LEFT JOIN products ON services.product_id = products.id
+WHERE (services.status = 'ACTIVE' OR services.status = 'SUSPENDED' OR services.status = 'PENDING')
+AND services.expires_at <= (CURRENT_TIMESTAMP + make_interval(days => COALESCE(products.invoice_days_before_expiry, @default_days::integer))) AND services.expires_at > CURRENT_TIMESTAMP
 AND NOT EXISTS (
     SELECT 1 FROM invoices 
     JOIN invoice_items ON invoices.id = invoice_items.invoice_id 
@@ -236,6 +338,46 @@ AND NOT EXISTS (
     AND invoices.status = 'UNPAID'
 );
 
+-- name: UpdateServiceSuspensionReason :exec
+UPDATE services SET suspension_reason = $1 WHERE id = $2;
+
+-- name: UpdateServicePlan :exec
+UPDATE services SET product_id = $1, label = $2, price = $3, settings = $4 WHERE id = $5;
+
+-- name: CreateServiceUpgrade :one
+INSERT INTO service_upgrades (service_id, invoice_id, product_id, settings, price, amount, status) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id;
+
+-- name: FindServiceUpgradeByIdForUpdate :one
+SELECT * FROM service_upgrades WHERE id = $1 FOR UPDATE;
+
+-- name: UpdateServiceUpgradeStatus :exec
+UPDATE service_upgrades SET status = $1 WHERE id = $2;
+
+-- name: CountPendingServiceUpgrades :one
+SELECT COUNT(*) FROM service_upgrades INNER JOIN invoices ON service_upgrades.invoice_id = invoices.id WHERE service_upgrades.service_id = $1 AND service_upgrades.status = 'PENDING' AND invoices.status = 'UNPAID';
+
+-- name: UpdateServiceUsageBilledUntil :exec
+UPDATE services SET usage_billed_until = $1 WHERE id = $2;
+
+-- TRIALS --
+
+-- name: CreateTrial :exec
+INSERT INTO trials (product_id, user_id, email, service_id) VALUES ($1, $2, $3, $4);
+
+-- name: CountTrials :one
+SELECT COUNT(*) FROM trials WHERE product_id = $1 AND (user_id = $2 OR email = $3);
+
+-- name: CountUserGatewayPayments :one
+SELECT COUNT(*) FROM invoice_payments INNER JOIN invoices ON invoice_payments.invoice_id = invoices.id WHERE invoices.user_id = $1 AND invoice_payments.gateway <> 'Credit' AND invoice_payments.amount > 0;
+
+-- USAGE RECORDS --
+
+-- name: CreateUsageRecord :exec
+INSERT INTO usage_records (service_id, metric, quantity, recorded_at) VALUES ($1, $2, $3, $4);
+
+-- name: SumServiceUsage :many
+SELECT metric, SUM(quantity)::decimal AS quantity FROM usage_records WHERE service_id = $1 AND recorded_at >= $2 AND recorded_at < $3 GROUP BY metric ORDER BY metric;
+
 -- GATEWAYS --
 
 -- name: ListGateways :many
@@ -262,6 +404,30 @@ SELECT * FROM gateways WHERE id = $1;
 -- name: FindGatewayByName :one
 SELECT * FROM gateways WHERE name = $1;
 
+-- name: CreateGatewayOrder :exec
+INSERT INTO gateway_orders (gateway, order_id, invoice_id, status) VALUES ($1, $2, $3, $4);
+
+-- name: ListGatewayOrdersByStatus :many
+SELECT * FROM gateway_orders WHERE gateway = $1 AND status = $2 ORDER BY id ASC;
+
+-- name: UpdateGatewayOrderStatus :exec
+UPDATE gateway_orders SET status = $1 WHERE gateway = $2 AND order_id = $3;
+
+-- name: CreateGatewayRefund :one
+INSERT INTO gateway_refunds (payment_id, amount, description, status) VALUES ($1, $2, $3, $4) RETURNING id;
+
+-- name: FindGatewayRefund :one
+SELECT * FROM gateway_refunds WHERE id = $1 AND payment_id IN (SELECT id FROM invoice_payments WHERE invoice_id = $2);
+
+-- name: ListInvoiceGatewayRefunds :many
+SELECT * FROM gateway_refunds WHERE payment_id IN (SELECT id FROM invoice_payments WHERE invoice_id = $1) ORDER BY id ASC;
+
+-- name: UpdateGatewayRefund :exec
+UPDATE gateway_refunds SET status = $1, reference_id = $2, error = $3 WHERE id = $4;
+
+-- name: TotalPendingGatewayRefund :one
+SELECT COALESCE(SUM(amount), 0)::decimal FROM gateway_refunds WHERE payment_id = $1 AND status = 'PENDING';
+
 
 -- SERVERS --
 
@@ -284,6 +450,230 @@ SELECT * FROM servers WHERE id = $1;
 UPDATE servers SET settings = $1 WHERE id = $2;
 
 
+-- CREDIT --
+
+-- name: CreateCreditTransaction :one
+INSERT INTO credit_transactions (user_id, type, amount, description, invoice_id) VALUES ($1, $2, $3, $4, $5) RETURNING id;
+
+-- name: ListCreditTransactionsPaged :many
+SELECT * FROM credit_transactions WHERE user_id = $1 ORDER BY id DESC LIMIT $2 OFFSET $3;
+
+-- name: CountCreditTransactions :one
+SELECT COUNT(*) FROM credit_transactions WHERE user_id = $1;
+
+-- name: CreditOrCommissionsExist :one
+SELECT EXISTS (SELECT 1 FROM credit_transactions) OR EXISTS (SELECT 1 FROM commissions);
+
+
+-- CREDIT NOTES --
+
+-- name: CreateCreditNote :one
+INSERT INTO credit_notes (number, invoice_id, user_id, reason, subtotal, tax, amount, currency) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id;
+
+-- name: CreateCreditNoteItem :exec
+INSERT INTO credit_note_items (credit_note_id, description, amount) VALUES ($1, $2, $3);
+
+-- name: FindCreditNoteById :one
+SELECT * FROM credit_notes WHERE id = $1;
+
+-- name: ListCreditNoteItems :many
+SELECT * FROM credit_note_items WHERE credit_note_id = $1 ORDER BY id;
+
+-- name: ListCreditNotesByInvoice :many
+SELECT * FROM credit_notes WHERE invoice_id = $1 ORDER BY id;
+
+-- name: SearchCreditNotesPaged :many
+SELECT * FROM credit_notes WHERE (@user_id::integer = 0 OR user_id = @user_id::integer) ORDER BY id DESC LIMIT $1 OFFSET $2;
+
+-- name: CountCreditNotes :one
+SELECT COUNT(*) FROM credit_notes WHERE (@user_id::integer = 0 OR user_id = @user_id::integer);
+
+-- name: SumCreditNotesByInvoice :one
+SELECT COALESCE(SUM(amount), 0)::decimal FROM credit_notes WHERE invoice_id = $1;
+
+-- name: NextCreditNoteNumber :one
+INSERT INTO credit_note_number_sequences (period, last) VALUES ($1, 1) ON CONFLICT (period) DO UPDATE SET last = credit_note_number_sequences.last + 1 RETURNING last;
+
+-- name: FindInvoiceItem :one
+SELECT * FROM invoice_items WHERE id = $1 AND invoice_id = $2;
+
+-- TAX --
+
+-- name: ListTaxRules :many
+SELECT * FROM tax_rules ORDER BY country, state, id;
+
+-- name: FindTaxRuleById :one
+SELECT * FROM tax_rules WHERE id = $1;
+
+-- name: FindTaxRule :one
+SELECT * FROM tax_rules WHERE lower(country) = lower(@country::text) AND (state = '' OR lower(state) = lower(@state::text)) ORDER BY state DESC, id LIMIT 1;
+
+-- name: CreateTaxRule :one
+INSERT INTO tax_rules (name, country, state, rate, inclusive, reverse_charge) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id;
+
+-- name: UpdateTaxRule :exec
+UPDATE tax_rules SET name = $1, country = $2, state = $3, rate = $4, inclusive = $5, reverse_charge = $6 WHERE id = $7;
+
+-- name: DeleteTaxRule :exec
+DELETE FROM tax_rules WHERE id = $1;
+
+-- COUPONS --
+
+-- name: ListCoupons :many
+SELECT * FROM coupons ORDER BY id DESC;
+
+-- name: FindCouponById :one
+SELECT * FROM coupons WHERE id = $1;
+
+-- name: FindCouponByCode :one
+SELECT * FROM coupons WHERE lower(code) = lower(@code::text);
+
+-- name: FindCouponByIdForUpdate :one
+SELECT * FROM coupons WHERE id = $1 FOR UPDATE;
+
+-- name: CreateCoupon :one
+INSERT INTO coupons (code, type, value, currency, product_ids, durations, recurring, max_uses, max_uses_per_user, valid_from, valid_until, enabled) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id;
+
+-- name: UpdateCoupon :exec
+UPDATE coupons SET code = $1, type = $2, value = $3, currency = $4, product_ids = $5, durations = $6, recurring = $7, max_uses = $8, max_uses_per_user = $9, valid_from = $10, valid_until = $11, enabled = $12 WHERE id = $13;
+
+-- name: DeleteCoupon :exec
+DELETE FROM coupons WHERE id = $1;
+
+-- name: IncreaseCouponUses :exec
+UPDATE coupons SET uses = uses + 1 WHERE id = $1;
+
+-- name: CreateCouponUse :exec
+INSERT INTO coupon_uses (coupon_id, user_id, service_id) VALUES ($1, $2, $3);
+
+-- name: CountCouponUsesByUser :one
+SELECT COUNT(*) FROM coupon_uses WHERE coupon_id = $1 AND user_id = $2;
+
+-- COMMISSIONS --
+
+-- name: ListInvoiceCommissionBases :many
+SELECT services.id AS service_id, services.affiliate_id, services.product_id, SUM(invoice_items.amount)::decimal AS amount, EXISTS (SELECT 1 FROM invoice_items earlier INNER JOIN invoices ON earlier.invoice_id = invoices.id WHERE earlier.type = 'service' AND earlier.item_id = services.id AND earlier.invoice_id <> @invoice_id AND invoices.status IN ('PAID', 'PARTIALLY_REFUNDED', 'REFUNDED')) AS renewal FROM invoice_items LEFT JOIN service_upgrades ON invoice_items.type = 'upgrade' AND invoice_items.item_id = service_upgrades.id INNER JOIN services ON services.id = COALESCE(service_upgrades.service_id, invoice_items.item_id) WHERE invoice_items.invoice_id = @invoice_id AND invoice_items.type IN ('service', 'discount', 'upgrade', 'usage', 'proration') AND services.affiliate_id IS NOT NULL GROUP BY services.id ORDER BY services.id;
+
+-- name: CreateCommission :exec
+INSERT INTO commissions (affiliate_id, invoice_id, amount) VALUES ($1, $2, $3) ON CONFLICT (invoice_id, affiliate_id) DO NOTHING;
+
+-- name: ReverseCommissions :exec
+UPDATE commissions SET reversed = LEAST(amount, reversed + ROUND(amount * @fraction::decimal, 2)) WHERE invoice_id = @invoice_id;
+
+-- name: ListPayableCommissionsForUpdate :many
+SELECT * FROM commissions WHERE affiliate_id = @affiliate_id AND amount - reversed <> paid_out AND (created_at <= @held_until::timestamp OR amount - reversed < paid_out) ORDER BY id FOR UPDATE;
+
+-- name: UpdateCommissionPaidOut :exec
+UPDATE commissions SET paid_out = amount - reversed WHERE id = $1;
+
+-- name: AffiliateCommissionStats :one
+SELECT COALESCE(SUM(amount - reversed), 0)::decimal AS earned, COALESCE(SUM(paid_out), 0)::decimal AS paid_out, COALESCE(SUM(amount - reversed - paid_out) FILTER (WHERE (created_at <= @held_until::timestamp OR amount - reversed < paid_out)), 0)::decimal AS available, COALESCE(SUM(amount - reversed - paid_out) FILTER (WHERE NOT (created_at <= @held_until::timestamp OR amount - reversed < paid_out)), 0)::decimal AS pending FROM commissions WHERE affiliate_id = @affiliate_id;
+
+-- name: CountAffiliateServices :one
+SELECT COUNT(*) FROM services WHERE affiliate_id = $1;
+
+-- name: ListCommissionsPaged :many
+SELECT * FROM commissions WHERE affiliate_id = $1 ORDER BY id DESC LIMIT $2 OFFSET $3;
+
+-- name: CountCommissions :one
+SELECT COUNT(*) FROM commissions WHERE affiliate_id = $1;
+
+-- REPORTS --
+
+-- name: RevenueByPeriod :many
+SELECT date_trunc(@period::text, invoice_payments.created_at)::timestamp AS period, invoices.currency, SUM(invoice_payments.amount)::decimal AS amount FROM invoice_payments INNER JOIN invoices ON invoice_payments.invoice_id = invoices.id WHERE invoice_payments.gateway <> 'Credit' AND invoice_payments.created_at >= @start_at::timestamp AND invoice_payments.created_at < @end_at::timestamp GROUP BY period, invoices.currency ORDER BY period, invoices.currency;
+
+-- name: RevenueByGateway :many
+SELECT invoice_payments.gateway, invoices.currency, COALESCE(SUM(invoice_payments.amount) FILTER (WHERE invoice_payments.refund_of IS NULL), 0)::decimal AS paid, COALESCE(-SUM(invoice_payments.amount) FILTER (WHERE invoice_payments.refund_of IS NOT NULL), 0)::decimal AS refunded, COUNT(*) FILTER (WHERE invoice_payments.refund_of IS NULL) AS payments FROM invoice_payments INNER JOIN invoices ON invoice_payments.invoice_id = invoices.id WHERE invoice_payments.created_at >= @start_at::timestamp AND invoice_payments.created_at < @end_at::timestamp GROUP BY invoice_payments.gateway, invoices.currency ORDER BY invoice_payments.gateway, invoices.currency;
+
+-- name: RevenueByProduct :many
+SELECT services.product_id, COALESCE(products.name, '')::text AS product_name, invoices.currency, SUM(invoice_items.amount)::decimal AS amount FROM invoice_items INNER JOIN invoices ON invoice_items.invoice_id = invoices.id LEFT JOIN service_upgrades ON invoice_items.type = 'upgrade' AND invoice_items.item_id = service_upgrades.id INNER JOIN services ON services.id = COALESCE(service_upgrades.service_id, invoice_items.item_id) LEFT JOIN products ON services.product_id = products.id WHERE invoice_items.type IN ('service', 'discount', 'upgrade', 'usage', 'proration') AND invoices.status IN ('PAID', 'PARTIALLY_REFUNDED') AND invoices.paid_at >= @start_at::timestamp AND invoices.paid_at < @end_at::timestamp GROUP BY services.product_id, products.name, invoices.currency ORDER BY amount DESC;
+
+-- name: MonthlyRecurringRevenue :many
+SELECT currency, COUNT(*) AS services, COALESCE(SUM(CASE WHEN billing_cycle_months > 0 THEN GREATEST(price - CASE WHEN discount_rate > 0 THEN ROUND(price * discount_rate / 100, 2) ELSE discount END, 0) / billing_cycle_months ELSE GREATEST(price - CASE WHEN discount_rate > 0 THEN ROUND(price * discount_rate / 100, 2) ELSE discount END, 0) * 2629746 / billing_cycle END), 0)::decimal AS mrr FROM services WHERE status = 'ACTIVE' AND billing_cycle > 0 GROUP BY currency ORDER BY currency;
+
+-- name: ChurnByMonth :many
+SELECT date_trunc('month', cancelled_at)::timestamp AS period, currency, COUNT(*) AS cancellations, COALESCE(SUM(CASE WHEN billing_cycle_months > 0 THEN GREATEST(price - CASE WHEN discount_rate > 0 THEN ROUND(price * discount_rate / 100, 2) ELSE discount END, 0) / billing_cycle_months ELSE GREATEST(price - CASE WHEN discount_rate > 0 THEN ROUND(price * discount_rate / 100, 2) ELSE discount END, 0) * 2629746 / billing_cycle END) FILTER (WHERE billing_cycle > 0), 0)::decimal AS lost_mrr FROM services WHERE cancelled_at >= @start_at::timestamp AND cancelled_at < @end_at::timestamp AND cancellation_reason IS DISTINCT FROM 'invoice overdue' GROUP BY period, currency ORDER BY period, currency;
+
+-- name: CountServicesActiveAt :one
+SELECT COUNT(*) FROM services WHERE created_at < @at::timestamp AND (cancelled_at IS NULL OR cancelled_at >= @at::timestamp) AND status <> 'UNPAID' AND cancellation_reason IS DISTINCT FROM 'invoice overdue';
+
+-- name: OutstandingReceivables :many
+SELECT invoices.currency, COUNT(*) AS invoices, COALESCE(SUM(invoices.amount - COALESCE(payments.paid, 0)), 0)::decimal AS outstanding, COALESCE(SUM(invoices.amount - COALESCE(payments.paid, 0)) FILTER (WHERE invoices.due_at >= CURRENT_TIMESTAMP), 0)::decimal AS not_due, COALESCE(SUM(invoices.amount - COALESCE(payments.paid, 0)) FILTER (WHERE invoices.due_at < CURRENT_TIMESTAMP AND invoices.due_at >= CURRENT_TIMESTAMP - INTERVAL '30 days'), 0)::decimal AS overdue_30, COALESCE(SUM(invoices.amount - COALESCE(payments.paid, 0)) FILTER (WHERE invoices.due_at < CURRENT_TIMESTAMP - INTERVAL '30 days' AND invoices.due_at >= CURRENT_TIMESTAMP - INTERVAL '60 days'), 0)::decimal AS overdue_60, COALESCE(SUM(invoices.amount - COALESCE(payments.paid, 0)) FILTER (WHERE invoices.due_at < CURRENT_TIMESTAMP - INTERVAL '60 days' AND invoices.due_at >= CURRENT_TIMESTAMP - INTERVAL '90 days'), 0)::decimal AS overdue_90, COALESCE(SUM(invoices.amount - COALESCE(payments.paid, 0)) FILTER (WHERE invoices.due_at < CURRENT_TIMESTAMP - INTERVAL '90 days'), 0)::decimal AS overdue_over_90 FROM invoices LEFT JOIN (SELECT invoice_id, SUM(amount) AS paid FROM invoice_payments GROUP BY invoice_id) payments ON payments.invoice_id = invoices.id WHERE invoices.status = 'UNPAID' GROUP BY invoices.currency ORDER BY invoices.currency;
+
+-- name: ListStatementInvoices :many
+SELECT * FROM invoices WHERE user_id = @user_id AND (status <> 'CANCELLED' OR paid_at IS NOT NULL) AND created_at >= @start_at::timestamp AND created_at < @end_at::timestamp ORDER BY created_at, id;
+
+-- name: ListStatementPayments :many
+SELECT invoice_payments.id, invoice_payments.invoice_id, invoice_payments.created_at, invoice_payments.description, invoice_payments.amount, invoice_payments.gateway, invoice_payments.refund_of, invoices.currency, invoices.number FROM invoice_payments INNER JOIN invoices ON invoice_payments.invoice_id = invoices.id WHERE invoices.user_id = @user_id AND invoice_payments.created_at >= @start_at::timestamp AND invoice_payments.created_at < @end_at::timestamp ORDER BY invoice_payments.created_at, invoice_payments.id;
+
+-- name: ListStatementCreditNotes :many
+SELECT * FROM credit_notes WHERE user_id = @user_id AND created_at >= @start_at::timestamp AND created_at < @end_at::timestamp ORDER BY created_at, id;
+
+-- name: StatementBalance :many
+SELECT currency, SUM(amount)::decimal AS balance FROM (SELECT invoices.currency, invoices.amount FROM invoices WHERE invoices.user_id = @user_id AND (invoices.status <> 'CANCELLED' OR invoices.paid_at IS NOT NULL) AND invoices.created_at < @at::timestamp UNION ALL SELECT invoices.currency, -invoice_payments.amount FROM invoice_payments INNER JOIN invoices ON invoice_payments.invoice_id = invoices.id WHERE invoices.user_id = @user_id AND invoice_payments.created_at < @at::timestamp UNION ALL SELECT credit_notes.currency, -credit_notes.amount FROM credit_notes WHERE credit_notes.user_id = @user_id AND credit_notes.created_at < @at::timestamp) entries GROUP BY currency ORDER BY currency;
+
+-- EXPORTS --
+
+-- name: ExportInvoices :many
+SELECT invoices.id, invoices.number, invoices.user_id, users.email, users.name, invoices.status, invoices.created_at, invoices.due_at, invoices.paid_at, invoices.currency, invoices.subtotal, invoices.tax, invoices.tax_name, invoices.tax_rate, invoices.tax_inclusive, invoices.amount FROM invoices INNER JOIN users ON invoices.user_id = users.id WHERE (CASE WHEN @cash_basis::boolean THEN invoices.paid_at ELSE invoices.created_at END) >= @start_at::timestamp AND (CASE WHEN @cash_basis::boolean THEN invoices.paid_at ELSE invoices.created_at END) < @end_at::timestamp AND (invoices.status <> 'CANCELLED' OR invoices.paid_at IS NOT NULL) ORDER BY invoices.id;
+
+-- name: ExportInvoiceItems :many
+SELECT invoice_items.id, invoice_items.invoice_id, invoices.number, users.email, users.name, invoices.created_at, invoices.due_at, invoices.paid_at, invoices.currency, invoice_items.description, invoice_items.amount, invoice_items.type, invoice_items.item_id, invoices.tax_name, invoices.tax_rate, invoices.tax_inclusive FROM invoice_items INNER JOIN invoices ON invoice_items.invoice_id = invoices.id INNER JOIN users ON invoices.user_id = users.id WHERE (CASE WHEN @cash_basis::boolean THEN invoices.paid_at ELSE invoices.created_at END) >= @start_at::timestamp AND (CASE WHEN @cash_basis::boolean THEN invoices.paid_at ELSE invoices.created_at END) < @end_at::timestamp AND (invoices.status <> 'CANCELLED' OR invoices.paid_at IS NOT NULL) ORDER BY invoices.id, invoice_items.id;
+
+-- name: ExportPayments :many
+SELECT invoice_payments.id, invoice_payments.invoice_id, invoices.number, users.email, users.name, invoice_payments.created_at, invoice_payments.description, invoice_payments.amount, invoice_payments.reference_id, invoice_payments.gateway, invoice_payments.refund_of, invoices.currency FROM invoice_payments INNER JOIN invoices ON invoice_payments.invoice_id = invoices.id INNER JOIN users ON invoices.user_id = users.id WHERE invoice_payments.created_at >= @start_at::timestamp AND invoice_payments.created_at < @end_at::timestamp ORDER BY invoice_payments.created_at, invoice_payments.id;
+
+-- name: ExportJournal :many
+SELECT entries.date, entries.type, entries.id, entries.invoice_id, entries.number, users.name, entries.currency, entries.subtotal, entries.tax, entries.amount, entries.gateway, entries.description FROM (SELECT (CASE WHEN @cash_basis::boolean THEN invoices.paid_at ELSE invoices.created_at END)::timestamp AS date, 'invoice'::text AS type, invoices.id, invoices.id AS invoice_id, invoices.number, invoices.user_id, invoices.currency, invoices.subtotal, invoices.tax, invoices.amount, ''::text AS gateway, ''::text AS description FROM invoices WHERE (CASE WHEN @cash_basis::boolean THEN invoices.paid_at ELSE invoices.created_at END) >= @start_at::timestamp AND (CASE WHEN @cash_basis::boolean THEN invoices.paid_at ELSE invoices.created_at END) < @end_at::timestamp AND (invoices.status <> 'CANCELLED' OR invoices.paid_at IS NOT NULL) UNION ALL SELECT invoice_payments.created_at, CASE WHEN invoice_payments.refund_of IS NULL THEN 'payment' ELSE 'refund' END, invoice_payments.id, invoices.id, invoices.number, invoices.user_id, invoices.currency, invoice_payments.amount, 0, invoice_payments.amount, invoice_payments.gateway, invoice_payments.description FROM invoice_payments INNER JOIN invoices ON invoice_payments.invoice_id = invoices.id WHERE invoice_payments.created_at >= @start_at::timestamp AND invoice_payments.created_at < @end_at::timestamp UNION ALL SELECT credit_notes.created_at, 'credit_note', credit_notes.id, credit_notes.invoice_id, credit_notes.number, credit_notes.user_id, credit_notes.currency, credit_notes.subtotal, credit_notes.tax, credit_notes.amount, '', credit_notes.reason FROM credit_notes WHERE credit_notes.created_at >= @start_at::timestamp AND credit_notes.created_at < @end_at::timestamp) entries INNER JOIN users ON entries.user_id = users.id ORDER BY entries.date, entries.type, entries.id;
+
+-- CARTS --
+
+-- name: FindCartByToken :one
+SELECT * FROM carts WHERE token = $1;
+
+-- name: FindCartByUser :one
+SELECT * FROM carts WHERE user_id = $1;
+
+-- name: FindCartByIdForUpdate :one
+SELECT * FROM carts WHERE id = $1 FOR UPDATE;
+
+-- name: CreateCart :one
+INSERT INTO carts (token, user_id) VALUES ($1, $2) RETURNING *;
+
+-- name: UpdateCartUser :exec
+UPDATE carts SET user_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2;
+
+-- name: TouchCart :exec
+UPDATE carts SET updated_at = CURRENT_TIMESTAMP WHERE id = $1;
+
+-- name: DeleteCart :exec
+DELETE FROM carts WHERE id = $1;
+
+-- name: DeleteStaleGuestCarts :execrows
+DELETE FROM carts WHERE user_id IS NULL AND updated_at < @before::timestamp;
+
+-- name: ListCartItems :many
+SELECT * FROM cart_items WHERE cart_id = $1 ORDER BY id;
+
+-- name: CountCartItems :one
+SELECT COUNT(*) FROM cart_items WHERE cart_id = $1;
+
+-- name: CreateCartItem :one
+INSERT INTO cart_items (cart_id, product_id, duration, options, coupon) VALUES ($1, $2, $3, $4, $5) RETURNING id;
+
+-- name: UpdateCartItem :execrows
+UPDATE cart_items SET duration = @duration, options = @options, coupon = @coupon WHERE id = @id AND cart_id = @cart_id;
+
+-- name: DeleteCartItem :execrows
+DELETE FROM cart_items WHERE id = @id AND cart_id = @cart_id;
+
+-- name: DeleteCartItems :exec
+DELETE FROM cart_items WHERE cart_id = $1;
+
+-- name: MoveCartItems :exec
+UPDATE cart_items SET cart_id = @to_cart_id WHERE cart_id = @from_cart_id;
+
 -- SETTINGS --
 
 -- name: FindSettingByKey :one
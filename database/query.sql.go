@@ -14,7 +14,7 @@ import (
 )
 
 const addInvoicePayment = `-- name: AddInvoicePayment :one
-INSERT INTO invoice_payments (invoice_id, description, amount, reference_id, gateway) VALUES ($1, $2, $3, $4, $5) RETURNING id
+INSERT INTO invoice_payments (invoice_id, description, amount, reference_id, gateway) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (gateway, reference_id) WHERE reference_id <> '' DO NOTHING RETURNING id
 `
 
 type AddInvoicePaymentParams struct {
@@ -38,6 +38,61 @@ func (q *Queries) AddInvoicePayment(ctx context.Context, arg AddInvoicePaymentPa
 	return id, err
 }
 
+const addInvoiceRefund = `-- name: AddInvoiceRefund :one
+INSERT INTO invoice_payments (invoice_id, description, amount, reference_id, gateway, refund_of) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT (gateway, reference_id) WHERE reference_id <> '' DO NOTHING RETURNING id
+`
+
+type AddInvoiceRefundParams struct {
+	InvoiceID   int32           `json:"invoice_id"`
+	Description string          `json:"description"`
+	Amount      decimal.Decimal `json:"amount"`
+	ReferenceID string          `json:"reference_id"`
+	Gateway     string          `json:"gateway"`
+	RefundOf    pgtype.Int4     `json:"refund_of"`
+}
+
+func (q *Queries) AddInvoiceRefund(ctx context.Context, arg AddInvoiceRefundParams) (int32, error) {
+	row := q.db.QueryRow(ctx, addInvoiceRefund,
+		arg.InvoiceID,
+		arg.Description,
+		arg.Amount,
+		arg.ReferenceID,
+		arg.Gateway,
+		arg.RefundOf,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const affiliateCommissionStats = `-- name: AffiliateCommissionStats :one
+SELECT COALESCE(SUM(amount - reversed), 0)::decimal AS earned, COALESCE(SUM(paid_out), 0)::decimal AS paid_out, COALESCE(SUM(amount - reversed - paid_out) FILTER (WHERE (created_at <= $1::timestamp OR amount - reversed < paid_out)), 0)::decimal AS available, COALESCE(SUM(amount - reversed - paid_out) FILTER (WHERE NOT (created_at <= $1::timestamp OR amount - reversed < paid_out)), 0)::decimal AS pending FROM commissions WHERE affiliate_id = $2
+`
+
+type AffiliateCommissionStatsParams struct {
+	HeldUntil   types.Timestamp `json:"held_until"`
+	AffiliateID int32           `json:"affiliate_id"`
+}
+
+type AffiliateCommissionStatsRow struct {
+	Earned    decimal.Decimal `json:"earned"`
+	PaidOut   decimal.Decimal `json:"paid_out"`
+	Available decimal.Decimal `json:"available"`
+	Pending   decimal.Decimal `json:"pending"`
+}
+
+func (q *Queries) AffiliateCommissionStats(ctx context.Context, arg AffiliateCommissionStatsParams) (AffiliateCommissionStatsRow, error) {
+	row := q.db.QueryRow(ctx, affiliateCommissionStats, arg.HeldUntil, arg.AffiliateID)
+	var i AffiliateCommissionStatsRow
+	err := row.Scan(
+		&i.Earned,
+		&i.PaidOut,
+		&i.Available,
+		&i.Pending,
+	)
+	return i, err
+}
+
 const attemptDecreaseProductStock = `-- name: AttemptDecreaseProductStock :execrows
 UPDATE products SET stock = stock - 1 WHERE id = $1 AND stock_control = 2 AND stock > 0
 `
@@ -50,8 +105,183 @@ func (q *Queries) AttemptDecreaseProductStock(ctx context.Context, id int32) (in
 	return result.RowsAffected(), nil
 }
 
+const cancelUnpaidInvoicesForService = `-- name: CancelUnpaidInvoicesForService :exec
+UPDATE invoices SET status = 'CANCELLED', cancellation_reason = $1 WHERE status = 'UNPAID' AND id IN (SELECT invoice_id FROM invoice_items WHERE invoice_items.type = 'service' AND invoice_items.item_id = $2)
+`
+
+type CancelUnpaidInvoicesForServiceParams struct {
+	CancellationReason pgtype.Text `json:"cancellation_reason"`
+	ServiceID          pgtype.Int4 `json:"service_id"`
+}
+
+func (q *Queries) CancelUnpaidInvoicesForService(ctx context.Context, arg CancelUnpaidInvoicesForServiceParams) error {
+	_, err := q.db.Exec(ctx, cancelUnpaidInvoicesForService, arg.CancellationReason, arg.ServiceID)
+	return err
+}
+
+const churnByMonth = `-- name: ChurnByMonth :many
+SELECT date_trunc('month', cancelled_at)::timestamp AS period, currency, COUNT(*) AS cancellations, COALESCE(SUM(CASE WHEN billing_cycle_months > 0 THEN GREATEST(price - CASE WHEN discount_rate > 0 THEN ROUND(price * discount_rate / 100, 2) ELSE discount END, 0) / billing_cycle_months ELSE GREATEST(price - CASE WHEN discount_rate > 0 THEN ROUND(price * discount_rate / 100, 2) ELSE discount END, 0) * 2629746 / billing_cycle END) FILTER (WHERE billing_cycle > 0), 0)::decimal AS lost_mrr FROM services WHERE cancelled_at >= $1::timestamp AND cancelled_at < $2::timestamp AND cancellation_reason IS DISTINCT FROM 'invoice overdue' GROUP BY period, currency ORDER BY period, currency
+`
+
+type ChurnByMonthParams struct {
+	StartAt types.Timestamp `json:"start_at"`
+	EndAt   types.Timestamp `json:"end_at"`
+}
+
+type ChurnByMonthRow struct {
+	Period        types.Timestamp `json:"period"`
+	Currency      string          `json:"currency"`
+	Cancellations int64           `json:"cancellations"`
+	LostMrr       decimal.Decimal `json:"lost_mrr"`
+}
+
+func (q *Queries) ChurnByMonth(ctx context.Context, arg ChurnByMonthParams) ([]ChurnByMonthRow, error) {
+	rows, err := q.db.Query(ctx, churnByMonth, arg.StartAt, arg.EndAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ChurnByMonthRow{}
+	for rows.Next() {
+		var i ChurnByMonthRow
+		if err := rows.Scan(
+			&i.Period,
+			&i.Currency,
+			&i.Cancellations,
+			&i.LostMrr,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countAffiliateServices = `-- name: CountAffiliateServices :one
+SELECT COUNT(*) FROM services WHERE affiliate_id = $1
+`
+
+func (q *Queries) CountAffiliateServices(ctx context.Context, affiliateID pgtype.Int4) (int64, error) {
+	row := q.db.QueryRow(ctx, countAffiliateServices, affiliateID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countCartItems = `-- name: CountCartItems :one
+SELECT COUNT(*) FROM cart_items WHERE cart_id = $1
+`
+
+func (q *Queries) CountCartItems(ctx context.Context, cartID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, countCartItems, cartID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countCommissions = `-- name: CountCommissions :one
+SELECT COUNT(*) FROM commissions WHERE affiliate_id = $1
+`
+
+func (q *Queries) CountCommissions(ctx context.Context, affiliateID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, countCommissions, affiliateID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countCouponUsesByUser = `-- name: CountCouponUsesByUser :one
+SELECT COUNT(*) FROM coupon_uses WHERE coupon_id = $1 AND user_id = $2
+`
+
+type CountCouponUsesByUserParams struct {
+	CouponID int32 `json:"coupon_id"`
+	UserID   int32 `json:"user_id"`
+}
+
+func (q *Queries) CountCouponUsesByUser(ctx context.Context, arg CountCouponUsesByUserParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countCouponUsesByUser, arg.CouponID, arg.UserID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countCreditNotes = `-- name: CountCreditNotes :one
+SELECT COUNT(*) FROM credit_notes WHERE ($1::integer = 0 OR user_id = $1::integer)
+`
+
+func (q *Queries) CountCreditNotes(ctx context.Context, userID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, countCreditNotes, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countCreditTransactions = `-- name: CountCreditTransactions :one
+SELECT COUNT(*) FROM credit_transactions WHERE user_id = $1
+`
+
+func (q *Queries) CountCreditTransactions(ctx context.Context, userID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, countCreditTransactions, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countInvoiceItemsByType = `-- name: CountInvoiceItemsByType :one
+SELECT COUNT(*) FROM invoice_items WHERE invoice_id = $1 AND type = $2
+`
+
+type CountInvoiceItemsByTypeParams struct {
+	InvoiceID int32  `json:"invoice_id"`
+	Type      string `json:"type"`
+}
+
+func (q *Queries) CountInvoiceItemsByType(ctx context.Context, arg CountInvoiceItemsByTypeParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countInvoiceItemsByType, arg.InvoiceID, arg.Type)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countPendingServiceUpgrades = `-- name: CountPendingServiceUpgrades :one
+SELECT COUNT(*) FROM service_upgrades INNER JOIN invoices ON service_upgrades.invoice_id = invoices.id WHERE service_upgrades.service_id = $1 AND service_upgrades.status = 'PENDING' AND invoices.status = 'UNPAID'
+`
+
+func (q *Queries) CountPendingServiceUpgrades(ctx context.Context, serviceID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, countPendingServiceUpgrades, serviceID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countReferredUsers = `-- name: CountReferredUsers :one
+SELECT COUNT(*) FROM users WHERE referred_by = $1
+`
+
+func (q *Queries) CountReferredUsers(ctx context.Context, referredBy pgtype.Int4) (int64, error) {
+	row := q.db.QueryRow(ctx, countReferredUsers, referredBy)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countServicesActiveAt = `-- name: CountServicesActiveAt :one
+SELECT COUNT(*) FROM services WHERE created_at < $1::timestamp AND (cancelled_at IS NULL OR cancelled_at >= $1::timestamp) AND status <> 'UNPAID' AND cancellation_reason IS DISTINCT FROM 'invoice overdue'
+`
+
+func (q *Queries) CountServicesActiveAt(ctx context.Context, at types.Timestamp) (int64, error) {
+	row := q.db.QueryRow(ctx, countServicesActiveAt, at)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const countServicesByServer = `-- name: CountServicesByServer :one
-SELECT COUNT(id) FROM services WHERE (status = 'PENDING' OR status = 'ACTIVE' OR status = 'SUSPENDED' OR status = 'UNPAID') AND (settings::jsonb ? 'server' AND (settings->>'server')::integer = $1::integer)
+SELECT COUNT(id) FROM services WHERE (status = 'PENDING' OR status = 'PENDING_REVIEW' OR status = 'ACTIVE' OR status = 'SUSPENDED' OR status = 'UNPAID') AND (settings::jsonb ? 'server' AND (settings->>'server')::integer = $1::integer)
 `
 
 func (q *Queries) CountServicesByServer(ctx context.Context, server int32) (int64, error) {
@@ -84,6 +314,23 @@ func (q *Queries) CountServicesPaged(ctx context.Context, arg CountServicesPaged
 	return count, err
 }
 
+const countTrials = `-- name: CountTrials :one
+SELECT COUNT(*) FROM trials WHERE product_id = $1 AND (user_id = $2 OR email = $3)
+`
+
+type CountTrialsParams struct {
+	ProductID int32       `json:"product_id"`
+	UserID    pgtype.Int4 `json:"user_id"`
+	Email     string      `json:"email"`
+}
+
+func (q *Queries) CountTrials(ctx context.Context, arg CountTrialsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countTrials, arg.ProductID, arg.UserID, arg.Email)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const countUnpaidInvoiceForService = `-- name: CountUnpaidInvoiceForService :one
 
 SELECT COUNT(*) FROM invoices INNER JOIN invoice_items ON invoices.id = invoice_items.invoice_id WHERE invoice_items.item_id = $1 AND invoice_items.type = 'service' AND invoices.status = 'UNPAID'
@@ -97,6 +344,33 @@ func (q *Queries) CountUnpaidInvoiceForService(ctx context.Context, itemID pgtyp
 	return count, err
 }
 
+const countUserGatewayPayments = `-- name: CountUserGatewayPayments :one
+SELECT COUNT(*) FROM invoice_payments INNER JOIN invoices ON invoice_payments.invoice_id = invoices.id WHERE invoices.user_id = $1 AND invoice_payments.gateway <> 'Credit' AND invoice_payments.amount > 0
+`
+
+func (q *Queries) CountUserGatewayPayments(ctx context.Context, userID int32) (int64, error) {
+	row := q.db.QueryRow(ctx, countUserGatewayPayments, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countUserServicesSince = `-- name: CountUserServicesSince :one
+SELECT COUNT(*) FROM services WHERE user_id = $1 AND created_at >= $2
+`
+
+type CountUserServicesSinceParams struct {
+	UserID    int32           `json:"user_id"`
+	CreatedAt types.Timestamp `json:"created_at"`
+}
+
+func (q *Queries) CountUserServicesSince(ctx context.Context, arg CountUserServicesSinceParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countUserServicesSince, arg.UserID, arg.CreatedAt)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const countUsers = `-- name: CountUsers :one
 SELECT COUNT(id) FROM users
 `
@@ -108,6 +382,52 @@ func (q *Queries) CountUsers(ctx context.Context) (int64, error) {
 	return count, err
 }
 
+const createCart = `-- name: CreateCart :one
+INSERT INTO carts (token, user_id) VALUES ($1, $2) RETURNING id, token, user_id, updated_at
+`
+
+type CreateCartParams struct {
+	Token  string      `json:"token"`
+	UserID pgtype.Int4 `json:"user_id"`
+}
+
+func (q *Queries) CreateCart(ctx context.Context, arg CreateCartParams) (Cart, error) {
+	row := q.db.QueryRow(ctx, createCart, arg.Token, arg.UserID)
+	var i Cart
+	err := row.Scan(
+		&i.ID,
+		&i.Token,
+		&i.UserID,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const createCartItem = `-- name: CreateCartItem :one
+INSERT INTO cart_items (cart_id, product_id, duration, options, coupon) VALUES ($1, $2, $3, $4, $5) RETURNING id
+`
+
+type CreateCartItemParams struct {
+	CartID    int32                 `json:"cart_id"`
+	ProductID int32                 `json:"product_id"`
+	Duration  int32                 `json:"duration"`
+	Options   types.CartItemOptions `json:"options"`
+	Coupon    string                `json:"coupon"`
+}
+
+func (q *Queries) CreateCartItem(ctx context.Context, arg CreateCartItemParams) (int32, error) {
+	row := q.db.QueryRow(ctx, createCartItem,
+		arg.CartID,
+		arg.ProductID,
+		arg.Duration,
+		arg.Options,
+		arg.Coupon,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
 const createCategory = `-- name: CreateCategory :one
 INSERT INTO categories (name, description) VALUES ($1, $2) RETURNING id
 `
@@ -124,110 +444,343 @@ func (q *Queries) CreateCategory(ctx context.Context, arg CreateCategoryParams)
 	return id, err
 }
 
-const createGatewayOrIgnore = `-- name: CreateGatewayOrIgnore :exec
-INSERT INTO gateways (name, display_name, settings, enabled, fee) VALUES ($1, $1, '{}'::json, false, '0.00%') ON CONFLICT DO NOTHING
+const createCommission = `-- name: CreateCommission :exec
+INSERT INTO commissions (affiliate_id, invoice_id, amount) VALUES ($1, $2, $3) ON CONFLICT (invoice_id, affiliate_id) DO NOTHING
 `
 
-func (q *Queries) CreateGatewayOrIgnore(ctx context.Context, name string) error {
-	_, err := q.db.Exec(ctx, createGatewayOrIgnore, name)
+type CreateCommissionParams struct {
+	AffiliateID int32           `json:"affiliate_id"`
+	InvoiceID   int32           `json:"invoice_id"`
+	Amount      decimal.Decimal `json:"amount"`
+}
+
+func (q *Queries) CreateCommission(ctx context.Context, arg CreateCommissionParams) error {
+	_, err := q.db.Exec(ctx, createCommission, arg.AffiliateID, arg.InvoiceID, arg.Amount)
 	return err
 }
 
-const createInvoice = `-- name: CreateInvoice :one
-INSERT INTO invoices (user_id, status, cancellation_reason, paid_at, due_at, amount) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id
+const createCoupon = `-- name: CreateCoupon :one
+INSERT INTO coupons (code, type, value, currency, product_ids, durations, recurring, max_uses, max_uses_per_user, valid_from, valid_until, enabled) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id
 `
 
-type CreateInvoiceParams struct {
-	UserID             int32           `json:"user_id"`
-	Status             string          `json:"status"`
-	CancellationReason pgtype.Text     `json:"cancellation_reason"`
-	PaidAt             types.Timestamp `json:"paid_at"`
-	DueAt              types.Timestamp `json:"due_at"`
-	Amount             decimal.Decimal `json:"amount"`
-}
-
-func (q *Queries) CreateInvoice(ctx context.Context, arg CreateInvoiceParams) (int32, error) {
-	row := q.db.QueryRow(ctx, createInvoice,
-		arg.UserID,
-		arg.Status,
-		arg.CancellationReason,
-		arg.PaidAt,
-		arg.DueAt,
-		arg.Amount,
+type CreateCouponParams struct {
+	Code           string          `json:"code"`
+	Type           string          `json:"type"`
+	Value          decimal.Decimal `json:"value"`
+	Currency       string          `json:"currency"`
+	ProductIds     []int32         `json:"product_ids"`
+	Durations      []int32         `json:"durations"`
+	Recurring      bool            `json:"recurring"`
+	MaxUses        int32           `json:"max_uses"`
+	MaxUsesPerUser int32           `json:"max_uses_per_user"`
+	ValidFrom      types.Timestamp `json:"valid_from"`
+	ValidUntil     types.Timestamp `json:"valid_until"`
+	Enabled        bool            `json:"enabled"`
+}
+
+func (q *Queries) CreateCoupon(ctx context.Context, arg CreateCouponParams) (int32, error) {
+	row := q.db.QueryRow(ctx, createCoupon,
+		arg.Code,
+		arg.Type,
+		arg.Value,
+		arg.Currency,
+		arg.ProductIds,
+		arg.Durations,
+		arg.Recurring,
+		arg.MaxUses,
+		arg.MaxUsesPerUser,
+		arg.ValidFrom,
+		arg.ValidUntil,
+		arg.Enabled,
 	)
 	var id int32
 	err := row.Scan(&id)
 	return id, err
 }
 
-const createInvoiceItem = `-- name: CreateInvoiceItem :exec
-INSERT INTO invoice_items (invoice_id, description, amount, type, item_id) VALUES ($1, $2, $3, $4, $5)
+const createCouponUse = `-- name: CreateCouponUse :exec
+INSERT INTO coupon_uses (coupon_id, user_id, service_id) VALUES ($1, $2, $3)
 `
 
-type CreateInvoiceItemParams struct {
-	InvoiceID   int32           `json:"invoice_id"`
-	Description string          `json:"description"`
-	Amount      decimal.Decimal `json:"amount"`
-	Type        string          `json:"type"`
-	ItemID      pgtype.Int4     `json:"item_id"`
+type CreateCouponUseParams struct {
+	CouponID  int32       `json:"coupon_id"`
+	UserID    int32       `json:"user_id"`
+	ServiceID pgtype.Int4 `json:"service_id"`
 }
 
-func (q *Queries) CreateInvoiceItem(ctx context.Context, arg CreateInvoiceItemParams) error {
-	_, err := q.db.Exec(ctx, createInvoiceItem,
-		arg.InvoiceID,
-		arg.Description,
-		arg.Amount,
-		arg.Type,
-		arg.ItemID,
-	)
+func (q *Queries) CreateCouponUse(ctx context.Context, arg CreateCouponUseParams) error {
+	_, err := q.db.Exec(ctx, createCouponUse, arg.CouponID, arg.UserID, arg.ServiceID)
 	return err
 }
 
-const createProduct = `-- name: CreateProduct :one
-INSERT INTO products (name, description, category_id, extension, enabled, pricing, settings, stock, stock_control) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id
+const createCreditNote = `-- name: CreateCreditNote :one
+INSERT INTO credit_notes (number, invoice_id, user_id, reason, subtotal, tax, amount, currency) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id
 `
 
-type CreateProductParams struct {
-	Name         string                `json:"name"`
-	Description  string                `json:"description"`
-	CategoryID   int32                 `json:"category_id"`
-	Extension    string                `json:"extension"`
-	Enabled      bool                  `json:"enabled"`
-	Pricing      types.ProductPrices   `json:"pricing"`
-	Settings     types.ProductSettings `json:"settings"`
-	Stock        int32                 `json:"stock"`
-	StockControl int32                 `json:"stock_control"`
+type CreateCreditNoteParams struct {
+	Number    string          `json:"number"`
+	InvoiceID int32           `json:"invoice_id"`
+	UserID    int32           `json:"user_id"`
+	Reason    string          `json:"reason"`
+	Subtotal  decimal.Decimal `json:"subtotal"`
+	Tax       decimal.Decimal `json:"tax"`
+	Amount    decimal.Decimal `json:"amount"`
+	Currency  string          `json:"currency"`
 }
 
-func (q *Queries) CreateProduct(ctx context.Context, arg CreateProductParams) (int32, error) {
-	row := q.db.QueryRow(ctx, createProduct,
-		arg.Name,
-		arg.Description,
-		arg.CategoryID,
-		arg.Extension,
-		arg.Enabled,
-		arg.Pricing,
-		arg.Settings,
-		arg.Stock,
-		arg.StockControl,
+func (q *Queries) CreateCreditNote(ctx context.Context, arg CreateCreditNoteParams) (int32, error) {
+	row := q.db.QueryRow(ctx, createCreditNote,
+		arg.Number,
+		arg.InvoiceID,
+		arg.UserID,
+		arg.Reason,
+		arg.Subtotal,
+		arg.Tax,
+		arg.Amount,
+		arg.Currency,
 	)
 	var id int32
 	err := row.Scan(&id)
 	return id, err
 }
 
-const createProductOption = `-- name: CreateProductOption :exec
-INSERT INTO product_options (product_id, name, display_name, type, regex, values, description) VALUES ($1, $2, $3, $4, $5, $6, $7)
+const createCreditNoteItem = `-- name: CreateCreditNoteItem :exec
+INSERT INTO credit_note_items (credit_note_id, description, amount) VALUES ($1, $2, $3)
 `
 
-type CreateProductOptionParams struct {
-	ProductID   int32                     `json:"product_id"`
-	Name        string                    `json:"name"`
-	DisplayName string                    `json:"display_name"`
-	Type        string                    `json:"type"`
-	Regex       string                    `json:"regex"`
-	Values      types.ProductOptionValues `json:"values"`
-	Description string                    `json:"description"`
+type CreateCreditNoteItemParams struct {
+	CreditNoteID int32           `json:"credit_note_id"`
+	Description  string          `json:"description"`
+	Amount       decimal.Decimal `json:"amount"`
+}
+
+func (q *Queries) CreateCreditNoteItem(ctx context.Context, arg CreateCreditNoteItemParams) error {
+	_, err := q.db.Exec(ctx, createCreditNoteItem, arg.CreditNoteID, arg.Description, arg.Amount)
+	return err
+}
+
+const createCreditTransaction = `-- name: CreateCreditTransaction :one
+
+INSERT INTO credit_transactions (user_id, type, amount, description, invoice_id) VALUES ($1, $2, $3, $4, $5) RETURNING id
+`
+
+type CreateCreditTransactionParams struct {
+	UserID      int32           `json:"user_id"`
+	Type        string          `json:"type"`
+	Amount      decimal.Decimal `json:"amount"`
+	Description string          `json:"description"`
+	InvoiceID   pgtype.Int4     `json:"invoice_id"`
+}
+
+// CREDIT --
+func (q *Queries) CreateCreditTransaction(ctx context.Context, arg CreateCreditTransactionParams) (int32, error) {
+	row := q.db.QueryRow(ctx, createCreditTransaction,
+		arg.UserID,
+		arg.Type,
+		arg.Amount,
+		arg.Description,
+		arg.InvoiceID,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createGatewayOrIgnore = `-- name: CreateGatewayOrIgnore :exec
+INSERT INTO gateways (name, display_name, settings, enabled, fee) VALUES ($1, $1, '{}'::json, false, '0.00%') ON CONFLICT DO NOTHING
+`
+
+func (q *Queries) CreateGatewayOrIgnore(ctx context.Context, name string) error {
+	_, err := q.db.Exec(ctx, createGatewayOrIgnore, name)
+	return err
+}
+
+const createGatewayOrder = `-- name: CreateGatewayOrder :exec
+INSERT INTO gateway_orders (gateway, order_id, invoice_id, status) VALUES ($1, $2, $3, $4)
+`
+
+type CreateGatewayOrderParams struct {
+	Gateway   string `json:"gateway"`
+	OrderID   string `json:"order_id"`
+	InvoiceID int32  `json:"invoice_id"`
+	Status    string `json:"status"`
+}
+
+func (q *Queries) CreateGatewayOrder(ctx context.Context, arg CreateGatewayOrderParams) error {
+	_, err := q.db.Exec(ctx, createGatewayOrder,
+		arg.Gateway,
+		arg.OrderID,
+		arg.InvoiceID,
+		arg.Status,
+	)
+	return err
+}
+
+const createGatewayRefund = `-- name: CreateGatewayRefund :one
+INSERT INTO gateway_refunds (payment_id, amount, description, status) VALUES ($1, $2, $3, $4) RETURNING id
+`
+
+type CreateGatewayRefundParams struct {
+	PaymentID   int32           `json:"payment_id"`
+	Amount      decimal.Decimal `json:"amount"`
+	Description string          `json:"description"`
+	Status      string          `json:"status"`
+}
+
+func (q *Queries) CreateGatewayRefund(ctx context.Context, arg CreateGatewayRefundParams) (int32, error) {
+	row := q.db.QueryRow(ctx, createGatewayRefund,
+		arg.PaymentID,
+		arg.Amount,
+		arg.Description,
+		arg.Status,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createInvoice = `-- name: CreateInvoice :one
+INSERT INTO invoices (user_id, status, cancellation_reason, paid_at, due_at, amount, currency, tax_rate, tax_name, tax_inclusive, reverse_charge) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11) RETURNING id
+`
+
+type CreateInvoiceParams struct {
+	UserID             int32           `json:"user_id"`
+	Status             string          `json:"status"`
+	CancellationReason pgtype.Text     `json:"cancellation_reason"`
+	PaidAt             types.Timestamp `json:"paid_at"`
+	DueAt              types.Timestamp `json:"due_at"`
+	Amount             decimal.Decimal `json:"amount"`
+	Currency           string          `json:"currency"`
+	TaxRate            decimal.Decimal `json:"tax_rate"`
+	TaxName            string          `json:"tax_name"`
+	TaxInclusive       bool            `json:"tax_inclusive"`
+	ReverseCharge      bool            `json:"reverse_charge"`
+}
+
+func (q *Queries) CreateInvoice(ctx context.Context, arg CreateInvoiceParams) (int32, error) {
+	row := q.db.QueryRow(ctx, createInvoice,
+		arg.UserID,
+		arg.Status,
+		arg.CancellationReason,
+		arg.PaidAt,
+		arg.DueAt,
+		arg.Amount,
+		arg.Currency,
+		arg.TaxRate,
+		arg.TaxName,
+		arg.TaxInclusive,
+		arg.ReverseCharge,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createInvoiceItem = `-- name: CreateInvoiceItem :exec
+INSERT INTO invoice_items (invoice_id, description, amount, type, item_id) VALUES ($1, $2, $3, $4, $5)
+`
+
+type CreateInvoiceItemParams struct {
+	InvoiceID   int32           `json:"invoice_id"`
+	Description string          `json:"description"`
+	Amount      decimal.Decimal `json:"amount"`
+	Type        string          `json:"type"`
+	ItemID      pgtype.Int4     `json:"item_id"`
+}
+
+func (q *Queries) CreateInvoiceItem(ctx context.Context, arg CreateInvoiceItemParams) error {
+	_, err := q.db.Exec(ctx, createInvoiceItem,
+		arg.InvoiceID,
+		arg.Description,
+		arg.Amount,
+		arg.Type,
+		arg.ItemID,
+	)
+	return err
+}
+
+const createInvoiceReminder = `-- name: CreateInvoiceReminder :execrows
+INSERT INTO invoice_reminders (invoice_id, stage) VALUES ($1, $2) ON CONFLICT DO NOTHING
+`
+
+type CreateInvoiceReminderParams struct {
+	InvoiceID int32  `json:"invoice_id"`
+	Stage     string `json:"stage"`
+}
+
+func (q *Queries) CreateInvoiceReminder(ctx context.Context, arg CreateInvoiceReminderParams) (int64, error) {
+	result, err := q.db.Exec(ctx, createInvoiceReminder, arg.InvoiceID, arg.Stage)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const createProduct = `-- name: CreateProduct :one
+INSERT INTO products (name, description, category_id, extension, enabled, pricing, settings, stock, stock_control, invoice_days_before_expiry, suspend_days_after_due, terminate_days_after_suspension, billing_anchor_day, metered_pricing, trial_days, trial_requires_payment_method, trial_once_per_user, commission_percent, commission_recurring) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19) RETURNING id
+`
+
+type CreateProductParams struct {
+	Name                         string                `json:"name"`
+	Description                  string                `json:"description"`
+	CategoryID                   int32                 `json:"category_id"`
+	Extension                    string                `json:"extension"`
+	Enabled                      bool                  `json:"enabled"`
+	Pricing                      types.ProductPrices   `json:"pricing"`
+	Settings                     types.ProductSettings `json:"settings"`
+	Stock                        int32                 `json:"stock"`
+	StockControl                 int32                 `json:"stock_control"`
+	InvoiceDaysBeforeExpiry      pgtype.Int4           `json:"invoice_days_before_expiry"`
+	SuspendDaysAfterDue          pgtype.Int4           `json:"suspend_days_after_due"`
+	TerminateDaysAfterSuspension pgtype.Int4           `json:"terminate_days_after_suspension"`
+	BillingAnchorDay             pgtype.Int4           `json:"billing_anchor_day"`
+	MeteredPricing               types.MeteredPrices   `json:"metered_pricing"`
+	TrialDays                    int32                 `json:"trial_days"`
+	TrialRequiresPaymentMethod   bool                  `json:"trial_requires_payment_method"`
+	TrialOncePerUser             bool                  `json:"trial_once_per_user"`
+	CommissionPercent            decimal.Decimal       `json:"commission_percent"`
+	CommissionRecurring          bool                  `json:"commission_recurring"`
+}
+
+func (q *Queries) CreateProduct(ctx context.Context, arg CreateProductParams) (int32, error) {
+	row := q.db.QueryRow(ctx, createProduct,
+		arg.Name,
+		arg.Description,
+		arg.CategoryID,
+		arg.Extension,
+		arg.Enabled,
+		arg.Pricing,
+		arg.Settings,
+		arg.Stock,
+		arg.StockControl,
+		arg.InvoiceDaysBeforeExpiry,
+		arg.SuspendDaysAfterDue,
+		arg.TerminateDaysAfterSuspension,
+		arg.BillingAnchorDay,
+		arg.MeteredPricing,
+		arg.TrialDays,
+		arg.TrialRequiresPaymentMethod,
+		arg.TrialOncePerUser,
+		arg.CommissionPercent,
+		arg.CommissionRecurring,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createProductOption = `-- name: CreateProductOption :exec
+INSERT INTO product_options (product_id, name, display_name, type, regex, values, description) VALUES ($1, $2, $3, $4, $5, $6, $7)
+`
+
+type CreateProductOptionParams struct {
+	ProductID   int32                     `json:"product_id"`
+	Name        string                    `json:"name"`
+	DisplayName string                    `json:"display_name"`
+	Type        string                    `json:"type"`
+	Regex       string                    `json:"regex"`
+	Values      types.ProductOptionValues `json:"values"`
+	Description string                    `json:"description"`
 }
 
 func (q *Queries) CreateProductOption(ctx context.Context, arg CreateProductOptionParams) error {
@@ -261,18 +814,27 @@ func (q *Queries) CreateServer(ctx context.Context, arg CreateServerParams) (int
 }
 
 const createService = `-- name: CreateService :one
-INSERT INTO services (label, user_id, status, billing_cycle, price, extension, settings, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id
+INSERT INTO services (label, user_id, status, billing_cycle, price, extension, settings, expires_at, currency, discount, product_id, billing_cycle_months, billing_day, affiliate_id, order_ip, order_country, discount_rate) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17) RETURNING id
 `
 
 type CreateServiceParams struct {
-	Label        string                `json:"label"`
-	UserID       int32                 `json:"user_id"`
-	Status       string                `json:"status"`
-	BillingCycle int32                 `json:"billing_cycle"`
-	Price        decimal.Decimal       `json:"price"`
-	Extension    string                `json:"extension"`
-	Settings     types.ServiceSettings `json:"settings"`
-	ExpiresAt    types.Timestamp       `json:"expires_at"`
+	Label              string                `json:"label"`
+	UserID             int32                 `json:"user_id"`
+	Status             string                `json:"status"`
+	BillingCycle       int32                 `json:"billing_cycle"`
+	Price              decimal.Decimal       `json:"price"`
+	Extension          string                `json:"extension"`
+	Settings           types.ServiceSettings `json:"settings"`
+	ExpiresAt          types.Timestamp       `json:"expires_at"`
+	Currency           string                `json:"currency"`
+	Discount           decimal.Decimal       `json:"discount"`
+	ProductID          pgtype.Int4           `json:"product_id"`
+	BillingCycleMonths int32                 `json:"billing_cycle_months"`
+	BillingDay         int32                 `json:"billing_day"`
+	AffiliateID        pgtype.Int4           `json:"affiliate_id"`
+	OrderIp            string                `json:"order_ip"`
+	OrderCountry       string                `json:"order_country"`
+	DiscountRate       decimal.Decimal       `json:"discount_rate"`
 }
 
 func (q *Queries) CreateService(ctx context.Context, arg CreateServiceParams) (int32, error) {
@@ -285,6 +847,44 @@ func (q *Queries) CreateService(ctx context.Context, arg CreateServiceParams) (i
 		arg.Extension,
 		arg.Settings,
 		arg.ExpiresAt,
+		arg.Currency,
+		arg.Discount,
+		arg.ProductID,
+		arg.BillingCycleMonths,
+		arg.BillingDay,
+		arg.AffiliateID,
+		arg.OrderIp,
+		arg.OrderCountry,
+		arg.DiscountRate,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createServiceUpgrade = `-- name: CreateServiceUpgrade :one
+INSERT INTO service_upgrades (service_id, invoice_id, product_id, settings, price, amount, status) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id
+`
+
+type CreateServiceUpgradeParams struct {
+	ServiceID int32                 `json:"service_id"`
+	InvoiceID pgtype.Int4           `json:"invoice_id"`
+	ProductID int32                 `json:"product_id"`
+	Settings  types.ServiceSettings `json:"settings"`
+	Price     decimal.Decimal       `json:"price"`
+	Amount    decimal.Decimal       `json:"amount"`
+	Status    string                `json:"status"`
+}
+
+func (q *Queries) CreateServiceUpgrade(ctx context.Context, arg CreateServiceUpgradeParams) (int32, error) {
+	row := q.db.QueryRow(ctx, createServiceUpgrade,
+		arg.ServiceID,
+		arg.InvoiceID,
+		arg.ProductID,
+		arg.Settings,
+		arg.Price,
+		arg.Amount,
+		arg.Status,
 	)
 	var id int32
 	err := row.Scan(&id)
@@ -306,6 +906,75 @@ func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) er
 	return err
 }
 
+const createTaxRule = `-- name: CreateTaxRule :one
+INSERT INTO tax_rules (name, country, state, rate, inclusive, reverse_charge) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id
+`
+
+type CreateTaxRuleParams struct {
+	Name          string          `json:"name"`
+	Country       string          `json:"country"`
+	State         string          `json:"state"`
+	Rate          decimal.Decimal `json:"rate"`
+	Inclusive     bool            `json:"inclusive"`
+	ReverseCharge bool            `json:"reverse_charge"`
+}
+
+func (q *Queries) CreateTaxRule(ctx context.Context, arg CreateTaxRuleParams) (int32, error) {
+	row := q.db.QueryRow(ctx, createTaxRule,
+		arg.Name,
+		arg.Country,
+		arg.State,
+		arg.Rate,
+		arg.Inclusive,
+		arg.ReverseCharge,
+	)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createTrial = `-- name: CreateTrial :exec
+INSERT INTO trials (product_id, user_id, email, service_id) VALUES ($1, $2, $3, $4)
+`
+
+type CreateTrialParams struct {
+	ProductID int32       `json:"product_id"`
+	UserID    pgtype.Int4 `json:"user_id"`
+	Email     string      `json:"email"`
+	ServiceID pgtype.Int4 `json:"service_id"`
+}
+
+func (q *Queries) CreateTrial(ctx context.Context, arg CreateTrialParams) error {
+	_, err := q.db.Exec(ctx, createTrial,
+		arg.ProductID,
+		arg.UserID,
+		arg.Email,
+		arg.ServiceID,
+	)
+	return err
+}
+
+const createUsageRecord = `-- name: CreateUsageRecord :exec
+INSERT INTO usage_records (service_id, metric, quantity, recorded_at) VALUES ($1, $2, $3, $4)
+`
+
+type CreateUsageRecordParams struct {
+	ServiceID  int32           `json:"service_id"`
+	Metric     string          `json:"metric"`
+	Quantity   decimal.Decimal `json:"quantity"`
+	RecordedAt types.Timestamp `json:"recorded_at"`
+}
+
+func (q *Queries) CreateUsageRecord(ctx context.Context, arg CreateUsageRecordParams) error {
+	_, err := q.db.Exec(ctx, createUsageRecord,
+		arg.ServiceID,
+		arg.Metric,
+		arg.Quantity,
+		arg.RecordedAt,
+	)
+	return err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (email, name, role, password, address, city, state, country, zip_code) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id
 `
@@ -339,6 +1008,17 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (int32,
 	return id, err
 }
 
+const creditOrCommissionsExist = `-- name: CreditOrCommissionsExist :one
+SELECT EXISTS (SELECT 1 FROM credit_transactions) OR EXISTS (SELECT 1 FROM commissions)
+`
+
+func (q *Queries) CreditOrCommissionsExist(ctx context.Context) (bool, error) {
+	row := q.db.QueryRow(ctx, creditOrCommissionsExist)
+	var column_1 bool
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
 const deleteAllInvoiceItems = `-- name: DeleteAllInvoiceItems :exec
 DELETE FROM invoice_items WHERE invoice_id = $1
 `
@@ -348,6 +1028,41 @@ func (q *Queries) DeleteAllInvoiceItems(ctx context.Context, invoiceID int32) er
 	return err
 }
 
+const deleteCart = `-- name: DeleteCart :exec
+DELETE FROM carts WHERE id = $1
+`
+
+func (q *Queries) DeleteCart(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, deleteCart, id)
+	return err
+}
+
+const deleteCartItem = `-- name: DeleteCartItem :execrows
+DELETE FROM cart_items WHERE id = $1 AND cart_id = $2
+`
+
+type DeleteCartItemParams struct {
+	ID     int32 `json:"id"`
+	CartID int32 `json:"cart_id"`
+}
+
+func (q *Queries) DeleteCartItem(ctx context.Context, arg DeleteCartItemParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteCartItem, arg.ID, arg.CartID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteCartItems = `-- name: DeleteCartItems :exec
+DELETE FROM cart_items WHERE cart_id = $1
+`
+
+func (q *Queries) DeleteCartItems(ctx context.Context, cartID int32) error {
+	_, err := q.db.Exec(ctx, deleteCartItems, cartID)
+	return err
+}
+
 const deleteCategory = `-- name: DeleteCategory :exec
 DELETE FROM categories WHERE id = $1
 `
@@ -357,6 +1072,15 @@ func (q *Queries) DeleteCategory(ctx context.Context, id int32) error {
 	return err
 }
 
+const deleteCoupon = `-- name: DeleteCoupon :exec
+DELETE FROM coupons WHERE id = $1
+`
+
+func (q *Queries) DeleteCoupon(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, deleteCoupon, id)
+	return err
+}
+
 const deleteExpiredSessions = `-- name: DeleteExpiredSessions :exec
 DELETE FROM sessions WHERE expires_at < CURRENT_TIMESTAMP
 `
@@ -434,6 +1158,27 @@ func (q *Queries) DeleteSession(ctx context.Context, token string) error {
 	return err
 }
 
+const deleteStaleGuestCarts = `-- name: DeleteStaleGuestCarts :execrows
+DELETE FROM carts WHERE user_id IS NULL AND updated_at < $1::timestamp
+`
+
+func (q *Queries) DeleteStaleGuestCarts(ctx context.Context, before types.Timestamp) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteStaleGuestCarts, before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteTaxRule = `-- name: DeleteTaxRule :exec
+DELETE FROM tax_rules WHERE id = $1
+`
+
+func (q *Queries) DeleteTaxRule(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, deleteTaxRule, id)
+	return err
+}
+
 const deleteUser = `-- name: DeleteUser :exec
 DELETE FROM users WHERE id = $1
 `
@@ -443,45 +1188,61 @@ func (q *Queries) DeleteUser(ctx context.Context, id int32) error {
 	return err
 }
 
-const findCategoryById = `-- name: FindCategoryById :one
+const exportInvoiceItems = `-- name: ExportInvoiceItems :many
+SELECT invoice_items.id, invoice_items.invoice_id, invoices.number, users.email, users.name, invoices.created_at, invoices.due_at, invoices.paid_at, invoices.currency, invoice_items.description, invoice_items.amount, invoice_items.type, invoice_items.item_id, invoices.tax_name, invoices.tax_rate, invoices.tax_inclusive FROM invoice_items INNER JOIN invoices ON invoice_items.invoice_id = invoices.id INNER JOIN users ON invoices.user_id = users.id WHERE (CASE WHEN $1::boolean THEN invoices.paid_at ELSE invoices.created_at END) >= $2::timestamp AND (CASE WHEN $1::boolean THEN invoices.paid_at ELSE invoices.created_at END) < $3::timestamp AND (invoices.status <> 'CANCELLED' OR invoices.paid_at IS NOT NULL) ORDER BY invoices.id, invoice_items.id
+`
 
-SELECT id, name, description FROM categories WHERE id = $1
-`
-
-// CATEGORIES --
-func (q *Queries) FindCategoryById(ctx context.Context, id int32) (Category, error) {
-	row := q.db.QueryRow(ctx, findCategoryById, id)
-	var i Category
-	err := row.Scan(&i.ID, &i.Name, &i.Description)
-	return i, err
+type ExportInvoiceItemsParams struct {
+	CashBasis bool            `json:"cash_basis"`
+	StartAt   types.Timestamp `json:"start_at"`
+	EndAt     types.Timestamp `json:"end_at"`
 }
 
-const findEnabledProductsByCategory = `-- name: FindEnabledProductsByCategory :many
-
-SELECT id, name, description, category_id, extension, enabled, pricing, settings, stock, stock_control FROM products WHERE category_id = $1 AND enabled = TRUE
-`
-
-// PRODUCTS --
-func (q *Queries) FindEnabledProductsByCategory(ctx context.Context, categoryID int32) ([]Product, error) {
-	rows, err := q.db.Query(ctx, findEnabledProductsByCategory, categoryID)
+type ExportInvoiceItemsRow struct {
+	ID           int32           `json:"id"`
+	InvoiceID    int32           `json:"invoice_id"`
+	Number       string          `json:"number"`
+	Email        string          `json:"email"`
+	Name         string          `json:"name"`
+	CreatedAt    types.Timestamp `json:"created_at"`
+	DueAt        types.Timestamp `json:"due_at"`
+	PaidAt       types.Timestamp `json:"paid_at"`
+	Currency     string          `json:"currency"`
+	Description  string          `json:"description"`
+	Amount       decimal.Decimal `json:"amount"`
+	Type         string          `json:"type"`
+	ItemID       pgtype.Int4     `json:"item_id"`
+	TaxName      string          `json:"tax_name"`
+	TaxRate      decimal.Decimal `json:"tax_rate"`
+	TaxInclusive bool            `json:"tax_inclusive"`
+}
+
+func (q *Queries) ExportInvoiceItems(ctx context.Context, arg ExportInvoiceItemsParams) ([]ExportInvoiceItemsRow, error) {
+	rows, err := q.db.Query(ctx, exportInvoiceItems, arg.CashBasis, arg.StartAt, arg.EndAt)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Product{}
+	items := []ExportInvoiceItemsRow{}
 	for rows.Next() {
-		var i Product
+		var i ExportInvoiceItemsRow
 		if err := rows.Scan(
 			&i.ID,
+			&i.InvoiceID,
+			&i.Number,
+			&i.Email,
 			&i.Name,
+			&i.CreatedAt,
+			&i.DueAt,
+			&i.PaidAt,
+			&i.Currency,
 			&i.Description,
-			&i.CategoryID,
-			&i.Extension,
-			&i.Enabled,
-			&i.Pricing,
-			&i.Settings,
-			&i.Stock,
-			&i.StockControl,
+			&i.Amount,
+			&i.Type,
+			&i.ItemID,
+			&i.TaxName,
+			&i.TaxRate,
+			&i.TaxInclusive,
 		); err != nil {
 			return nil, err
 		}
@@ -493,117 +1254,61 @@ func (q *Queries) FindEnabledProductsByCategory(ctx context.Context, categoryID
 	return items, nil
 }
 
-const findGatewayById = `-- name: FindGatewayById :one
-SELECT id, display_name, name, settings, enabled, fee FROM gateways WHERE id = $1
-`
-
-func (q *Queries) FindGatewayById(ctx context.Context, id int32) (Gateway, error) {
-	row := q.db.QueryRow(ctx, findGatewayById, id)
-	var i Gateway
-	err := row.Scan(
-		&i.ID,
-		&i.DisplayName,
-		&i.Name,
-		&i.Settings,
-		&i.Enabled,
-		&i.Fee,
-	)
-	return i, err
-}
-
-const findGatewayByName = `-- name: FindGatewayByName :one
-SELECT id, display_name, name, settings, enabled, fee FROM gateways WHERE name = $1
-`
-
-func (q *Queries) FindGatewayByName(ctx context.Context, name string) (Gateway, error) {
-	row := q.db.QueryRow(ctx, findGatewayByName, name)
-	var i Gateway
-	err := row.Scan(
-		&i.ID,
-		&i.DisplayName,
-		&i.Name,
-		&i.Settings,
-		&i.Enabled,
-		&i.Fee,
-	)
-	return i, err
-}
-
-const findInvoiceById = `-- name: FindInvoiceById :one
-SELECT id, user_id, status, cancellation_reason, paid_at, due_at, amount, created_at FROM invoices WHERE id = $1
-`
-
-func (q *Queries) FindInvoiceById(ctx context.Context, id int32) (Invoice, error) {
-	row := q.db.QueryRow(ctx, findInvoiceById, id)
-	var i Invoice
-	err := row.Scan(
-		&i.ID,
-		&i.UserID,
-		&i.Status,
-		&i.CancellationReason,
-		&i.PaidAt,
-		&i.DueAt,
-		&i.Amount,
-		&i.CreatedAt,
-	)
-	return i, err
-}
-
-const findInvoiceByIdWithUsername = `-- name: FindInvoiceByIdWithUsername :one
-SELECT invoices.id, invoices.user_id, invoices.status, invoices.cancellation_reason, invoices.paid_at, invoices.due_at, invoices.amount, invoices.created_at, users.name AS username FROM invoices INNER JOIN users ON invoices.user_id = users.id WHERE invoices.id = $1
+const exportInvoices = `-- name: ExportInvoices :many
+SELECT invoices.id, invoices.number, invoices.user_id, users.email, users.name, invoices.status, invoices.created_at, invoices.due_at, invoices.paid_at, invoices.currency, invoices.subtotal, invoices.tax, invoices.tax_name, invoices.tax_rate, invoices.tax_inclusive, invoices.amount FROM invoices INNER JOIN users ON invoices.user_id = users.id WHERE (CASE WHEN $1::boolean THEN invoices.paid_at ELSE invoices.created_at END) >= $2::timestamp AND (CASE WHEN $1::boolean THEN invoices.paid_at ELSE invoices.created_at END) < $3::timestamp AND (invoices.status <> 'CANCELLED' OR invoices.paid_at IS NOT NULL) ORDER BY invoices.id
 `
 
-type FindInvoiceByIdWithUsernameRow struct {
-	ID                 int32           `json:"id"`
-	UserID             int32           `json:"user_id"`
-	Status             string          `json:"status"`
-	CancellationReason pgtype.Text     `json:"cancellation_reason"`
-	PaidAt             types.Timestamp `json:"paid_at"`
-	DueAt              types.Timestamp `json:"due_at"`
-	Amount             decimal.Decimal `json:"amount"`
-	CreatedAt          types.Timestamp `json:"created_at"`
-	Username           string          `json:"username"`
-}
-
-func (q *Queries) FindInvoiceByIdWithUsername(ctx context.Context, id int32) (FindInvoiceByIdWithUsernameRow, error) {
-	row := q.db.QueryRow(ctx, findInvoiceByIdWithUsername, id)
-	var i FindInvoiceByIdWithUsernameRow
-	err := row.Scan(
-		&i.ID,
-		&i.UserID,
-		&i.Status,
-		&i.CancellationReason,
-		&i.PaidAt,
-		&i.DueAt,
-		&i.Amount,
-		&i.CreatedAt,
-		&i.Username,
-	)
-	return i, err
+type ExportInvoicesParams struct {
+	CashBasis bool            `json:"cash_basis"`
+	StartAt   types.Timestamp `json:"start_at"`
+	EndAt     types.Timestamp `json:"end_at"`
 }
 
-const findInvoiceByService = `-- name: FindInvoiceByService :many
-SELECT invoices.id, invoices.user_id, invoices.status, invoices.cancellation_reason, invoices.paid_at, invoices.due_at, invoices.amount, invoices.created_at FROM invoices INNER JOIN invoice_items ON invoices.id = invoice_items.invoice_id WHERE invoice_items.item_id = $1 AND invoice_items.type = 'service' ORDER BY invoices.id DESC
-`
-
-func (q *Queries) FindInvoiceByService(ctx context.Context, itemID pgtype.Int4) ([]Invoice, error) {
-	rows, err := q.db.Query(ctx, findInvoiceByService, itemID)
+type ExportInvoicesRow struct {
+	ID           int32           `json:"id"`
+	Number       string          `json:"number"`
+	UserID       int32           `json:"user_id"`
+	Email        string          `json:"email"`
+	Name         string          `json:"name"`
+	Status       string          `json:"status"`
+	CreatedAt    types.Timestamp `json:"created_at"`
+	DueAt        types.Timestamp `json:"due_at"`
+	PaidAt       types.Timestamp `json:"paid_at"`
+	Currency     string          `json:"currency"`
+	Subtotal     decimal.Decimal `json:"subtotal"`
+	Tax          decimal.Decimal `json:"tax"`
+	TaxName      string          `json:"tax_name"`
+	TaxRate      decimal.Decimal `json:"tax_rate"`
+	TaxInclusive bool            `json:"tax_inclusive"`
+	Amount       decimal.Decimal `json:"amount"`
+}
+
+func (q *Queries) ExportInvoices(ctx context.Context, arg ExportInvoicesParams) ([]ExportInvoicesRow, error) {
+	rows, err := q.db.Query(ctx, exportInvoices, arg.CashBasis, arg.StartAt, arg.EndAt)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Invoice{}
+	items := []ExportInvoicesRow{}
 	for rows.Next() {
-		var i Invoice
+		var i ExportInvoicesRow
 		if err := rows.Scan(
 			&i.ID,
+			&i.Number,
 			&i.UserID,
+			&i.Email,
+			&i.Name,
 			&i.Status,
-			&i.CancellationReason,
-			&i.PaidAt,
+			&i.CreatedAt,
 			&i.DueAt,
+			&i.PaidAt,
+			&i.Currency,
+			&i.Subtotal,
+			&i.Tax,
+			&i.TaxName,
+			&i.TaxRate,
+			&i.TaxInclusive,
 			&i.Amount,
-			&i.CreatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -615,28 +1320,53 @@ func (q *Queries) FindInvoiceByService(ctx context.Context, itemID pgtype.Int4)
 	return items, nil
 }
 
-const findOverdueInvoices = `-- name: FindOverdueInvoices :many
-SELECT id, user_id, status, cancellation_reason, paid_at, due_at, amount, created_at FROM invoices WHERE status = 'UNPAID' AND due_at <= CURRENT_TIMESTAMP ORDER BY id
+const exportJournal = `-- name: ExportJournal :many
+SELECT entries.date, entries.type, entries.id, entries.invoice_id, entries.number, users.name, entries.currency, entries.subtotal, entries.tax, entries.amount, entries.gateway, entries.description FROM (SELECT (CASE WHEN $1::boolean THEN invoices.paid_at ELSE invoices.created_at END)::timestamp AS date, 'invoice'::text AS type, invoices.id, invoices.id AS invoice_id, invoices.number, invoices.user_id, invoices.currency, invoices.subtotal, invoices.tax, invoices.amount, ''::text AS gateway, ''::text AS description FROM invoices WHERE (CASE WHEN $1::boolean THEN invoices.paid_at ELSE invoices.created_at END) >= $2::timestamp AND (CASE WHEN $1::boolean THEN invoices.paid_at ELSE invoices.created_at END) < $3::timestamp AND (invoices.status <> 'CANCELLED' OR invoices.paid_at IS NOT NULL) UNION ALL SELECT invoice_payments.created_at, CASE WHEN invoice_payments.refund_of IS NULL THEN 'payment' ELSE 'refund' END, invoice_payments.id, invoices.id, invoices.number, invoices.user_id, invoices.currency, invoice_payments.amount, 0, invoice_payments.amount, invoice_payments.gateway, invoice_payments.description FROM invoice_payments INNER JOIN invoices ON invoice_payments.invoice_id = invoices.id WHERE invoice_payments.created_at >= $2::timestamp AND invoice_payments.created_at < $3::timestamp UNION ALL SELECT credit_notes.created_at, 'credit_note', credit_notes.id, credit_notes.invoice_id, credit_notes.number, credit_notes.user_id, credit_notes.currency, credit_notes.subtotal, credit_notes.tax, credit_notes.amount, '', credit_notes.reason FROM credit_notes WHERE credit_notes.created_at >= $2::timestamp AND credit_notes.created_at < $3::timestamp) entries INNER JOIN users ON entries.user_id = users.id ORDER BY entries.date, entries.type, entries.id
 `
 
-func (q *Queries) FindOverdueInvoices(ctx context.Context) ([]Invoice, error) {
-	rows, err := q.db.Query(ctx, findOverdueInvoices)
+type ExportJournalParams struct {
+	CashBasis bool            `json:"cash_basis"`
+	StartAt   types.Timestamp `json:"start_at"`
+	EndAt     types.Timestamp `json:"end_at"`
+}
+
+type ExportJournalRow struct {
+	Date        types.Timestamp `json:"date"`
+	Type        string          `json:"type"`
+	ID          int32           `json:"id"`
+	InvoiceID   int32           `json:"invoice_id"`
+	Number      string          `json:"number"`
+	Name        string          `json:"name"`
+	Currency    string          `json:"currency"`
+	Subtotal    decimal.Decimal `json:"subtotal"`
+	Tax         decimal.Decimal `json:"tax"`
+	Amount      decimal.Decimal `json:"amount"`
+	Gateway     string          `json:"gateway"`
+	Description string          `json:"description"`
+}
+
+func (q *Queries) ExportJournal(ctx context.Context, arg ExportJournalParams) ([]ExportJournalRow, error) {
+	rows, err := q.db.Query(ctx, exportJournal, arg.CashBasis, arg.StartAt, arg.EndAt)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Invoice{}
+	items := []ExportJournalRow{}
 	for rows.Next() {
-		var i Invoice
+		var i ExportJournalRow
 		if err := rows.Scan(
+			&i.Date,
+			&i.Type,
 			&i.ID,
-			&i.UserID,
-			&i.Status,
-			&i.CancellationReason,
-			&i.PaidAt,
-			&i.DueAt,
+			&i.InvoiceID,
+			&i.Number,
+			&i.Name,
+			&i.Currency,
+			&i.Subtotal,
+			&i.Tax,
 			&i.Amount,
-			&i.CreatedAt,
+			&i.Gateway,
+			&i.Description,
 		); err != nil {
 			return nil, err
 		}
@@ -648,32 +1378,52 @@ func (q *Queries) FindOverdueInvoices(ctx context.Context) ([]Invoice, error) {
 	return items, nil
 }
 
-const findOverdueServices = `-- name: FindOverdueServices :many
-SELECT id, label, user_id, status, cancellation_reason, billing_cycle, price, extension, settings, expires_at, created_at, cancelled_at FROM services WHERE (status = 'SUSPENDED' OR status = 'ACTIVE' OR status = 'PENDING') AND expires_at <= CURRENT_TIMESTAMP ORDER BY id
+const exportPayments = `-- name: ExportPayments :many
+SELECT invoice_payments.id, invoice_payments.invoice_id, invoices.number, users.email, users.name, invoice_payments.created_at, invoice_payments.description, invoice_payments.amount, invoice_payments.reference_id, invoice_payments.gateway, invoice_payments.refund_of, invoices.currency FROM invoice_payments INNER JOIN invoices ON invoice_payments.invoice_id = invoices.id INNER JOIN users ON invoices.user_id = users.id WHERE invoice_payments.created_at >= $1::timestamp AND invoice_payments.created_at < $2::timestamp ORDER BY invoice_payments.created_at, invoice_payments.id
 `
 
-func (q *Queries) FindOverdueServices(ctx context.Context) ([]Service, error) {
-	rows, err := q.db.Query(ctx, findOverdueServices)
+type ExportPaymentsParams struct {
+	StartAt types.Timestamp `json:"start_at"`
+	EndAt   types.Timestamp `json:"end_at"`
+}
+
+type ExportPaymentsRow struct {
+	ID          int32           `json:"id"`
+	InvoiceID   int32           `json:"invoice_id"`
+	Number      string          `json:"number"`
+	Email       string          `json:"email"`
+	Name        string          `json:"name"`
+	CreatedAt   types.Timestamp `json:"created_at"`
+	Description string          `json:"description"`
+	Amount      decimal.Decimal `json:"amount"`
+	ReferenceID string          `json:"reference_id"`
+	Gateway     string          `json:"gateway"`
+	RefundOf    pgtype.Int4     `json:"refund_of"`
+	Currency    string          `json:"currency"`
+}
+
+func (q *Queries) ExportPayments(ctx context.Context, arg ExportPaymentsParams) ([]ExportPaymentsRow, error) {
+	rows, err := q.db.Query(ctx, exportPayments, arg.StartAt, arg.EndAt)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Service{}
+	items := []ExportPaymentsRow{}
 	for rows.Next() {
-		var i Service
+		var i ExportPaymentsRow
 		if err := rows.Scan(
 			&i.ID,
-			&i.Label,
-			&i.UserID,
-			&i.Status,
-			&i.CancellationReason,
-			&i.BillingCycle,
-			&i.Price,
-			&i.Extension,
-			&i.Settings,
-			&i.ExpiresAt,
+			&i.InvoiceID,
+			&i.Number,
+			&i.Email,
+			&i.Name,
 			&i.CreatedAt,
-			&i.CancelledAt,
+			&i.Description,
+			&i.Amount,
+			&i.ReferenceID,
+			&i.Gateway,
+			&i.RefundOf,
+			&i.Currency,
 		); err != nil {
 			return nil, err
 		}
@@ -685,228 +1435,200 @@ func (q *Queries) FindOverdueServices(ctx context.Context) ([]Service, error) {
 	return items, nil
 }
 
-const findProductById = `-- name: FindProductById :one
-SELECT id, name, description, category_id, extension, enabled, pricing, settings, stock, stock_control FROM products WHERE id = $1
+const findCartByIdForUpdate = `-- name: FindCartByIdForUpdate :one
+SELECT id, token, user_id, updated_at FROM carts WHERE id = $1 FOR UPDATE
 `
 
-func (q *Queries) FindProductById(ctx context.Context, id int32) (Product, error) {
-	row := q.db.QueryRow(ctx, findProductById, id)
-	var i Product
+func (q *Queries) FindCartByIdForUpdate(ctx context.Context, id int32) (Cart, error) {
+	row := q.db.QueryRow(ctx, findCartByIdForUpdate, id)
+	var i Cart
 	err := row.Scan(
 		&i.ID,
-		&i.Name,
-		&i.Description,
-		&i.CategoryID,
-		&i.Extension,
-		&i.Enabled,
-		&i.Pricing,
-		&i.Settings,
-		&i.Stock,
-		&i.StockControl,
+		&i.Token,
+		&i.UserID,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
 
-const findProductOptionsByProduct = `-- name: FindProductOptionsByProduct :many
-SELECT product_id, name, display_name, type, regex, values, description FROM product_options WHERE product_id = $1
+const findCartByToken = `-- name: FindCartByToken :one
+SELECT id, token, user_id, updated_at FROM carts WHERE token = $1
 `
 
-func (q *Queries) FindProductOptionsByProduct(ctx context.Context, productID int32) ([]ProductOption, error) {
-	rows, err := q.db.Query(ctx, findProductOptionsByProduct, productID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	items := []ProductOption{}
-	for rows.Next() {
-		var i ProductOption
-		if err := rows.Scan(
-			&i.ProductID,
-			&i.Name,
-			&i.DisplayName,
-			&i.Type,
-			&i.Regex,
-			&i.Values,
-			&i.Description,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+func (q *Queries) FindCartByToken(ctx context.Context, token string) (Cart, error) {
+	row := q.db.QueryRow(ctx, findCartByToken, token)
+	var i Cart
+	err := row.Scan(
+		&i.ID,
+		&i.Token,
+		&i.UserID,
+		&i.UpdatedAt,
+	)
+	return i, err
 }
 
-const findProductsByCategory = `-- name: FindProductsByCategory :many
-SELECT id, name, description, category_id, extension, enabled, pricing, settings, stock, stock_control FROM products WHERE category_id = $1 ORDER BY id
+const findCartByUser = `-- name: FindCartByUser :one
+SELECT id, token, user_id, updated_at FROM carts WHERE user_id = $1
 `
 
-func (q *Queries) FindProductsByCategory(ctx context.Context, categoryID int32) ([]Product, error) {
-	rows, err := q.db.Query(ctx, findProductsByCategory, categoryID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	items := []Product{}
-	for rows.Next() {
-		var i Product
-		if err := rows.Scan(
-			&i.ID,
-			&i.Name,
-			&i.Description,
-			&i.CategoryID,
-			&i.Extension,
-			&i.Enabled,
-			&i.Pricing,
-			&i.Settings,
-			&i.Stock,
-			&i.StockControl,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+func (q *Queries) FindCartByUser(ctx context.Context, userID pgtype.Int4) (Cart, error) {
+	row := q.db.QueryRow(ctx, findCartByUser, userID)
+	var i Cart
+	err := row.Scan(
+		&i.ID,
+		&i.Token,
+		&i.UserID,
+		&i.UpdatedAt,
+	)
+	return i, err
 }
 
-const findServerById = `-- name: FindServerById :one
-SELECT id, label, extension, settings FROM servers WHERE id = $1
+const findCategoryById = `-- name: FindCategoryById :one
+
+SELECT id, name, description FROM categories WHERE id = $1
 `
 
-func (q *Queries) FindServerById(ctx context.Context, id int32) (Server, error) {
-	row := q.db.QueryRow(ctx, findServerById, id)
-	var i Server
+// CATEGORIES --
+func (q *Queries) FindCategoryById(ctx context.Context, id int32) (Category, error) {
+	row := q.db.QueryRow(ctx, findCategoryById, id)
+	var i Category
+	err := row.Scan(&i.ID, &i.Name, &i.Description)
+	return i, err
+}
+
+const findCouponByCode = `-- name: FindCouponByCode :one
+SELECT id, code, type, value, currency, product_ids, durations, recurring, max_uses, max_uses_per_user, uses, valid_from, valid_until, enabled, created_at FROM coupons WHERE lower(code) = lower($1::text)
+`
+
+func (q *Queries) FindCouponByCode(ctx context.Context, code string) (Coupon, error) {
+	row := q.db.QueryRow(ctx, findCouponByCode, code)
+	var i Coupon
 	err := row.Scan(
 		&i.ID,
-		&i.Label,
-		&i.Extension,
-		&i.Settings,
+		&i.Code,
+		&i.Type,
+		&i.Value,
+		&i.Currency,
+		&i.ProductIds,
+		&i.Durations,
+		&i.Recurring,
+		&i.MaxUses,
+		&i.MaxUsesPerUser,
+		&i.Uses,
+		&i.ValidFrom,
+		&i.ValidUntil,
+		&i.Enabled,
+		&i.CreatedAt,
 	)
 	return i, err
 }
 
-const findServiceById = `-- name: FindServiceById :one
-SELECT id, label, user_id, status, cancellation_reason, billing_cycle, price, extension, settings, expires_at, created_at, cancelled_at FROM services WHERE id = $1
+const findCouponById = `-- name: FindCouponById :one
+SELECT id, code, type, value, currency, product_ids, durations, recurring, max_uses, max_uses_per_user, uses, valid_from, valid_until, enabled, created_at FROM coupons WHERE id = $1
 `
 
-func (q *Queries) FindServiceById(ctx context.Context, id int32) (Service, error) {
-	row := q.db.QueryRow(ctx, findServiceById, id)
-	var i Service
+func (q *Queries) FindCouponById(ctx context.Context, id int32) (Coupon, error) {
+	row := q.db.QueryRow(ctx, findCouponById, id)
+	var i Coupon
 	err := row.Scan(
 		&i.ID,
-		&i.Label,
-		&i.UserID,
-		&i.Status,
-		&i.CancellationReason,
-		&i.BillingCycle,
-		&i.Price,
-		&i.Extension,
-		&i.Settings,
-		&i.ExpiresAt,
+		&i.Code,
+		&i.Type,
+		&i.Value,
+		&i.Currency,
+		&i.ProductIds,
+		&i.Durations,
+		&i.Recurring,
+		&i.MaxUses,
+		&i.MaxUsesPerUser,
+		&i.Uses,
+		&i.ValidFrom,
+		&i.ValidUntil,
+		&i.Enabled,
 		&i.CreatedAt,
-		&i.CancelledAt,
 	)
 	return i, err
 }
 
-const findServiceByIdForUpdate = `-- name: FindServiceByIdForUpdate :one
-SELECT id, label, user_id, status, cancellation_reason, billing_cycle, price, extension, settings, expires_at, created_at, cancelled_at FROM services WHERE id = $1 FOR UPDATE
+const findCouponByIdForUpdate = `-- name: FindCouponByIdForUpdate :one
+SELECT id, code, type, value, currency, product_ids, durations, recurring, max_uses, max_uses_per_user, uses, valid_from, valid_until, enabled, created_at FROM coupons WHERE id = $1 FOR UPDATE
 `
 
-func (q *Queries) FindServiceByIdForUpdate(ctx context.Context, id int32) (Service, error) {
-	row := q.db.QueryRow(ctx, findServiceByIdForUpdate, id)
-	var i Service
+func (q *Queries) FindCouponByIdForUpdate(ctx context.Context, id int32) (Coupon, error) {
+	row := q.db.QueryRow(ctx, findCouponByIdForUpdate, id)
+	var i Coupon
 	err := row.Scan(
 		&i.ID,
-		&i.Label,
-		&i.UserID,
-		&i.Status,
-		&i.CancellationReason,
-		&i.BillingCycle,
-		&i.Price,
-		&i.Extension,
-		&i.Settings,
-		&i.ExpiresAt,
+		&i.Code,
+		&i.Type,
+		&i.Value,
+		&i.Currency,
+		&i.ProductIds,
+		&i.Durations,
+		&i.Recurring,
+		&i.MaxUses,
+		&i.MaxUsesPerUser,
+		&i.Uses,
+		&i.ValidFrom,
+		&i.ValidUntil,
+		&i.Enabled,
 		&i.CreatedAt,
-		&i.CancelledAt,
 	)
 	return i, err
 }
 
-const findServiceByIdWithName = `-- name: FindServiceByIdWithName :one
-SELECT services.id, services.label, services.user_id, services.status, services.cancellation_reason, services.billing_cycle, services.price, services.extension, services.settings, services.expires_at, services.created_at, services.cancelled_at, users.name FROM services INNER JOIN users ON services.user_id = users.id WHERE services.id = $1
+const findCreditNoteById = `-- name: FindCreditNoteById :one
+SELECT id, number, invoice_id, user_id, reason, subtotal, tax, amount, currency, created_at FROM credit_notes WHERE id = $1
 `
 
-type FindServiceByIdWithNameRow struct {
-	ID                 int32                 `json:"id"`
-	Label              string                `json:"label"`
-	UserID             int32                 `json:"user_id"`
-	Status             string                `json:"status"`
-	CancellationReason pgtype.Text           `json:"cancellation_reason"`
-	BillingCycle       int32                 `json:"billing_cycle"`
-	Price              decimal.Decimal       `json:"price"`
-	Extension          string                `json:"extension"`
-	Settings           types.ServiceSettings `json:"settings"`
-	ExpiresAt          types.Timestamp       `json:"expires_at"`
-	CreatedAt          types.Timestamp       `json:"created_at"`
-	CancelledAt        types.Timestamp       `json:"cancelled_at"`
-	Name               string                `json:"name"`
-}
-
-func (q *Queries) FindServiceByIdWithName(ctx context.Context, id int32) (FindServiceByIdWithNameRow, error) {
-	row := q.db.QueryRow(ctx, findServiceByIdWithName, id)
-	var i FindServiceByIdWithNameRow
+func (q *Queries) FindCreditNoteById(ctx context.Context, id int32) (CreditNote, error) {
+	row := q.db.QueryRow(ctx, findCreditNoteById, id)
+	var i CreditNote
 	err := row.Scan(
 		&i.ID,
-		&i.Label,
+		&i.Number,
+		&i.InvoiceID,
 		&i.UserID,
-		&i.Status,
-		&i.CancellationReason,
-		&i.BillingCycle,
-		&i.Price,
-		&i.Extension,
-		&i.Settings,
-		&i.ExpiresAt,
+		&i.Reason,
+		&i.Subtotal,
+		&i.Tax,
+		&i.Amount,
+		&i.Currency,
 		&i.CreatedAt,
-		&i.CancelledAt,
-		&i.Name,
 	)
 	return i, err
 }
 
-const findServiceByUser = `-- name: FindServiceByUser :many
-
-SELECT id, label, user_id, status, cancellation_reason, billing_cycle, price, extension, settings, expires_at, created_at, cancelled_at FROM services WHERE user_id = $1 ORDER BY id DESC
+const findDueInvoicesWithoutReminder = `-- name: FindDueInvoicesWithoutReminder :many
+SELECT id, user_id, status, cancellation_reason, paid_at, due_at, amount, created_at, currency, subtotal, tax, tax_rate, tax_name, tax_inclusive, reverse_charge, number FROM invoices WHERE status = 'UNPAID' AND due_at <= CURRENT_TIMESTAMP AND due_at > CURRENT_TIMESTAMP - interval '1 day' AND NOT EXISTS (SELECT 1 FROM invoice_reminders WHERE invoice_reminders.invoice_id = invoices.id AND invoice_reminders.stage = 'due') ORDER BY id
 `
 
-// SERVICES --
-func (q *Queries) FindServiceByUser(ctx context.Context, userID int32) ([]Service, error) {
-	rows, err := q.db.Query(ctx, findServiceByUser, userID)
+func (q *Queries) FindDueInvoicesWithoutReminder(ctx context.Context) ([]Invoice, error) {
+	rows, err := q.db.Query(ctx, findDueInvoicesWithoutReminder)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Service{}
+	items := []Invoice{}
 	for rows.Next() {
-		var i Service
+		var i Invoice
 		if err := rows.Scan(
 			&i.ID,
-			&i.Label,
 			&i.UserID,
 			&i.Status,
 			&i.CancellationReason,
-			&i.BillingCycle,
-			&i.Price,
-			&i.Extension,
-			&i.Settings,
-			&i.ExpiresAt,
+			&i.PaidAt,
+			&i.DueAt,
+			&i.Amount,
 			&i.CreatedAt,
-			&i.CancelledAt,
+			&i.Currency,
+			&i.Subtotal,
+			&i.Tax,
+			&i.TaxRate,
+			&i.TaxName,
+			&i.TaxInclusive,
+			&i.ReverseCharge,
+			&i.Number,
 		); err != nil {
 			return nil, err
 		}
@@ -918,41 +1640,42 @@ func (q *Queries) FindServiceByUser(ctx context.Context, userID int32) ([]Servic
 	return items, nil
 }
 
-const findServicesForRenewal = `-- name: FindServicesForRenewal :many
-SELECT id, label, user_id, status, cancellation_reason, billing_cycle, price, extension, settings, expires_at, created_at, cancelled_at FROM services 
-WHERE (status = 'ACTIVE' OR status = 'SUSPENDED' OR status = 'PENDING') 
-AND expires_at <= (CURRENT_TIMESTAMP + interval '7 days') AND expires_at > CURRENT_TIMESTAMP
-AND NOT EXISTS (
-    SELECT 1 FROM invoices 
-    JOIN invoice_items ON invoices.id = invoice_items.invoice_id 
-    WHERE invoice_items.item_id = services.id 
-    AND invoice_items.type = 'service' 
-    AND invoices.status = 'UNPAID'
-)
+const findEnabledProductsByCategory = `-- name: FindEnabledProductsByCategory :many
+
+SELECT id, name, description, category_id, extension, enabled, pricing, settings, stock, stock_control, invoice_days_before_expiry, suspend_days_after_due, terminate_days_after_suspension, billing_anchor_day, metered_pricing, trial_days, trial_requires_payment_method, trial_once_per_user, commission_percent, commission_recurring FROM products WHERE category_id = $1 AND enabled = TRUE
 `
 
-func (q *Queries) FindServicesForRenewal(ctx context.Context) ([]Service, error) {
-	rows, err := q.db.Query(ctx, findServicesForRenewal)
+// PRODUCTS --
+func (q *Queries) FindEnabledProductsByCategory(ctx context.Context, categoryID int32) ([]Product, error) {
+	rows, err := q.db.Query(ctx, findEnabledProductsByCategory, categoryID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Service{}
+	items := []Product{}
 	for rows.Next() {
-		var i Service
+		var i Product
 		if err := rows.Scan(
 			&i.ID,
-			&i.Label,
-			&i.UserID,
-			&i.Status,
-			&i.CancellationReason,
-			&i.BillingCycle,
-			&i.Price,
+			&i.Name,
+			&i.Description,
+			&i.CategoryID,
 			&i.Extension,
+			&i.Enabled,
+			&i.Pricing,
 			&i.Settings,
-			&i.ExpiresAt,
-			&i.CreatedAt,
-			&i.CancelledAt,
+			&i.Stock,
+			&i.StockControl,
+			&i.InvoiceDaysBeforeExpiry,
+			&i.SuspendDaysAfterDue,
+			&i.TerminateDaysAfterSuspension,
+			&i.BillingAnchorDay,
+			&i.MeteredPricing,
+			&i.TrialDays,
+			&i.TrialRequiresPaymentMethod,
+			&i.TrialOncePerUser,
+			&i.CommissionPercent,
+			&i.CommissionRecurring,
 		); err != nil {
 			return nil, err
 		}
@@ -964,96 +1687,1580 @@ func (q *Queries) FindServicesForRenewal(ctx context.Context) ([]Service, error)
 	return items, nil
 }
 
-const findSessionByToken = `-- name: FindSessionByToken :one
-
-SELECT id, token, user_id, created_at, expires_at FROM sessions WHERE token = $1 AND expires_at > CURRENT_TIMESTAMP
+const findGatewayById = `-- name: FindGatewayById :one
+SELECT id, display_name, name, settings, enabled, fee FROM gateways WHERE id = $1
 `
 
-// SESSIONS --
-func (q *Queries) FindSessionByToken(ctx context.Context, token string) (Session, error) {
-	row := q.db.QueryRow(ctx, findSessionByToken, token)
-	var i Session
+func (q *Queries) FindGatewayById(ctx context.Context, id int32) (Gateway, error) {
+	row := q.db.QueryRow(ctx, findGatewayById, id)
+	var i Gateway
 	err := row.Scan(
 		&i.ID,
-		&i.Token,
-		&i.UserID,
-		&i.CreatedAt,
-		&i.ExpiresAt,
+		&i.DisplayName,
+		&i.Name,
+		&i.Settings,
+		&i.Enabled,
+		&i.Fee,
 	)
 	return i, err
 }
 
-const findSettingByKey = `-- name: FindSettingByKey :one
-
-SELECT id, key, value FROM settings WHERE key = $1
+const findGatewayByName = `-- name: FindGatewayByName :one
+SELECT id, display_name, name, settings, enabled, fee FROM gateways WHERE name = $1
 `
 
-// SETTINGS --
-func (q *Queries) FindSettingByKey(ctx context.Context, key string) (Setting, error) {
-	row := q.db.QueryRow(ctx, findSettingByKey, key)
-	var i Setting
-	err := row.Scan(&i.ID, &i.Key, &i.Value)
+func (q *Queries) FindGatewayByName(ctx context.Context, name string) (Gateway, error) {
+	row := q.db.QueryRow(ctx, findGatewayByName, name)
+	var i Gateway
+	err := row.Scan(
+		&i.ID,
+		&i.DisplayName,
+		&i.Name,
+		&i.Settings,
+		&i.Enabled,
+		&i.Fee,
+	)
 	return i, err
 }
 
-const findUserByEmail = `-- name: FindUserByEmail :one
-SELECT id, email, name, role, password, address, city, state, country, zip_code FROM users WHERE email = $1
+const findGatewayRefund = `-- name: FindGatewayRefund :one
+SELECT id, payment_id, amount, description, status, reference_id, error, created_at FROM gateway_refunds WHERE id = $1 AND payment_id IN (SELECT id FROM invoice_payments WHERE invoice_id = $2)
 `
 
-func (q *Queries) FindUserByEmail(ctx context.Context, email string) (User, error) {
-	row := q.db.QueryRow(ctx, findUserByEmail, email)
-	var i User
+type FindGatewayRefundParams struct {
+	ID        int32 `json:"id"`
+	InvoiceID int32 `json:"invoice_id"`
+}
+
+func (q *Queries) FindGatewayRefund(ctx context.Context, arg FindGatewayRefundParams) (GatewayRefund, error) {
+	row := q.db.QueryRow(ctx, findGatewayRefund, arg.ID, arg.InvoiceID)
+	var i GatewayRefund
 	err := row.Scan(
 		&i.ID,
-		&i.Email,
-		&i.Name,
-		&i.Role,
-		&i.Password,
-		&i.Address,
-		&i.City,
-		&i.State,
-		&i.Country,
-		&i.ZipCode,
+		&i.PaymentID,
+		&i.Amount,
+		&i.Description,
+		&i.Status,
+		&i.ReferenceID,
+		&i.Error,
+		&i.CreatedAt,
 	)
 	return i, err
 }
 
-const findUserById = `-- name: FindUserById :one
-SELECT id, email, name, role, password, address, city, state, country, zip_code FROM users WHERE id = $1
+const findInvoiceById = `-- name: FindInvoiceById :one
+SELECT id, user_id, status, cancellation_reason, paid_at, due_at, amount, created_at, currency, subtotal, tax, tax_rate, tax_name, tax_inclusive, reverse_charge, number FROM invoices WHERE id = $1
 `
 
-func (q *Queries) FindUserById(ctx context.Context, id int32) (User, error) {
-	row := q.db.QueryRow(ctx, findUserById, id)
-	var i User
+func (q *Queries) FindInvoiceById(ctx context.Context, id int32) (Invoice, error) {
+	row := q.db.QueryRow(ctx, findInvoiceById, id)
+	var i Invoice
 	err := row.Scan(
 		&i.ID,
-		&i.Email,
-		&i.Name,
-		&i.Role,
-		&i.Password,
-		&i.Address,
-		&i.City,
-		&i.State,
-		&i.Country,
-		&i.ZipCode,
+		&i.UserID,
+		&i.Status,
+		&i.CancellationReason,
+		&i.PaidAt,
+		&i.DueAt,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.Currency,
+		&i.Subtotal,
+		&i.Tax,
+		&i.TaxRate,
+		&i.TaxName,
+		&i.TaxInclusive,
+		&i.ReverseCharge,
+		&i.Number,
 	)
 	return i, err
 }
 
-const listCategories = `-- name: ListCategories :many
-SELECT id, name, description FROM categories ORDER BY id
+const findInvoiceByIdWithUsername = `-- name: FindInvoiceByIdWithUsername :one
+SELECT invoices.id, invoices.user_id, invoices.status, invoices.cancellation_reason, invoices.paid_at, invoices.due_at, invoices.amount, invoices.created_at, invoices.currency, invoices.subtotal, invoices.tax, invoices.tax_rate, invoices.tax_name, invoices.tax_inclusive, invoices.reverse_charge, invoices.number, users.name AS username FROM invoices INNER JOIN users ON invoices.user_id = users.id WHERE invoices.id = $1
 `
 
-func (q *Queries) ListCategories(ctx context.Context) ([]Category, error) {
-	rows, err := q.db.Query(ctx, listCategories)
-	if err != nil {
-		return nil, err
-	}
+type FindInvoiceByIdWithUsernameRow struct {
+	ID                 int32           `json:"id"`
+	UserID             int32           `json:"user_id"`
+	Status             string          `json:"status"`
+	CancellationReason pgtype.Text     `json:"cancellation_reason"`
+	PaidAt             types.Timestamp `json:"paid_at"`
+	DueAt              types.Timestamp `json:"due_at"`
+	Amount             decimal.Decimal `json:"amount"`
+	CreatedAt          types.Timestamp `json:"created_at"`
+	Currency           string          `json:"currency"`
+	Subtotal           decimal.Decimal `json:"subtotal"`
+	Tax                decimal.Decimal `json:"tax"`
+	TaxRate            decimal.Decimal `json:"tax_rate"`
+	TaxName            string          `json:"tax_name"`
+	TaxInclusive       bool            `json:"tax_inclusive"`
+	ReverseCharge      bool            `json:"reverse_charge"`
+	Number             string          `json:"number"`
+	Username           string          `json:"username"`
+}
+
+func (q *Queries) FindInvoiceByIdWithUsername(ctx context.Context, id int32) (FindInvoiceByIdWithUsernameRow, error) {
+	row := q.db.QueryRow(ctx, findInvoiceByIdWithUsername, id)
+	var i FindInvoiceByIdWithUsernameRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.CancellationReason,
+		&i.PaidAt,
+		&i.DueAt,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.Currency,
+		&i.Subtotal,
+		&i.Tax,
+		&i.TaxRate,
+		&i.TaxName,
+		&i.TaxInclusive,
+		&i.ReverseCharge,
+		&i.Number,
+		&i.Username,
+	)
+	return i, err
+}
+
+const findInvoiceByService = `-- name: FindInvoiceByService :many
+SELECT invoices.id, invoices.user_id, invoices.status, invoices.cancellation_reason, invoices.paid_at, invoices.due_at, invoices.amount, invoices.created_at, invoices.currency, invoices.subtotal, invoices.tax, invoices.tax_rate, invoices.tax_name, invoices.tax_inclusive, invoices.reverse_charge, invoices.number FROM invoices INNER JOIN invoice_items ON invoices.id = invoice_items.invoice_id WHERE invoice_items.item_id = $1 AND invoice_items.type = 'service' ORDER BY invoices.id DESC
+`
+
+func (q *Queries) FindInvoiceByService(ctx context.Context, itemID pgtype.Int4) ([]Invoice, error) {
+	rows, err := q.db.Query(ctx, findInvoiceByService, itemID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Invoice{}
+	for rows.Next() {
+		var i Invoice
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Status,
+			&i.CancellationReason,
+			&i.PaidAt,
+			&i.DueAt,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.Currency,
+			&i.Subtotal,
+			&i.Tax,
+			&i.TaxRate,
+			&i.TaxName,
+			&i.TaxInclusive,
+			&i.ReverseCharge,
+			&i.Number,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findInvoiceItem = `-- name: FindInvoiceItem :one
+SELECT id, invoice_id, description, amount, type, item_id, created_at FROM invoice_items WHERE id = $1 AND invoice_id = $2
+`
+
+type FindInvoiceItemParams struct {
+	ID        int32 `json:"id"`
+	InvoiceID int32 `json:"invoice_id"`
+}
+
+func (q *Queries) FindInvoiceItem(ctx context.Context, arg FindInvoiceItemParams) (InvoiceItem, error) {
+	row := q.db.QueryRow(ctx, findInvoiceItem, arg.ID, arg.InvoiceID)
+	var i InvoiceItem
+	err := row.Scan(
+		&i.ID,
+		&i.InvoiceID,
+		&i.Description,
+		&i.Amount,
+		&i.Type,
+		&i.ItemID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const findInvoicePayment = `-- name: FindInvoicePayment :one
+SELECT id, invoice_id, created_at, description, amount, reference_id, gateway, refund_of, credited FROM invoice_payments WHERE id = $1 AND invoice_id = $2
+`
+
+type FindInvoicePaymentParams struct {
+	ID        int32 `json:"id"`
+	InvoiceID int32 `json:"invoice_id"`
+}
+
+func (q *Queries) FindInvoicePayment(ctx context.Context, arg FindInvoicePaymentParams) (InvoicePayment, error) {
+	row := q.db.QueryRow(ctx, findInvoicePayment, arg.ID, arg.InvoiceID)
+	var i InvoicePayment
+	err := row.Scan(
+		&i.ID,
+		&i.InvoiceID,
+		&i.CreatedAt,
+		&i.Description,
+		&i.Amount,
+		&i.ReferenceID,
+		&i.Gateway,
+		&i.RefundOf,
+		&i.Credited,
+	)
+	return i, err
+}
+
+const findInvoicePaymentByReference = `-- name: FindInvoicePaymentByReference :one
+SELECT id, invoice_id, created_at, description, amount, reference_id, gateway, refund_of, credited FROM invoice_payments WHERE gateway = $1 AND reference_id = $2 ORDER BY id ASC LIMIT 1
+`
+
+type FindInvoicePaymentByReferenceParams struct {
+	Gateway     string `json:"gateway"`
+	ReferenceID string `json:"reference_id"`
+}
+
+func (q *Queries) FindInvoicePaymentByReference(ctx context.Context, arg FindInvoicePaymentByReferenceParams) (InvoicePayment, error) {
+	row := q.db.QueryRow(ctx, findInvoicePaymentByReference, arg.Gateway, arg.ReferenceID)
+	var i InvoicePayment
+	err := row.Scan(
+		&i.ID,
+		&i.InvoiceID,
+		&i.CreatedAt,
+		&i.Description,
+		&i.Amount,
+		&i.ReferenceID,
+		&i.Gateway,
+		&i.RefundOf,
+		&i.Credited,
+	)
+	return i, err
+}
+
+const findInvoicesForLateFee = `-- name: FindInvoicesForLateFee :many
+SELECT invoices.id, invoices.user_id, invoices.status, invoices.cancellation_reason, invoices.paid_at, invoices.due_at, invoices.amount, invoices.created_at, invoices.currency, invoices.subtotal, invoices.tax, invoices.tax_rate, invoices.tax_name, invoices.tax_inclusive, invoices.reverse_charge, invoices.number FROM invoices INNER JOIN users ON invoices.user_id = users.id WHERE invoices.status = 'UNPAID' AND invoices.due_at <= CURRENT_TIMESTAMP - make_interval(days => $1::integer) AND NOT users.late_fee_exempt AND EXISTS (SELECT 1 FROM invoice_items INNER JOIN services ON invoice_items.item_id = services.id WHERE invoice_items.invoice_id = invoices.id AND invoice_items.type = 'service' AND services.status NOT IN ('UNPAID', 'PENDING')) AND NOT EXISTS (SELECT 1 FROM invoice_items WHERE invoice_items.invoice_id = invoices.id AND invoice_items.type = 'late_fee') ORDER BY invoices.id
+`
+
+func (q *Queries) FindInvoicesForLateFee(ctx context.Context, graceDays int32) ([]Invoice, error) {
+	rows, err := q.db.Query(ctx, findInvoicesForLateFee, graceDays)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Invoice{}
+	for rows.Next() {
+		var i Invoice
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Status,
+			&i.CancellationReason,
+			&i.PaidAt,
+			&i.DueAt,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.Currency,
+			&i.Subtotal,
+			&i.Tax,
+			&i.TaxRate,
+			&i.TaxName,
+			&i.TaxInclusive,
+			&i.ReverseCharge,
+			&i.Number,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findNewInvoicesWithoutReminder = `-- name: FindNewInvoicesWithoutReminder :many
+SELECT id, user_id, status, cancellation_reason, paid_at, due_at, amount, created_at, currency, subtotal, tax, tax_rate, tax_name, tax_inclusive, reverse_charge, number FROM invoices WHERE status = 'UNPAID' AND created_at >= CURRENT_TIMESTAMP - interval '1 day' AND NOT EXISTS (SELECT 1 FROM invoice_reminders WHERE invoice_reminders.invoice_id = invoices.id AND invoice_reminders.stage = 'created') ORDER BY id
+`
+
+func (q *Queries) FindNewInvoicesWithoutReminder(ctx context.Context) ([]Invoice, error) {
+	rows, err := q.db.Query(ctx, findNewInvoicesWithoutReminder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Invoice{}
+	for rows.Next() {
+		var i Invoice
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Status,
+			&i.CancellationReason,
+			&i.PaidAt,
+			&i.DueAt,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.Currency,
+			&i.Subtotal,
+			&i.Tax,
+			&i.TaxRate,
+			&i.TaxName,
+			&i.TaxInclusive,
+			&i.ReverseCharge,
+			&i.Number,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findOverdueInvoices = `-- name: FindOverdueInvoices :many
+SELECT id, user_id, status, cancellation_reason, paid_at, due_at, amount, created_at, currency, subtotal, tax, tax_rate, tax_name, tax_inclusive, reverse_charge, number FROM invoices WHERE status = 'UNPAID' AND due_at <= CURRENT_TIMESTAMP ORDER BY id
+`
+
+func (q *Queries) FindOverdueInvoices(ctx context.Context) ([]Invoice, error) {
+	rows, err := q.db.Query(ctx, findOverdueInvoices)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Invoice{}
+	for rows.Next() {
+		var i Invoice
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Status,
+			&i.CancellationReason,
+			&i.PaidAt,
+			&i.DueAt,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.Currency,
+			&i.Subtotal,
+			&i.Tax,
+			&i.TaxRate,
+			&i.TaxName,
+			&i.TaxInclusive,
+			&i.ReverseCharge,
+			&i.Number,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findOverdueServices = `-- name: FindOverdueServices :many
+SELECT id, label, user_id, status, cancellation_reason, billing_cycle, price, extension, settings, expires_at, created_at, cancelled_at, currency, discount, product_id, suspension_reason, billing_cycle_months, billing_day, usage_billed_until, affiliate_id, order_ip, order_country, review_reason, discount_rate FROM services WHERE (status = 'SUSPENDED' OR status = 'ACTIVE' OR status = 'PENDING') AND expires_at <= CURRENT_TIMESTAMP ORDER BY id
+`
+
+func (q *Queries) FindOverdueServices(ctx context.Context) ([]Service, error) {
+	rows, err := q.db.Query(ctx, findOverdueServices)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Service{}
+	for rows.Next() {
+		var i Service
+		if err := rows.Scan(
+			&i.ID,
+			&i.Label,
+			&i.UserID,
+			&i.Status,
+			&i.CancellationReason,
+			&i.BillingCycle,
+			&i.Price,
+			&i.Extension,
+			&i.Settings,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+			&i.CancelledAt,
+			&i.Currency,
+			&i.Discount,
+			&i.ProductID,
+			&i.SuspensionReason,
+			&i.BillingCycleMonths,
+			&i.BillingDay,
+			&i.UsageBilledUntil,
+			&i.AffiliateID,
+			&i.OrderIp,
+			&i.OrderCountry,
+			&i.ReviewReason,
+			&i.DiscountRate,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findProductById = `-- name: FindProductById :one
+SELECT id, name, description, category_id, extension, enabled, pricing, settings, stock, stock_control, invoice_days_before_expiry, suspend_days_after_due, terminate_days_after_suspension, billing_anchor_day, metered_pricing, trial_days, trial_requires_payment_method, trial_once_per_user, commission_percent, commission_recurring FROM products WHERE id = $1
+`
+
+func (q *Queries) FindProductById(ctx context.Context, id int32) (Product, error) {
+	row := q.db.QueryRow(ctx, findProductById, id)
+	var i Product
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Description,
+		&i.CategoryID,
+		&i.Extension,
+		&i.Enabled,
+		&i.Pricing,
+		&i.Settings,
+		&i.Stock,
+		&i.StockControl,
+		&i.InvoiceDaysBeforeExpiry,
+		&i.SuspendDaysAfterDue,
+		&i.TerminateDaysAfterSuspension,
+		&i.BillingAnchorDay,
+		&i.MeteredPricing,
+		&i.TrialDays,
+		&i.TrialRequiresPaymentMethod,
+		&i.TrialOncePerUser,
+		&i.CommissionPercent,
+		&i.CommissionRecurring,
+	)
+	return i, err
+}
+
+const findProductOptionsByProduct = `-- name: FindProductOptionsByProduct :many
+SELECT product_id, name, display_name, type, regex, values, description FROM product_options WHERE product_id = $1
+`
+
+func (q *Queries) FindProductOptionsByProduct(ctx context.Context, productID int32) ([]ProductOption, error) {
+	rows, err := q.db.Query(ctx, findProductOptionsByProduct, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ProductOption{}
+	for rows.Next() {
+		var i ProductOption
+		if err := rows.Scan(
+			&i.ProductID,
+			&i.Name,
+			&i.DisplayName,
+			&i.Type,
+			&i.Regex,
+			&i.Values,
+			&i.Description,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findProductsByCategory = `-- name: FindProductsByCategory :many
+SELECT id, name, description, category_id, extension, enabled, pricing, settings, stock, stock_control, invoice_days_before_expiry, suspend_days_after_due, terminate_days_after_suspension, billing_anchor_day, metered_pricing, trial_days, trial_requires_payment_method, trial_once_per_user, commission_percent, commission_recurring FROM products WHERE category_id = $1 ORDER BY id
+`
+
+func (q *Queries) FindProductsByCategory(ctx context.Context, categoryID int32) ([]Product, error) {
+	rows, err := q.db.Query(ctx, findProductsByCategory, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Product{}
+	for rows.Next() {
+		var i Product
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.CategoryID,
+			&i.Extension,
+			&i.Enabled,
+			&i.Pricing,
+			&i.Settings,
+			&i.Stock,
+			&i.StockControl,
+			&i.InvoiceDaysBeforeExpiry,
+			&i.SuspendDaysAfterDue,
+			&i.TerminateDaysAfterSuspension,
+			&i.BillingAnchorDay,
+			&i.MeteredPricing,
+			&i.TrialDays,
+			&i.TrialRequiresPaymentMethod,
+			&i.TrialOncePerUser,
+			&i.CommissionPercent,
+			&i.CommissionRecurring,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findServerById = `-- name: FindServerById :one
+SELECT id, label, extension, settings FROM servers WHERE id = $1
+`
+
+func (q *Queries) FindServerById(ctx context.Context, id int32) (Server, error) {
+	row := q.db.QueryRow(ctx, findServerById, id)
+	var i Server
+	err := row.Scan(
+		&i.ID,
+		&i.Label,
+		&i.Extension,
+		&i.Settings,
+	)
+	return i, err
+}
+
+const findServiceById = `-- name: FindServiceById :one
+SELECT id, label, user_id, status, cancellation_reason, billing_cycle, price, extension, settings, expires_at, created_at, cancelled_at, currency, discount, product_id, suspension_reason, billing_cycle_months, billing_day, usage_billed_until, affiliate_id, order_ip, order_country, review_reason, discount_rate FROM services WHERE id = $1
+`
+
+func (q *Queries) FindServiceById(ctx context.Context, id int32) (Service, error) {
+	row := q.db.QueryRow(ctx, findServiceById, id)
+	var i Service
+	err := row.Scan(
+		&i.ID,
+		&i.Label,
+		&i.UserID,
+		&i.Status,
+		&i.CancellationReason,
+		&i.BillingCycle,
+		&i.Price,
+		&i.Extension,
+		&i.Settings,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.CancelledAt,
+		&i.Currency,
+		&i.Discount,
+		&i.ProductID,
+		&i.SuspensionReason,
+		&i.BillingCycleMonths,
+		&i.BillingDay,
+		&i.UsageBilledUntil,
+		&i.AffiliateID,
+		&i.OrderIp,
+		&i.OrderCountry,
+		&i.ReviewReason,
+		&i.DiscountRate,
+	)
+	return i, err
+}
+
+const findServiceByIdForUpdate = `-- name: FindServiceByIdForUpdate :one
+SELECT id, label, user_id, status, cancellation_reason, billing_cycle, price, extension, settings, expires_at, created_at, cancelled_at, currency, discount, product_id, suspension_reason, billing_cycle_months, billing_day, usage_billed_until, affiliate_id, order_ip, order_country, review_reason, discount_rate FROM services WHERE id = $1 FOR UPDATE
+`
+
+func (q *Queries) FindServiceByIdForUpdate(ctx context.Context, id int32) (Service, error) {
+	row := q.db.QueryRow(ctx, findServiceByIdForUpdate, id)
+	var i Service
+	err := row.Scan(
+		&i.ID,
+		&i.Label,
+		&i.UserID,
+		&i.Status,
+		&i.CancellationReason,
+		&i.BillingCycle,
+		&i.Price,
+		&i.Extension,
+		&i.Settings,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.CancelledAt,
+		&i.Currency,
+		&i.Discount,
+		&i.ProductID,
+		&i.SuspensionReason,
+		&i.BillingCycleMonths,
+		&i.BillingDay,
+		&i.UsageBilledUntil,
+		&i.AffiliateID,
+		&i.OrderIp,
+		&i.OrderCountry,
+		&i.ReviewReason,
+		&i.DiscountRate,
+	)
+	return i, err
+}
+
+const findServiceByIdWithName = `-- name: FindServiceByIdWithName :one
+SELECT services.id, services.label, services.user_id, services.status, services.cancellation_reason, services.billing_cycle, services.price, services.extension, services.settings, services.expires_at, services.created_at, services.cancelled_at, services.currency, services.discount, services.product_id, services.suspension_reason, services.billing_cycle_months, services.billing_day, services.usage_billed_until, services.affiliate_id, services.order_ip, services.order_country, services.review_reason, services.discount_rate, users.name FROM services INNER JOIN users ON services.user_id = users.id WHERE services.id = $1
+`
+
+type FindServiceByIdWithNameRow struct {
+	ID                 int32                 `json:"id"`
+	Label              string                `json:"label"`
+	UserID             int32                 `json:"user_id"`
+	Status             string                `json:"status"`
+	CancellationReason pgtype.Text           `json:"cancellation_reason"`
+	BillingCycle       int32                 `json:"billing_cycle"`
+	Price              decimal.Decimal       `json:"price"`
+	Extension          string                `json:"extension"`
+	Settings           types.ServiceSettings `json:"settings"`
+	ExpiresAt          types.Timestamp       `json:"expires_at"`
+	CreatedAt          types.Timestamp       `json:"created_at"`
+	CancelledAt        types.Timestamp       `json:"cancelled_at"`
+	Currency           string                `json:"currency"`
+	Discount           decimal.Decimal       `json:"discount"`
+	ProductID          pgtype.Int4           `json:"product_id"`
+	SuspensionReason   pgtype.Text           `json:"suspension_reason"`
+	BillingCycleMonths int32                 `json:"billing_cycle_months"`
+	BillingDay         int32                 `json:"billing_day"`
+	UsageBilledUntil   types.Timestamp       `json:"usage_billed_until"`
+	AffiliateID        pgtype.Int4           `json:"affiliate_id"`
+	OrderIp            string                `json:"order_ip"`
+	OrderCountry       string                `json:"order_country"`
+	ReviewReason       pgtype.Text           `json:"review_reason"`
+	DiscountRate       decimal.Decimal       `json:"discount_rate"`
+	Name               string                `json:"name"`
+}
+
+func (q *Queries) FindServiceByIdWithName(ctx context.Context, id int32) (FindServiceByIdWithNameRow, error) {
+	row := q.db.QueryRow(ctx, findServiceByIdWithName, id)
+	var i FindServiceByIdWithNameRow
+	err := row.Scan(
+		&i.ID,
+		&i.Label,
+		&i.UserID,
+		&i.Status,
+		&i.CancellationReason,
+		&i.BillingCycle,
+		&i.Price,
+		&i.Extension,
+		&i.Settings,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+		&i.CancelledAt,
+		&i.Currency,
+		&i.Discount,
+		&i.ProductID,
+		&i.SuspensionReason,
+		&i.BillingCycleMonths,
+		&i.BillingDay,
+		&i.UsageBilledUntil,
+		&i.AffiliateID,
+		&i.OrderIp,
+		&i.OrderCountry,
+		&i.ReviewReason,
+		&i.DiscountRate,
+		&i.Name,
+	)
+	return i, err
+}
+
+const findServiceByUser = `-- name: FindServiceByUser :many
+
+SELECT id, label, user_id, status, cancellation_reason, billing_cycle, price, extension, settings, expires_at, created_at, cancelled_at, currency, discount, product_id, suspension_reason, billing_cycle_months, billing_day, usage_billed_until, affiliate_id, order_ip, order_country, review_reason, discount_rate FROM services WHERE user_id = $1 ORDER BY id DESC
+`
+
+// SERVICES --
+func (q *Queries) FindServiceByUser(ctx context.Context, userID int32) ([]Service, error) {
+	rows, err := q.db.Query(ctx, findServiceByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Service{}
+	for rows.Next() {
+		var i Service
+		if err := rows.Scan(
+			&i.ID,
+			&i.Label,
+			&i.UserID,
+			&i.Status,
+			&i.CancellationReason,
+			&i.BillingCycle,
+			&i.Price,
+			&i.Extension,
+			&i.Settings,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+			&i.CancelledAt,
+			&i.Currency,
+			&i.Discount,
+			&i.ProductID,
+			&i.SuspensionReason,
+			&i.BillingCycleMonths,
+			&i.BillingDay,
+			&i.UsageBilledUntil,
+			&i.AffiliateID,
+			&i.OrderIp,
+			&i.OrderCountry,
+			&i.ReviewReason,
+			&i.DiscountRate,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findServiceUpgradeByIdForUpdate = `-- name: FindServiceUpgradeByIdForUpdate :one
+SELECT id, service_id, invoice_id, product_id, settings, price, amount, status, created_at FROM service_upgrades WHERE id = $1 FOR UPDATE
+`
+
+func (q *Queries) FindServiceUpgradeByIdForUpdate(ctx context.Context, id int32) (ServiceUpgrade, error) {
+	row := q.db.QueryRow(ctx, findServiceUpgradeByIdForUpdate, id)
+	var i ServiceUpgrade
+	err := row.Scan(
+		&i.ID,
+		&i.ServiceID,
+		&i.InvoiceID,
+		&i.ProductID,
+		&i.Settings,
+		&i.Price,
+		&i.Amount,
+		&i.Status,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const findServicesForRenewal = `-- name: FindServicesForRenewal :many
+SELECT services.id, services.label, services.user_id, services.status, services.cancellation_reason, services.billing_cycle, services.price, services.extension, services.settings, services.expires_at, services.created_at, services.cancelled_at, services.currency, services.discount, services.product_id, services.suspension_reason, services.billing_cycle_months, services.billing_day, services.usage_billed_until, services.affiliate_id, services.order_ip, services.order_country, services.review_reason, services.discount_rate FROM services
+LEFT JOIN products ON services.product_id = products.id
+WHERE (services.status = 'ACTIVE' OR services.status = 'SUSPENDED' OR services.status = 'PENDING')
+AND services.expires_at <= (CURRENT_TIMESTAMP + make_interval(days => COALESCE(products.invoice_days_before_expiry, $1::integer))) AND services.expires_at > CURRENT_TIMESTAMP
+AND NOT EXISTS (
+    SELECT 1 FROM invoices 
+    JOIN invoice_items ON invoices.id = invoice_items.invoice_id 
+    WHERE invoice_items.item_id = services.id 
+    AND invoice_items.type = 'service' 
+    AND invoices.status = 'UNPAID'
+)
+`
+
+func (q *Queries) FindServicesForRenewal(ctx context.Context, defaultDays int32) ([]Service, error) {
+	rows, err := q.db.Query(ctx, findServicesForRenewal, defaultDays)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Service{}
+	for rows.Next() {
+		var i Service
+		if err := rows.Scan(
+			&i.ID,
+			&i.Label,
+			&i.UserID,
+			&i.Status,
+			&i.CancellationReason,
+			&i.BillingCycle,
+			&i.Price,
+			&i.Extension,
+			&i.Settings,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+			&i.CancelledAt,
+			&i.Currency,
+			&i.Discount,
+			&i.ProductID,
+			&i.SuspensionReason,
+			&i.BillingCycleMonths,
+			&i.BillingDay,
+			&i.UsageBilledUntil,
+			&i.AffiliateID,
+			&i.OrderIp,
+			&i.OrderCountry,
+			&i.ReviewReason,
+			&i.DiscountRate,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findSessionByToken = `-- name: FindSessionByToken :one
+
+SELECT id, token, user_id, created_at, expires_at FROM sessions WHERE token = $1 AND expires_at > CURRENT_TIMESTAMP
+`
+
+// SESSIONS --
+func (q *Queries) FindSessionByToken(ctx context.Context, token string) (Session, error) {
+	row := q.db.QueryRow(ctx, findSessionByToken, token)
+	var i Session
+	err := row.Scan(
+		&i.ID,
+		&i.Token,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const findSettingByKey = `-- name: FindSettingByKey :one
+
+SELECT id, key, value FROM settings WHERE key = $1
+`
+
+// SETTINGS --
+func (q *Queries) FindSettingByKey(ctx context.Context, key string) (Setting, error) {
+	row := q.db.QueryRow(ctx, findSettingByKey, key)
+	var i Setting
+	err := row.Scan(&i.ID, &i.Key, &i.Value)
+	return i, err
+}
+
+const findSuspendedInvoicesWithoutReminder = `-- name: FindSuspendedInvoicesWithoutReminder :many
+SELECT id, user_id, status, cancellation_reason, paid_at, due_at, amount, created_at, currency, subtotal, tax, tax_rate, tax_name, tax_inclusive, reverse_charge, number FROM invoices WHERE status = 'UNPAID' AND EXISTS (SELECT 1 FROM invoice_items INNER JOIN services ON invoice_items.item_id = services.id WHERE invoice_items.invoice_id = invoices.id AND invoice_items.type = 'service' AND services.status = 'SUSPENDED' AND services.suspension_reason = 'overdue') AND NOT EXISTS (SELECT 1 FROM invoice_reminders WHERE invoice_reminders.invoice_id = invoices.id AND invoice_reminders.stage = 'suspended') ORDER BY id
+`
+
+func (q *Queries) FindSuspendedInvoicesWithoutReminder(ctx context.Context) ([]Invoice, error) {
+	rows, err := q.db.Query(ctx, findSuspendedInvoicesWithoutReminder)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Invoice{}
+	for rows.Next() {
+		var i Invoice
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Status,
+			&i.CancellationReason,
+			&i.PaidAt,
+			&i.DueAt,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.Currency,
+			&i.Subtotal,
+			&i.Tax,
+			&i.TaxRate,
+			&i.TaxName,
+			&i.TaxInclusive,
+			&i.ReverseCharge,
+			&i.Number,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findTaxRule = `-- name: FindTaxRule :one
+SELECT id, name, country, state, rate, inclusive, reverse_charge FROM tax_rules WHERE lower(country) = lower($1::text) AND (state = '' OR lower(state) = lower($2::text)) ORDER BY state DESC, id LIMIT 1
+`
+
+type FindTaxRuleParams struct {
+	Country string `json:"country"`
+	State   string `json:"state"`
+}
+
+func (q *Queries) FindTaxRule(ctx context.Context, arg FindTaxRuleParams) (TaxRule, error) {
+	row := q.db.QueryRow(ctx, findTaxRule, arg.Country, arg.State)
+	var i TaxRule
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Country,
+		&i.State,
+		&i.Rate,
+		&i.Inclusive,
+		&i.ReverseCharge,
+	)
+	return i, err
+}
+
+const findTaxRuleById = `-- name: FindTaxRuleById :one
+SELECT id, name, country, state, rate, inclusive, reverse_charge FROM tax_rules WHERE id = $1
+`
+
+func (q *Queries) FindTaxRuleById(ctx context.Context, id int32) (TaxRule, error) {
+	row := q.db.QueryRow(ctx, findTaxRuleById, id)
+	var i TaxRule
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Country,
+		&i.State,
+		&i.Rate,
+		&i.Inclusive,
+		&i.ReverseCharge,
+	)
+	return i, err
+}
+
+const findUpcomingInvoicesWithoutReminder = `-- name: FindUpcomingInvoicesWithoutReminder :many
+SELECT id, user_id, status, cancellation_reason, paid_at, due_at, amount, created_at, currency, subtotal, tax, tax_rate, tax_name, tax_inclusive, reverse_charge, number FROM invoices WHERE status = 'UNPAID' AND due_at > CURRENT_TIMESTAMP AND due_at <= CURRENT_TIMESTAMP + make_interval(days => $1::integer) AND created_at < due_at - make_interval(days => $1::integer) AND NOT EXISTS (SELECT 1 FROM invoice_reminders WHERE invoice_reminders.invoice_id = invoices.id AND invoice_reminders.stage = 'upcoming') ORDER BY id
+`
+
+func (q *Queries) FindUpcomingInvoicesWithoutReminder(ctx context.Context, days int32) ([]Invoice, error) {
+	rows, err := q.db.Query(ctx, findUpcomingInvoicesWithoutReminder, days)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Invoice{}
+	for rows.Next() {
+		var i Invoice
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Status,
+			&i.CancellationReason,
+			&i.PaidAt,
+			&i.DueAt,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.Currency,
+			&i.Subtotal,
+			&i.Tax,
+			&i.TaxRate,
+			&i.TaxName,
+			&i.TaxInclusive,
+			&i.ReverseCharge,
+			&i.Number,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const findUserByEmail = `-- name: FindUserByEmail :one
+SELECT id, email, name, role, password, address, city, state, country, zip_code, credit, currency, vat_id, vat_id_valid, email_reminders, late_fee_exempt, billing_anchor_day, referral_code, referred_by FROM users WHERE email = $1
+`
+
+func (q *Queries) FindUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRow(ctx, findUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Name,
+		&i.Role,
+		&i.Password,
+		&i.Address,
+		&i.City,
+		&i.State,
+		&i.Country,
+		&i.ZipCode,
+		&i.Credit,
+		&i.Currency,
+		&i.VatID,
+		&i.VatIDValid,
+		&i.EmailReminders,
+		&i.LateFeeExempt,
+		&i.BillingAnchorDay,
+		&i.ReferralCode,
+		&i.ReferredBy,
+	)
+	return i, err
+}
+
+const findUserById = `-- name: FindUserById :one
+SELECT id, email, name, role, password, address, city, state, country, zip_code, credit, currency, vat_id, vat_id_valid, email_reminders, late_fee_exempt, billing_anchor_day, referral_code, referred_by FROM users WHERE id = $1
+`
+
+func (q *Queries) FindUserById(ctx context.Context, id int32) (User, error) {
+	row := q.db.QueryRow(ctx, findUserById, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Name,
+		&i.Role,
+		&i.Password,
+		&i.Address,
+		&i.City,
+		&i.State,
+		&i.Country,
+		&i.ZipCode,
+		&i.Credit,
+		&i.Currency,
+		&i.VatID,
+		&i.VatIDValid,
+		&i.EmailReminders,
+		&i.LateFeeExempt,
+		&i.BillingAnchorDay,
+		&i.ReferralCode,
+		&i.ReferredBy,
+	)
+	return i, err
+}
+
+const findUserByIdForUpdate = `-- name: FindUserByIdForUpdate :one
+SELECT id, email, name, role, password, address, city, state, country, zip_code, credit, currency, vat_id, vat_id_valid, email_reminders, late_fee_exempt, billing_anchor_day, referral_code, referred_by FROM users WHERE id = $1 FOR UPDATE
+`
+
+func (q *Queries) FindUserByIdForUpdate(ctx context.Context, id int32) (User, error) {
+	row := q.db.QueryRow(ctx, findUserByIdForUpdate, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Name,
+		&i.Role,
+		&i.Password,
+		&i.Address,
+		&i.City,
+		&i.State,
+		&i.Country,
+		&i.ZipCode,
+		&i.Credit,
+		&i.Currency,
+		&i.VatID,
+		&i.VatIDValid,
+		&i.EmailReminders,
+		&i.LateFeeExempt,
+		&i.BillingAnchorDay,
+		&i.ReferralCode,
+		&i.ReferredBy,
+	)
+	return i, err
+}
+
+const findUserByReferralCode = `-- name: FindUserByReferralCode :one
+SELECT id, email, name, role, password, address, city, state, country, zip_code, credit, currency, vat_id, vat_id_valid, email_reminders, late_fee_exempt, billing_anchor_day, referral_code, referred_by FROM users WHERE referral_code = $1
+`
+
+func (q *Queries) FindUserByReferralCode(ctx context.Context, referralCode pgtype.Text) (User, error) {
+	row := q.db.QueryRow(ctx, findUserByReferralCode, referralCode)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Name,
+		&i.Role,
+		&i.Password,
+		&i.Address,
+		&i.City,
+		&i.State,
+		&i.Country,
+		&i.ZipCode,
+		&i.Credit,
+		&i.Currency,
+		&i.VatID,
+		&i.VatIDValid,
+		&i.EmailReminders,
+		&i.LateFeeExempt,
+		&i.BillingAnchorDay,
+		&i.ReferralCode,
+		&i.ReferredBy,
+	)
+	return i, err
+}
+
+const increaseCouponUses = `-- name: IncreaseCouponUses :exec
+UPDATE coupons SET uses = uses + 1 WHERE id = $1
+`
+
+func (q *Queries) IncreaseCouponUses(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, increaseCouponUses, id)
+	return err
+}
+
+const listCartItems = `-- name: ListCartItems :many
+SELECT id, cart_id, product_id, duration, options, coupon, created_at FROM cart_items WHERE cart_id = $1 ORDER BY id
+`
+
+func (q *Queries) ListCartItems(ctx context.Context, cartID int32) ([]CartItem, error) {
+	rows, err := q.db.Query(ctx, listCartItems, cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CartItem{}
+	for rows.Next() {
+		var i CartItem
+		if err := rows.Scan(
+			&i.ID,
+			&i.CartID,
+			&i.ProductID,
+			&i.Duration,
+			&i.Options,
+			&i.Coupon,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCategories = `-- name: ListCategories :many
+SELECT id, name, description FROM categories ORDER BY id
+`
+
+func (q *Queries) ListCategories(ctx context.Context) ([]Category, error) {
+	rows, err := q.db.Query(ctx, listCategories)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Category{}
+	for rows.Next() {
+		var i Category
+		if err := rows.Scan(&i.ID, &i.Name, &i.Description); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCommissionsPaged = `-- name: ListCommissionsPaged :many
+SELECT id, affiliate_id, invoice_id, amount, reversed, paid_out, created_at FROM commissions WHERE affiliate_id = $1 ORDER BY id DESC LIMIT $2 OFFSET $3
+`
+
+type ListCommissionsPagedParams struct {
+	AffiliateID int32 `json:"affiliate_id"`
+	Limit       int32 `json:"limit"`
+	Offset      int32 `json:"offset"`
+}
+
+func (q *Queries) ListCommissionsPaged(ctx context.Context, arg ListCommissionsPagedParams) ([]Commission, error) {
+	rows, err := q.db.Query(ctx, listCommissionsPaged, arg.AffiliateID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Commission{}
+	for rows.Next() {
+		var i Commission
+		if err := rows.Scan(
+			&i.ID,
+			&i.AffiliateID,
+			&i.InvoiceID,
+			&i.Amount,
+			&i.Reversed,
+			&i.PaidOut,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCoupons = `-- name: ListCoupons :many
+SELECT id, code, type, value, currency, product_ids, durations, recurring, max_uses, max_uses_per_user, uses, valid_from, valid_until, enabled, created_at FROM coupons ORDER BY id DESC
+`
+
+func (q *Queries) ListCoupons(ctx context.Context) ([]Coupon, error) {
+	rows, err := q.db.Query(ctx, listCoupons)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Coupon{}
+	for rows.Next() {
+		var i Coupon
+		if err := rows.Scan(
+			&i.ID,
+			&i.Code,
+			&i.Type,
+			&i.Value,
+			&i.Currency,
+			&i.ProductIds,
+			&i.Durations,
+			&i.Recurring,
+			&i.MaxUses,
+			&i.MaxUsesPerUser,
+			&i.Uses,
+			&i.ValidFrom,
+			&i.ValidUntil,
+			&i.Enabled,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCreditNoteItems = `-- name: ListCreditNoteItems :many
+SELECT id, credit_note_id, description, amount FROM credit_note_items WHERE credit_note_id = $1 ORDER BY id
+`
+
+func (q *Queries) ListCreditNoteItems(ctx context.Context, creditNoteID int32) ([]CreditNoteItem, error) {
+	rows, err := q.db.Query(ctx, listCreditNoteItems, creditNoteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CreditNoteItem{}
+	for rows.Next() {
+		var i CreditNoteItem
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreditNoteID,
+			&i.Description,
+			&i.Amount,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCreditNotesByInvoice = `-- name: ListCreditNotesByInvoice :many
+SELECT id, number, invoice_id, user_id, reason, subtotal, tax, amount, currency, created_at FROM credit_notes WHERE invoice_id = $1 ORDER BY id
+`
+
+func (q *Queries) ListCreditNotesByInvoice(ctx context.Context, invoiceID int32) ([]CreditNote, error) {
+	rows, err := q.db.Query(ctx, listCreditNotesByInvoice, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CreditNote{}
+	for rows.Next() {
+		var i CreditNote
+		if err := rows.Scan(
+			&i.ID,
+			&i.Number,
+			&i.InvoiceID,
+			&i.UserID,
+			&i.Reason,
+			&i.Subtotal,
+			&i.Tax,
+			&i.Amount,
+			&i.Currency,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listCreditTransactionsPaged = `-- name: ListCreditTransactionsPaged :many
+SELECT id, user_id, type, amount, description, invoice_id, created_at FROM credit_transactions WHERE user_id = $1 ORDER BY id DESC LIMIT $2 OFFSET $3
+`
+
+type ListCreditTransactionsPagedParams struct {
+	UserID int32 `json:"user_id"`
+	Limit  int32 `json:"limit"`
+	Offset int32 `json:"offset"`
+}
+
+func (q *Queries) ListCreditTransactionsPaged(ctx context.Context, arg ListCreditTransactionsPagedParams) ([]CreditTransaction, error) {
+	rows, err := q.db.Query(ctx, listCreditTransactionsPaged, arg.UserID, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CreditTransaction{}
+	for rows.Next() {
+		var i CreditTransaction
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Type,
+			&i.Amount,
+			&i.Description,
+			&i.InvoiceID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEnabledGateways = `-- name: ListEnabledGateways :many
+SELECT display_name, name FROM gateways WHERE enabled = true ORDER BY id ASC
+`
+
+type ListEnabledGatewaysRow struct {
+	DisplayName string `json:"display_name"`
+	Name        string `json:"name"`
+}
+
+func (q *Queries) ListEnabledGateways(ctx context.Context) ([]ListEnabledGatewaysRow, error) {
+	rows, err := q.db.Query(ctx, listEnabledGateways)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListEnabledGatewaysRow{}
+	for rows.Next() {
+		var i ListEnabledGatewaysRow
+		if err := rows.Scan(&i.DisplayName, &i.Name); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEnabledProducts = `-- name: ListEnabledProducts :many
+SELECT id, name, description, category_id, extension, enabled, pricing, settings, stock, stock_control, invoice_days_before_expiry, suspend_days_after_due, terminate_days_after_suspension, billing_anchor_day, metered_pricing, trial_days, trial_requires_payment_method, trial_once_per_user, commission_percent, commission_recurring FROM products WHERE enabled ORDER BY id
+`
+
+func (q *Queries) ListEnabledProducts(ctx context.Context) ([]Product, error) {
+	rows, err := q.db.Query(ctx, listEnabledProducts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Product{}
+	for rows.Next() {
+		var i Product
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.CategoryID,
+			&i.Extension,
+			&i.Enabled,
+			&i.Pricing,
+			&i.Settings,
+			&i.Stock,
+			&i.StockControl,
+			&i.InvoiceDaysBeforeExpiry,
+			&i.SuspendDaysAfterDue,
+			&i.TerminateDaysAfterSuspension,
+			&i.BillingAnchorDay,
+			&i.MeteredPricing,
+			&i.TrialDays,
+			&i.TrialRequiresPaymentMethod,
+			&i.TrialOncePerUser,
+			&i.CommissionPercent,
+			&i.CommissionRecurring,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listGatewayOrdersByStatus = `-- name: ListGatewayOrdersByStatus :many
+SELECT id, gateway, order_id, invoice_id, status, created_at FROM gateway_orders WHERE gateway = $1 AND status = $2 ORDER BY id ASC
+`
+
+type ListGatewayOrdersByStatusParams struct {
+	Gateway string `json:"gateway"`
+	Status  string `json:"status"`
+}
+
+func (q *Queries) ListGatewayOrdersByStatus(ctx context.Context, arg ListGatewayOrdersByStatusParams) ([]GatewayOrder, error) {
+	rows, err := q.db.Query(ctx, listGatewayOrdersByStatus, arg.Gateway, arg.Status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []GatewayOrder{}
+	for rows.Next() {
+		var i GatewayOrder
+		if err := rows.Scan(
+			&i.ID,
+			&i.Gateway,
+			&i.OrderID,
+			&i.InvoiceID,
+			&i.Status,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listGatewayNames = `-- name: ListGatewayNames :many
+SELECT name FROM gateways ORDER BY id ASC
+`
+
+func (q *Queries) ListGatewayNames(ctx context.Context) ([]string, error) {
+	rows, err := q.db.Query(ctx, listGatewayNames)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		items = append(items, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listGateways = `-- name: ListGateways :many
+
+SELECT id, display_name, name, settings, enabled, fee FROM gateways ORDER BY id ASC
+`
+
+// GATEWAYS --
+func (q *Queries) ListGateways(ctx context.Context) ([]Gateway, error) {
+	rows, err := q.db.Query(ctx, listGateways)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Gateway{}
+	for rows.Next() {
+		var i Gateway
+		if err := rows.Scan(
+			&i.ID,
+			&i.DisplayName,
+			&i.Name,
+			&i.Settings,
+			&i.Enabled,
+			&i.Fee,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listInvoiceCommissionBases = `-- name: ListInvoiceCommissionBases :many
+SELECT services.id AS service_id, services.affiliate_id, services.product_id, SUM(invoice_items.amount)::decimal AS amount, EXISTS (SELECT 1 FROM invoice_items earlier INNER JOIN invoices ON earlier.invoice_id = invoices.id WHERE earlier.type = 'service' AND earlier.item_id = services.id AND earlier.invoice_id <> $1 AND invoices.status IN ('PAID', 'PARTIALLY_REFUNDED', 'REFUNDED')) AS renewal FROM invoice_items LEFT JOIN service_upgrades ON invoice_items.type = 'upgrade' AND invoice_items.item_id = service_upgrades.id INNER JOIN services ON services.id = COALESCE(service_upgrades.service_id, invoice_items.item_id) WHERE invoice_items.invoice_id = $1 AND invoice_items.type IN ('service', 'discount', 'upgrade', 'usage', 'proration') AND services.affiliate_id IS NOT NULL GROUP BY services.id ORDER BY services.id
+`
+
+type ListInvoiceCommissionBasesRow struct {
+	ServiceID   int32           `json:"service_id"`
+	AffiliateID pgtype.Int4     `json:"affiliate_id"`
+	ProductID   pgtype.Int4     `json:"product_id"`
+	Amount      decimal.Decimal `json:"amount"`
+	Renewal     bool            `json:"renewal"`
+}
+
+func (q *Queries) ListInvoiceCommissionBases(ctx context.Context, invoiceID int32) ([]ListInvoiceCommissionBasesRow, error) {
+	rows, err := q.db.Query(ctx, listInvoiceCommissionBases, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListInvoiceCommissionBasesRow{}
+	for rows.Next() {
+		var i ListInvoiceCommissionBasesRow
+		if err := rows.Scan(
+			&i.ServiceID,
+			&i.AffiliateID,
+			&i.ProductID,
+			&i.Amount,
+			&i.Renewal,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listInvoiceGatewayRefunds = `-- name: ListInvoiceGatewayRefunds :many
+SELECT id, payment_id, amount, description, status, reference_id, error, created_at FROM gateway_refunds WHERE payment_id IN (SELECT id FROM invoice_payments WHERE invoice_id = $1) ORDER BY id ASC
+`
+
+func (q *Queries) ListInvoiceGatewayRefunds(ctx context.Context, invoiceID int32) ([]GatewayRefund, error) {
+	rows, err := q.db.Query(ctx, listInvoiceGatewayRefunds, invoiceID)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
-	items := []Category{}
+	items := []GatewayRefund{}
 	for rows.Next() {
-		var i Category
-		if err := rows.Scan(&i.ID, &i.Name, &i.Description); err != nil {
+		var i GatewayRefund
+		if err := rows.Scan(
+			&i.ID,
+			&i.PaymentID,
+			&i.Amount,
+			&i.Description,
+			&i.Status,
+			&i.ReferenceID,
+			&i.Error,
+			&i.CreatedAt,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -1064,25 +3271,62 @@ func (q *Queries) ListCategories(ctx context.Context) ([]Category, error) {
 	return items, nil
 }
 
-const listEnabledGateways = `-- name: ListEnabledGateways :many
-SELECT display_name, name FROM gateways WHERE enabled = true ORDER BY id ASC
+const listInvoiceItems = `-- name: ListInvoiceItems :many
+SELECT id, invoice_id, description, amount, type, item_id, created_at FROM invoice_items WHERE invoice_id = $1 ORDER BY id
 `
 
-type ListEnabledGatewaysRow struct {
-	DisplayName string `json:"display_name"`
-	Name        string `json:"name"`
+func (q *Queries) ListInvoiceItems(ctx context.Context, invoiceID int32) ([]InvoiceItem, error) {
+	rows, err := q.db.Query(ctx, listInvoiceItems, invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []InvoiceItem{}
+	for rows.Next() {
+		var i InvoiceItem
+		if err := rows.Scan(
+			&i.ID,
+			&i.InvoiceID,
+			&i.Description,
+			&i.Amount,
+			&i.Type,
+			&i.ItemID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
-func (q *Queries) ListEnabledGateways(ctx context.Context) ([]ListEnabledGatewaysRow, error) {
-	rows, err := q.db.Query(ctx, listEnabledGateways)
+const listInvoicePayments = `-- name: ListInvoicePayments :many
+SELECT id, invoice_id, created_at, description, amount, reference_id, gateway, refund_of, credited FROM invoice_payments WHERE invoice_id = $1 ORDER BY id ASC
+`
+
+func (q *Queries) ListInvoicePayments(ctx context.Context, invoiceID int32) ([]InvoicePayment, error) {
+	rows, err := q.db.Query(ctx, listInvoicePayments, invoiceID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []ListEnabledGatewaysRow{}
+	items := []InvoicePayment{}
 	for rows.Next() {
-		var i ListEnabledGatewaysRow
-		if err := rows.Scan(&i.DisplayName, &i.Name); err != nil {
+		var i InvoicePayment
+		if err := rows.Scan(
+			&i.ID,
+			&i.InvoiceID,
+			&i.CreatedAt,
+			&i.Description,
+			&i.Amount,
+			&i.ReferenceID,
+			&i.Gateway,
+			&i.RefundOf,
+			&i.Credited,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -1093,30 +3337,280 @@ func (q *Queries) ListEnabledGateways(ctx context.Context) ([]ListEnabledGateway
 	return items, nil
 }
 
-const listEnabledProducts = `-- name: ListEnabledProducts :many
-SELECT id, name, description, category_id, extension, enabled, pricing, settings, stock, stock_control FROM products WHERE enabled ORDER BY id
+const listPayableCommissionsForUpdate = `-- name: ListPayableCommissionsForUpdate :many
+SELECT id, affiliate_id, invoice_id, amount, reversed, paid_out, created_at FROM commissions WHERE affiliate_id = $1 AND amount - reversed <> paid_out AND (created_at <= $2::timestamp OR amount - reversed < paid_out) ORDER BY id FOR UPDATE
 `
 
-func (q *Queries) ListEnabledProducts(ctx context.Context) ([]Product, error) {
-	rows, err := q.db.Query(ctx, listEnabledProducts)
+type ListPayableCommissionsForUpdateParams struct {
+	AffiliateID int32           `json:"affiliate_id"`
+	HeldUntil   types.Timestamp `json:"held_until"`
+}
+
+func (q *Queries) ListPayableCommissionsForUpdate(ctx context.Context, arg ListPayableCommissionsForUpdateParams) ([]Commission, error) {
+	rows, err := q.db.Query(ctx, listPayableCommissionsForUpdate, arg.AffiliateID, arg.HeldUntil)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Commission{}
+	for rows.Next() {
+		var i Commission
+		if err := rows.Scan(
+			&i.ID,
+			&i.AffiliateID,
+			&i.InvoiceID,
+			&i.Amount,
+			&i.Reversed,
+			&i.PaidOut,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listProducts = `-- name: ListProducts :many
+SELECT id, name, description, category_id, extension, enabled, pricing, settings, stock, stock_control, invoice_days_before_expiry, suspend_days_after_due, terminate_days_after_suspension, billing_anchor_day, metered_pricing, trial_days, trial_requires_payment_method, trial_once_per_user, commission_percent, commission_recurring FROM products ORDER BY id
+`
+
+func (q *Queries) ListProducts(ctx context.Context) ([]Product, error) {
+	rows, err := q.db.Query(ctx, listProducts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Product{}
+	for rows.Next() {
+		var i Product
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Description,
+			&i.CategoryID,
+			&i.Extension,
+			&i.Enabled,
+			&i.Pricing,
+			&i.Settings,
+			&i.Stock,
+			&i.StockControl,
+			&i.InvoiceDaysBeforeExpiry,
+			&i.SuspendDaysAfterDue,
+			&i.TerminateDaysAfterSuspension,
+			&i.BillingAnchorDay,
+			&i.MeteredPricing,
+			&i.TrialDays,
+			&i.TrialRequiresPaymentMethod,
+			&i.TrialOncePerUser,
+			&i.CommissionPercent,
+			&i.CommissionRecurring,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listServers = `-- name: ListServers :many
+
+SELECT id, label, extension, settings FROM servers ORDER BY id ASC
+`
+
+// SERVERS --
+func (q *Queries) ListServers(ctx context.Context) ([]Server, error) {
+	rows, err := q.db.Query(ctx, listServers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Server{}
+	for rows.Next() {
+		var i Server
+		if err := rows.Scan(
+			&i.ID,
+			&i.Label,
+			&i.Extension,
+			&i.Settings,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStatementCreditNotes = `-- name: ListStatementCreditNotes :many
+SELECT id, number, invoice_id, user_id, reason, subtotal, tax, amount, currency, created_at FROM credit_notes WHERE user_id = $1 AND created_at >= $2::timestamp AND created_at < $3::timestamp ORDER BY created_at, id
+`
+
+type ListStatementCreditNotesParams struct {
+	UserID  int32           `json:"user_id"`
+	StartAt types.Timestamp `json:"start_at"`
+	EndAt   types.Timestamp `json:"end_at"`
+}
+
+func (q *Queries) ListStatementCreditNotes(ctx context.Context, arg ListStatementCreditNotesParams) ([]CreditNote, error) {
+	rows, err := q.db.Query(ctx, listStatementCreditNotes, arg.UserID, arg.StartAt, arg.EndAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []CreditNote{}
+	for rows.Next() {
+		var i CreditNote
+		if err := rows.Scan(
+			&i.ID,
+			&i.Number,
+			&i.InvoiceID,
+			&i.UserID,
+			&i.Reason,
+			&i.Subtotal,
+			&i.Tax,
+			&i.Amount,
+			&i.Currency,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStatementInvoices = `-- name: ListStatementInvoices :many
+SELECT id, user_id, status, cancellation_reason, paid_at, due_at, amount, created_at, currency, subtotal, tax, tax_rate, tax_name, tax_inclusive, reverse_charge, number FROM invoices WHERE user_id = $1 AND (status <> 'CANCELLED' OR paid_at IS NOT NULL) AND created_at >= $2::timestamp AND created_at < $3::timestamp ORDER BY created_at, id
+`
+
+type ListStatementInvoicesParams struct {
+	UserID  int32           `json:"user_id"`
+	StartAt types.Timestamp `json:"start_at"`
+	EndAt   types.Timestamp `json:"end_at"`
+}
+
+func (q *Queries) ListStatementInvoices(ctx context.Context, arg ListStatementInvoicesParams) ([]Invoice, error) {
+	rows, err := q.db.Query(ctx, listStatementInvoices, arg.UserID, arg.StartAt, arg.EndAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Invoice{}
+	for rows.Next() {
+		var i Invoice
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Status,
+			&i.CancellationReason,
+			&i.PaidAt,
+			&i.DueAt,
+			&i.Amount,
+			&i.CreatedAt,
+			&i.Currency,
+			&i.Subtotal,
+			&i.Tax,
+			&i.TaxRate,
+			&i.TaxName,
+			&i.TaxInclusive,
+			&i.ReverseCharge,
+			&i.Number,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listStatementPayments = `-- name: ListStatementPayments :many
+SELECT invoice_payments.id, invoice_payments.invoice_id, invoice_payments.created_at, invoice_payments.description, invoice_payments.amount, invoice_payments.gateway, invoice_payments.refund_of, invoices.currency, invoices.number FROM invoice_payments INNER JOIN invoices ON invoice_payments.invoice_id = invoices.id WHERE invoices.user_id = $1 AND invoice_payments.created_at >= $2::timestamp AND invoice_payments.created_at < $3::timestamp ORDER BY invoice_payments.created_at, invoice_payments.id
+`
+
+type ListStatementPaymentsParams struct {
+	UserID  int32           `json:"user_id"`
+	StartAt types.Timestamp `json:"start_at"`
+	EndAt   types.Timestamp `json:"end_at"`
+}
+
+type ListStatementPaymentsRow struct {
+	ID          int32           `json:"id"`
+	InvoiceID   int32           `json:"invoice_id"`
+	CreatedAt   types.Timestamp `json:"created_at"`
+	Description string          `json:"description"`
+	Amount      decimal.Decimal `json:"amount"`
+	Gateway     string          `json:"gateway"`
+	RefundOf    pgtype.Int4     `json:"refund_of"`
+	Currency    string          `json:"currency"`
+	Number      string          `json:"number"`
+}
+
+func (q *Queries) ListStatementPayments(ctx context.Context, arg ListStatementPaymentsParams) ([]ListStatementPaymentsRow, error) {
+	rows, err := q.db.Query(ctx, listStatementPayments, arg.UserID, arg.StartAt, arg.EndAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []ListStatementPaymentsRow{}
+	for rows.Next() {
+		var i ListStatementPaymentsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.InvoiceID,
+			&i.CreatedAt,
+			&i.Description,
+			&i.Amount,
+			&i.Gateway,
+			&i.RefundOf,
+			&i.Currency,
+			&i.Number,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTaxRules = `-- name: ListTaxRules :many
+SELECT id, name, country, state, rate, inclusive, reverse_charge FROM tax_rules ORDER BY country, state, id
+`
+
+func (q *Queries) ListTaxRules(ctx context.Context) ([]TaxRule, error) {
+	rows, err := q.db.Query(ctx, listTaxRules)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Product{}
+	items := []TaxRule{}
 	for rows.Next() {
-		var i Product
+		var i TaxRule
 		if err := rows.Scan(
 			&i.ID,
 			&i.Name,
-			&i.Description,
-			&i.CategoryID,
-			&i.Extension,
-			&i.Enabled,
-			&i.Pricing,
-			&i.Settings,
-			&i.Stock,
-			&i.StockControl,
+			&i.Country,
+			&i.State,
+			&i.Rate,
+			&i.Inclusive,
+			&i.ReverseCharge,
 		); err != nil {
 			return nil, err
 		}
@@ -1128,23 +3622,45 @@ func (q *Queries) ListEnabledProducts(ctx context.Context) ([]Product, error) {
 	return items, nil
 }
 
-const listGatewayNames = `-- name: ListGatewayNames :many
-SELECT name FROM gateways ORDER BY id ASC
+const listUsers = `-- name: ListUsers :many
+
+SELECT id, email, name, role, password, address, city, state, country, zip_code, credit, currency, vat_id, vat_id_valid, email_reminders, late_fee_exempt, billing_anchor_day, referral_code, referred_by FROM users ORDER BY id
 `
 
-func (q *Queries) ListGatewayNames(ctx context.Context) ([]string, error) {
-	rows, err := q.db.Query(ctx, listGatewayNames)
+// USERS --
+func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
+	rows, err := q.db.Query(ctx, listUsers)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []string{}
+	items := []User{}
 	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Email,
+			&i.Name,
+			&i.Role,
+			&i.Password,
+			&i.Address,
+			&i.City,
+			&i.State,
+			&i.Country,
+			&i.ZipCode,
+			&i.Credit,
+			&i.Currency,
+			&i.VatID,
+			&i.VatIDValid,
+			&i.EmailReminders,
+			&i.LateFeeExempt,
+			&i.BillingAnchorDay,
+			&i.ReferralCode,
+			&i.ReferredBy,
+		); err != nil {
 			return nil, err
 		}
-		items = append(items, name)
+		items = append(items, i)
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -1152,28 +3668,29 @@ func (q *Queries) ListGatewayNames(ctx context.Context) ([]string, error) {
 	return items, nil
 }
 
-const listGateways = `-- name: ListGateways :many
-
-SELECT id, display_name, name, settings, enabled, fee FROM gateways ORDER BY id ASC
+const monthlyRecurringRevenue = `-- name: MonthlyRecurringRevenue :many
+SELECT currency, COUNT(*) AS services, COALESCE(SUM(CASE WHEN billing_cycle_months > 0 THEN GREATEST(price - CASE WHEN discount_rate > 0 THEN ROUND(price * discount_rate / 100, 2) ELSE discount END, 0) / billing_cycle_months ELSE GREATEST(price - CASE WHEN discount_rate > 0 THEN ROUND(price * discount_rate / 100, 2) ELSE discount END, 0) * 2629746 / billing_cycle END), 0)::decimal AS mrr FROM services WHERE status = 'ACTIVE' AND billing_cycle > 0 GROUP BY currency ORDER BY currency
 `
 
-// GATEWAYS --
-func (q *Queries) ListGateways(ctx context.Context) ([]Gateway, error) {
-	rows, err := q.db.Query(ctx, listGateways)
+type MonthlyRecurringRevenueRow struct {
+	Currency string          `json:"currency"`
+	Services int64           `json:"services"`
+	Mrr      decimal.Decimal `json:"mrr"`
+}
+
+func (q *Queries) MonthlyRecurringRevenue(ctx context.Context) ([]MonthlyRecurringRevenueRow, error) {
+	rows, err := q.db.Query(ctx, monthlyRecurringRevenue)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Gateway{}
+	items := []MonthlyRecurringRevenueRow{}
 	for rows.Next() {
-		var i Gateway
+		var i MonthlyRecurringRevenueRow
 		if err := rows.Scan(
-			&i.ID,
-			&i.DisplayName,
-			&i.Name,
-			&i.Settings,
-			&i.Enabled,
-			&i.Fee,
+			&i.Currency,
+			&i.Services,
+			&i.Mrr,
 		); err != nil {
 			return nil, err
 		}
@@ -1185,27 +3702,89 @@ func (q *Queries) ListGateways(ctx context.Context) ([]Gateway, error) {
 	return items, nil
 }
 
-const listInvoiceItems = `-- name: ListInvoiceItems :many
-SELECT id, invoice_id, description, amount, type, item_id, created_at FROM invoice_items WHERE invoice_id = $1 ORDER BY id
+const moveCartItems = `-- name: MoveCartItems :exec
+UPDATE cart_items SET cart_id = $1 WHERE cart_id = $2
 `
 
-func (q *Queries) ListInvoiceItems(ctx context.Context, invoiceID int32) ([]InvoiceItem, error) {
-	rows, err := q.db.Query(ctx, listInvoiceItems, invoiceID)
+type MoveCartItemsParams struct {
+	ToCartID   int32 `json:"to_cart_id"`
+	FromCartID int32 `json:"from_cart_id"`
+}
+
+func (q *Queries) MoveCartItems(ctx context.Context, arg MoveCartItemsParams) error {
+	_, err := q.db.Exec(ctx, moveCartItems, arg.ToCartID, arg.FromCartID)
+	return err
+}
+
+const moveInvoiceItems = `-- name: MoveInvoiceItems :exec
+UPDATE invoice_items SET invoice_id = $1 WHERE invoice_id = $2
+`
+
+type MoveInvoiceItemsParams struct {
+	InvoiceID   int32 `json:"invoice_id"`
+	InvoiceID_2 int32 `json:"invoice_id_2"`
+}
+
+func (q *Queries) MoveInvoiceItems(ctx context.Context, arg MoveInvoiceItemsParams) error {
+	_, err := q.db.Exec(ctx, moveInvoiceItems, arg.InvoiceID, arg.InvoiceID_2)
+	return err
+}
+
+const nextCreditNoteNumber = `-- name: NextCreditNoteNumber :one
+INSERT INTO credit_note_number_sequences (period, last) VALUES ($1, 1) ON CONFLICT (period) DO UPDATE SET last = credit_note_number_sequences.last + 1 RETURNING last
+`
+
+func (q *Queries) NextCreditNoteNumber(ctx context.Context, period int32) (int32, error) {
+	row := q.db.QueryRow(ctx, nextCreditNoteNumber, period)
+	var last int32
+	err := row.Scan(&last)
+	return last, err
+}
+
+const nextInvoiceNumber = `-- name: NextInvoiceNumber :one
+INSERT INTO invoice_number_sequences (period, last) VALUES ($1, 1) ON CONFLICT (period) DO UPDATE SET last = invoice_number_sequences.last + 1 RETURNING last
+`
+
+func (q *Queries) NextInvoiceNumber(ctx context.Context, period int32) (int32, error) {
+	row := q.db.QueryRow(ctx, nextInvoiceNumber, period)
+	var last int32
+	err := row.Scan(&last)
+	return last, err
+}
+
+const outstandingReceivables = `-- name: OutstandingReceivables :many
+SELECT invoices.currency, COUNT(*) AS invoices, COALESCE(SUM(invoices.amount - COALESCE(payments.paid, 0)), 0)::decimal AS outstanding, COALESCE(SUM(invoices.amount - COALESCE(payments.paid, 0)) FILTER (WHERE invoices.due_at >= CURRENT_TIMESTAMP), 0)::decimal AS not_due, COALESCE(SUM(invoices.amount - COALESCE(payments.paid, 0)) FILTER (WHERE invoices.due_at < CURRENT_TIMESTAMP AND invoices.due_at >= CURRENT_TIMESTAMP - INTERVAL '30 days'), 0)::decimal AS overdue_30, COALESCE(SUM(invoices.amount - COALESCE(payments.paid, 0)) FILTER (WHERE invoices.due_at < CURRENT_TIMESTAMP - INTERVAL '30 days' AND invoices.due_at >= CURRENT_TIMESTAMP - INTERVAL '60 days'), 0)::decimal AS overdue_60, COALESCE(SUM(invoices.amount - COALESCE(payments.paid, 0)) FILTER (WHERE invoices.due_at < CURRENT_TIMESTAMP - INTERVAL '60 days' AND invoices.due_at >= CURRENT_TIMESTAMP - INTERVAL '90 days'), 0)::decimal AS overdue_90, COALESCE(SUM(invoices.amount - COALESCE(payments.paid, 0)) FILTER (WHERE invoices.due_at < CURRENT_TIMESTAMP - INTERVAL '90 days'), 0)::decimal AS overdue_over_90 FROM invoices LEFT JOIN (SELECT invoice_id, SUM(amount) AS paid FROM invoice_payments GROUP BY invoice_id) payments ON payments.invoice_id = invoices.id WHERE invoices.status = 'UNPAID' GROUP BY invoices.currency ORDER BY invoices.currency
+`
+
+type OutstandingReceivablesRow struct {
+	Currency      string          `json:"currency"`
+	Invoices      int64           `json:"invoices"`
+	Outstanding   decimal.Decimal `json:"outstanding"`
+	NotDue        decimal.Decimal `json:"not_due"`
+	Overdue30     decimal.Decimal `json:"overdue_30"`
+	Overdue60     decimal.Decimal `json:"overdue_60"`
+	Overdue90     decimal.Decimal `json:"overdue_90"`
+	OverdueOver90 decimal.Decimal `json:"overdue_over_90"`
+}
+
+func (q *Queries) OutstandingReceivables(ctx context.Context) ([]OutstandingReceivablesRow, error) {
+	rows, err := q.db.Query(ctx, outstandingReceivables)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []InvoiceItem{}
+	items := []OutstandingReceivablesRow{}
 	for rows.Next() {
-		var i InvoiceItem
+		var i OutstandingReceivablesRow
 		if err := rows.Scan(
-			&i.ID,
-			&i.InvoiceID,
-			&i.Description,
-			&i.Amount,
-			&i.Type,
-			&i.ItemID,
-			&i.CreatedAt,
+			&i.Currency,
+			&i.Invoices,
+			&i.Outstanding,
+			&i.NotDue,
+			&i.Overdue30,
+			&i.Overdue60,
+			&i.Overdue90,
+			&i.OverdueOver90,
 		); err != nil {
 			return nil, err
 		}
@@ -1217,27 +3796,38 @@ func (q *Queries) ListInvoiceItems(ctx context.Context, invoiceID int32) ([]Invo
 	return items, nil
 }
 
-const listInvoicePayments = `-- name: ListInvoicePayments :many
-SELECT id, invoice_id, created_at, description, amount, reference_id, gateway FROM invoice_payments WHERE invoice_id = $1 ORDER BY id ASC
+const revenueByGateway = `-- name: RevenueByGateway :many
+SELECT invoice_payments.gateway, invoices.currency, COALESCE(SUM(invoice_payments.amount) FILTER (WHERE invoice_payments.refund_of IS NULL), 0)::decimal AS paid, COALESCE(-SUM(invoice_payments.amount) FILTER (WHERE invoice_payments.refund_of IS NOT NULL), 0)::decimal AS refunded, COUNT(*) FILTER (WHERE invoice_payments.refund_of IS NULL) AS payments FROM invoice_payments INNER JOIN invoices ON invoice_payments.invoice_id = invoices.id WHERE invoice_payments.created_at >= $1::timestamp AND invoice_payments.created_at < $2::timestamp GROUP BY invoice_payments.gateway, invoices.currency ORDER BY invoice_payments.gateway, invoices.currency
 `
 
-func (q *Queries) ListInvoicePayments(ctx context.Context, invoiceID int32) ([]InvoicePayment, error) {
-	rows, err := q.db.Query(ctx, listInvoicePayments, invoiceID)
+type RevenueByGatewayParams struct {
+	StartAt types.Timestamp `json:"start_at"`
+	EndAt   types.Timestamp `json:"end_at"`
+}
+
+type RevenueByGatewayRow struct {
+	Gateway  string          `json:"gateway"`
+	Currency string          `json:"currency"`
+	Paid     decimal.Decimal `json:"paid"`
+	Refunded decimal.Decimal `json:"refunded"`
+	Payments int64           `json:"payments"`
+}
+
+func (q *Queries) RevenueByGateway(ctx context.Context, arg RevenueByGatewayParams) ([]RevenueByGatewayRow, error) {
+	rows, err := q.db.Query(ctx, revenueByGateway, arg.StartAt, arg.EndAt)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []InvoicePayment{}
+	items := []RevenueByGatewayRow{}
 	for rows.Next() {
-		var i InvoicePayment
+		var i RevenueByGatewayRow
 		if err := rows.Scan(
-			&i.ID,
-			&i.InvoiceID,
-			&i.CreatedAt,
-			&i.Description,
-			&i.Amount,
-			&i.ReferenceID,
 			&i.Gateway,
+			&i.Currency,
+			&i.Paid,
+			&i.Refunded,
+			&i.Payments,
 		); err != nil {
 			return nil, err
 		}
@@ -1249,30 +3839,35 @@ func (q *Queries) ListInvoicePayments(ctx context.Context, invoiceID int32) ([]I
 	return items, nil
 }
 
-const listProducts = `-- name: ListProducts :many
-SELECT id, name, description, category_id, extension, enabled, pricing, settings, stock, stock_control FROM products ORDER BY id
+const revenueByPeriod = `-- name: RevenueByPeriod :many
+SELECT date_trunc($1::text, invoice_payments.created_at)::timestamp AS period, invoices.currency, SUM(invoice_payments.amount)::decimal AS amount FROM invoice_payments INNER JOIN invoices ON invoice_payments.invoice_id = invoices.id WHERE invoice_payments.gateway <> 'Credit' AND invoice_payments.created_at >= $2::timestamp AND invoice_payments.created_at < $3::timestamp GROUP BY period, invoices.currency ORDER BY period, invoices.currency
 `
 
-func (q *Queries) ListProducts(ctx context.Context) ([]Product, error) {
-	rows, err := q.db.Query(ctx, listProducts)
+type RevenueByPeriodParams struct {
+	Period  string          `json:"period"`
+	StartAt types.Timestamp `json:"start_at"`
+	EndAt   types.Timestamp `json:"end_at"`
+}
+
+type RevenueByPeriodRow struct {
+	Period   types.Timestamp `json:"period"`
+	Currency string          `json:"currency"`
+	Amount   decimal.Decimal `json:"amount"`
+}
+
+func (q *Queries) RevenueByPeriod(ctx context.Context, arg RevenueByPeriodParams) ([]RevenueByPeriodRow, error) {
+	rows, err := q.db.Query(ctx, revenueByPeriod, arg.Period, arg.StartAt, arg.EndAt)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Product{}
+	items := []RevenueByPeriodRow{}
 	for rows.Next() {
-		var i Product
+		var i RevenueByPeriodRow
 		if err := rows.Scan(
-			&i.ID,
-			&i.Name,
-			&i.Description,
-			&i.CategoryID,
-			&i.Extension,
-			&i.Enabled,
-			&i.Pricing,
-			&i.Settings,
-			&i.Stock,
-			&i.StockControl,
+			&i.Period,
+			&i.Currency,
+			&i.Amount,
 		); err != nil {
 			return nil, err
 		}
@@ -1284,26 +3879,36 @@ func (q *Queries) ListProducts(ctx context.Context) ([]Product, error) {
 	return items, nil
 }
 
-const listServers = `-- name: ListServers :many
-
-SELECT id, label, extension, settings FROM servers ORDER BY id ASC
+const revenueByProduct = `-- name: RevenueByProduct :many
+SELECT services.product_id, COALESCE(products.name, '')::text AS product_name, invoices.currency, SUM(invoice_items.amount)::decimal AS amount FROM invoice_items INNER JOIN invoices ON invoice_items.invoice_id = invoices.id LEFT JOIN service_upgrades ON invoice_items.type = 'upgrade' AND invoice_items.item_id = service_upgrades.id INNER JOIN services ON services.id = COALESCE(service_upgrades.service_id, invoice_items.item_id) LEFT JOIN products ON services.product_id = products.id WHERE invoice_items.type IN ('service', 'discount', 'upgrade', 'usage', 'proration') AND invoices.status IN ('PAID', 'PARTIALLY_REFUNDED') AND invoices.paid_at >= $1::timestamp AND invoices.paid_at < $2::timestamp GROUP BY services.product_id, products.name, invoices.currency ORDER BY amount DESC
 `
 
-// SERVERS --
-func (q *Queries) ListServers(ctx context.Context) ([]Server, error) {
-	rows, err := q.db.Query(ctx, listServers)
+type RevenueByProductParams struct {
+	StartAt types.Timestamp `json:"start_at"`
+	EndAt   types.Timestamp `json:"end_at"`
+}
+
+type RevenueByProductRow struct {
+	ProductID   pgtype.Int4     `json:"product_id"`
+	ProductName string          `json:"product_name"`
+	Currency    string          `json:"currency"`
+	Amount      decimal.Decimal `json:"amount"`
+}
+
+func (q *Queries) RevenueByProduct(ctx context.Context, arg RevenueByProductParams) ([]RevenueByProductRow, error) {
+	rows, err := q.db.Query(ctx, revenueByProduct, arg.StartAt, arg.EndAt)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []Server{}
+	items := []RevenueByProductRow{}
 	for rows.Next() {
-		var i Server
+		var i RevenueByProductRow
 		if err := rows.Scan(
-			&i.ID,
-			&i.Label,
-			&i.Extension,
-			&i.Settings,
+			&i.ProductID,
+			&i.ProductName,
+			&i.Currency,
+			&i.Amount,
 		); err != nil {
 			return nil, err
 		}
@@ -1315,32 +3920,50 @@ func (q *Queries) ListServers(ctx context.Context) ([]Server, error) {
 	return items, nil
 }
 
-const listUsers = `-- name: ListUsers :many
+const reverseCommissions = `-- name: ReverseCommissions :exec
+UPDATE commissions SET reversed = LEAST(amount, reversed + ROUND(amount * $1::decimal, 2)) WHERE invoice_id = $2
+`
+
+type ReverseCommissionsParams struct {
+	Fraction  decimal.Decimal `json:"fraction"`
+	InvoiceID int32           `json:"invoice_id"`
+}
+
+func (q *Queries) ReverseCommissions(ctx context.Context, arg ReverseCommissionsParams) error {
+	_, err := q.db.Exec(ctx, reverseCommissions, arg.Fraction, arg.InvoiceID)
+	return err
+}
 
-SELECT id, email, name, role, password, address, city, state, country, zip_code FROM users ORDER BY id
+const searchCreditNotesPaged = `-- name: SearchCreditNotesPaged :many
+SELECT id, number, invoice_id, user_id, reason, subtotal, tax, amount, currency, created_at FROM credit_notes WHERE ($3::integer = 0 OR user_id = $3::integer) ORDER BY id DESC LIMIT $1 OFFSET $2
 `
 
-// USERS --
-func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
-	rows, err := q.db.Query(ctx, listUsers)
+type SearchCreditNotesPagedParams struct {
+	Limit  int32 `json:"limit"`
+	Offset int32 `json:"offset"`
+	UserID int32 `json:"user_id"`
+}
+
+func (q *Queries) SearchCreditNotesPaged(ctx context.Context, arg SearchCreditNotesPagedParams) ([]CreditNote, error) {
+	rows, err := q.db.Query(ctx, searchCreditNotesPaged, arg.Limit, arg.Offset, arg.UserID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	items := []User{}
+	items := []CreditNote{}
 	for rows.Next() {
-		var i User
+		var i CreditNote
 		if err := rows.Scan(
 			&i.ID,
-			&i.Email,
-			&i.Name,
-			&i.Role,
-			&i.Password,
-			&i.Address,
-			&i.City,
-			&i.State,
-			&i.Country,
-			&i.ZipCode,
+			&i.Number,
+			&i.InvoiceID,
+			&i.UserID,
+			&i.Reason,
+			&i.Subtotal,
+			&i.Tax,
+			&i.Amount,
+			&i.Currency,
+			&i.CreatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -1369,7 +3992,7 @@ func (q *Queries) SearchInvoicesCount(ctx context.Context, arg SearchInvoicesCou
 }
 
 const searchInvoicesPaged = `-- name: SearchInvoicesPaged :many
-SELECT id, user_id, status, cancellation_reason, paid_at, due_at, amount, created_at FROM invoices WHERE ($3::text = '' OR $3::text = status) AND ($4::integer = 0 OR $4::integer = user_id) ORDER BY id DESC LIMIT $1 OFFSET $2
+SELECT id, user_id, status, cancellation_reason, paid_at, due_at, amount, created_at, currency, subtotal, tax, tax_rate, tax_name, tax_inclusive, reverse_charge, number FROM invoices WHERE ($3::text = '' OR $3::text = status) AND ($4::integer = 0 OR $4::integer = user_id) ORDER BY id DESC LIMIT $1 OFFSET $2
 `
 
 type SearchInvoicesPagedParams struct {
@@ -1402,6 +4025,14 @@ func (q *Queries) SearchInvoicesPaged(ctx context.Context, arg SearchInvoicesPag
 			&i.DueAt,
 			&i.Amount,
 			&i.CreatedAt,
+			&i.Currency,
+			&i.Subtotal,
+			&i.Tax,
+			&i.TaxRate,
+			&i.TaxName,
+			&i.TaxInclusive,
+			&i.ReverseCharge,
+			&i.Number,
 		); err != nil {
 			return nil, err
 		}
@@ -1414,21 +4045,31 @@ func (q *Queries) SearchInvoicesPaged(ctx context.Context, arg SearchInvoicesPag
 }
 
 const searchProduct = `-- name: SearchProduct :many
-SELECT products.id as id, products.name, products.description, products.category_id, products.extension, products.enabled, products.pricing, products.settings, products.stock, products.stock_control, categories.name AS category_name FROM products INNER JOIN categories ON categories.id = products.category_id  WHERE (category_id = $1 OR $1 < 1) ORDER BY products.id
+SELECT products.id as id, products.name, products.description, products.category_id, products.extension, products.enabled, products.pricing, products.settings, products.stock, products.stock_control, products.invoice_days_before_expiry, products.suspend_days_after_due, products.terminate_days_after_suspension, products.billing_anchor_day, products.metered_pricing, products.trial_days, products.trial_requires_payment_method, products.trial_once_per_user, products.commission_percent, products.commission_recurring, categories.name AS category_name FROM products INNER JOIN categories ON categories.id = products.category_id  WHERE (category_id = $1 OR $1 < 1) ORDER BY products.id
 `
 
 type SearchProductRow struct {
-	ID           int32                 `json:"id"`
-	Name         string                `json:"name"`
-	Description  string                `json:"description"`
-	CategoryID   int32                 `json:"category_id"`
-	Extension    string                `json:"extension"`
-	Enabled      bool                  `json:"enabled"`
-	Pricing      types.ProductPrices   `json:"pricing"`
-	Settings     types.ProductSettings `json:"settings"`
-	Stock        int32                 `json:"stock"`
-	StockControl int32                 `json:"stock_control"`
-	CategoryName string                `json:"category_name"`
+	ID                           int32                 `json:"id"`
+	Name                         string                `json:"name"`
+	Description                  string                `json:"description"`
+	CategoryID                   int32                 `json:"category_id"`
+	Extension                    string                `json:"extension"`
+	Enabled                      bool                  `json:"enabled"`
+	Pricing                      types.ProductPrices   `json:"pricing"`
+	Settings                     types.ProductSettings `json:"settings"`
+	Stock                        int32                 `json:"stock"`
+	StockControl                 int32                 `json:"stock_control"`
+	InvoiceDaysBeforeExpiry      pgtype.Int4           `json:"invoice_days_before_expiry"`
+	SuspendDaysAfterDue          pgtype.Int4           `json:"suspend_days_after_due"`
+	TerminateDaysAfterSuspension pgtype.Int4           `json:"terminate_days_after_suspension"`
+	BillingAnchorDay             pgtype.Int4           `json:"billing_anchor_day"`
+	MeteredPricing               types.MeteredPrices   `json:"metered_pricing"`
+	TrialDays                    int32                 `json:"trial_days"`
+	TrialRequiresPaymentMethod   bool                  `json:"trial_requires_payment_method"`
+	TrialOncePerUser             bool                  `json:"trial_once_per_user"`
+	CommissionPercent            decimal.Decimal       `json:"commission_percent"`
+	CommissionRecurring          bool                  `json:"commission_recurring"`
+	CategoryName                 string                `json:"category_name"`
 }
 
 func (q *Queries) SearchProduct(ctx context.Context, categoryID int32) ([]SearchProductRow, error) {
@@ -1451,6 +4092,16 @@ func (q *Queries) SearchProduct(ctx context.Context, categoryID int32) ([]Search
 			&i.Settings,
 			&i.Stock,
 			&i.StockControl,
+			&i.InvoiceDaysBeforeExpiry,
+			&i.SuspendDaysAfterDue,
+			&i.TerminateDaysAfterSuspension,
+			&i.BillingAnchorDay,
+			&i.MeteredPricing,
+			&i.TrialDays,
+			&i.TrialRequiresPaymentMethod,
+			&i.TrialOncePerUser,
+			&i.CommissionPercent,
+			&i.CommissionRecurring,
 			&i.CategoryName,
 		); err != nil {
 			return nil, err
@@ -1537,7 +4188,7 @@ func (q *Queries) SearchUsersCount(ctx context.Context, search string) (int64, e
 }
 
 const searchUsersPaged = `-- name: SearchUsersPaged :many
-SELECT id, email, name, role, password, address, city, state, country, zip_code FROM users WHERE position($3::text in email)>0 OR position($3::text in name)>0 ORDER BY id LIMIT $1 OFFSET $2
+SELECT id, email, name, role, password, address, city, state, country, zip_code, credit, currency, vat_id, vat_id_valid, email_reminders, late_fee_exempt, billing_anchor_day, referral_code, referred_by FROM users WHERE position($3::text in email)>0 OR position($3::text in name)>0 ORDER BY id LIMIT $1 OFFSET $2
 `
 
 type SearchUsersPagedParams struct {
@@ -1566,6 +4217,157 @@ func (q *Queries) SearchUsersPaged(ctx context.Context, arg SearchUsersPagedPara
 			&i.State,
 			&i.Country,
 			&i.ZipCode,
+			&i.Credit,
+			&i.Currency,
+			&i.VatID,
+			&i.VatIDValid,
+			&i.EmailReminders,
+			&i.LateFeeExempt,
+			&i.BillingAnchorDay,
+			&i.ReferralCode,
+			&i.ReferredBy,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const selectInvoiceForUpdate = `-- name: SelectInvoiceForUpdate :one
+SELECT id, user_id, status, cancellation_reason, paid_at, due_at, amount, created_at, currency, subtotal, tax, tax_rate, tax_name, tax_inclusive, reverse_charge, number FROM invoices WHERE id = $1 FOR UPDATE
+`
+
+func (q *Queries) SelectInvoiceForUpdate(ctx context.Context, id int32) (Invoice, error) {
+	row := q.db.QueryRow(ctx, selectInvoiceForUpdate, id)
+	var i Invoice
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Status,
+		&i.CancellationReason,
+		&i.PaidAt,
+		&i.DueAt,
+		&i.Amount,
+		&i.CreatedAt,
+		&i.Currency,
+		&i.Subtotal,
+		&i.Tax,
+		&i.TaxRate,
+		&i.TaxName,
+		&i.TaxInclusive,
+		&i.ReverseCharge,
+		&i.Number,
+	)
+	return i, err
+}
+
+const statementBalance = `-- name: StatementBalance :many
+SELECT currency, SUM(amount)::decimal AS balance FROM (SELECT invoices.currency, invoices.amount FROM invoices WHERE invoices.user_id = $1 AND (invoices.status <> 'CANCELLED' OR invoices.paid_at IS NOT NULL) AND invoices.created_at < $2::timestamp UNION ALL SELECT invoices.currency, -invoice_payments.amount FROM invoice_payments INNER JOIN invoices ON invoice_payments.invoice_id = invoices.id WHERE invoices.user_id = $1 AND invoice_payments.created_at < $2::timestamp UNION ALL SELECT credit_notes.currency, -credit_notes.amount FROM credit_notes WHERE credit_notes.user_id = $1 AND credit_notes.created_at < $2::timestamp) entries GROUP BY currency ORDER BY currency
+`
+
+type StatementBalanceParams struct {
+	UserID int32           `json:"user_id"`
+	At     types.Timestamp `json:"at"`
+}
+
+type StatementBalanceRow struct {
+	Currency string          `json:"currency"`
+	Balance  decimal.Decimal `json:"balance"`
+}
+
+func (q *Queries) StatementBalance(ctx context.Context, arg StatementBalanceParams) ([]StatementBalanceRow, error) {
+	rows, err := q.db.Query(ctx, statementBalance, arg.UserID, arg.At)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []StatementBalanceRow{}
+	for rows.Next() {
+		var i StatementBalanceRow
+		if err := rows.Scan(
+			&i.Currency,
+			&i.Balance,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const sumCreditNotesByInvoice = `-- name: SumCreditNotesByInvoice :one
+SELECT COALESCE(SUM(amount), 0)::decimal FROM credit_notes WHERE invoice_id = $1
+`
+
+func (q *Queries) SumCreditNotesByInvoice(ctx context.Context, invoiceID int32) (decimal.Decimal, error) {
+	row := q.db.QueryRow(ctx, sumCreditNotesByInvoice, invoiceID)
+	var column_1 decimal.Decimal
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const sumInvoiceItems = `-- name: SumInvoiceItems :one
+SELECT COALESCE(SUM(amount), 0)::decimal FROM invoice_items WHERE invoice_id = $1
+`
+
+func (q *Queries) SumInvoiceItems(ctx context.Context, invoiceID int32) (decimal.Decimal, error) {
+	row := q.db.QueryRow(ctx, sumInvoiceItems, invoiceID)
+	var column_1 decimal.Decimal
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const sumInvoicePaymentsAndRefunds = `-- name: SumInvoicePaymentsAndRefunds :one
+SELECT COALESCE(SUM(amount) FILTER (WHERE refund_of IS NULL), 0)::decimal AS paid, COALESCE(-SUM(amount) FILTER (WHERE refund_of IS NOT NULL), 0)::decimal AS refunded, COALESCE(SUM(credited), 0)::decimal AS credited FROM invoice_payments WHERE invoice_id = $1
+`
+
+type SumInvoicePaymentsAndRefundsRow struct {
+	Paid     decimal.Decimal `json:"paid"`
+	Refunded decimal.Decimal `json:"refunded"`
+	Credited decimal.Decimal `json:"credited"`
+}
+
+func (q *Queries) SumInvoicePaymentsAndRefunds(ctx context.Context, invoiceID int32) (SumInvoicePaymentsAndRefundsRow, error) {
+	row := q.db.QueryRow(ctx, sumInvoicePaymentsAndRefunds, invoiceID)
+	var i SumInvoicePaymentsAndRefundsRow
+	err := row.Scan(&i.Paid, &i.Refunded, &i.Credited)
+	return i, err
+}
+
+const sumServiceUsage = `-- name: SumServiceUsage :many
+SELECT metric, SUM(quantity)::decimal AS quantity FROM usage_records WHERE service_id = $1 AND recorded_at >= $2 AND recorded_at < $3 GROUP BY metric ORDER BY metric
+`
+
+type SumServiceUsageParams struct {
+	ServiceID    int32           `json:"service_id"`
+	RecordedAt   types.Timestamp `json:"recorded_at"`
+	RecordedAt_2 types.Timestamp `json:"recorded_at_2"`
+}
+
+type SumServiceUsageRow struct {
+	Metric   string          `json:"metric"`
+	Quantity decimal.Decimal `json:"quantity"`
+}
+
+func (q *Queries) SumServiceUsage(ctx context.Context, arg SumServiceUsageParams) ([]SumServiceUsageRow, error) {
+	rows, err := q.db.Query(ctx, sumServiceUsage, arg.ServiceID, arg.RecordedAt, arg.RecordedAt_2)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []SumServiceUsageRow{}
+	for rows.Next() {
+		var i SumServiceUsageRow
+		if err := rows.Scan(
+			&i.Metric,
+			&i.Quantity,
 		); err != nil {
 			return nil, err
 		}
@@ -1577,37 +4379,88 @@ func (q *Queries) SearchUsersPaged(ctx context.Context, arg SearchUsersPagedPara
 	return items, nil
 }
 
-const selectInvoiceForUpdate = `-- name: SelectInvoiceForUpdate :one
-SELECT id, user_id, status, cancellation_reason, paid_at, due_at, amount, created_at FROM invoices WHERE id = $1 FOR UPDATE
+const totalInvoicePayment = `-- name: TotalInvoicePayment :one
+SELECT COALESCE(SUM(amount), 0)::decimal FROM invoice_payments WHERE invoice_id = $1
 `
 
-func (q *Queries) SelectInvoiceForUpdate(ctx context.Context, id int32) (Invoice, error) {
-	row := q.db.QueryRow(ctx, selectInvoiceForUpdate, id)
-	var i Invoice
-	err := row.Scan(
-		&i.ID,
-		&i.UserID,
-		&i.Status,
-		&i.CancellationReason,
-		&i.PaidAt,
-		&i.DueAt,
-		&i.Amount,
-		&i.CreatedAt,
-	)
-	return i, err
+func (q *Queries) TotalInvoicePayment(ctx context.Context, invoiceID int32) (decimal.Decimal, error) {
+	row := q.db.QueryRow(ctx, totalInvoicePayment, invoiceID)
+	var column_1 decimal.Decimal
+	err := row.Scan(&column_1)
+	return column_1, err
 }
 
-const totalInvoicePayment = `-- name: TotalInvoicePayment :one
-SELECT SUM(amount::decimal)::decimal FROM invoice_payments WHERE invoice_id = $1
+const totalPaymentRefund = `-- name: TotalPaymentRefund :one
+SELECT COALESCE(-SUM(amount), 0)::decimal FROM invoice_payments WHERE refund_of = $1
 `
 
-func (q *Queries) TotalInvoicePayment(ctx context.Context, invoiceID int32) (decimal.Decimal, error) {
-	row := q.db.QueryRow(ctx, totalInvoicePayment, invoiceID)
+func (q *Queries) TotalPaymentRefund(ctx context.Context, refundOf pgtype.Int4) (decimal.Decimal, error) {
+	row := q.db.QueryRow(ctx, totalPaymentRefund, refundOf)
+	var column_1 decimal.Decimal
+	err := row.Scan(&column_1)
+	return column_1, err
+}
+
+const totalPendingGatewayRefund = `-- name: TotalPendingGatewayRefund :one
+SELECT COALESCE(SUM(amount), 0)::decimal FROM gateway_refunds WHERE payment_id = $1 AND status = 'PENDING'
+`
+
+func (q *Queries) TotalPendingGatewayRefund(ctx context.Context, paymentID int32) (decimal.Decimal, error) {
+	row := q.db.QueryRow(ctx, totalPendingGatewayRefund, paymentID)
 	var column_1 decimal.Decimal
 	err := row.Scan(&column_1)
 	return column_1, err
 }
 
+const touchCart = `-- name: TouchCart :exec
+UPDATE carts SET updated_at = CURRENT_TIMESTAMP WHERE id = $1
+`
+
+func (q *Queries) TouchCart(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, touchCart, id)
+	return err
+}
+
+const updateCartItem = `-- name: UpdateCartItem :execrows
+UPDATE cart_items SET duration = $1, options = $2, coupon = $3 WHERE id = $4 AND cart_id = $5
+`
+
+type UpdateCartItemParams struct {
+	Duration int32                 `json:"duration"`
+	Options  types.CartItemOptions `json:"options"`
+	Coupon   string                `json:"coupon"`
+	ID       int32                 `json:"id"`
+	CartID   int32                 `json:"cart_id"`
+}
+
+func (q *Queries) UpdateCartItem(ctx context.Context, arg UpdateCartItemParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateCartItem,
+		arg.Duration,
+		arg.Options,
+		arg.Coupon,
+		arg.ID,
+		arg.CartID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateCartUser = `-- name: UpdateCartUser :exec
+UPDATE carts SET user_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2
+`
+
+type UpdateCartUserParams struct {
+	UserID pgtype.Int4 `json:"user_id"`
+	ID     int32       `json:"id"`
+}
+
+func (q *Queries) UpdateCartUser(ctx context.Context, arg UpdateCartUserParams) error {
+	_, err := q.db.Exec(ctx, updateCartUser, arg.UserID, arg.ID)
+	return err
+}
+
 const updateCategory = `-- name: UpdateCategory :exec
 UPDATE categories SET name = $1, description = $2 WHERE id = $3
 `
@@ -1623,6 +4476,54 @@ func (q *Queries) UpdateCategory(ctx context.Context, arg UpdateCategoryParams)
 	return err
 }
 
+const updateCommissionPaidOut = `-- name: UpdateCommissionPaidOut :exec
+UPDATE commissions SET paid_out = amount - reversed WHERE id = $1
+`
+
+func (q *Queries) UpdateCommissionPaidOut(ctx context.Context, id int32) error {
+	_, err := q.db.Exec(ctx, updateCommissionPaidOut, id)
+	return err
+}
+
+const updateCoupon = `-- name: UpdateCoupon :exec
+UPDATE coupons SET code = $1, type = $2, value = $3, currency = $4, product_ids = $5, durations = $6, recurring = $7, max_uses = $8, max_uses_per_user = $9, valid_from = $10, valid_until = $11, enabled = $12 WHERE id = $13
+`
+
+type UpdateCouponParams struct {
+	Code           string          `json:"code"`
+	Type           string          `json:"type"`
+	Value          decimal.Decimal `json:"value"`
+	Currency       string          `json:"currency"`
+	ProductIds     []int32         `json:"product_ids"`
+	Durations      []int32         `json:"durations"`
+	Recurring      bool            `json:"recurring"`
+	MaxUses        int32           `json:"max_uses"`
+	MaxUsesPerUser int32           `json:"max_uses_per_user"`
+	ValidFrom      types.Timestamp `json:"valid_from"`
+	ValidUntil     types.Timestamp `json:"valid_until"`
+	Enabled        bool            `json:"enabled"`
+	ID             int32           `json:"id"`
+}
+
+func (q *Queries) UpdateCoupon(ctx context.Context, arg UpdateCouponParams) error {
+	_, err := q.db.Exec(ctx, updateCoupon,
+		arg.Code,
+		arg.Type,
+		arg.Value,
+		arg.Currency,
+		arg.ProductIds,
+		arg.Durations,
+		arg.Recurring,
+		arg.MaxUses,
+		arg.MaxUsesPerUser,
+		arg.ValidFrom,
+		arg.ValidUntil,
+		arg.Enabled,
+		arg.ID,
+	)
+	return err
+}
+
 const updateGateway = `-- name: UpdateGateway :exec
 UPDATE gateways SET display_name = $1, settings = $2, enabled = $3, fee = $4 WHERE name = $5
 `
@@ -1646,6 +4547,42 @@ func (q *Queries) UpdateGateway(ctx context.Context, arg UpdateGatewayParams) er
 	return err
 }
 
+const updateGatewayOrderStatus = `-- name: UpdateGatewayOrderStatus :exec
+UPDATE gateway_orders SET status = $1 WHERE gateway = $2 AND order_id = $3
+`
+
+type UpdateGatewayOrderStatusParams struct {
+	Status  string `json:"status"`
+	Gateway string `json:"gateway"`
+	OrderID string `json:"order_id"`
+}
+
+func (q *Queries) UpdateGatewayOrderStatus(ctx context.Context, arg UpdateGatewayOrderStatusParams) error {
+	_, err := q.db.Exec(ctx, updateGatewayOrderStatus, arg.Status, arg.Gateway, arg.OrderID)
+	return err
+}
+
+const updateGatewayRefund = `-- name: UpdateGatewayRefund :exec
+UPDATE gateway_refunds SET status = $1, reference_id = $2, error = $3 WHERE id = $4
+`
+
+type UpdateGatewayRefundParams struct {
+	Status      string `json:"status"`
+	ReferenceID string `json:"reference_id"`
+	Error       string `json:"error"`
+	ID          int32  `json:"id"`
+}
+
+func (q *Queries) UpdateGatewayRefund(ctx context.Context, arg UpdateGatewayRefundParams) error {
+	_, err := q.db.Exec(ctx, updateGatewayRefund,
+		arg.Status,
+		arg.ReferenceID,
+		arg.Error,
+		arg.ID,
+	)
+	return err
+}
+
 const updateInvoice = `-- name: UpdateInvoice :exec
 UPDATE invoices SET status = $1, cancellation_reason = $2, paid_at = $3, due_at = $4 WHERE id = $5
 `
@@ -1669,15 +4606,6 @@ func (q *Queries) UpdateInvoice(ctx context.Context, arg UpdateInvoiceParams) er
 	return err
 }
 
-const updateInvoiceAmount = `-- name: UpdateInvoiceAmount :exec
-UPDATE invoices SET amount = (SELECT SUM(amount) FROM invoice_items WHERE invoice_id = $1) WHERE id = $1
-`
-
-func (q *Queries) UpdateInvoiceAmount(ctx context.Context, invoiceID int32) error {
-	_, err := q.db.Exec(ctx, updateInvoiceAmount, invoiceID)
-	return err
-}
-
 const updateInvoiceCancelled = `-- name: UpdateInvoiceCancelled :exec
 UPDATE invoices SET status = 'CANCELLED', cancellation_reason = $1 WHERE id = $2
 `
@@ -1692,6 +4620,20 @@ func (q *Queries) UpdateInvoiceCancelled(ctx context.Context, arg UpdateInvoiceC
 	return err
 }
 
+const updateInvoiceDueAt = `-- name: UpdateInvoiceDueAt :exec
+UPDATE invoices SET due_at = $1 WHERE id = $2
+`
+
+type UpdateInvoiceDueAtParams struct {
+	DueAt types.Timestamp `json:"due_at"`
+	ID    int32           `json:"id"`
+}
+
+func (q *Queries) UpdateInvoiceDueAt(ctx context.Context, arg UpdateInvoiceDueAtParams) error {
+	_, err := q.db.Exec(ctx, updateInvoiceDueAt, arg.DueAt, arg.ID)
+	return err
+}
+
 const updateInvoiceItem = `-- name: UpdateInvoiceItem :exec
 UPDATE invoice_items SET description = $1, amount = $2 WHERE id = $3 AND invoice_id = $4
 `
@@ -1713,6 +4655,20 @@ func (q *Queries) UpdateInvoiceItem(ctx context.Context, arg UpdateInvoiceItemPa
 	return err
 }
 
+const updateInvoiceNumber = `-- name: UpdateInvoiceNumber :exec
+UPDATE invoices SET number = $1 WHERE id = $2
+`
+
+type UpdateInvoiceNumberParams struct {
+	Number string `json:"number"`
+	ID     int32  `json:"id"`
+}
+
+func (q *Queries) UpdateInvoiceNumber(ctx context.Context, arg UpdateInvoiceNumberParams) error {
+	_, err := q.db.Exec(ctx, updateInvoiceNumber, arg.Number, arg.ID)
+	return err
+}
+
 const updateInvoicePaid = `-- name: UpdateInvoicePaid :exec
 UPDATE invoices SET status = 'PAID', paid_at = CURRENT_TIMESTAMP WHERE id = $1
 `
@@ -1722,21 +4678,80 @@ func (q *Queries) UpdateInvoicePaid(ctx context.Context, id int32) error {
 	return err
 }
 
+const updateInvoicePaymentCredited = `-- name: UpdateInvoicePaymentCredited :exec
+UPDATE invoice_payments SET credited = $1 WHERE id = $2
+`
+
+type UpdateInvoicePaymentCreditedParams struct {
+	Credited decimal.Decimal `json:"credited"`
+	ID       int32           `json:"id"`
+}
+
+func (q *Queries) UpdateInvoicePaymentCredited(ctx context.Context, arg UpdateInvoicePaymentCreditedParams) error {
+	_, err := q.db.Exec(ctx, updateInvoicePaymentCredited, arg.Credited, arg.ID)
+	return err
+}
+
+const updateInvoiceStatus = `-- name: UpdateInvoiceStatus :exec
+UPDATE invoices SET status = $1 WHERE id = $2
+`
+
+type UpdateInvoiceStatusParams struct {
+	Status string `json:"status"`
+	ID     int32  `json:"id"`
+}
+
+func (q *Queries) UpdateInvoiceStatus(ctx context.Context, arg UpdateInvoiceStatusParams) error {
+	_, err := q.db.Exec(ctx, updateInvoiceStatus, arg.Status, arg.ID)
+	return err
+}
+
+const updateInvoiceTotals = `-- name: UpdateInvoiceTotals :exec
+UPDATE invoices SET subtotal = $1, tax = $2, amount = $3 WHERE id = $4
+`
+
+type UpdateInvoiceTotalsParams struct {
+	Subtotal decimal.Decimal `json:"subtotal"`
+	Tax      decimal.Decimal `json:"tax"`
+	Amount   decimal.Decimal `json:"amount"`
+	ID       int32           `json:"id"`
+}
+
+func (q *Queries) UpdateInvoiceTotals(ctx context.Context, arg UpdateInvoiceTotalsParams) error {
+	_, err := q.db.Exec(ctx, updateInvoiceTotals,
+		arg.Subtotal,
+		arg.Tax,
+		arg.Amount,
+		arg.ID,
+	)
+	return err
+}
+
 const updateProduct = `-- name: UpdateProduct :exec
-UPDATE products SET name = $1, description = $2, category_id = $3, extension = $4, enabled = $5, pricing = $6, settings = $7, stock = $8, stock_control = $9 WHERE id = $10
+UPDATE products SET name = $1, description = $2, category_id = $3, extension = $4, enabled = $5, pricing = $6, settings = $7, stock = $8, stock_control = $9, invoice_days_before_expiry = $10, suspend_days_after_due = $11, terminate_days_after_suspension = $12, billing_anchor_day = $13, metered_pricing = $14, trial_days = $15, trial_requires_payment_method = $16, trial_once_per_user = $17, commission_percent = $18, commission_recurring = $19 WHERE id = $20
 `
 
 type UpdateProductParams struct {
-	Name         string                `json:"name"`
-	Description  string                `json:"description"`
-	CategoryID   int32                 `json:"category_id"`
-	Extension    string                `json:"extension"`
-	Enabled      bool                  `json:"enabled"`
-	Pricing      types.ProductPrices   `json:"pricing"`
-	Settings     types.ProductSettings `json:"settings"`
-	Stock        int32                 `json:"stock"`
-	StockControl int32                 `json:"stock_control"`
-	ID           int32                 `json:"id"`
+	Name                         string                `json:"name"`
+	Description                  string                `json:"description"`
+	CategoryID                   int32                 `json:"category_id"`
+	Extension                    string                `json:"extension"`
+	Enabled                      bool                  `json:"enabled"`
+	Pricing                      types.ProductPrices   `json:"pricing"`
+	Settings                     types.ProductSettings `json:"settings"`
+	Stock                        int32                 `json:"stock"`
+	StockControl                 int32                 `json:"stock_control"`
+	InvoiceDaysBeforeExpiry      pgtype.Int4           `json:"invoice_days_before_expiry"`
+	SuspendDaysAfterDue          pgtype.Int4           `json:"suspend_days_after_due"`
+	TerminateDaysAfterSuspension pgtype.Int4           `json:"terminate_days_after_suspension"`
+	BillingAnchorDay             pgtype.Int4           `json:"billing_anchor_day"`
+	MeteredPricing               types.MeteredPrices   `json:"metered_pricing"`
+	TrialDays                    int32                 `json:"trial_days"`
+	TrialRequiresPaymentMethod   bool                  `json:"trial_requires_payment_method"`
+	TrialOncePerUser             bool                  `json:"trial_once_per_user"`
+	CommissionPercent            decimal.Decimal       `json:"commission_percent"`
+	CommissionRecurring          bool                  `json:"commission_recurring"`
+	ID                           int32                 `json:"id"`
 }
 
 func (q *Queries) UpdateProduct(ctx context.Context, arg UpdateProductParams) error {
@@ -1750,6 +4765,16 @@ func (q *Queries) UpdateProduct(ctx context.Context, arg UpdateProductParams) er
 		arg.Settings,
 		arg.Stock,
 		arg.StockControl,
+		arg.InvoiceDaysBeforeExpiry,
+		arg.SuspendDaysAfterDue,
+		arg.TerminateDaysAfterSuspension,
+		arg.BillingAnchorDay,
+		arg.MeteredPricing,
+		arg.TrialDays,
+		arg.TrialRequiresPaymentMethod,
+		arg.TrialOncePerUser,
+		arg.CommissionPercent,
+		arg.CommissionRecurring,
 		arg.ID,
 	)
 	return err
@@ -1791,15 +4816,17 @@ func (q *Queries) UpdateServerSettings(ctx context.Context, arg UpdateServerSett
 }
 
 const updateService = `-- name: UpdateService :exec
-UPDATE services SET label = $1, billing_cycle = $2, price = $3, expires_at = $4 WHERE id = $5
+UPDATE services SET label = $1, billing_cycle = $2, price = $3, expires_at = $4, billing_cycle_months = $5, billing_day = $6 WHERE id = $7
 `
 
 type UpdateServiceParams struct {
-	Label        string          `json:"label"`
-	BillingCycle int32           `json:"billing_cycle"`
-	Price        decimal.Decimal `json:"price"`
-	ExpiresAt    types.Timestamp `json:"expires_at"`
-	ID           int32           `json:"id"`
+	Label              string          `json:"label"`
+	BillingCycle       int32           `json:"billing_cycle"`
+	Price              decimal.Decimal `json:"price"`
+	ExpiresAt          types.Timestamp `json:"expires_at"`
+	BillingCycleMonths int32           `json:"billing_cycle_months"`
+	BillingDay         int32           `json:"billing_day"`
+	ID                 int32           `json:"id"`
 }
 
 func (q *Queries) UpdateService(ctx context.Context, arg UpdateServiceParams) error {
@@ -1808,6 +4835,8 @@ func (q *Queries) UpdateService(ctx context.Context, arg UpdateServiceParams) er
 		arg.BillingCycle,
 		arg.Price,
 		arg.ExpiresAt,
+		arg.BillingCycleMonths,
+		arg.BillingDay,
 		arg.ID,
 	)
 	return err
@@ -1856,6 +4885,43 @@ func (q *Queries) UpdateServiceLabel(ctx context.Context, arg UpdateServiceLabel
 	return err
 }
 
+const updateServicePlan = `-- name: UpdateServicePlan :exec
+UPDATE services SET product_id = $1, label = $2, price = $3, settings = $4 WHERE id = $5
+`
+
+type UpdateServicePlanParams struct {
+	ProductID pgtype.Int4           `json:"product_id"`
+	Label     string                `json:"label"`
+	Price     decimal.Decimal       `json:"price"`
+	Settings  types.ServiceSettings `json:"settings"`
+	ID        int32                 `json:"id"`
+}
+
+func (q *Queries) UpdateServicePlan(ctx context.Context, arg UpdateServicePlanParams) error {
+	_, err := q.db.Exec(ctx, updateServicePlan,
+		arg.ProductID,
+		arg.Label,
+		arg.Price,
+		arg.Settings,
+		arg.ID,
+	)
+	return err
+}
+
+const updateServiceReviewReason = `-- name: UpdateServiceReviewReason :exec
+UPDATE services SET review_reason = $1 WHERE id = $2
+`
+
+type UpdateServiceReviewReasonParams struct {
+	ReviewReason pgtype.Text `json:"review_reason"`
+	ID           int32       `json:"id"`
+}
+
+func (q *Queries) UpdateServiceReviewReason(ctx context.Context, arg UpdateServiceReviewReasonParams) error {
+	_, err := q.db.Exec(ctx, updateServiceReviewReason, arg.ReviewReason, arg.ID)
+	return err
+}
+
 const updateServiceSettings = `-- name: UpdateServiceSettings :exec
 UPDATE services SET settings = $1 WHERE id = $2
 `
@@ -1884,6 +4950,48 @@ func (q *Queries) UpdateServiceStatus(ctx context.Context, arg UpdateServiceStat
 	return err
 }
 
+const updateServiceSuspensionReason = `-- name: UpdateServiceSuspensionReason :exec
+UPDATE services SET suspension_reason = $1 WHERE id = $2
+`
+
+type UpdateServiceSuspensionReasonParams struct {
+	SuspensionReason pgtype.Text `json:"suspension_reason"`
+	ID               int32       `json:"id"`
+}
+
+func (q *Queries) UpdateServiceSuspensionReason(ctx context.Context, arg UpdateServiceSuspensionReasonParams) error {
+	_, err := q.db.Exec(ctx, updateServiceSuspensionReason, arg.SuspensionReason, arg.ID)
+	return err
+}
+
+const updateServiceUpgradeStatus = `-- name: UpdateServiceUpgradeStatus :exec
+UPDATE service_upgrades SET status = $1 WHERE id = $2
+`
+
+type UpdateServiceUpgradeStatusParams struct {
+	Status string `json:"status"`
+	ID     int32  `json:"id"`
+}
+
+func (q *Queries) UpdateServiceUpgradeStatus(ctx context.Context, arg UpdateServiceUpgradeStatusParams) error {
+	_, err := q.db.Exec(ctx, updateServiceUpgradeStatus, arg.Status, arg.ID)
+	return err
+}
+
+const updateServiceUsageBilledUntil = `-- name: UpdateServiceUsageBilledUntil :exec
+UPDATE services SET usage_billed_until = $1 WHERE id = $2
+`
+
+type UpdateServiceUsageBilledUntilParams struct {
+	UsageBilledUntil types.Timestamp `json:"usage_billed_until"`
+	ID               int32           `json:"id"`
+}
+
+func (q *Queries) UpdateServiceUsageBilledUntil(ctx context.Context, arg UpdateServiceUsageBilledUntilParams) error {
+	_, err := q.db.Exec(ctx, updateServiceUsageBilledUntil, arg.UsageBilledUntil, arg.ID)
+	return err
+}
+
 const updateSessionExpiryTime = `-- name: UpdateSessionExpiryTime :exec
 UPDATE sessions SET expires_at = $2 WHERE token = $1
 `
@@ -1912,6 +5020,33 @@ func (q *Queries) UpdateSetting(ctx context.Context, arg UpdateSettingParams) er
 	return err
 }
 
+const updateTaxRule = `-- name: UpdateTaxRule :exec
+UPDATE tax_rules SET name = $1, country = $2, state = $3, rate = $4, inclusive = $5, reverse_charge = $6 WHERE id = $7
+`
+
+type UpdateTaxRuleParams struct {
+	Name          string          `json:"name"`
+	Country       string          `json:"country"`
+	State         string          `json:"state"`
+	Rate          decimal.Decimal `json:"rate"`
+	Inclusive     bool            `json:"inclusive"`
+	ReverseCharge bool            `json:"reverse_charge"`
+	ID            int32           `json:"id"`
+}
+
+func (q *Queries) UpdateTaxRule(ctx context.Context, arg UpdateTaxRuleParams) error {
+	_, err := q.db.Exec(ctx, updateTaxRule,
+		arg.Name,
+		arg.Country,
+		arg.State,
+		arg.Rate,
+		arg.Inclusive,
+		arg.ReverseCharge,
+		arg.ID,
+	)
+	return err
+}
+
 const updateUser = `-- name: UpdateUser :exec
 UPDATE users SET email = $2, name = $3, role = $4, address = $5, city = $6, state = $7, country = $8, zip_code = $9 WHERE id = $1
 `
@@ -1943,6 +5078,78 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) error {
 	return err
 }
 
+const updateUserBillingAnchorDay = `-- name: UpdateUserBillingAnchorDay :exec
+UPDATE users SET billing_anchor_day = $2 WHERE id = $1
+`
+
+type UpdateUserBillingAnchorDayParams struct {
+	ID               int32       `json:"id"`
+	BillingAnchorDay pgtype.Int4 `json:"billing_anchor_day"`
+}
+
+const updateUserCredit = `-- name: UpdateUserCredit :one
+UPDATE users SET credit = credit + $1::decimal WHERE id = $2 AND credit + $1::decimal >= 0 RETURNING credit
+`
+
+type UpdateUserCreditParams struct {
+	Amount decimal.Decimal `json:"amount"`
+	ID     int32           `json:"id"`
+}
+
+func (q *Queries) UpdateUserCredit(ctx context.Context, arg UpdateUserCreditParams) (decimal.Decimal, error) {
+	row := q.db.QueryRow(ctx, updateUserCredit, arg.Amount, arg.ID)
+	var credit decimal.Decimal
+	err := row.Scan(&credit)
+	return credit, err
+}
+
+const updateUserCurrency = `-- name: UpdateUserCurrency :exec
+UPDATE users SET currency = $2 WHERE id = $1
+`
+
+type UpdateUserCurrencyParams struct {
+	ID       int32  `json:"id"`
+	Currency string `json:"currency"`
+}
+
+func (q *Queries) UpdateUserCurrency(ctx context.Context, arg UpdateUserCurrencyParams) error {
+	_, err := q.db.Exec(ctx, updateUserCurrency, arg.ID, arg.Currency)
+	return err
+}
+
+const updateUserEmailReminders = `-- name: UpdateUserEmailReminders :exec
+UPDATE users SET email_reminders = $2 WHERE id = $1
+`
+
+type UpdateUserEmailRemindersParams struct {
+	ID             int32 `json:"id"`
+	EmailReminders bool  `json:"email_reminders"`
+}
+
+func (q *Queries) UpdateUserEmailReminders(ctx context.Context, arg UpdateUserEmailRemindersParams) error {
+	_, err := q.db.Exec(ctx, updateUserEmailReminders, arg.ID, arg.EmailReminders)
+	return err
+}
+
+const updateUserLateFeeExempt = `-- name: UpdateUserLateFeeExempt :exec
+UPDATE users SET late_fee_exempt = $2 WHERE id = $1
+`
+
+type UpdateUserLateFeeExemptParams struct {
+	ID            int32 `json:"id"`
+	LateFeeExempt bool  `json:"late_fee_exempt"`
+}
+
+func (q *Queries) UpdateUserLateFeeExempt(ctx context.Context, arg UpdateUserLateFeeExemptParams) error {
+	_, err := q.db.Exec(ctx, updateUserLateFeeExempt, arg.ID, arg.LateFeeExempt)
+	return err
+}
+
+func (q *Queries) UpdateUserBillingAnchorDay(ctx context.Context, arg UpdateUserBillingAnchorDayParams) error {
+	_, err := q.db.Exec(ctx, updateUserBillingAnchorDay, arg.ID, arg.BillingAnchorDay)
+	return err
+}
+
 const updateUserPassword = `-- name: UpdateUserPassword :exec
 UPDATE users SET password = $2 WHERE id = $1
 `
@@ -1983,3 +5190,46 @@ func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfilePa
 	)
 	return err
 }
+
+const updateUserReferralCode = `-- name: UpdateUserReferralCode :exec
+UPDATE users SET referral_code = $2 WHERE id = $1 AND referral_code IS NULL
+`
+
+type UpdateUserReferralCodeParams struct {
+	ID           int32       `json:"id"`
+	ReferralCode pgtype.Text `json:"referral_code"`
+}
+
+func (q *Queries) UpdateUserReferralCode(ctx context.Context, arg UpdateUserReferralCodeParams) error {
+	_, err := q.db.Exec(ctx, updateUserReferralCode, arg.ID, arg.ReferralCode)
+	return err
+}
+
+const updateUserReferredBy = `-- name: UpdateUserReferredBy :exec
+UPDATE users SET referred_by = $2 WHERE id = $1
+`
+
+type UpdateUserReferredByParams struct {
+	ID         int32       `json:"id"`
+	ReferredBy pgtype.Int4 `json:"referred_by"`
+}
+
+func (q *Queries) UpdateUserReferredBy(ctx context.Context, arg UpdateUserReferredByParams) error {
+	_, err := q.db.Exec(ctx, updateUserReferredBy, arg.ID, arg.ReferredBy)
+	return err
+}
+
+const updateUserVatID = `-- name: UpdateUserVatID :exec
+UPDATE users SET vat_id = $2, vat_id_valid = $3 WHERE id = $1
+`
+
+type UpdateUserVatIDParams struct {
+	ID         int32  `json:"id"`
+	VatID      string `json:"vat_id"`
+	VatIDValid bool   `json:"vat_id_valid"`
+}
+
+func (q *Queries) UpdateUserVatID(ctx context.Context, arg UpdateUserVatIDParams) error {
+	_, err := q.db.Exec(ctx, updateUserVatID, arg.ID, arg.VatID, arg.VatIDValid)
+	return err
+}
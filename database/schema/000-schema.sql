@@ -129,4 +129,284 @@ CREATE TABLE IF NOT EXISTS settings
     id    SERIAL PRIMARY KEY,
     key   VARCHAR(200) UNIQUE NOT NULL,
     value TEXT         NOT NULL
-);
\ No newline at end of file
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS credit DECIMAL(12, 2) NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS credit_transactions
+(
+    id          SERIAL PRIMARY KEY,
+    user_id     INTEGER        NOT NULL REFERENCES users,
+    type        VARCHAR(200)   NOT NULL,
+    amount      DECIMAL(12, 2) NOT NULL,
+    description TEXT           NOT NULL,
+    invoice_id  INTEGER REFERENCES invoices,
+    created_at  TIMESTAMP      NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE invoice_payments ADD COLUMN IF NOT EXISTS refund_of INTEGER REFERENCES invoice_payments;
+
+CREATE TABLE IF NOT EXISTS gateway_orders
+(
+    id         SERIAL PRIMARY KEY,
+    gateway    VARCHAR(200) NOT NULL,
+    order_id   VARCHAR(200) NOT NULL,
+    invoice_id INTEGER      NOT NULL REFERENCES invoices,
+    status     VARCHAR(200) NOT NULL,
+    created_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (gateway, order_id)
+);
+
+-- the part of a payment carried over to the credit balance as overpayment, in the currency of the invoice
+ALTER TABLE invoice_payments ADD COLUMN IF NOT EXISTS credited DECIMAL(12, 2) NOT NULL DEFAULT 0;
+
+-- refunds sent through payment gateways. A refund is PENDING while the gateway is called, and until it is recorded
+-- as a negative payment.
+CREATE TABLE IF NOT EXISTS gateway_refunds
+(
+    id           SERIAL PRIMARY KEY,
+    payment_id   INTEGER        NOT NULL REFERENCES invoice_payments,
+    amount       DECIMAL(12, 2) NOT NULL,
+    description  VARCHAR(200)   NOT NULL,
+    status       VARCHAR(200)   NOT NULL,
+    reference_id VARCHAR(200)   NOT NULL DEFAULT '',
+    error        TEXT           NOT NULL DEFAULT '',
+    created_at   TIMESTAMP      NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- payments recorded more than once before the index existed are kept, but the reference of the duplicates is
+-- suffixed with their id so that the index can be created. Admins can find them by the suffix and review them.
+UPDATE invoice_payments
+SET reference_id = LEFT(reference_id, 170) || '#duplicate-' || id
+WHERE reference_id <> ''
+  AND id NOT IN (SELECT MIN(id) FROM invoice_payments WHERE reference_id <> '' GROUP BY gateway, reference_id);
+CREATE UNIQUE INDEX IF NOT EXISTS invoice_payments_gateway_reference_id ON invoice_payments (gateway, reference_id) WHERE reference_id <> '';
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT '';
+-- existing invoices and services are in the default currency, which is USD unless it has been set
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT '';
+ALTER TABLE services ADD COLUMN IF NOT EXISTS currency VARCHAR(3) NOT NULL DEFAULT '';
+UPDATE invoices SET currency = COALESCE((SELECT value FROM settings WHERE key = 'default_currency'), 'USD') WHERE currency = '';
+UPDATE services SET currency = COALESCE((SELECT value FROM settings WHERE key = 'default_currency'), 'USD') WHERE currency = '';
+
+CREATE TABLE IF NOT EXISTS tax_rules
+(
+    id             SERIAL PRIMARY KEY,
+    name           VARCHAR(200)  NOT NULL,
+    country        VARCHAR(200)  NOT NULL,
+    state          VARCHAR(200)  NOT NULL,
+    rate           DECIMAL(6, 3) NOT NULL,
+    inclusive      BOOLEAN       NOT NULL,
+    reverse_charge BOOLEAN       NOT NULL
+);
+
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS subtotal DECIMAL(12, 2) NOT NULL DEFAULT 0;
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS tax DECIMAL(12, 2) NOT NULL DEFAULT 0;
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS tax_rate DECIMAL(6, 3) NOT NULL DEFAULT 0;
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS tax_name VARCHAR(200) NOT NULL DEFAULT '';
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS tax_inclusive BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS reverse_charge BOOLEAN NOT NULL DEFAULT false;
+-- invoices created before taxes were introduced
+UPDATE invoices SET subtotal = amount WHERE subtotal = 0 AND tax = 0 AND amount <> 0;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS vat_id VARCHAR(200) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS vat_id_valid BOOLEAN NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS coupons
+(
+    id                SERIAL PRIMARY KEY,
+    code              VARCHAR(100)   NOT NULL UNIQUE,
+    type              VARCHAR(20)    NOT NULL,
+    value             DECIMAL(12, 2) NOT NULL,
+    currency          VARCHAR(3)     NOT NULL DEFAULT '',
+    product_ids       INTEGER[]      NOT NULL DEFAULT '{}',
+    durations         INTEGER[]      NOT NULL DEFAULT '{}',
+    recurring         BOOLEAN        NOT NULL DEFAULT false,
+    max_uses          INTEGER        NOT NULL DEFAULT 0,
+    max_uses_per_user INTEGER        NOT NULL DEFAULT 0,
+    uses              INTEGER        NOT NULL DEFAULT 0,
+    valid_from        TIMESTAMP,
+    valid_until       TIMESTAMP,
+    enabled           BOOLEAN        NOT NULL DEFAULT true,
+    created_at        TIMESTAMP      NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS coupon_uses
+(
+    id         SERIAL PRIMARY KEY,
+    coupon_id  INTEGER   NOT NULL REFERENCES coupons ON DELETE CASCADE,
+    user_id    INTEGER   NOT NULL REFERENCES users,
+    service_id INTEGER REFERENCES services ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE services ADD COLUMN IF NOT EXISTS discount DECIMAL(12, 2) NOT NULL DEFAULT 0;
+
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS number VARCHAR(100) NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS invoices_number ON invoices (number) WHERE number <> '';
+
+-- last invoice number of each numbering period, which is the year if numbers reset yearly, otherwise 0
+CREATE TABLE IF NOT EXISTS invoice_number_sequences
+(
+    period INTEGER PRIMARY KEY,
+    last   INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS credit_notes
+(
+    id         SERIAL PRIMARY KEY,
+    number     VARCHAR(100)   NOT NULL UNIQUE,
+    invoice_id INTEGER        NOT NULL REFERENCES invoices,
+    user_id    INTEGER        NOT NULL REFERENCES users,
+    reason     TEXT           NOT NULL,
+    subtotal   DECIMAL(12, 2) NOT NULL,
+    tax        DECIMAL(12, 2) NOT NULL,
+    amount     DECIMAL(12, 2) NOT NULL,
+    currency   VARCHAR(3)     NOT NULL,
+    created_at TIMESTAMP      NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS credit_note_items
+(
+    id             SERIAL PRIMARY KEY,
+    credit_note_id INTEGER        NOT NULL REFERENCES credit_notes ON DELETE CASCADE,
+    description    TEXT           NOT NULL,
+    amount         DECIMAL(12, 2) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS credit_note_number_sequences
+(
+    period INTEGER PRIMARY KEY,
+    last   INTEGER NOT NULL
+);
+
+ALTER TABLE services ADD COLUMN IF NOT EXISTS product_id INTEGER REFERENCES products ON DELETE SET NULL;
+
+CREATE TABLE IF NOT EXISTS service_upgrades
+(
+    id         SERIAL PRIMARY KEY,
+    service_id INTEGER        NOT NULL REFERENCES services ON DELETE CASCADE,
+    invoice_id INTEGER REFERENCES invoices,
+    product_id INTEGER        NOT NULL REFERENCES products,
+    settings   JSONB          NOT NULL,
+    price      DECIMAL(12, 2) NOT NULL,
+    amount     DECIMAL(12, 2) NOT NULL,
+    status     VARCHAR(20)    NOT NULL,
+    created_at TIMESTAMP      NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS invoice_days_before_expiry INTEGER;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS suspend_days_after_due INTEGER;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS terminate_days_after_suspension INTEGER;
+ALTER TABLE services ADD COLUMN IF NOT EXISTS suspension_reason TEXT;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_reminders BOOLEAN NOT NULL DEFAULT TRUE;
+
+CREATE TABLE IF NOT EXISTS invoice_reminders
+(
+    invoice_id INTEGER     NOT NULL REFERENCES invoices ON DELETE CASCADE,
+    stage      VARCHAR(20) NOT NULL,
+    sent_at    TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (invoice_id, stage)
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS late_fee_exempt BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- calendar billing cycles renew every billing_cycle_months months on billing_day, billing_cycle is used otherwise
+ALTER TABLE services ADD COLUMN IF NOT EXISTS billing_cycle_months INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE services ADD COLUMN IF NOT EXISTS billing_day INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS billing_anchor_day INTEGER;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS billing_anchor_day INTEGER;
+-- proration items are linked to their service. Older ones are linked if their invoice has a single service.
+UPDATE invoice_items
+SET item_id = (SELECT MIN(s.item_id) FROM invoice_items s WHERE s.invoice_id = invoice_items.invoice_id AND s.type = 'service')
+WHERE type = 'proration'
+  AND item_id IS NULL
+  AND (SELECT COUNT(*) FROM invoice_items s WHERE s.invoice_id = invoice_items.invoice_id AND s.type = 'service') = 1;
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS metered_pricing JSONB NOT NULL DEFAULT '[]';
+-- usage before usage_billed_until has been charged on renewal invoices
+ALTER TABLE services ADD COLUMN IF NOT EXISTS usage_billed_until TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS usage_records
+(
+    id          SERIAL PRIMARY KEY,
+    service_id  INTEGER        NOT NULL REFERENCES services ON DELETE CASCADE,
+    metric      VARCHAR(100)   NOT NULL,
+    quantity    DECIMAL(20, 6) NOT NULL,
+    recorded_at TIMESTAMP      NOT NULL,
+    created_at  TIMESTAMP      NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS usage_records_service_id ON usage_records (service_id, recorded_at);
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS trial_days INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS trial_requires_payment_method BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS trial_once_per_user BOOLEAN NOT NULL DEFAULT TRUE;
+
+-- trials are kept after the user is deleted, so that the email address cannot be used for another trial
+CREATE TABLE IF NOT EXISTS trials
+(
+    id         SERIAL PRIMARY KEY,
+    product_id INTEGER      NOT NULL REFERENCES products ON DELETE CASCADE,
+    user_id    INTEGER REFERENCES users ON DELETE SET NULL,
+    email      VARCHAR(255) NOT NULL,
+    service_id INTEGER REFERENCES services ON DELETE SET NULL,
+    created_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS trials_product_id ON trials (product_id);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS referral_code VARCHAR(32) UNIQUE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS referred_by INTEGER REFERENCES users ON DELETE SET NULL;
+-- commission_percent of the invoiced amount excluding tax is paid to the affiliate on the first invoice of
+-- services, or on all invoices if commission_recurring
+ALTER TABLE products ADD COLUMN IF NOT EXISTS commission_percent DECIMAL(5, 2) NOT NULL DEFAULT 0;
+ALTER TABLE products ADD COLUMN IF NOT EXISTS commission_recurring BOOLEAN NOT NULL DEFAULT FALSE;
+-- the affiliate who referred the user when the service was ordered
+ALTER TABLE services ADD COLUMN IF NOT EXISTS affiliate_id INTEGER REFERENCES users ON DELETE SET NULL;
+
+-- amounts are in the default currency, amount - reversed - paid_out is owed to the affiliate
+CREATE TABLE IF NOT EXISTS commissions
+(
+    id           SERIAL PRIMARY KEY,
+    affiliate_id INTEGER        NOT NULL REFERENCES users ON DELETE CASCADE,
+    invoice_id   INTEGER        NOT NULL REFERENCES invoices ON DELETE CASCADE,
+    amount       DECIMAL(12, 2) NOT NULL,
+    reversed     DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    paid_out     DECIMAL(12, 2) NOT NULL DEFAULT 0,
+    created_at   TIMESTAMP      NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (invoice_id, affiliate_id)
+);
+CREATE INDEX IF NOT EXISTS commissions_affiliate_id ON commissions (affiliate_id);
+
+-- the IP address and its country (from Cloudflare) from which the service was ordered, used for fraud screening
+ALTER TABLE services ADD COLUMN IF NOT EXISTS order_ip VARCHAR(45) NOT NULL DEFAULT '';
+ALTER TABLE services ADD COLUMN IF NOT EXISTS order_country VARCHAR(2) NOT NULL DEFAULT '';
+-- why the order is held for review if the status is PENDING_REVIEW
+ALTER TABLE services ADD COLUMN IF NOT EXISTS review_reason TEXT;
+
+-- percentage of the price discounted on renewals by a percentage coupon, so that the discount follows price changes.
+-- discount is the fixed discount if discount_rate is 0.
+ALTER TABLE services ADD COLUMN IF NOT EXISTS discount_rate DECIMAL(5, 2) NOT NULL DEFAULT 0;
+UPDATE services SET discount_rate = LEAST(coupons.value, 100) FROM coupon_uses INNER JOIN coupons ON coupon_uses.coupon_id = coupons.id WHERE coupon_uses.service_id = services.id AND coupons.type = 'percentage' AND coupons.recurring AND services.discount > 0 AND services.discount_rate = 0;
+
+-- carts of logged in users are found by user_id, carts of guests by token. Guest carts are moved to the user when
+-- they log in.
+CREATE TABLE IF NOT EXISTS carts
+(
+    id         SERIAL PRIMARY KEY,
+    token      VARCHAR(64) NOT NULL UNIQUE,
+    user_id    INTEGER UNIQUE REFERENCES users ON DELETE CASCADE,
+    updated_at TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS cart_items
+(
+    id         SERIAL PRIMARY KEY,
+    cart_id    INTEGER      NOT NULL REFERENCES carts ON DELETE CASCADE,
+    product_id INTEGER      NOT NULL REFERENCES products ON DELETE CASCADE,
+    duration   INTEGER      NOT NULL,
+    options    JSONB        NOT NULL,
+    coupon     VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP    NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS cart_items_cart_id ON cart_items (cart_id);
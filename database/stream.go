@@ -0,0 +1,116 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Streaming variants of :many queries that return too many rows to be loaded into memory at once. sqlc does not
+// generate them, so they reuse the generated queries and row types, and call fn for each row as it is read.
+// The connection is held until all rows are read or fn returns an error, which is then returned.
+
+func forEachRow[T any](rows pgx.Rows, err error, scan func(pgx.Rows, *T) error, fn func(T) error) error {
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i T
+		if err := scan(rows, &i); err != nil {
+			return err
+		}
+		if err := fn(i); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (q *Queries) ExportInvoicesEach(ctx context.Context, arg ExportInvoicesParams, fn func(ExportInvoicesRow) error) error {
+	rows, err := q.db.Query(ctx, exportInvoices, arg.CashBasis, arg.StartAt, arg.EndAt)
+	return forEachRow(rows, err, func(rows pgx.Rows, i *ExportInvoicesRow) error {
+		return rows.Scan(
+			&i.ID,
+			&i.Number,
+			&i.UserID,
+			&i.Email,
+			&i.Name,
+			&i.Status,
+			&i.CreatedAt,
+			&i.DueAt,
+			&i.PaidAt,
+			&i.Currency,
+			&i.Subtotal,
+			&i.Tax,
+			&i.TaxName,
+			&i.TaxRate,
+			&i.TaxInclusive,
+			&i.Amount,
+		)
+	}, fn)
+}
+
+func (q *Queries) ExportInvoiceItemsEach(ctx context.Context, arg ExportInvoiceItemsParams, fn func(ExportInvoiceItemsRow) error) error {
+	rows, err := q.db.Query(ctx, exportInvoiceItems, arg.CashBasis, arg.StartAt, arg.EndAt)
+	return forEachRow(rows, err, func(rows pgx.Rows, i *ExportInvoiceItemsRow) error {
+		return rows.Scan(
+			&i.ID,
+			&i.InvoiceID,
+			&i.Number,
+			&i.Email,
+			&i.Name,
+			&i.CreatedAt,
+			&i.DueAt,
+			&i.PaidAt,
+			&i.Currency,
+			&i.Description,
+			&i.Amount,
+			&i.Type,
+			&i.ItemID,
+			&i.TaxName,
+			&i.TaxRate,
+			&i.TaxInclusive,
+		)
+	}, fn)
+}
+
+func (q *Queries) ExportPaymentsEach(ctx context.Context, arg ExportPaymentsParams, fn func(ExportPaymentsRow) error) error {
+	rows, err := q.db.Query(ctx, exportPayments, arg.StartAt, arg.EndAt)
+	return forEachRow(rows, err, func(rows pgx.Rows, i *ExportPaymentsRow) error {
+		return rows.Scan(
+			&i.ID,
+			&i.InvoiceID,
+			&i.Number,
+			&i.Email,
+			&i.Name,
+			&i.CreatedAt,
+			&i.Description,
+			&i.Amount,
+			&i.ReferenceID,
+			&i.Gateway,
+			&i.RefundOf,
+			&i.Currency,
+		)
+	}, fn)
+}
+
+func (q *Queries) ExportJournalEach(ctx context.Context, arg ExportJournalParams, fn func(ExportJournalRow) error) error {
+	rows, err := q.db.Query(ctx, exportJournal, arg.CashBasis, arg.StartAt, arg.EndAt)
+	return forEachRow(rows, err, func(rows pgx.Rows, i *ExportJournalRow) error {
+		return rows.Scan(
+			&i.Date,
+			&i.Type,
+			&i.ID,
+			&i.InvoiceID,
+			&i.Number,
+			&i.Name,
+			&i.Currency,
+			&i.Subtotal,
+			&i.Tax,
+			&i.Amount,
+			&i.Gateway,
+			&i.Description,
+		)
+	}, fn)
+}
@@ -7,8 +7,27 @@ type ProductPrices = []ProductPrice
 type ProductPrice struct {
 	DisplayName string          `json:"display_name"`
 	Duration    int32           `json:"duration"` // number of seconds
+	Months      int32           `json:"months"`   // calendar months, the cycle is Duration seconds long if zero
 	Price       decimal.Decimal `json:"price"`
 	SetupFee    decimal.Decimal `json:"setup_fee"`
+	Currency    string          `json:"currency"` // empty for the default currency
+}
+
+type MeteredPrices = []MeteredPrice
+
+// MeteredPrice is the price of a metered resource of a product, e.g. bandwidth or compute hours.
+// Usage is charged by graduated tiers, each unit is charged at the price of the tier it falls in.
+type MeteredPrice struct {
+	Metric      string             `json:"metric"` // metric of the usage records
+	DisplayName string             `json:"display_name"`
+	Unit        string             `json:"unit"`     // e.g. GB, hours
+	Currency    string             `json:"currency"` // empty for the default currency
+	Tiers       []MeteredPriceTier `json:"tiers"`
+}
+
+type MeteredPriceTier struct {
+	UpTo      decimal.Decimal `json:"up_to"` // upper bound of the tier, zero for the last tier which has no upper bound
+	UnitPrice decimal.Decimal `json:"unit_price"`
 }
 
 type ProductOptionValues = []ProductOptionValue
@@ -17,6 +36,7 @@ type ProductOptionValuePrice struct {
 	Duration int32           `json:"duration"` // number of seconds
 	Price    decimal.Decimal `json:"price"`
 	SetupFee decimal.Decimal `json:"setup_fee"`
+	Currency string          `json:"currency"` // empty for the default currency
 }
 
 type ProductOptionValue struct {
@@ -29,6 +49,8 @@ type ProductSettings map[string]string
 
 type ServiceSettings map[string]string
 
+type CartItemOptions map[string]string
+
 type GatewaySettings map[string]string
 
 type ServerSettings map[string]string
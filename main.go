@@ -72,6 +72,7 @@ func main() {
 
 	// cron jobs
 	service.InitCron()
+	gateways.InitCron()
 
 	// river
 	database.InitRiver()
@@ -0,0 +1,297 @@
+package service
+
+import (
+	"billing3/database"
+	"billing3/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+// AffiliateStats is the referral code of an affiliate, the users and orders referred by them, and their commissions.
+// Commissions are in the default currency. Pending commissions become available for payout after the hold period,
+// so that they can still be reversed if the invoice is refunded.
+type AffiliateStats struct {
+	ReferralCode string          `json:"referral_code"`
+	Referrals    int64           `json:"referrals"`
+	Orders       int64           `json:"orders"`
+	Earned       decimal.Decimal `json:"earned"`
+	PaidOut      decimal.Decimal `json:"paid_out"`
+	Available    decimal.Decimal `json:"available"`
+	Pending      decimal.Decimal `json:"pending"`
+	Currency     string          `json:"currency"`
+}
+
+// ReferralCode returns the referral code of the user, and generates one if the user has none yet.
+func ReferralCode(ctx context.Context, user *database.User) (string, error) {
+	if user.ReferralCode.Valid {
+		return user.ReferralCode.String, nil
+	}
+
+	for range 5 {
+		err := database.Q.UpdateUserReferralCode(ctx, database.UpdateUserReferralCodeParams{
+			ID:           user.ID,
+			ReferralCode: pgtype.Text{Valid: true, String: utils.RandomToken(4)},
+		})
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == database.PGErrorUniqueViolation {
+			// the code is taken by another user
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("db: %w", err)
+		}
+		break
+	}
+
+	// the code may have been generated concurrently
+	u, err := database.Q.FindUserById(ctx, user.ID)
+	if err != nil {
+		return "", fmt.Errorf("db: %w", err)
+	}
+	if !u.ReferralCode.Valid {
+		return "", errors.New("failed to generate referral code")
+	}
+	return u.ReferralCode.String, nil
+}
+
+// FindAffiliateByReferralCode returns the user with the referral code. ErrInvalidReferralCode is returned if there
+// is none.
+func FindAffiliateByReferralCode(ctx context.Context, code string) (*database.User, error) {
+	user, err := database.Q.FindUserByReferralCode(ctx, pgtype.Text{Valid: true, String: code})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidReferralCode
+		}
+		return nil, fmt.Errorf("db: %w", err)
+	}
+	return &user, nil
+}
+
+// GetAffiliateStats returns the referral statistics and commissions of the user.
+func GetAffiliateStats(ctx context.Context, user *database.User) (*AffiliateStats, error) {
+	code, err := ReferralCode(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	referrals, err := database.Q.CountReferredUsers(ctx, pgtype.Int4{Valid: true, Int32: user.ID})
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	orders, err := database.Q.CountAffiliateServices(ctx, pgtype.Int4{Valid: true, Int32: user.ID})
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	commissions, err := database.Q.AffiliateCommissionStats(ctx, database.AffiliateCommissionStatsParams{
+		HeldUntil:   Timestamp(commissionHeldUntil(ctx)),
+		AffiliateID: user.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	return &AffiliateStats{
+		ReferralCode: code,
+		Referrals:    referrals,
+		Orders:       orders,
+		Earned:       commissions.Earned,
+		PaidOut:      commissions.PaidOut,
+		Available:    commissions.Available,
+		Pending:      commissions.Pending,
+		Currency:     DefaultCurrency(ctx),
+	}, nil
+}
+
+// ListCommissions returns a page of the commissions of the affiliate, newest first.
+func ListCommissions(ctx context.Context, affiliateId int32, page int, itemPerPage int32) (int, []database.Commission, error) {
+	totalCount, err := database.Q.CountCommissions(ctx, affiliateId)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	totalPages := int(math.Ceil(float64(totalCount) / float64(itemPerPage)))
+
+	commissions, err := database.Q.ListCommissionsPaged(ctx, database.ListCommissionsPagedParams{
+		AffiliateID: affiliateId,
+		Limit:       itemPerPage,
+		Offset:      int32(page-1) * itemPerPage,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return totalPages, commissions, nil
+}
+
+// AccrueCommissions credits the affiliates who referred the services on a paid invoice with the commission of the
+// products. The commission is a percentage of the invoiced amount of each service excluding tax, on the first
+// invoice of the service, or on all invoices if the product pays recurring commissions. Commissions are accrued only
+// once per invoice.
+//
+// qtx should be a transaction. qtx is not commited.
+func AccrueCommissions(ctx context.Context, qtx *database.Queries, invoice *database.Invoice) error {
+	bases, err := qtx.ListInvoiceCommissionBases(ctx, invoice.ID)
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+
+	products := make(map[int32]*database.Product)
+	amounts := make(map[int32]decimal.Decimal) // by affiliate
+
+	for _, base := range bases {
+		// affiliates do not earn commissions on their own orders
+		if !base.ProductID.Valid || !base.AffiliateID.Valid || base.AffiliateID.Int32 == invoice.UserID {
+			continue
+		}
+
+		product, ok := products[base.ProductID.Int32]
+		if !ok {
+			p, err := qtx.FindProductById(ctx, base.ProductID.Int32)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("find product: %w", err)
+			}
+			product = &p
+			products[base.ProductID.Int32] = product
+		}
+
+		if !product.CommissionPercent.GreaterThan(decimal.Zero) || (base.Renewal && !product.CommissionRecurring) {
+			continue
+		}
+
+		subtotal, _, _ := TaxFromInvoice(invoice).Apply(base.Amount)
+		if !subtotal.GreaterThan(decimal.Zero) {
+			continue
+		}
+
+		amounts[base.AffiliateID.Int32] = amounts[base.AffiliateID.Int32].Add(subtotal.Mul(product.CommissionPercent).Div(decimal.NewFromInt(100)))
+	}
+
+	affiliates := make([]int32, 0, len(amounts))
+	for affiliateId := range amounts {
+		affiliates = append(affiliates, affiliateId)
+	}
+	slices.Sort(affiliates)
+
+	for _, affiliateId := range affiliates {
+		amount, err := ConvertCurrency(ctx, amounts[affiliateId], invoice.Currency, DefaultCurrency(ctx))
+		if err != nil {
+			return fmt.Errorf("convert commission: %w", err)
+		}
+		amount = amount.Round(2)
+		if !amount.GreaterThan(decimal.Zero) {
+			continue
+		}
+
+		slog.Info("accrue commission", "invoice_id", invoice.ID, "affiliate_id", affiliateId, "amount", amount)
+
+		err = qtx.CreateCommission(ctx, database.CreateCommissionParams{
+			AffiliateID: affiliateId,
+			InvoiceID:   invoice.ID,
+			Amount:      amount,
+		})
+		if err != nil {
+			return fmt.Errorf("db: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// reverseCommissions reverses the share of the commissions of the invoice that corresponds to the refunded amount.
+// Commissions that have been paid out already are deducted from the next payout.
+//
+// qtx should be a transaction. qtx is not commited.
+func reverseCommissions(ctx context.Context, qtx *database.Queries, invoiceId int32, refunded decimal.Decimal) error {
+	invoice, err := qtx.FindInvoiceById(ctx, invoiceId)
+	if err != nil {
+		return fmt.Errorf("find invoice: %w", err)
+	}
+
+	fraction := decimal.NewFromInt(1)
+	if invoice.Status != InvoiceRefunded && invoice.Amount.GreaterThan(decimal.Zero) {
+		fraction = decimal.Min(refunded.Div(invoice.Amount), fraction)
+	}
+
+	err = qtx.ReverseCommissions(ctx, database.ReverseCommissionsParams{
+		Fraction:  fraction,
+		InvoiceID: invoiceId,
+	})
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+	return nil
+}
+
+// PayoutCommissions pays the available commissions of the affiliate into their account credit, and returns the
+// amount paid out. ErrNoCommissionPayable is returned if nothing is available, and ErrCommissionBelowMinimum if the
+// amount is below the minimum payout.
+//
+// qtx should be a transaction. The user is locked until the transaction ends. qtx is not commited.
+func PayoutCommissions(ctx context.Context, qtx *database.Queries, affiliateId int32) (decimal.Decimal, error) {
+	_, err := qtx.FindUserByIdForUpdate(ctx, affiliateId)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("lock user: %w", err)
+	}
+
+	commissions, err := qtx.ListPayableCommissionsForUpdate(ctx, database.ListPayableCommissionsForUpdateParams{
+		AffiliateID: affiliateId,
+		HeldUntil:   Timestamp(commissionHeldUntil(ctx)),
+	})
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("db: %w", err)
+	}
+
+	total := decimal.Zero
+	for _, commission := range commissions {
+		total = total.Add(commission.Amount.Sub(commission.Reversed).Sub(commission.PaidOut))
+	}
+
+	if !total.GreaterThan(decimal.Zero) {
+		return decimal.Zero, ErrNoCommissionPayable
+	}
+	minimum, _ := decimal.NewFromString(SettingAffiliateMinPayout.Get(ctx))
+	if total.LessThan(minimum) {
+		return decimal.Zero, fmt.Errorf("%w: %s %s", ErrCommissionBelowMinimum, minimum.StringFixed(2), DefaultCurrency(ctx))
+	}
+
+	for _, commission := range commissions {
+		err = qtx.UpdateCommissionPaidOut(ctx, commission.ID)
+		if err != nil {
+			return decimal.Zero, fmt.Errorf("db: %w", err)
+		}
+	}
+
+	_, err = AddCredit(ctx, qtx, affiliateId, total, CreditCommission, "Affiliate commission payout", pgtype.Int4{})
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	slog.Info("commission payout", "affiliate_id", affiliateId, "amount", total, "commissions", len(commissions))
+
+	return total, nil
+}
+
+// commissionHeldUntil returns the time before which commissions must have been accrued to be available for payout.
+func commissionHeldUntil(ctx context.Context) time.Time {
+	return time.Now().AddDate(0, 0, -intSetting(ctx, SettingAffiliateHoldDays))
+}
+
+func validateNonNegativeDecimal(value string) error {
+	d, err := decimal.NewFromString(value)
+	if err != nil || d.LessThan(decimal.Zero) {
+		return errors.New("must be a non-negative number")
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package service
+
+import (
+	"billing3/database"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+const InvoiceItemProration = "proration"
+
+// BillingCycle is the length of the billing cycle of a service.
+//
+// Calendar cycles are Months months long, and renew on Day of the month. The renewal date is clamped to the last day
+// of months shorter than Day, e.g. a monthly cycle on the 31st renews on February 28th and then on March 31st.
+// Other cycles are Seconds long.
+type BillingCycle struct {
+	Seconds int32
+	Months  int32
+	Day     int32 // day of month of calendar cycles, the day of the current expiry time is used if zero
+}
+
+// ServiceBillingCycle returns the billing cycle of the service.
+func ServiceBillingCycle(s *database.Service) BillingCycle {
+	return BillingCycle{
+		Seconds: s.BillingCycle,
+		Months:  s.BillingCycleMonths,
+		Day:     s.BillingDay,
+	}
+}
+
+// Calendar returns whether the billing cycle follows calendar months.
+func (c BillingCycle) Calendar() bool {
+	return c.Months > 0
+}
+
+// Next returns the end of the billing cycle starting at t.
+func (c BillingCycle) Next(t time.Time) time.Time {
+	if !c.Calendar() {
+		return t.Add(time.Duration(c.Seconds) * time.Second)
+	}
+	return addMonths(t, int(c.Months), c.day(t))
+}
+
+// Previous returns the start of the billing cycle ending at t.
+func (c BillingCycle) Previous(t time.Time) time.Time {
+	if !c.Calendar() {
+		return t.Add(-time.Duration(c.Seconds) * time.Second)
+	}
+	return addMonths(t, -int(c.Months), c.day(t))
+}
+
+func (c BillingCycle) day(t time.Time) int {
+	if c.Day > 0 {
+		return int(c.Day)
+	}
+	return t.Day()
+}
+
+// addMonths adds months to t, and moves it to day of the month, or the last day of the month if the month is shorter.
+// The time of day is kept.
+func addMonths(t time.Time, months int, day int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	return first.AddDate(0, 0, min(day, daysInMonth(first))-1)
+}
+
+func daysInMonth(t time.Time) int {
+	return time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, t.Location()).Day()
+}
+
+// BillingAnchorDay returns the day of month on which services of the product ordered by the user renew. The anchor
+// day of the user takes precedence over the one of the product. BillingAnchorDay returns 0 if neither has one.
+func BillingAnchorDay(user *database.User, product *database.Product) int32 {
+	if user != nil && user.BillingAnchorDay.Valid {
+		return user.BillingAnchorDay.Int32
+	}
+	if product.BillingAnchorDay.Valid {
+		return product.BillingAnchorDay.Int32
+	}
+	return 0
+}
+
+// FirstBillingPeriod returns the end of the first billing period of a service with a calendar billing cycle that is
+// ordered at now and renews on anchorDay, which is the first anchor day after now, and the fraction of the billing
+// cycle that the period covers. Anchor days start at midnight UTC.
+func FirstBillingPeriod(cycle BillingCycle, anchorDay int32, now time.Time) (time.Time, decimal.Decimal) {
+	now = now.UTC()
+	cycle.Day = anchorDay
+
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := addMonths(month, 0, int(anchorDay))
+	if !end.After(now) {
+		end = addMonths(month, 1, int(anchorDay))
+	}
+
+	start := cycle.Previous(end)
+	fraction := decimal.NewFromInt(int64(end.Sub(now) / time.Second)).Div(decimal.NewFromInt(int64(end.Sub(start) / time.Second)))
+
+	return end, fraction
+}
+
+// AddInvoiceProration adds the proration of the first billing period to an invoice, and updates the invoice amount.
+// amount is the adjustment of the recurring fee of the service, which is negative.
+func AddInvoiceProration(ctx context.Context, qtx *database.Queries, invoiceId int32, serviceId int32, periodEnd time.Time, amount decimal.Decimal) error {
+	err := qtx.CreateInvoiceItem(ctx, database.CreateInvoiceItemParams{
+		InvoiceID:   invoiceId,
+		Description: "Proration until " + periodEnd.Format("2006-01-02"),
+		Amount:      amount,
+		Type:        InvoiceItemProration,
+		ItemID:      pgtype.Int4{Valid: true, Int32: serviceId},
+	})
+	if err != nil {
+		return fmt.Errorf("create invoice item: %w", err)
+	}
+
+	return RecalculateInvoiceAmount(ctx, qtx, invoiceId)
+}
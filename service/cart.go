@@ -0,0 +1,393 @@
+package service
+
+import (
+	"billing3/database"
+	"billing3/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+const maxCartItems = 20
+
+const redactedOption = "******"
+
+// guest carts that have not been updated for this long are deleted
+const guestCartLifetime = 30 * 24 * time.Hour
+
+// CartItemRequest adds an item to the cart, or updates it. The product of an item can not be changed. Free trials
+// can not be ordered through the cart.
+type CartItemRequest struct {
+	ProductID int               `json:"product_id" validate:"required"`
+	Duration  int               `json:"duration" validate:"min=0"`
+	Options   map[string]string `json:"options"`
+	Coupon    string            `json:"coupon"`
+}
+
+// CartPricing is the price of all items in the cart, which are ordered with a single invoice. The cart is charged in
+// the requested currency if all products have a price in it, otherwise in the default currency.
+type CartPricing struct {
+	Currency string            `json:"currency"`
+	Items    []CartItemPricing `json:"items"`
+
+	// tax of the combined invoice
+	Tax       Tax             `json:"tax"`
+	Subtotal  decimal.Decimal `json:"subtotal"`
+	TaxAmount decimal.Decimal `json:"tax_amount"`
+	Total     decimal.Decimal `json:"total"`
+}
+
+type CartItemPricing struct {
+	CartItemID int32             `json:"cart_item_id"`
+	ProductID  int32             `json:"product_id"`
+	Product    *database.Product `json:"-"`
+	Options    map[string]string `json:"-"`
+	Redacted   map[string]string `json:"options"` // options with passwords removed
+	Pricing    *Pricing          `json:"pricing"`
+}
+
+// FindCart returns the cart of the user if user is not nil, otherwise the guest cart with the token. If a user sends
+// the token of a guest cart, the guest cart is moved to the user, and merged into their cart if they have one.
+//
+// If there is no cart, a new cart is created if create is true, otherwise nil is returned.
+func FindCart(ctx context.Context, user *database.User, token string, create bool) (*database.Cart, error) {
+	var guestCart *database.Cart
+	if token != "" {
+		cart, err := database.Q.FindCartByToken(ctx, token)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("db: %w", err)
+		}
+		// the token of a user's cart can not be used to access it
+		if err == nil && !cart.UserID.Valid {
+			guestCart = &cart
+		}
+	}
+
+	if user == nil {
+		if guestCart != nil || !create {
+			return guestCart, nil
+		}
+		return createCart(ctx, pgtype.Int4{})
+	}
+
+	userId := pgtype.Int4{Valid: true, Int32: user.ID}
+
+	cart, err := database.Q.FindCartByUser(ctx, userId)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+	found := err == nil
+
+	if guestCart != nil {
+		return claimGuestCart(ctx, guestCart, user, found, &cart)
+	}
+
+	if found {
+		return &cart, nil
+	}
+	if !create {
+		return nil, nil
+	}
+	return createCart(ctx, userId)
+}
+
+// claimGuestCart moves the guest cart to the user. If the user already has a cart, the items of the guest cart are
+// moved into it, and the guest cart is deleted.
+func claimGuestCart(ctx context.Context, guestCart *database.Cart, user *database.User, hasCart bool, userCart *database.Cart) (*database.Cart, error) {
+	slog.Info("claim guest cart", "cart_id", guestCart.ID, "user_id", user.ID, "merge_into", userCart.ID)
+
+	if !hasCart {
+		err := database.Q.UpdateCartUser(ctx, database.UpdateCartUserParams{
+			UserID: pgtype.Int4{Valid: true, Int32: user.ID},
+			ID:     guestCart.ID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("db: %w", err)
+		}
+		guestCart.UserID = pgtype.Int4{Valid: true, Int32: user.ID}
+		return guestCart, nil
+	}
+
+	tx, err := database.Conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := database.Q.WithTx(tx)
+
+	err = qtx.MoveCartItems(ctx, database.MoveCartItemsParams{
+		ToCartID:   userCart.ID,
+		FromCartID: guestCart.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	err = qtx.DeleteCart(ctx, guestCart.ID)
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	err = qtx.TouchCart(ctx, userCart.ID)
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+
+	return userCart, nil
+}
+
+func createCart(ctx context.Context, userId pgtype.Int4) (*database.Cart, error) {
+	cart, err := database.Q.CreateCart(ctx, database.CreateCartParams{
+		Token:  utils.RandomToken(32),
+		UserID: userId,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+	return &cart, nil
+}
+
+// ListCartItems returns the items in the cart. Values of password options are replaced with asterisks.
+func ListCartItems(ctx context.Context, cartId int32) ([]database.CartItem, error) {
+	items, err := database.Q.ListCartItems(ctx, cartId)
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	passwords := make(map[int32][]string) // password options by product
+	for i, item := range items {
+		names, ok := passwords[item.ProductID]
+		if !ok {
+			options, err := database.Q.FindProductOptionsByProduct(ctx, item.ProductID)
+			if err != nil {
+				return nil, fmt.Errorf("db: %w", err)
+			}
+			for _, option := range options {
+				if option.Type == "password" {
+					names = append(names, option.Name)
+				}
+			}
+			passwords[item.ProductID] = names
+		}
+
+		for _, name := range names {
+			if _, ok := item.Options[name]; ok {
+				items[i].Options[name] = redactedOption
+			}
+		}
+	}
+
+	return items, nil
+}
+
+// AddCartItem validates the item like an order, and adds it to the cart. ErrCartFull is returned if the cart has
+// too many items. The error of CalculatePricing is returned if the item is invalid. Other errors are logged, and
+// ErrInternalError is returned.
+func AddCartItem(ctx context.Context, cart *database.Cart, user *database.User, req CartItemRequest) (int32, error) {
+	count, err := database.Q.CountCartItems(ctx, cart.ID)
+	if err != nil {
+		slog.Error("add cart item", "err", err, "cart", cart.ID)
+		return 0, ErrInternalError
+	}
+	if count >= maxCartItems {
+		return 0, ErrCartFull
+	}
+
+	_, options, _, _, err := CalculatePricing(ctx, cartItemOrderRequest(req, ""), user)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := database.Q.CreateCartItem(ctx, database.CreateCartItemParams{
+		CartID:    cart.ID,
+		ProductID: int32(req.ProductID),
+		Duration:  int32(req.Duration),
+		Options:   options,
+		Coupon:    req.Coupon,
+	})
+	if err != nil {
+		slog.Error("add cart item", "err", err, "cart", cart.ID)
+		return 0, ErrInternalError
+	}
+
+	err = database.Q.TouchCart(ctx, cart.ID)
+	if err != nil {
+		slog.Error("add cart item", "err", err, "cart", cart.ID)
+		return 0, ErrInternalError
+	}
+
+	return id, nil
+}
+
+// UpdateCartItem changes the billing cycle, options and coupon of an item in the cart. ErrNotFound is returned if the
+// item is not in the cart, or is of another product than req.ProductID. Errors are returned as by AddCartItem.
+func UpdateCartItem(ctx context.Context, cart *database.Cart, user *database.User, itemId int32, req CartItemRequest) error {
+	items, err := database.Q.ListCartItems(ctx, cart.ID)
+	if err != nil {
+		slog.Error("update cart item", "err", err, "cart", cart.ID)
+		return ErrInternalError
+	}
+	var existing *database.CartItem
+	for i, item := range items {
+		if item.ID == itemId && item.ProductID == int32(req.ProductID) {
+			existing = &items[i]
+			break
+		}
+	}
+	if existing == nil {
+		return ErrNotFound
+	}
+
+	// password options are redacted by ListCartItems, and keep their value if they are sent back unchanged
+	for name, value := range req.Options {
+		if old, ok := existing.Options[name]; ok && value == redactedOption {
+			req.Options[name] = old
+		}
+	}
+
+	_, options, _, _, err := CalculatePricing(ctx, cartItemOrderRequest(req, ""), user)
+	if err != nil {
+		return err
+	}
+
+	_, err = database.Q.UpdateCartItem(ctx, database.UpdateCartItemParams{
+		Duration: int32(req.Duration),
+		Options:  options,
+		Coupon:   req.Coupon,
+		ID:       itemId,
+		CartID:   cart.ID,
+	})
+	if err != nil {
+		slog.Error("update cart item", "err", err, "cart", cart.ID)
+		return ErrInternalError
+	}
+
+	err = database.Q.TouchCart(ctx, cart.ID)
+	if err != nil {
+		slog.Error("update cart item", "err", err, "cart", cart.ID)
+		return ErrInternalError
+	}
+
+	return nil
+}
+
+// RemoveCartItem removes an item from the cart. ErrNotFound is returned if the item is not in the cart.
+func RemoveCartItem(ctx context.Context, cart *database.Cart, itemId int32) error {
+	rows, err := database.Q.DeleteCartItem(ctx, database.DeleteCartItemParams{
+		ID:     itemId,
+		CartID: cart.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	err = database.Q.TouchCart(ctx, cart.ID)
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+
+	return nil
+}
+
+// CalculateCartPricing calculates the price of the items in the cart as CalculatePricing does for each of them.
+// ErrCartEmpty is returned if there are no items. Errors of invalid items are prefixed with the product name, or
+// with the cart item ID if the product can not be found.
+func CalculateCartPricing(ctx context.Context, items []database.CartItem, currency string, user *database.User) (*CartPricing, error) {
+	if len(items) == 0 {
+		return nil, ErrCartEmpty
+	}
+
+	defaultCurrency := DefaultCurrency(ctx)
+	if currency == "" {
+		currency = defaultCurrency
+	}
+
+	cartPricing := CartPricing{
+		Currency: currency,
+		Items:    make([]CartItemPricing, 0, len(items)),
+	}
+
+	total := decimal.Zero
+	for _, item := range items {
+		req := cartItemOrderRequest(CartItemRequest{
+			ProductID: int(item.ProductID),
+			Duration:  int(item.Duration),
+			Options:   item.Options,
+			Coupon:    item.Coupon,
+		}, currency)
+
+		product, options, redacted, pricing, err := CalculatePricing(ctx, req, user)
+		if err != nil {
+			if errors.Is(err, ErrInternalError) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%s: %w", cartItemName(ctx, &item), err)
+		}
+
+		// products without a price in the currency are charged in the default currency, so the whole cart has
+		// to be charged in the default currency
+		if pricing.Currency != currency {
+			return CalculateCartPricing(ctx, items, defaultCurrency, user)
+		}
+
+		cartPricing.Items = append(cartPricing.Items, CartItemPricing{
+			CartItemID: item.ID,
+			ProductID:  item.ProductID,
+			Product:    product,
+			Options:    options,
+			Redacted:   redacted,
+			Pricing:    pricing,
+		})
+		cartPricing.Tax = pricing.Tax
+		total = total.Add(pricing.RecurringFee).Add(pricing.SetupFee).Sub(pricing.Discount).Add(pricing.Proration)
+	}
+
+	cartPricing.Subtotal, cartPricing.TaxAmount, cartPricing.Total = cartPricing.Tax.Apply(total)
+
+	return &cartPricing, nil
+}
+
+func cartItemOrderRequest(req CartItemRequest, currency string) OrderRequest {
+	return OrderRequest{
+		ProductID: req.ProductID,
+		Duration:  req.Duration,
+		Options:   req.Options,
+		Currency:  currency,
+		Coupon:    req.Coupon,
+	}
+}
+
+func cartItemName(ctx context.Context, item *database.CartItem) string {
+	product, err := database.Q.FindProductById(ctx, item.ProductID)
+	if err != nil {
+		return fmt.Sprintf("cart item %d", item.ID)
+	}
+	return product.Name
+}
+
+// DeleteStaleGuestCarts deletes guest carts that have not been updated for guestCartLifetime.
+func DeleteStaleGuestCarts() error {
+	rows, err := database.Q.DeleteStaleGuestCarts(context.Background(), Timestamp(time.Now().Add(-guestCartLifetime)))
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+	if rows > 0 {
+		slog.Info("delete stale guest carts", "count", rows)
+	}
+	return nil
+}
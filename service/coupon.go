@@ -0,0 +1,165 @@
+package service
+
+import (
+	"billing3/database"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	CouponPercentage = "PERCENTAGE"
+	CouponFixed      = "FIXED"
+)
+
+// FindCoupon finds a coupon by code and checks that it can be used to order the product with the given billing cycle.
+// The per-user limit is not checked if user is nil.
+func FindCoupon(ctx context.Context, qtx *database.Queries, code string, productId int32, duration int32, user *database.User) (*database.Coupon, error) {
+	coupon, err := qtx.FindCouponByCode(ctx, code)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidCoupon
+		}
+		return nil, fmt.Errorf("find coupon: %w", err)
+	}
+
+	var userId int32
+	if user != nil {
+		userId = user.ID
+	}
+
+	err = checkCoupon(ctx, qtx, &coupon, productId, duration, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &coupon, nil
+}
+
+// checkCoupon returns an error if the coupon cannot be used. The per-user limit is not checked if userId is 0.
+func checkCoupon(ctx context.Context, qtx *database.Queries, coupon *database.Coupon, productId int32, duration int32, userId int32) error {
+	if !coupon.Enabled {
+		return ErrInvalidCoupon
+	}
+
+	now := time.Now()
+	if coupon.ValidFrom.Valid && now.Before(coupon.ValidFrom.Time) {
+		return ErrInvalidCoupon
+	}
+	if coupon.ValidUntil.Valid && now.After(coupon.ValidUntil.Time) {
+		return ErrCouponExpired
+	}
+
+	if len(coupon.ProductIds) > 0 && !slices.Contains(coupon.ProductIds, productId) {
+		return ErrCouponNotApplicable
+	}
+	if len(coupon.Durations) > 0 && !slices.Contains(coupon.Durations, duration) {
+		return ErrCouponNotApplicable
+	}
+
+	if coupon.MaxUses > 0 && coupon.Uses >= coupon.MaxUses {
+		return ErrCouponUsedUp
+	}
+
+	if coupon.MaxUsesPerUser > 0 && userId != 0 {
+		uses, err := qtx.CountCouponUsesByUser(ctx, database.CountCouponUsesByUserParams{
+			CouponID: coupon.ID,
+			UserID:   userId,
+		})
+		if err != nil {
+			return fmt.Errorf("count coupon uses: %w", err)
+		}
+		if uses >= int64(coupon.MaxUsesPerUser) {
+			return ErrCouponUsedUp
+		}
+	}
+
+	return nil
+}
+
+// IsCouponError returns whether err is caused by a coupon that cannot be used, rather than an internal error.
+func IsCouponError(err error) bool {
+	return errors.Is(err, ErrInvalidCoupon) || errors.Is(err, ErrCouponExpired) || errors.Is(err, ErrCouponNotApplicable) || errors.Is(err, ErrCouponUsedUp)
+}
+
+// CouponDiscount returns the discount of the coupon on the recurring fee and on the setup fee, in currency.
+// Fixed discounts are applied to the recurring fee first, and are converted from the currency of the coupon.
+func CouponDiscount(ctx context.Context, coupon *database.Coupon, recurringFee decimal.Decimal, setupFee decimal.Decimal, currency string) (recurring decimal.Decimal, setup decimal.Decimal, err error) {
+	if coupon.Type == CouponPercentage {
+		rate := decimal.Min(coupon.Value, decimal.NewFromInt(100)).Div(decimal.NewFromInt(100))
+		return RoundCurrency(recurringFee.Mul(rate), currency), RoundCurrency(setupFee.Mul(rate), currency), nil
+	}
+
+	value, err := ConvertCurrency(ctx, coupon.Value, priceCurrency(coupon.Currency, DefaultCurrency(ctx)), currency)
+	if err != nil {
+		return decimal.Zero, decimal.Zero, fmt.Errorf("convert coupon value: %w", err)
+	}
+
+	recurring = decimal.Min(value, recurringFee)
+	setup = decimal.Min(value.Sub(recurring), setupFee)
+	return recurring, setup, nil
+}
+
+// ServiceDiscount returns the recurring discount of the service. Percentage discounts are calculated from the current
+// price, so that they follow price changes, e.g. upgrades.
+func ServiceDiscount(s *database.Service) decimal.Decimal {
+	if s.DiscountRate.GreaterThan(decimal.Zero) {
+		return RoundCurrency(s.Price.Mul(s.DiscountRate).Div(decimal.NewFromInt(100)), s.Currency)
+	}
+	return decimal.Min(s.Discount, s.Price)
+}
+
+// RedeemCoupon records the use of a coupon for a new service. The coupon is locked and checked again, so that
+// concurrent orders can not exceed its limits.
+func RedeemCoupon(ctx context.Context, qtx *database.Queries, couponId int32, productId int32, duration int32, userId int32, serviceId int32) error {
+	coupon, err := qtx.FindCouponByIdForUpdate(ctx, couponId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrInvalidCoupon
+		}
+		return fmt.Errorf("find coupon: %w", err)
+	}
+
+	err = checkCoupon(ctx, qtx, &coupon, productId, duration, userId)
+	if err != nil {
+		return err
+	}
+
+	err = qtx.CreateCouponUse(ctx, database.CreateCouponUseParams{
+		CouponID:  couponId,
+		UserID:    userId,
+		ServiceID: pgtype.Int4{Valid: true, Int32: serviceId},
+	})
+	if err != nil {
+		return fmt.Errorf("create coupon use: %w", err)
+	}
+
+	err = qtx.IncreaseCouponUses(ctx, couponId)
+	if err != nil {
+		return fmt.Errorf("increase coupon uses: %w", err)
+	}
+
+	return nil
+}
+
+// AddInvoiceDiscount adds a discount item to an invoice, and updates the invoice amount.
+func AddInvoiceDiscount(ctx context.Context, qtx *database.Queries, invoiceId int32, description string, amount decimal.Decimal) error {
+	err := qtx.CreateInvoiceItem(ctx, database.CreateInvoiceItemParams{
+		InvoiceID:   invoiceId,
+		Description: description,
+		Amount:      amount.Neg(),
+		Type:        InvoiceItemDiscount,
+		ItemID:      pgtype.Int4{Valid: false},
+	})
+	if err != nil {
+		return fmt.Errorf("create invoice item: %w", err)
+	}
+
+	return RecalculateInvoiceAmount(ctx, qtx, invoiceId)
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"billing3/database"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	CreditDeposit     = "DEPOSIT"
+	CreditOverpayment = "OVERPAYMENT"
+	CreditAdjustment  = "ADJUSTMENT"
+	CreditConsumption = "CONSUMPTION"
+	CreditRefund      = "REFUND"
+	CreditCommission  = "COMMISSION"
+
+	GatewayCredit = "Credit"
+)
+
+// AddCredit changes the credit balance of the user by amount and records the change in the credit ledger.
+// amount is negative if credit is consumed. ErrInsufficientCredit is returned if the balance would become negative.
+//
+// qtx should be a transaction. qtx is not commited.
+//
+// AddCredit returns the id of the ledger entry.
+func AddCredit(ctx context.Context, qtx *database.Queries, userId int32, amount decimal.Decimal, typ string, description string, invoiceId pgtype.Int4) (int32, error) {
+	balance, err := qtx.UpdateUserCredit(ctx, database.UpdateUserCreditParams{
+		Amount: amount,
+		ID:     userId,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrInsufficientCredit
+		}
+		return 0, fmt.Errorf("update user credit: %w", err)
+	}
+
+	id, err := qtx.CreateCreditTransaction(ctx, database.CreateCreditTransactionParams{
+		UserID:      userId,
+		Type:        typ,
+		Amount:      amount,
+		Description: description,
+		InvoiceID:   invoiceId,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("create credit transaction: %w", err)
+	}
+
+	slog.Info("credit changed", "user_id", userId, "amount", amount, "type", typ, "balance", balance, "invoice_id", invoiceId.Int32, "transaction_id", id)
+
+	return id, nil
+}
+
+// ListCreditTransactions returns the credit ledger of the user, newest first.
+func ListCreditTransactions(ctx context.Context, userId int32, page int, itemPerPage int32) (int, []database.CreditTransaction, error) {
+	totalCount, err := database.Q.CountCreditTransactions(ctx, userId)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	totalPages := int(math.Ceil(float64(totalCount) / float64(itemPerPage)))
+
+	transactions, err := database.Q.ListCreditTransactionsPaged(ctx, database.ListCreditTransactionsPagedParams{
+		UserID: userId,
+		Limit:  itemPerPage,
+		Offset: int32(page-1) * itemPerPage,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return totalPages, transactions, nil
+}
+
+// AutoApplyCredit pays a new invoice with the credit balance of the invoice owner if SettingCreditAutoApply is
+// enabled, see ApplyCreditToInvoice. It returns true if the invoice becomes PAID, in which case the caller should call
+// OnInvoicePaid after the transaction is commited.
+//
+// qtx should be a transaction. qtx is not commited.
+func AutoApplyCredit(ctx context.Context, qtx *database.Queries, invoiceId int32) (bool, error) {
+	if SettingCreditAutoApply.Get(ctx) != "true" {
+		return false, nil
+	}
+	return ApplyCreditToInvoice(ctx, qtx, invoiceId)
+}
+
+// ApplyCreditToInvoice pays as much of the outstanding amount of an UNPAID invoice as possible
+// using the credit balance of the invoice owner. Credit is kept in the default currency, so invoices
+// in other currencies are left untouched. It returns true if the invoice becomes PAID, in
+// which case the caller should call OnInvoicePaid after the transaction is commited.
+//
+// qtx should be a transaction. qtx is not commited.
+func ApplyCreditToInvoice(ctx context.Context, qtx *database.Queries, invoiceId int32) (bool, error) {
+	invoice, err := qtx.SelectInvoiceForUpdate(ctx, invoiceId)
+	if err != nil {
+		return false, fmt.Errorf("find invoice: %w", err)
+	}
+
+	if invoice.Status != InvoiceUnpaid || invoice.Currency != DefaultCurrency(ctx) {
+		return false, nil
+	}
+
+	totalPayment, err := qtx.TotalInvoicePayment(ctx, invoiceId)
+	if err != nil {
+		return false, fmt.Errorf("total invoice payment: %w", err)
+	}
+
+	user, err := qtx.FindUserById(ctx, invoice.UserID)
+	if err != nil {
+		return false, fmt.Errorf("find user: %w", err)
+	}
+
+	amount := decimal.Min(invoice.Amount.Sub(totalPayment), user.Credit)
+	if amount.LessThanOrEqual(decimal.Zero) {
+		return false, nil
+	}
+
+	transactionId, err := AddCredit(ctx, qtx, invoice.UserID, amount.Neg(), CreditConsumption, fmt.Sprintf("Payment for invoice #%d", invoiceId), pgtype.Int4{Valid: true, Int32: invoiceId})
+	if err != nil {
+		return false, err
+	}
+
+	return InvoiceAddPaymentTx(ctx, qtx, invoiceId, "Account credit", amount, strconv.Itoa(int(transactionId)), GatewayCredit)
+}
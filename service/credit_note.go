@@ -0,0 +1,145 @@
+package service
+
+import (
+	"billing3/database"
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+
+	"github.com/shopspring/decimal"
+)
+
+type CreditNoteItem struct {
+	Description string          `json:"description" validate:"required"`
+	Amount      decimal.Decimal `json:"amount"`
+}
+
+// InvoiceIsPaid returns whether an invoice with the status has been paid, including invoices
+// that have been refunded since.
+func InvoiceIsPaid(status string) bool {
+	return status == InvoicePaid || status == InvoicePartiallyRefunded || status == InvoiceRefunded
+}
+
+// CreateCreditNote issues a credit note for the invoice. Item amounts are in the same terms as
+// the invoice items, i.e. they include the tax if the invoice tax is inclusive, and the tax
+// snapshot of the invoice is applied to them.
+//
+// qtx should be a transaction. qtx is not commited.
+func CreateCreditNote(ctx context.Context, qtx *database.Queries, invoice *database.Invoice, reason string, items []CreditNoteItem) (int32, error) {
+	sum := decimal.Zero
+	for _, item := range items {
+		sum = sum.Add(item.Amount)
+	}
+
+	subtotal, tax, total := TaxFromInvoice(invoice).Apply(sum)
+
+	return insertCreditNote(ctx, qtx, invoice, reason, items, subtotal, tax, total)
+}
+
+// createRefundCreditNote issues a credit note for a refund of the payment. amount is the refunded
+// amount, which includes the tax.
+func createRefundCreditNote(ctx context.Context, qtx *database.Queries, invoice *database.Invoice, payment *database.InvoicePayment, amount decimal.Decimal, reason string) (int32, error) {
+	return createGrossCreditNote(ctx, qtx, invoice, reason, fmt.Sprintf("Refund of payment #%d (%s)", payment.ID, payment.Gateway), amount)
+}
+
+// createGrossCreditNote issues a credit note with a single item for amount, which includes the tax.
+func createGrossCreditNote(ctx context.Context, qtx *database.Queries, invoice *database.Invoice, reason string, description string, amount decimal.Decimal) (int32, error) {
+	t := TaxFromInvoice(invoice)
+
+	subtotal, tax := amount, decimal.Zero
+	if !t.ReverseCharge {
+		subtotal, tax, _ = Tax{Rate: t.Rate, Inclusive: true}.Apply(amount)
+	}
+
+	// items do not include the tax if the invoice tax is exclusive
+	itemAmount := amount
+	if !t.Inclusive {
+		itemAmount = subtotal
+	}
+
+	items := []CreditNoteItem{{
+		Description: description,
+		Amount:      itemAmount,
+	}}
+
+	return insertCreditNote(ctx, qtx, invoice, reason, items, subtotal, tax, amount)
+}
+
+func insertCreditNote(ctx context.Context, qtx *database.Queries, invoice *database.Invoice, reason string, items []CreditNoteItem, subtotal decimal.Decimal, tax decimal.Decimal, total decimal.Decimal) (int32, error) {
+	number, err := nextDocumentNumber(ctx, SettingCreditNoteNumberPrefix.Get(ctx), qtx.NextCreditNoteNumber)
+	if err != nil {
+		return 0, fmt.Errorf("next credit note number: %w", err)
+	}
+
+	id, err := qtx.CreateCreditNote(ctx, database.CreateCreditNoteParams{
+		Number:    number,
+		InvoiceID: invoice.ID,
+		UserID:    invoice.UserID,
+		Reason:    reason,
+		Subtotal:  subtotal,
+		Tax:       tax,
+		Amount:    total,
+		Currency:  invoice.Currency,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("create credit note: %w", err)
+	}
+
+	for _, item := range items {
+		err = qtx.CreateCreditNoteItem(ctx, database.CreateCreditNoteItemParams{
+			CreditNoteID: id,
+			Description:  item.Description,
+			Amount:       item.Amount,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("create credit note item: %w", err)
+		}
+	}
+
+	slog.Info("credit note issued", "id", id, "number", number, "invoice_id", invoice.ID, "amount", total, "currency", invoice.Currency, "reason", reason)
+
+	return id, nil
+}
+
+// CreditRemainingInvoiceAmount issues a credit note for the amount of the paid invoice that has not
+// been credited yet, e.g. when the invoice is cancelled. Nothing is done if the whole amount has
+// been credited already. The amount of paid invoices is never changed, adjustments and refunds
+// are credit notes, so the remaining amount is the invoice amount less all credit notes.
+//
+// qtx should be a transaction. qtx is not commited.
+func CreditRemainingInvoiceAmount(ctx context.Context, qtx *database.Queries, invoice *database.Invoice, reason string) error {
+	credited, err := qtx.SumCreditNotesByInvoice(ctx, invoice.ID)
+	if err != nil {
+		return fmt.Errorf("sum credit notes: %w", err)
+	}
+
+	remaining := invoice.Amount.Sub(credited)
+	if remaining.LessThanOrEqual(decimal.Zero) {
+		return nil
+	}
+
+	_, err = createGrossCreditNote(ctx, qtx, invoice, reason, fmt.Sprintf("Credit of invoice %s", InvoiceNumber(invoice)), remaining)
+	return err
+}
+
+// SearchCreditNotes returns a page of credit notes, userId is ignored if it is 0.
+func SearchCreditNotes(ctx context.Context, userId int32, page int, itemPerPage int32) (int, []database.CreditNote, error) {
+	totalCount, err := database.Q.CountCreditNotes(ctx, userId)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	totalPages := int(math.Ceil(float64(totalCount) / float64(itemPerPage)))
+
+	creditNotes, err := database.Q.SearchCreditNotesPaged(ctx, database.SearchCreditNotesPagedParams{
+		Limit:  itemPerPage,
+		Offset: int32(page-1) * itemPerPage,
+		UserID: userId,
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return totalPages, creditNotes, nil
+}
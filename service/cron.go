@@ -4,9 +4,13 @@ import (
 	"billing3/database"
 	"billing3/utils"
 	"context"
+	"os"
 )
 
 func InitCron() {
+	// read before the jobs start, reminders link to the site
+	PUBLIC_DOMAIN = os.Getenv("PUBLIC_DOMAIN")
+
 	utils.InitCronScheduler()
 
 	utils.NewCronJob("0 * * * *", func() error {
@@ -14,16 +18,28 @@ func InitCron() {
 	}, "close overdue invoices")
 
 	utils.NewCronJob("0 * * * *", func() error {
-		return CancelOverdueServices()
-	}, "cancel overdue services")
+		return ApplyLateFees()
+	}, "apply late fees")
+
+	utils.NewCronJob("0 * * * *", func() error {
+		return ProcessOverdueServices()
+	}, "suspend and terminate overdue services")
 
 	utils.NewCronJob("0 * * * *", func() error {
 		return database.Q.DeleteExpiredSessions(context.Background())
 	}, "delete expired sessions")
 
+	utils.NewCronJob("30 * * * *", func() error {
+		return DeleteStaleGuestCarts()
+	}, "delete stale guest carts")
+
 	utils.NewCronJob("0 0 * * *", func() error {
 		return GenerateRenewalInvoices()
 	}, "generate renewal invoices")
 
+	utils.NewCronJob("*/15 * * * *", func() error {
+		return SendInvoiceReminders()
+	}, "send invoice reminders")
+
 	utils.StartCronScheduler()
 }
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"billing3/database"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+var currencyRegex = regexp.MustCompile("^[A-Z]{3}$")
+
+// ZeroDecimalCurrencies have no minor unit in ISO 4217, or one that is not used in practice (MGA). Amounts are stored
+// with 2 decimal places, so currencies with 3 decimal places are rounded to 2 like all others. Payment gateways must
+// use the same list, so that amounts are charged as they are invoiced.
+var ZeroDecimalCurrencies = []string{
+	"BIF", "CLP", "DJF", "GNF", "ISK", "JPY", "KMF", "KRW", "MGA", "PYG", "RWF", "UGX", "UYI", "VND", "VUV", "XAF", "XOF", "XPF",
+}
+
+// CurrencyDecimals returns the number of decimal places of amounts in the currency, e.g. 2 for USD and 0 for JPY.
+func CurrencyDecimals(currency string) int32 {
+	if slices.Contains(ZeroDecimalCurrencies, strings.ToUpper(currency)) {
+		return 0
+	}
+	return 2
+}
+
+// RoundCurrency rounds amount to the decimal places of the currency.
+func RoundCurrency(amount decimal.Decimal, currency string) decimal.Decimal {
+	return amount.Round(CurrencyDecimals(currency))
+}
+
+// DefaultCurrency returns the currency of prices that have no currency set. Credit balances are
+// kept in the default currency.
+func DefaultCurrency(ctx context.Context) string {
+	return SettingDefaultCurrency.Get(ctx)
+}
+
+// ExchangeRates returns the exchange rates maintained by admins, i.e. the amount of each currency
+// that equals one unit of the default currency. The default currency has a rate of 1.
+func ExchangeRates(ctx context.Context) (map[string]decimal.Decimal, error) {
+	rates := make(map[string]decimal.Decimal)
+
+	err := json.Unmarshal([]byte(SettingExchangeRates.Get(ctx)), &rates)
+	if err != nil {
+		return nil, fmt.Errorf("invalid exchange rates: %w", err)
+	}
+
+	rates[DefaultCurrency(ctx)] = decimal.NewFromInt(1)
+
+	return rates, nil
+}
+
+// Currencies returns the currencies that users can choose from, which are the default
+// currency and those with an exchange rate.
+func Currencies(ctx context.Context) ([]string, error) {
+	rates, err := ExchangeRates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	currencies := make([]string, 0, len(rates))
+	for currency := range rates {
+		currencies = append(currencies, currency)
+	}
+	slices.Sort(currencies)
+
+	return currencies, nil
+}
+
+// ConvertCurrency converts amount from one currency to another using the exchange rates.
+// The result is rounded to the decimal places of the currency it is converted to.
+func ConvertCurrency(ctx context.Context, amount decimal.Decimal, from string, to string) (decimal.Decimal, error) {
+	if from == to {
+		return amount, nil
+	}
+
+	rates, err := ExchangeRates(ctx)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	fromRate, ok := rates[from]
+	if !ok {
+		return decimal.Zero, fmt.Errorf("%w: %s", ErrUnknownCurrency, from)
+	}
+	toRate, ok := rates[to]
+	if !ok {
+		return decimal.Zero, fmt.Errorf("%w: %s", ErrUnknownCurrency, to)
+	}
+
+	return RoundCurrency(amount.Div(fromRate).Mul(toRate), to), nil
+}
+
+// ValidCurrency returns whether currency is a three-letter ISO 4217 code, e.g. USD.
+func ValidCurrency(currency string) bool {
+	return currencyRegex.MatchString(currency)
+}
+
+func validateCurrency(value string) error {
+	if !ValidCurrency(value) {
+		return fmt.Errorf("invalid currency code \"%s\"", value)
+	}
+	return nil
+}
+
+// validateDefaultCurrency only allows the default currency to be changed before any amount has been kept in it.
+// Credit balances, credit transactions, commissions and fixed gateway fees have no currency of their own, and would be
+// re-denominated by the change. Settings are only validated when they are changed.
+func validateDefaultCurrency(value string) error {
+	err := validateCurrency(value)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+
+	exists, err := database.Q.CreditOrCommissionsExist(ctx)
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("the default currency cannot be changed once credit or commissions exist, as they are kept in the default currency")
+	}
+
+	gateways, err := database.Q.ListGateways(ctx)
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+	for _, g := range gateways {
+		if !g.Fee.Valid || strings.HasSuffix(g.Fee.String, "%") {
+			continue
+		}
+		fee, err := decimal.NewFromString(g.Fee.String)
+		if err == nil && !fee.IsZero() {
+			return fmt.Errorf("the default currency cannot be changed while gateway %s has a fixed fee, which is in the default currency", g.Name)
+		}
+	}
+
+	return nil
+}
+
+func validateExchangeRates(value string) error {
+	rates := make(map[string]decimal.Decimal)
+
+	err := json.Unmarshal([]byte(value), &rates)
+	if err != nil {
+		return fmt.Errorf("exchange rates must be a JSON object of currency code to rate: %w", err)
+	}
+
+	for currency, rate := range rates {
+		if !ValidCurrency(currency) {
+			return fmt.Errorf("invalid currency code \"%s\"", currency)
+		}
+		if rate.LessThanOrEqual(decimal.Zero) {
+			return fmt.Errorf("exchange rate of %s must be positive", currency)
+		}
+	}
+
+	return nil
+}
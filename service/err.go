@@ -6,3 +6,26 @@ var ErrServiceCancelled = errors.New("service is cancelled")
 var ErrUnpaidInvoiceExists = errors.New("unpaid invoice already exists for the service")
 var ErrNotFound = errors.New("not found")
 var ErrInternalError = errors.New("internal error")
+var ErrInsufficientCredit = errors.New("insufficient credit")
+var ErrRefundExceedsPayment = errors.New("refund amount exceeds the refundable amount of the payment")
+var ErrPaymentAlreadyRecorded = errors.New("payment has already been recorded")
+var ErrGatewayRefundNotPending = errors.New("gateway refund is not pending")
+var ErrUnknownCurrency = errors.New("unknown currency")
+var ErrInvalidVatID = errors.New("invalid VAT ID")
+var ErrVatIDValidationUnavailable = errors.New("VAT ID validation service is unavailable")
+var ErrInvalidCoupon = errors.New("invalid coupon code")
+var ErrCouponExpired = errors.New("coupon has expired")
+var ErrCouponNotApplicable = errors.New("coupon is not applicable to the order")
+var ErrCouponUsedUp = errors.New("coupon has reached its usage limit")
+var ErrUpgradeNotAvailable = errors.New("service cannot be upgraded or downgraded")
+var ErrUpgradePending = errors.New("an upgrade of the service is pending payment")
+var ErrInvoicesNotMergeable = errors.New("invoices cannot be merged")
+var ErrTrialNotAvailable = errors.New("free trial is not available for the product")
+var ErrTrialUsed = errors.New("free trial of the product has already been used")
+var ErrTrialPaymentMethodRequired = errors.New("a payment method is required for the free trial, please pay an invoice first")
+var ErrInvalidReferralCode = errors.New("invalid referral code")
+var ErrNoCommissionPayable = errors.New("no commission is available for payout")
+var ErrCommissionBelowMinimum = errors.New("available commission is below the minimum payout")
+var ErrServiceNotPendingReview = errors.New("service is not pending review")
+var ErrCartEmpty = errors.New("cart is empty")
+var ErrCartFull = errors.New("cart is full")
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"billing3/database"
+	"billing3/database/types"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	ExportBasisCash    = "cash"    // invoices are exported by the time they were paid
+	ExportBasisAccrual = "accrual" // invoices are exported by the time they were issued
+)
+
+// ExportRange is the time range and accounting basis of an export. Invoices that were cancelled before being paid
+// are never exported. Payments, refunds and credit notes are always exported by the time they were made.
+type ExportRange struct {
+	Basis string
+	From  time.Time // inclusive
+	To    time.Time // exclusive
+}
+
+// ValidExportBasis returns whether basis is ExportBasisCash or ExportBasisAccrual.
+func ValidExportBasis(basis string) bool {
+	return basis == ExportBasisCash || basis == ExportBasisAccrual
+}
+
+// ExportInvoicesCSV writes the invoices in the range to w as CSV, one row per invoice.
+//
+// Rows are written as they are read from the database, so an error may be returned after some rows were written.
+func ExportInvoicesCSV(ctx context.Context, w io.Writer, r ExportRange) error {
+	c := csv.NewWriter(w)
+	err := c.Write([]string{
+		"id", "number", "user_id", "email", "name", "status", "created_at", "due_at", "paid_at",
+		"currency", "subtotal", "tax", "tax_name", "tax_rate", "tax_inclusive", "amount",
+	})
+	if err != nil {
+		return err
+	}
+
+	err = database.Q.ExportInvoicesEach(ctx, database.ExportInvoicesParams{
+		CashBasis: r.Basis == ExportBasisCash,
+		StartAt:   Timestamp(r.From),
+		EndAt:     Timestamp(r.To),
+	}, func(row database.ExportInvoicesRow) error {
+		return c.Write([]string{
+			strconv.Itoa(int(row.ID)),
+			exportText(row.Number),
+			strconv.Itoa(int(row.UserID)),
+			exportText(row.Email),
+			exportText(row.Name),
+			row.Status,
+			exportTime(row.CreatedAt),
+			exportTime(row.DueAt),
+			exportTime(row.PaidAt),
+			row.Currency,
+			exportAmount(row.Subtotal),
+			exportAmount(row.Tax),
+			exportText(row.TaxName),
+			row.TaxRate.String(),
+			strconv.FormatBool(row.TaxInclusive),
+			exportAmount(row.Amount),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("export invoices: %w", err)
+	}
+
+	c.Flush()
+	return c.Error()
+}
+
+// ExportInvoiceItemsCSV writes the items of the invoices in the range to w as CSV, one row per item.
+func ExportInvoiceItemsCSV(ctx context.Context, w io.Writer, r ExportRange) error {
+	c := csv.NewWriter(w)
+	err := c.Write([]string{
+		"id", "invoice_id", "invoice_number", "email", "name", "invoice_created_at", "invoice_paid_at",
+		"currency", "type", "item_id", "description", "amount", "tax_name", "tax_rate", "tax_inclusive",
+	})
+	if err != nil {
+		return err
+	}
+
+	err = database.Q.ExportInvoiceItemsEach(ctx, database.ExportInvoiceItemsParams{
+		CashBasis: r.Basis == ExportBasisCash,
+		StartAt:   Timestamp(r.From),
+		EndAt:     Timestamp(r.To),
+	}, func(row database.ExportInvoiceItemsRow) error {
+		itemId := ""
+		if row.ItemID.Valid {
+			itemId = strconv.Itoa(int(row.ItemID.Int32))
+		}
+		return c.Write([]string{
+			strconv.Itoa(int(row.ID)),
+			strconv.Itoa(int(row.InvoiceID)),
+			exportText(row.Number),
+			exportText(row.Email),
+			exportText(row.Name),
+			exportTime(row.CreatedAt),
+			exportTime(row.PaidAt),
+			row.Currency,
+			row.Type,
+			itemId,
+			exportText(row.Description),
+			exportAmount(row.Amount),
+			exportText(row.TaxName),
+			row.TaxRate.String(),
+			strconv.FormatBool(row.TaxInclusive),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("export invoice items: %w", err)
+	}
+
+	c.Flush()
+	return c.Error()
+}
+
+// ExportInvoiceItemsXero writes the items of the invoices in the range to w in the format of the Xero sales invoice
+// import, which is also accepted by QuickBooks. Unit amounts are tax inclusive or exclusive as on the invoice, which
+// is chosen when importing the file.
+func ExportInvoiceItemsXero(ctx context.Context, w io.Writer, r ExportRange) error {
+	c := csv.NewWriter(w)
+	err := c.Write([]string{
+		"*ContactName", "EmailAddress", "*InvoiceNumber", "*InvoiceDate", "*DueDate", "*Description",
+		"*Quantity", "*UnitAmount", "*AccountCode", "*TaxType", "Currency",
+	})
+	if err != nil {
+		return err
+	}
+
+	salesAccount := SettingAccountingSalesAccount.Get(ctx)
+
+	err = database.Q.ExportInvoiceItemsEach(ctx, database.ExportInvoiceItemsParams{
+		CashBasis: r.Basis == ExportBasisCash,
+		StartAt:   Timestamp(r.From),
+		EndAt:     Timestamp(r.To),
+	}, func(row database.ExportInvoiceItemsRow) error {
+		contact := row.Name
+		if contact == "" {
+			contact = row.Email
+		}
+		number := row.Number
+		if number == "" {
+			number = "#" + strconv.Itoa(int(row.InvoiceID))
+		}
+		taxType := row.TaxName
+		if row.TaxRate.IsZero() || taxType == "" {
+			taxType = "Tax Exempt"
+		}
+		return c.Write([]string{
+			exportText(contact),
+			exportText(row.Email),
+			exportText(number),
+			exportDate(row.CreatedAt),
+			exportDate(row.DueAt),
+			exportText(row.Description),
+			"1",
+			exportAmount(row.Amount),
+			exportText(salesAccount),
+			exportText(taxType),
+			row.Currency,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("export invoice items: %w", err)
+	}
+
+	c.Flush()
+	return c.Error()
+}
+
+// ExportPaymentsCSV writes the payments and refunds made in the range to w as CSV. Refunds have negative amounts.
+func ExportPaymentsCSV(ctx context.Context, w io.Writer, r ExportRange) error {
+	c := csv.NewWriter(w)
+	err := c.Write([]string{
+		"id", "type", "invoice_id", "invoice_number", "email", "name", "created_at", "gateway",
+		"reference_id", "refund_of", "description", "currency", "amount",
+	})
+	if err != nil {
+		return err
+	}
+
+	err = database.Q.ExportPaymentsEach(ctx, database.ExportPaymentsParams{
+		StartAt: Timestamp(r.From),
+		EndAt:   Timestamp(r.To),
+	}, func(row database.ExportPaymentsRow) error {
+		typ := StatementPayment
+		refundOf := ""
+		if row.RefundOf.Valid {
+			typ = StatementRefund
+			refundOf = strconv.Itoa(int(row.RefundOf.Int32))
+		}
+		return c.Write([]string{
+			strconv.Itoa(int(row.ID)),
+			typ,
+			strconv.Itoa(int(row.InvoiceID)),
+			exportText(row.Number),
+			exportText(row.Email),
+			exportText(row.Name),
+			exportTime(row.CreatedAt),
+			exportText(row.Gateway),
+			exportText(row.ReferenceID),
+			refundOf,
+			exportText(row.Description),
+			row.Currency,
+			exportAmount(row.Amount),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("export payments: %w", err)
+	}
+
+	c.Flush()
+	return c.Error()
+}
+
+// ExportJournalCSV writes the invoices, payments, refunds and credit notes in the range to w as double-entry journal
+// lines, in the format of the QuickBooks journal entry import. The accounts are configured by the accounting
+// settings. Payments with account credit are booked against the customer credit account instead of the bank account.
+func ExportJournalCSV(ctx context.Context, w io.Writer, r ExportRange) error {
+	c := csv.NewWriter(w)
+	err := c.Write([]string{"Journal No", "Journal Date", "Currency", "Memo", "Account", "Debits", "Credits", "Description", "Name"})
+	if err != nil {
+		return err
+	}
+
+	receivable := SettingAccountingReceivableAccount.Get(ctx)
+	sales := SettingAccountingSalesAccount.Get(ctx)
+	tax := SettingAccountingTaxAccount.Get(ctx)
+	bank := SettingAccountingBankAccount.Get(ctx)
+	credit := SettingAccountingCreditAccount.Get(ctx)
+
+	err = database.Q.ExportJournalEach(ctx, database.ExportJournalParams{
+		CashBasis: r.Basis == ExportBasisCash,
+		StartAt:   Timestamp(r.From),
+		EndAt:     Timestamp(r.To),
+	}, func(row database.ExportJournalRow) error {
+		number := row.Number
+		if number == "" {
+			number = "#" + strconv.Itoa(int(row.InvoiceID))
+		}
+
+		// each line is an account and its debit, credits are negative debits
+		type line struct {
+			account string
+			debit   decimal.Decimal
+		}
+
+		var journalNo, memo string
+		var lines []line
+
+		switch row.Type {
+		case StatementInvoice:
+			journalNo = number
+			memo = "Invoice " + number
+			lines = []line{{receivable, row.Amount}, {sales, row.Subtotal.Neg()}, {tax, row.Tax.Neg()}}
+		case StatementCreditNote:
+			journalNo = row.Number
+			memo = "Credit note " + row.Number + ": " + row.Description
+			lines = []line{{sales, row.Subtotal}, {tax, row.Tax}, {receivable, row.Amount.Neg()}}
+		case StatementPayment, StatementRefund:
+			account := bank
+			if row.Gateway == GatewayCredit {
+				account = credit
+			}
+			if row.Type == StatementPayment {
+				journalNo = "PAY-" + strconv.Itoa(int(row.ID))
+			} else {
+				journalNo = "REF-" + strconv.Itoa(int(row.ID))
+			}
+			memo = row.Gateway + " " + row.Type + " for invoice " + number
+			lines = []line{{account, row.Amount}, {receivable, row.Amount.Neg()}}
+		default:
+			return errors.New("unknown journal entry type: " + row.Type)
+		}
+
+		for _, l := range lines {
+			if l.debit.IsZero() {
+				continue
+			}
+			debits, credits := "", ""
+			if l.debit.GreaterThan(decimal.Zero) {
+				debits = exportAmount(l.debit)
+			} else {
+				credits = exportAmount(l.debit.Neg())
+			}
+			err := c.Write([]string{exportText(journalNo), exportDate(row.Date), row.Currency, exportText(memo), exportText(l.account), debits, credits, exportText(row.Description), exportText(row.Name)})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("export journal: %w", err)
+	}
+
+	c.Flush()
+	return c.Error()
+}
+
+func exportTime(t types.Timestamp) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format(time.DateTime)
+}
+
+func exportDate(t types.Timestamp) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.Format(time.DateOnly)
+}
+
+// exportText escapes text that spreadsheets would evaluate as a formula, e.g. a name of "=HYPERLINK(...)", by
+// prefixing it with a quote. Amounts are not escaped, negative amounts are numbers.
+func exportText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func exportAmount(d decimal.Decimal) string {
+	return d.StringFixed(2)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log/slog"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/riverqueue/river"
 	"github.com/riverqueue/river/rivertype"
 )
@@ -87,14 +88,40 @@ var ErrActionRunning = errors.New("another action is running for this service")
 // The actions "create", "terminate", and "reinstall" are enqueued to a special queue that only allows one worker
 // to run at a time, to avoid race conditions on these operations.
 func DoActionAsync(ctx context.Context, ext string, serviceId int32, action string, newStatus string) error {
+	args, opts := actionJob(ext, serviceId, action, newStatus)
+	resp, err := database.River.Insert(ctx, args, opts)
+	if err != nil {
+		return fmt.Errorf("insert job: %w", err)
+	}
+	if resp.UniqueSkippedAsDuplicate {
+		return ErrActionRunning
+	}
+	return nil
+}
+
+// DoActionAsyncTx is like DoActionAsync, but the task is enqueued in the transaction tx, so that it only runs if tx
+// is commited, and after tx is commited.
+func DoActionAsyncTx(ctx context.Context, tx pgx.Tx, ext string, serviceId int32, action string, newStatus string) error {
+	args, opts := actionJob(ext, serviceId, action, newStatus)
+	resp, err := database.River.InsertTx(ctx, tx, args, opts)
+	if err != nil {
+		return fmt.Errorf("insert job: %w", err)
+	}
+	if resp.UniqueSkippedAsDuplicate {
+		return ErrActionRunning
+	}
+	return nil
+}
+
+func actionJob(ext string, serviceId int32, action string, newStatus string) (ExtensionActionArgs, *river.InsertOpts) {
 	queue := river.QueueDefault
-	if action == "create" || action == "terminate" || action == "reinstall" {
+	if action == "create" || action == "terminate" || action == "reinstall" || action == "resize" {
 		queue = database.QueueVM
 	}
 
 	slog.Info("do action async", "ext", ext, "service_id", serviceId, "action", action, "new_status", newStatus, "queue", queue)
 
-	resp, err := database.River.Insert(ctx, ExtensionActionArgs{
+	return ExtensionActionArgs{
 		ServiceId: serviceId,
 		Action:    action,
 		NewStatus: newStatus,
@@ -103,14 +130,7 @@ func DoActionAsync(ctx context.Context, ext string, serviceId int32, action stri
 		MaxAttempts: 1,
 		Queue:       queue,
 		Metadata:    []byte(fmt.Sprintf("{\"service_id\": %d}", serviceId)),
-	})
-	if err != nil {
-		return fmt.Errorf("insert job: %w", err)
-	}
-	if resp.UniqueSkippedAsDuplicate {
-		return ErrActionRunning
 	}
-	return nil
 }
 
 func init() {
@@ -29,6 +29,8 @@ type ServerSettings struct {
 	Regex       string   `json:"regex"`        // regex for validating input
 }
 
+// Extension provisions and manages services on a backend.
+// Extensions may report usage of metered resources with RecordUsage.
 type Extension interface {
 	// Init initializes the extension.
 	// Called when the application starts.
@@ -49,6 +51,10 @@ type Extension interface {
 	// Action performs an action on the service.
 	// Action must support the following actions:
 	// suspend, create, terminate, unsuspend
+	//
+	// The optional action "resize" applies changed service settings
+	// (e.g. after an upgrade) to the provisioned service. It is only
+	// invoked if it is returned by AdminActions.
 	Action(serviceId int32, action string) error
 
 	// ClientActions returns a list of actions that can be performed
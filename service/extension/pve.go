@@ -667,6 +667,87 @@ func (p *PVE) qemuDelete(serviceId int32, lxc bool) error {
 	return nil
 }
 
+// Apply cores, memory and disk size from the service settings to the VM.
+// Shrinking a disk is not supported by PVE, the disk is left as is in that case.
+func (p *PVE) qemuResize(serviceId int32, lxc bool) error {
+	serviceSettings, serverSettings, err := p.getServiceSettings(serviceId)
+	if err != nil {
+		return fmt.Errorf("pve: resize: %w", err)
+	}
+
+	cpu := serviceSettings["cpu"]
+	disk := serviceSettings["disk"]
+	memory := serviceSettings["memory"]
+
+	address := serverSettings["address"]
+	port := serverSettings["port"]
+	username := serverSettings["username"]
+	password := serverSettings["password"]
+	node := serverSettings["node"]
+	baseUrl := fmt.Sprintf("https://%s:%s/api2/json", address, port)
+
+	slog.Info("pve resize", "service id", serviceId, "cpu", cpu, "disk", disk, "memory", memory, "lxc", lxc)
+
+	csrf, ticket, err := p.pveAuth(baseUrl, username, password)
+	if err != nil {
+		return fmt.Errorf("pve: %w", err)
+	}
+
+	vmid := int(10000 + serviceId)
+
+	// cpu and memory
+	resp := pveResp[string]{}
+	form := url.Values{}
+	form.Set("cores", cpu)
+	form.Set("memory", memory)
+	if lxc {
+		// lxc config is updated synchronously
+		err = p.apiAction("PUT", fmt.Sprintf("%s/nodes/%s/lxc/%d/config", baseUrl, node, vmid), form, &resp, csrf, ticket)
+		if err != nil {
+			return fmt.Errorf("pve: %w", err)
+		}
+	} else {
+		err = p.apiAction("POST", fmt.Sprintf("%s/nodes/%s/qemu/%d/config", baseUrl, node, vmid), form, &resp, csrf, ticket)
+		if err != nil {
+			return fmt.Errorf("pve: %w", err)
+		}
+
+		err = p.waitForTask(baseUrl, node, ticket, resp.Data)
+		if err != nil {
+			return fmt.Errorf("pve: %w", err)
+		}
+	}
+
+	// disk
+	vmType := "qemu"
+	diskName := "scsi0"
+	if lxc {
+		vmType = "lxc"
+		diskName = "rootfs"
+	}
+
+	resp = pveResp[string]{}
+	form = url.Values{}
+	form.Set("disk", diskName)
+	form.Set("size", disk+"G")
+	err = p.apiAction("PUT", fmt.Sprintf("%s/nodes/%s/%s/%d/resize", baseUrl, node, vmType, vmid), form, &resp, csrf, ticket)
+	if err != nil {
+		if strings.Contains(err.Error(), "shrinking") {
+			// ignore error caused by a smaller disk size
+			slog.Warn("pve resize: disk not shrunk", "service id", serviceId, "disk", disk)
+			return nil
+		}
+		return fmt.Errorf("pve: %w", err)
+	}
+
+	err = p.waitForTask(baseUrl, node, ticket, resp.Data)
+	if err != nil {
+		return fmt.Errorf("pve: %w", err)
+	}
+
+	return nil
+}
+
 func (p *PVE) Action(serviceId int32, action string) error {
 
 	serviceSettings, _, err := p.getServiceSettings(serviceId)
@@ -714,6 +795,8 @@ func (p *PVE) Action(serviceId int32, action string) error {
 		return p.createService(serviceId)
 	case "boot":
 		return p.qemuStart(serviceId, vmType == "lxc")
+	case "resize":
+		return p.qemuResize(serviceId, vmType == "lxc")
 	}
 
 	return fmt.Errorf("invalid action \"%s\"", action)
@@ -737,7 +820,7 @@ func (p *PVE) AdminActions(serviceId int32) ([]string, error) {
 		return nil, fmt.Errorf("pve: db: %w", err)
 	}
 	if _, ok := s.Settings["server"]; ok {
-		return []string{"poweroff", "reboot", "terminate", "suspend", "unsuspend", "create", "force_poweroff", "boot"}, nil
+		return []string{"poweroff", "reboot", "terminate", "suspend", "unsuspend", "create", "force_poweroff", "boot", "resize"}, nil
 	}
 	return []string{"create"}, nil
 }
@@ -0,0 +1,40 @@
+package extension
+
+import (
+	"billing3/database"
+	"billing3/database/types"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+// RecordUsage records the usage of a metered resource by a service, e.g. bandwidth in GB or compute hours.
+// Extensions call RecordUsage to report usage, which is charged on the renewal invoices of the service
+// according to the metered pricing of the product.
+//
+// The usage is counted in the billing period that contains timestamp.
+func RecordUsage(ctx context.Context, serviceId int32, metric string, quantity decimal.Decimal, timestamp time.Time) error {
+	if metric == "" {
+		return fmt.Errorf("metric is required")
+	}
+	if quantity.LessThan(decimal.Zero) {
+		return fmt.Errorf("quantity must not be negative")
+	}
+
+	slog.Debug("record usage", "service_id", serviceId, "metric", metric, "quantity", quantity, "timestamp", timestamp)
+
+	err := database.Q.CreateUsageRecord(ctx, database.CreateUsageRecordParams{
+		ServiceID:  serviceId,
+		Metric:     metric,
+		Quantity:   quantity,
+		RecordedAt: types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: timestamp.UTC()}},
+	})
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"billing3/database"
+	"billing3/database/types"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// FraudChecker screens orders before they are provisioned. Orders that fail any check are held in the
+// PENDING_REVIEW status until an admin approves or rejects them.
+type FraudChecker interface {
+	// Name identifies the check in review reasons and logs.
+	Name() string
+
+	// Check returns the reason for holding the order of the service for review, or an empty string if the order
+	// passes the check. user is the owner of the service.
+	Check(ctx context.Context, qtx *database.Queries, s *database.Service, user *database.User) (string, error)
+}
+
+var FraudCheckers []FraudChecker
+
+// RegisterFraudChecker adds a check that is run on every order.
+func RegisterFraudChecker(checker FraudChecker) {
+	slog.Info("fraud checker registered", "name", checker.Name())
+	FraudCheckers = append(FraudCheckers, checker)
+}
+
+func init() {
+	RegisterFraudChecker(maxOrdersPerDayCheck{})
+	RegisterFraudChecker(emailDomainBlocklistCheck{})
+	RegisterFraudChecker(countryMismatchCheck{})
+}
+
+// ScreenOrder runs the fraud checks on a newly ordered service, which should be UNPAID or PENDING. If any check
+// fails, the service is put into the PENDING_REVIEW status, and ScreenOrder returns true. The caller must not
+// provision the service in that case. A check that returns an error holds the order too.
+func ScreenOrder(ctx context.Context, qtx *database.Queries, s *database.Service) (bool, error) {
+	user, err := qtx.FindUserById(ctx, s.UserID)
+	if err != nil {
+		return false, fmt.Errorf("find user: %w", err)
+	}
+
+	reasons := make([]string, 0)
+	for _, checker := range FraudCheckers {
+		reason, err := checker.Check(ctx, qtx, s, &user)
+		if err != nil {
+			slog.Error("fraud check", "err", err, "check", checker.Name(), "service_id", s.ID)
+			reason = "check failed"
+		}
+		if reason != "" {
+			reasons = append(reasons, checker.Name()+": "+reason)
+		}
+	}
+
+	if len(reasons) == 0 {
+		return false, nil
+	}
+
+	slog.Info("order held for review", "service_id", s.ID, "user_id", s.UserID, "reasons", reasons)
+
+	err = HoldService(ctx, qtx, s.ID, strings.Join(reasons, "; "))
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// HoldService puts the service into the PENDING_REVIEW status for an admin to approve or reject it.
+//
+// qtx should be a transaction. qtx is not commited.
+func HoldService(ctx context.Context, qtx *database.Queries, serviceId int32, reason string) error {
+	err := qtx.UpdateServiceStatus(ctx, database.UpdateServiceStatusParams{
+		Status: ServicePendingReview,
+		ID:     serviceId,
+	})
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+
+	err = qtx.UpdateServiceReviewReason(ctx, database.UpdateServiceReviewReasonParams{
+		ReviewReason: pgtype.Text{Valid: true, String: reason},
+		ID:           serviceId,
+	})
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+
+	return nil
+}
+
+// ApproveService approves a service held for review, and changes its status to PENDING. The review reason is kept.
+// Services held when their first invoice was paid have not been extended yet, their paid period starts when they are
+// approved. The caller should provision the service with ProvisionService after the transaction is commited.
+//
+// qtx should be a transaction. qtx is not commited.
+func ApproveService(ctx context.Context, qtx *database.Queries, serviceId int32) (*database.Service, error) {
+	s, err := qtx.FindServiceByIdForUpdate(ctx, serviceId)
+	if err != nil {
+		return nil, fmt.Errorf("find service: %w", err)
+	}
+
+	if s.Status != ServicePendingReview {
+		return nil, ErrServiceNotPendingReview
+	}
+
+	slog.Info("approve service", "service_id", s.ID)
+
+	if !s.ExpiresAt.Time.After(time.Now()) {
+		invoices, err := qtx.FindInvoiceByService(ctx, pgtype.Int4{Valid: true, Int32: s.ID})
+		if err != nil {
+			return nil, fmt.Errorf("find invoices: %w", err)
+		}
+
+		if slices.ContainsFunc(invoices, func(i database.Invoice) bool { return InvoiceIsPaid(i.Status) }) {
+			s.ExpiresAt = types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: ServiceBillingCycle(&s).Next(time.Now().UTC())}}
+			slog.Info("extend service expiry time", "service_id", s.ID, "expires_at", s.ExpiresAt.Time)
+
+			err = qtx.UpdateServiceExpiryTime(ctx, database.UpdateServiceExpiryTimeParams{
+				ID:        s.ID,
+				ExpiresAt: s.ExpiresAt,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("db: %w", err)
+			}
+		}
+	}
+
+	err = qtx.UpdateServiceStatus(ctx, database.UpdateServiceStatusParams{
+		Status: ServicePending,
+		ID:     s.ID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	s.Status = ServicePending
+	return &s, nil
+}
+
+// RejectService cancels a service held for review without provisioning it. Payments of the service are not
+// refunded automatically.
+//
+// qtx should be a transaction. qtx is not commited.
+func RejectService(ctx context.Context, qtx *database.Queries, serviceId int32, reason string) error {
+	s, err := qtx.FindServiceByIdForUpdate(ctx, serviceId)
+	if err != nil {
+		return fmt.Errorf("find service: %w", err)
+	}
+
+	if s.Status != ServicePendingReview {
+		return ErrServiceNotPendingReview
+	}
+
+	slog.Info("reject service", "service_id", s.ID, "reason", reason)
+
+	err = qtx.UpdateServiceCancelled(ctx, database.UpdateServiceCancelledParams{
+		CancellationReason: pgtype.Text{Valid: true, String: reason},
+		CancelledAt:        Timestamp(time.Now()),
+		ID:                 s.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+
+	err = qtx.UpdateServiceStatus(ctx, database.UpdateServiceStatusParams{
+		Status: ServiceCancelled,
+		ID:     s.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+
+	return nil
+}
+
+// maxOrdersPerDayCheck holds orders of users who ordered more services in the last 24 hours than allowed.
+type maxOrdersPerDayCheck struct{}
+
+func (maxOrdersPerDayCheck) Name() string {
+	return "max orders per day"
+}
+
+func (maxOrdersPerDayCheck) Check(ctx context.Context, qtx *database.Queries, s *database.Service, user *database.User) (string, error) {
+	max := intSetting(ctx, SettingFraudMaxOrdersPerDay)
+	if max <= 0 {
+		return "", nil
+	}
+
+	count, err := qtx.CountUserServicesSince(ctx, database.CountUserServicesSinceParams{
+		UserID:    user.ID,
+		CreatedAt: Timestamp(time.Now().Add(-24 * time.Hour)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("db: %w", err)
+	}
+
+	if count > int64(max) {
+		return strconv.FormatInt(count, 10) + " orders in 24 hours", nil
+	}
+	return "", nil
+}
+
+// emailDomainBlocklistCheck holds orders of users whose email address is in a blocked domain or its subdomains.
+type emailDomainBlocklistCheck struct{}
+
+func (emailDomainBlocklistCheck) Name() string {
+	return "email domain blocklist"
+}
+
+func (emailDomainBlocklistCheck) Check(ctx context.Context, qtx *database.Queries, s *database.Service, user *database.User) (string, error) {
+	_, domain, ok := strings.Cut(strings.ToLower(user.Email), "@")
+	if !ok {
+		return "", errors.New("invalid email address")
+	}
+
+	for _, blocked := range strings.FieldsFunc(SettingFraudEmailDomainBlocklist.Get(ctx), isListSeparator) {
+		blocked = strings.ToLower(blocked)
+		if domain == blocked || strings.HasSuffix(domain, "."+blocked) {
+			return "email domain " + domain + " is blocked", nil
+		}
+	}
+	return "", nil
+}
+
+// countryMismatchCheck holds orders placed from an IP address in another country than the billing address of the
+// user, or through Tor. The country of the IP address is provided by Cloudflare, orders are not checked without it,
+// i.e. unless the behind_cloudflare setting is enabled.
+type countryMismatchCheck struct{}
+
+func (countryMismatchCheck) Name() string {
+	return "country mismatch"
+}
+
+func (countryMismatchCheck) Check(ctx context.Context, qtx *database.Queries, s *database.Service, user *database.User) (string, error) {
+	if SettingFraudCountryMismatch.Get(ctx) != "true" {
+		return "", nil
+	}
+
+	ipCountry := strings.ToUpper(s.OrderCountry)
+	if ipCountry == "T1" {
+		return "ordered through Tor", nil
+	}
+	if ipCountry == "" || ipCountry == "XX" || !user.Country.Valid || user.Country.String == "" {
+		return "", nil
+	}
+
+	if !strings.EqualFold(ipCountry, user.Country.String) {
+		return "billing country " + user.Country.String + ", IP country " + ipCountry, nil
+	}
+	return "", nil
+}
+
+func isListSeparator(r rune) bool {
+	return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+}
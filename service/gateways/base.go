@@ -2,9 +2,11 @@ package gateways
 
 import (
 	"billing3/database"
+	"billing3/utils"
 	"context"
 	"log/slog"
 	"os"
+	"slices"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/shopspring/decimal"
@@ -28,14 +30,36 @@ type Gateway interface {
 	Settings() []GatewaySetting
 
 	// Pay initialize a one time payment, and returns a URL that the user will be redirected to.
-	// total is the total amount, including the payment gateway fee.
-	Pay(invoice *database.Invoice, user *database.User, total decimal.Decimal) (string, error)
+	// total is the total amount in currency, including the payment gateway fee.
+	Pay(ctx context.Context, invoice *database.Invoice, user *database.User, total decimal.Decimal, currency string) (string, error)
+
+	// Currencies returns the currencies that the gateway can charge, or nil if it supports any currency.
+	Currencies() []string
 
 	// Route is called once when the application starts.
 	// The payment gateway may register custom routes to r.
 	Route(r chi.Router) error
 }
 
+// Refunder is implemented by gateways that support refunding payments.
+type Refunder interface {
+	// Refund sends amount of the payment back to the payer, and returns the reference id of the refund.
+	// amount may be less than the amount of the payment for partial refunds.
+	Refund(payment *database.InvoicePayment, amount decimal.Decimal) (string, error)
+}
+
+// Reconciler is implemented by gateways that periodically reconcile payments with the payment provider,
+// e.g. to record payments whose notifications were missed.
+type Reconciler interface {
+	Reconcile() error
+}
+
+// SupportsCurrency returns whether the gateway can charge currency.
+func SupportsCurrency(gateway Gateway, currency string) bool {
+	currencies := gateway.Currencies()
+	return currencies == nil || slices.Contains(currencies, currency)
+}
+
 func registerGateway(name string, extension Gateway) {
 	slog.Info("gateway registered", "name", name)
 	Gateways[name] = extension
@@ -75,3 +99,15 @@ func InitGateways() error {
 
 	return nil
 }
+
+// InitCron registers the reconciliation jobs of gateways. It must be called after service.InitCron.
+func InitCron() {
+	for name, gateway := range Gateways {
+		reconciler, ok := gateway.(Reconciler)
+		if !ok {
+			continue
+		}
+
+		utils.NewCronJob("*/15 * * * *", reconciler.Reconcile, "reconcile "+name+" payments")
+	}
+}
@@ -0,0 +1,76 @@
+package gateways
+
+import (
+	"billing3/database"
+	"billing3/service"
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+// Credit pays invoices with the user's account credit balance.
+type Credit struct{}
+
+func (c *Credit) Settings() []GatewaySetting {
+	return []GatewaySetting{}
+}
+
+// Currencies returns the default currency, in which credit balances are kept.
+func (c *Credit) Currencies() []string {
+	return []string{service.DefaultCurrency(context.Background())}
+}
+
+func (c *Credit) Pay(ctx context.Context, invoice *database.Invoice, user *database.User, total decimal.Decimal, currency string) (string, error) {
+	if currency != service.DefaultCurrency(ctx) {
+		return "", fmt.Errorf("credit: unsupported currency %s", currency)
+	}
+
+	if user.Credit.LessThan(total) {
+		return "", service.ErrInsufficientCredit
+	}
+
+	tx, err := database.Conn.Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := database.Q.WithTx(tx)
+
+	// the balance is checked again when deducting, in case it has changed since the user is loaded
+	transactionId, err := service.AddCredit(ctx, qtx, user.ID, total.Neg(), service.CreditConsumption, fmt.Sprintf("Payment for invoice #%d", invoice.ID), pgtype.Int4{Valid: true, Int32: invoice.ID})
+	if err != nil {
+		return "", err
+	}
+
+	paid, err := service.InvoiceAddPaymentTx(ctx, qtx, invoice.ID, "Account credit", total, strconv.Itoa(int(transactionId)), service.GatewayCredit)
+	if err != nil {
+		return "", fmt.Errorf("credit: invoice add payment: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return "", fmt.Errorf("commit tx: %w", err)
+	}
+
+	slog.Info("credit payment", "invoice_id", invoice.ID, "total", total.String(), "user_id", user.ID, "transaction_id", transactionId)
+
+	if paid {
+		service.OnInvoicePaid(invoice.ID)
+	}
+
+	return "/dashboard/invoice/" + strconv.Itoa(int(invoice.ID)), nil
+}
+
+func (c *Credit) Route(r chi.Router) error {
+	return nil
+}
+
+func init() {
+	registerGateway(service.GatewayCredit, &Credit{})
+}
@@ -6,6 +6,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -16,41 +17,100 @@ import (
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
 	"github.com/shopspring/decimal"
 )
 
+// status of orders in gateway_orders
+const (
+	paypalOrderCreated   = "CREATED"
+	paypalOrderCompleted = "COMPLETED"
+	paypalOrderVoided    = "VOIDED"
+	paypalOrderExpired   = "EXPIRED"
+)
+
+// orders that have not been completed within this duration are no longer reconciled
+const paypalOrderExpiry = 72 * time.Hour
+
+var errPaypalNotFound = errors.New("paypal: resource not found")
+
+// errPaypalInvoiceNotPayable is returned when an approved order is not captured, because its invoice has been paid,
+// cancelled or refunded in the meantime.
+var errPaypalInvoiceNotPayable = errors.New("paypal: invoice is not payable")
+
 type Paypal struct {
 	httpClient     *http.Client
 	returnTemplate *template.Template
 }
 
+type paypalAmount struct {
+	CurrencyCode string `json:"currency_code"`
+	Value        string `json:"value"`
+}
+
+type paypalCapture struct {
+	Id                string       `json:"id"`
+	Status            string       `json:"status"`
+	Amount            paypalAmount `json:"amount"`
+	CustomId          string       `json:"custom_id"` // invoice id
+	SupplementaryData struct {
+		RelatedIds struct {
+			OrderId string `json:"order_id"`
+		} `json:"related_ids"`
+	} `json:"supplementary_data"`
+}
+
+type paypalOrder struct {
+	Id            string `json:"id"`
+	Status        string `json:"status"`
+	PurchaseUnits []struct {
+		ReferenceId string       `json:"reference_id"` // invoice id
+		Amount      paypalAmount `json:"amount"`
+		Payments    struct {
+			Captures []paypalCapture `json:"captures"`
+		} `json:"payments"`
+	} `json:"purchase_units"`
+}
+
 func (p *Paypal) Settings() []GatewaySetting {
 	return []GatewaySetting{
 		{DisplayName: "Client ID", Name: "client_id", Type: "string", Regex: "^.+$"},
 		{DisplayName: "Client Secret", Name: "client_secret", Type: "string", Regex: "^.+$"},
 		{DisplayName: "Sandbox", Name: "sandbox", Type: "select", Values: []string{"Yes", "No"}},
+		{DisplayName: "Webhook ID", Name: "webhook_id", Type: "string", Regex: "^.*$",
+			Description: "Add a webhook pointing to " + PUBLIC_DOMAIN + "/api/gateway/paypal/webhook for CHECKOUT.ORDER.APPROVED, PAYMENT.CAPTURE.COMPLETED and PAYMENT.CAPTURE.REFUNDED"},
 	}
 }
 
-func (p *Paypal) Pay(invoice *database.Invoice, user *database.User, total decimal.Decimal) (string, error) {
+func (p *Paypal) Currencies() []string {
+	return []string{"AUD", "BRL", "CAD", "CNY", "CZK", "DKK", "EUR", "HKD", "HUF", "ILS", "JPY", "MYR", "MXN", "TWD",
+		"NZD", "NOK", "PHP", "PLN", "GBP", "SGD", "SEK", "CHF", "THB", "USD"}
+}
+
+// newPaypalAmount formats amount in currency. Some currencies do not support decimals.
+func newPaypalAmount(amount decimal.Decimal, currency string) paypalAmount {
+	if currency == "HUF" || currency == "JPY" || currency == "TWD" {
+		return paypalAmount{CurrencyCode: currency, Value: amount.Round(0).String()}
+	}
+	return paypalAmount{CurrencyCode: currency, Value: amount.StringFixed(2)}
+}
+
+func (p *Paypal) Pay(ctx context.Context, invoice *database.Invoice, user *database.User, total decimal.Decimal, currency string) (string, error) {
 
 	if total.LessThanOrEqual(decimal.Zero) {
-		err := service.InvoiceAddPayment(context.Background(), int32(invoice.ID), "Paypal payment (Free)", decimal.Zero, "", "Paypal")
+		err := service.InvoiceAddPayment(ctx, int32(invoice.ID), "Paypal payment (Free)", decimal.Zero, "", "Paypal")
 		if err != nil {
 			return "", fmt.Errorf("paypal free: invoice add payment: %w", err)
 		}
 		return "/dashboard/invoice/" + strconv.Itoa(int(invoice.ID)), nil
 	}
 
-	settings, err := getSettings(context.Background(), "Paypal")
+	settings, err := getSettings(ctx, "Paypal")
 	if err != nil {
 		return "", err
 	}
 
-	paypalApi := "https://api-m.sandbox.paypal.com"
-	if settings["sandbox"] == "No" {
-		paypalApi = "https://api-m.paypal.com"
-	}
+	paypalApi := p.apiBase(settings)
 
 	// obtain access token
 
@@ -61,13 +121,10 @@ func (p *Paypal) Pay(invoice *database.Invoice, user *database.User, total decim
 
 	// create order
 
-	type amountStruct struct {
-		CurrencyCode string `json:"currency_code"`
-		Value        string `json:"value"`
-	}
 	type purchaseUnitStruct struct {
 		ReferenceId string       `json:"reference_id"`
-		Amount      amountStruct `json:"amount"`
+		CustomId    string       `json:"custom_id"` // copied to captures, used by webhooks
+		Amount      paypalAmount `json:"amount"`
 	}
 	type applicationContextStruct struct {
 		ReturnUrl          string `json:"return_url"`
@@ -83,7 +140,11 @@ func (p *Paypal) Pay(invoice *database.Invoice, user *database.User, total decim
 
 	req := reqStruct{
 		PurchaseUnit: []purchaseUnitStruct{
-			{ReferenceId: strconv.Itoa(int(invoice.ID)), Amount: amountStruct{CurrencyCode: "USD", Value: total.String()}},
+			{
+				ReferenceId: strconv.Itoa(int(invoice.ID)),
+				CustomId:    strconv.Itoa(int(invoice.ID)),
+				Amount:      newPaypalAmount(total, currency),
+			},
 		},
 		Intent: "CAPTURE",
 		ApplicationContext: applicationContextStruct{
@@ -101,7 +162,7 @@ func (p *Paypal) Pay(invoice *database.Invoice, user *database.User, total decim
 
 	// send request
 
-	httpReq, err := http.NewRequest(http.MethodPost, paypalApi+"/v2/checkout/orders", bytes.NewReader(reqBytes))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, paypalApi+"/v2/checkout/orders", bytes.NewReader(reqBytes))
 	if err != nil {
 		return "", fmt.Errorf("http: %w", err)
 	}
@@ -136,7 +197,20 @@ func (p *Paypal) Pay(invoice *database.Invoice, user *database.User, total decim
 		return "", fmt.Errorf("http: %s %s %s", httpResp.Status, resp.Error, resp.ErrorDescription)
 	}
 
-	slog.Info("paypal create order", "order_id", resp.Id, "invoice_id", invoice.ID, "total", total.String(), "user_id", user.ID)
+	slog.Info("paypal create order", "order_id", resp.Id, "invoice_id", invoice.ID, "total", total.String(), "currency", currency, "user_id", user.ID)
+
+	// remember the order, so that it can be captured by the reconciliation job
+	// if neither the customer returns nor the webhook is received. The customer
+	// is not sent to an order that cannot be reconciled, and can retry instead.
+	err = database.Q.CreateGatewayOrder(ctx, database.CreateGatewayOrderParams{
+		Gateway:   "Paypal",
+		OrderID:   resp.Id,
+		InvoiceID: invoice.ID,
+		Status:    paypalOrderCreated,
+	})
+	if err != nil {
+		return "", fmt.Errorf("save order %s: %w", resp.Id, err)
+	}
 
 	for _, link := range resp.Links {
 		if link.Rel == "approve" {
@@ -147,6 +221,13 @@ func (p *Paypal) Pay(invoice *database.Invoice, user *database.User, total decim
 	return "", fmt.Errorf("payment approve url not found")
 }
 
+func (p *Paypal) apiBase(settings map[string]string) string {
+	if settings["sandbox"] == "No" {
+		return "https://api-m.paypal.com"
+	}
+	return "https://api-m.sandbox.paypal.com"
+}
+
 // obtain access token using client id and client secret
 func (p *Paypal) getAccessToken(paypalApi, clientId, clientSecret string) (string, error) {
 	request, err := http.NewRequest(http.MethodPost, paypalApi+"/v1/oauth2/token", strings.NewReader("grant_type=client_credentials"))
@@ -180,126 +261,654 @@ func (p *Paypal) getAccessToken(paypalApi, clientId, clientSecret string) (strin
 	return resp.AccessToken, nil
 }
 
-func (p *Paypal) Route(r chi.Router) error {
+// getOrder returns the details of an order. errPaypalNotFound is returned if the order does not exist.
+func (p *Paypal) getOrder(paypalApi string, accessToken string, orderId string) (*paypalOrder, error) {
+	httpReq, err := http.NewRequest(http.MethodGet, paypalApi+"/v2/checkout/orders/"+orderId, nil)
+	if err != nil {
+		return nil, fmt.Errorf("http: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+accessToken)
 
-	r.Get("/return", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/html")
-		w.WriteHeader(http.StatusOK)
-		_ = p.returnTemplate.Execute(w, r.URL.Query().Get("token"))
-	})
+	httpResp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("http: %w", err)
+	}
+	defer httpResp.Body.Close()
 
-	r.Post("/capture", func(w http.ResponseWriter, r *http.Request) {
-		settings, err := getSettings(r.Context(), "Paypal")
+	if httpResp.StatusCode == http.StatusNotFound {
+		return nil, errPaypalNotFound
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http: %s", httpResp.Status)
+	}
+
+	var order paypalOrder
+	err = json.NewDecoder(httpResp.Body).Decode(&order)
+	if err != nil {
+		return nil, fmt.Errorf("http: %w", err)
+	}
+
+	return &order, nil
+}
+
+// captureOrder captures an approved order and records the payment. Orders that have been
+// captured already, e.g. by the webhook while the customer is being redirected, are recorded
+// the same way. The returned order may still be incomplete if the capture is pending.
+//
+// Approved orders of invoices that are no longer UNPAID are not captured, the order is marked
+// as voided and errPaypalInvoiceNotPayable is returned. The approval expires at PayPal.
+func (p *Paypal) captureOrder(ctx context.Context, orderId string) (*paypalOrder, error) {
+	settings, err := getSettings(ctx, "Paypal")
+	if err != nil {
+		return nil, err
+	}
+
+	paypalApi := p.apiBase(settings)
+
+	// obtain access token
+
+	accessToken, err := p.getAccessToken(paypalApi, settings["client_id"], settings["client_secret"])
+	if err != nil {
+		return nil, fmt.Errorf("get access token: %w", err)
+	}
+
+	// check the invoice before capturing, e.g. it may have been paid with another gateway
+	approved, err := p.getOrder(paypalApi, accessToken, orderId)
+	if err != nil {
+		return nil, fmt.Errorf("get order: %w", err)
+	}
+
+	if approved.Status == "APPROVED" {
+		invoiceId, err := paypalOrderInvoiceId(approved)
 		if err != nil {
-			slog.Error("paypal capture", "err", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+			return nil, err
 		}
 
-		paypalApi := "https://api-m.sandbox.paypal.com"
-		if settings["sandbox"] == "No" {
-			paypalApi = "https://api-m.paypal.com"
+		invoice, err := database.Q.FindInvoiceById(ctx, invoiceId)
+		if err != nil {
+			return nil, fmt.Errorf("find invoice: %w", err)
 		}
 
-		orderId := r.PostFormValue("order_id")
+		if invoice.Status != service.InvoiceUnpaid {
+			slog.Warn("paypal capture: invoice is not payable, order voided", "order_id", orderId, "invoice_id", invoiceId, "invoice_status", invoice.Status)
+
+			err = database.Q.UpdateGatewayOrderStatus(ctx, database.UpdateGatewayOrderStatusParams{
+				Status:  paypalOrderVoided,
+				Gateway: "Paypal",
+				OrderID: orderId,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("update order status: %w", err)
+			}
+			return nil, errPaypalInvoiceNotPayable
+		}
+	}
+
+	// capture
+	httpReq, err := http.NewRequest(http.MethodPost, paypalApi+"/v2/checkout/orders/"+orderId+"/capture", bytes.NewReader([]byte{}))
+	if err != nil {
+		return nil, fmt.Errorf("http: %w", err)
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+accessToken)
+	httpReq.Header.Set("Prefer", "return=representation")
+
+	httpResp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("http: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("http: %w", err)
+	}
+
+	var order *paypalOrder
+
+	switch {
+	case httpResp.StatusCode == http.StatusCreated:
+		order = &paypalOrder{}
+		err = json.Unmarshal(body, order)
+		if err != nil {
+			return nil, fmt.Errorf("http: %w", err)
+		}
+		slog.Info("paypal capture", "order_id", orderId, "status", order.Status)
+	case httpResp.StatusCode == http.StatusUnprocessableEntity && bytes.Contains(body, []byte("ORDER_ALREADY_CAPTURED")):
+		order, err = p.getOrder(paypalApi, accessToken, orderId)
+		if err != nil {
+			return nil, fmt.Errorf("get order: %w", err)
+		}
+		slog.Info("paypal capture: order already captured", "order_id", orderId, "status", order.Status)
+	default:
+		return nil, fmt.Errorf("http: %s %s", httpResp.Status, string(body))
+	}
+
+	err = p.recordOrder(ctx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// recordOrder records the completed captures of an order as invoice payments.
+func (p *Paypal) recordOrder(ctx context.Context, order *paypalOrder) error {
+	if order.Status != "COMPLETED" {
+		return nil
+	}
+
+	invoiceId, err := paypalOrderInvoiceId(order)
+	if err != nil {
+		return err
+	}
+
+	for _, capture := range order.PurchaseUnits[0].Payments.Captures {
+		err := p.recordCapture(ctx, invoiceId, &capture)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = database.Q.UpdateGatewayOrderStatus(ctx, database.UpdateGatewayOrderStatusParams{
+		Status:  paypalOrderCompleted,
+		Gateway: "Paypal",
+		OrderID: order.Id,
+	})
+	if err != nil {
+		return fmt.Errorf("update order status: %w", err)
+	}
+
+	return nil
+}
+
+// paypalOrderInvoiceId returns the id of the invoice paid by the order, which is the reference id of its purchase unit.
+func paypalOrderInvoiceId(order *paypalOrder) (int32, error) {
+	if len(order.PurchaseUnits) == 0 {
+		return 0, fmt.Errorf("order %s has no purchase units", order.Id)
+	}
+
+	invoiceId, err := strconv.Atoi(order.PurchaseUnits[0].ReferenceId)
+	if err != nil {
+		return 0, fmt.Errorf("invalid invoice id %s", order.PurchaseUnits[0].ReferenceId)
+	}
+	return int32(invoiceId), nil
+}
+
+// recordCapture adds a completed capture to the invoice. Captures that have been recorded already are ignored.
+// The capture id is used as the reference id, which is needed for refunds.
+func (p *Paypal) recordCapture(ctx context.Context, invoiceId int32, capture *paypalCapture) error {
+	if capture.Status != "COMPLETED" {
+		slog.Info("paypal capture not completed", "capture_id", capture.Id, "status", capture.Status, "invoice_id", invoiceId)
+		return nil
+	}
+
+	amount, err := decimal.NewFromString(capture.Amount.Value)
+	if err != nil {
+		return fmt.Errorf("invalid amount %s", capture.Amount.Value)
+	}
 
-		// obtain access token
+	err = service.InvoiceAddPayment(ctx, invoiceId, "Paypal payment", amount, capture.Id, "Paypal")
+	if errors.Is(err, service.ErrPaymentAlreadyRecorded) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("invoice add payment: %w", err)
+	}
+
+	return nil
+}
+
+// Refund refunds a captured payment, partially if amount is less than the captured amount.
+func (p *Paypal) Refund(payment *database.InvoicePayment, amount decimal.Decimal) (string, error) {
+	settings, err := getSettings(context.Background(), "Paypal")
+	if err != nil {
+		return "", err
+	}
+
+	paypalApi := p.apiBase(settings)
+
+	accessToken, err := p.getAccessToken(paypalApi, settings["client_id"], settings["client_secret"])
+	if err != nil {
+		return "", fmt.Errorf("get access token: %w", err)
+	}
+
+	captureId, err := p.getCaptureId(paypalApi, accessToken, payment.ReferenceID)
+	if err != nil {
+		return "", fmt.Errorf("get capture id: %w", err)
+	}
+
+	invoice, err := database.Q.FindInvoiceById(context.Background(), payment.InvoiceID)
+	if err != nil {
+		return "", fmt.Errorf("find invoice: %w", err)
+	}
+
+	type reqStruct struct {
+		Amount paypalAmount `json:"amount"`
+	}
+
+	reqBytes, err := json.Marshal(&reqStruct{Amount: newPaypalAmount(amount, invoice.Currency)})
+	if err != nil {
+		return "", fmt.Errorf("http: %w", err)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, paypalApi+"/v2/payments/captures/"+captureId+"/refund", bytes.NewReader(reqBytes))
+	if err != nil {
+		return "", fmt.Errorf("http: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+accessToken)
+
+	httpResp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("http: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	type respStruct struct {
+		Id      string `json:"id"`
+		Status  string `json:"status"`
+		Name    string `json:"name"`
+		Message string `json:"message"`
+	}
+
+	var resp respStruct
+	err = json.NewDecoder(httpResp.Body).Decode(&resp)
+	if err != nil {
+		return "", fmt.Errorf("http: %w", err)
+	}
+
+	if httpResp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("http: %s %s %s", httpResp.Status, resp.Name, resp.Message)
+	}
+
+	slog.Info("paypal refund", "capture_id", captureId, "refund_id", resp.Id, "status", resp.Status, "amount", amount.String(), "payment_id", payment.ID)
+
+	return resp.Id, nil
+}
+
+// getCaptureId returns the capture id of a payment. Payments recorded by older versions use the
+// order id as the reference id, which is resolved to the capture id of the order.
+func (p *Paypal) getCaptureId(paypalApi string, accessToken string, referenceId string) (string, error) {
+	order, err := p.getOrder(paypalApi, accessToken, referenceId)
+	if err != nil {
+		// not an order id
+		if errors.Is(err, errPaypalNotFound) {
+			return referenceId, nil
+		}
+		return "", err
+	}
+
+	if len(order.PurchaseUnits) == 0 || len(order.PurchaseUnits[0].Payments.Captures) == 0 {
+		return "", fmt.Errorf("order %s has no captures", referenceId)
+	}
+
+	return order.PurchaseUnits[0].Payments.Captures[0].Id, nil
+}
+
+// verifyWebhook verifies the signature of a webhook event using the verify-webhook-signature API.
+func (p *Paypal) verifyWebhook(settings map[string]string, header http.Header, payload []byte) error {
+	if settings["webhook_id"] == "" {
+		return fmt.Errorf("webhook id is not configured")
+	}
+
+	paypalApi := p.apiBase(settings)
+
+	accessToken, err := p.getAccessToken(paypalApi, settings["client_id"], settings["client_secret"])
+	if err != nil {
+		return fmt.Errorf("get access token: %w", err)
+	}
+
+	type reqStruct struct {
+		AuthAlgo         string          `json:"auth_algo"`
+		CertUrl          string          `json:"cert_url"`
+		TransmissionId   string          `json:"transmission_id"`
+		TransmissionSig  string          `json:"transmission_sig"`
+		TransmissionTime string          `json:"transmission_time"`
+		WebhookId        string          `json:"webhook_id"`
+		WebhookEvent     json.RawMessage `json:"webhook_event"`
+	}
+
+	reqBytes, err := json.Marshal(&reqStruct{
+		AuthAlgo:         header.Get("PAYPAL-AUTH-ALGO"),
+		CertUrl:          header.Get("PAYPAL-CERT-URL"),
+		TransmissionId:   header.Get("PAYPAL-TRANSMISSION-ID"),
+		TransmissionSig:  header.Get("PAYPAL-TRANSMISSION-SIG"),
+		TransmissionTime: header.Get("PAYPAL-TRANSMISSION-TIME"),
+		WebhookId:        settings["webhook_id"],
+		WebhookEvent:     payload,
+	})
+	if err != nil {
+		return fmt.Errorf("http: %w", err)
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, paypalApi+"/v1/notifications/verify-webhook-signature", bytes.NewReader(reqBytes))
+	if err != nil {
+		return fmt.Errorf("http: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Authorization", "Bearer "+accessToken)
+
+	httpResp, err := p.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("http: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	type respStruct struct {
+		VerificationStatus string `json:"verification_status"`
+	}
+
+	var resp respStruct
+	err = json.NewDecoder(httpResp.Body).Decode(&resp)
+	if err != nil {
+		return fmt.Errorf("http: %w", err)
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("http: %s", httpResp.Status)
+	}
+
+	if resp.VerificationStatus != "SUCCESS" {
+		return fmt.Errorf("verification status %s", resp.VerificationStatus)
+	}
+
+	return nil
+}
+
+// handleCaptureCompleted records a capture that has been completed, e.g. after a pending capture clears.
+func (p *Paypal) handleCaptureCompleted(ctx context.Context, capture *paypalCapture) error {
+	invoiceId, err := strconv.Atoi(capture.CustomId)
+	if err != nil {
+		// orders created by older versions don't have custom_id set
+		if capture.SupplementaryData.RelatedIds.OrderId == "" {
+			slog.Warn("paypal capture completed: unknown invoice", "capture_id", capture.Id)
+			return nil
+		}
+
+		settings, err := getSettings(ctx, "Paypal")
+		if err != nil {
+			return err
+		}
+
+		paypalApi := p.apiBase(settings)
 
 		accessToken, err := p.getAccessToken(paypalApi, settings["client_id"], settings["client_secret"])
 		if err != nil {
-			slog.Error("paypal capture", "err", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+			return fmt.Errorf("get access token: %w", err)
 		}
 
-		// capture
-		httpReq, err := http.NewRequest(http.MethodPost, paypalApi+"/v2/checkout/orders/"+orderId+"/capture", bytes.NewReader([]byte{}))
+		order, err := p.getOrder(paypalApi, accessToken, capture.SupplementaryData.RelatedIds.OrderId)
 		if err != nil {
-			slog.Error("paypal capture", "err", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+			return fmt.Errorf("get order: %w", err)
 		}
 
-		httpReq.Header.Set("Content-Type", "application/json")
-		httpReq.Header.Set("Authorization", "Bearer "+accessToken)
-		httpReq.Header.Set("Prefer", "return=representation")
+		return p.recordOrder(ctx, order)
+	}
 
-		httpResp, err := p.httpClient.Do(httpReq)
+	err = p.recordCapture(ctx, int32(invoiceId), capture)
+	if err != nil {
+		return err
+	}
+
+	if capture.SupplementaryData.RelatedIds.OrderId != "" {
+		err = database.Q.UpdateGatewayOrderStatus(ctx, database.UpdateGatewayOrderStatusParams{
+			Status:  paypalOrderCompleted,
+			Gateway: "Paypal",
+			OrderID: capture.SupplementaryData.RelatedIds.OrderId,
+		})
 		if err != nil {
-			slog.Error("paypal capture", "err", err, "order_id", orderId)
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+			return fmt.Errorf("update order status: %w", err)
 		}
-		defer httpResp.Body.Close()
+	}
 
-		type amountStruct struct {
-			CurrencyCode string `json:"currency_code"`
-			Value        string `json:"value"`
+	return nil
+}
+
+// handleCaptureRefunded records a refund, unless it has been recorded already, which is the case
+// for refunds issued from the admin panel.
+func (p *Paypal) handleCaptureRefunded(ctx context.Context, refundId string, captureId string, value string) error {
+	amount, err := decimal.NewFromString(value)
+	if err != nil {
+		return fmt.Errorf("invalid amount %s", value)
+	}
+
+	payment, err := database.Q.FindInvoicePaymentByReference(ctx, database.FindInvoicePaymentByReferenceParams{
+		Gateway:     "Paypal",
+		ReferenceID: captureId,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.Warn("paypal refund: payment not found", "capture_id", captureId, "refund_id", refundId)
+			return nil
 		}
-		type purchaseUnitStruct struct {
-			ReferenceId string       `json:"reference_id"` // invoice id
-			Amount      amountStruct `json:"amount"`
+		return fmt.Errorf("db: %w", err)
+	}
+
+	tx, err := database.Conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	qtx := database.Q.WithTx(tx)
+
+	// the admin panel holds the lock while refunding, so the refund is visible after acquiring it
+	_, err = qtx.SelectInvoiceForUpdate(ctx, payment.InvoiceID)
+	if err != nil {
+		return fmt.Errorf("select invoice for update: %w", err)
+	}
+
+	_, err = service.RecordRefund(ctx, qtx, &payment, amount, "Paypal refund", refundId, "Paypal")
+	if err != nil {
+		if errors.Is(err, service.ErrPaymentAlreadyRecorded) {
+			return nil
 		}
-		type respStruct struct {
-			Id             string               `json:"id"`
-			Status         string               `json:"status"`
-			PurchaseUnites []purchaseUnitStruct `json:"purchase_units"`
+		if errors.Is(err, service.ErrRefundExceedsPayment) {
+			slog.Warn("paypal refund: refund exceeds payment", "capture_id", captureId, "refund_id", refundId, "amount", amount)
+			return nil
+		}
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// Reconcile captures orders that have been approved by the customer, but not captured, because
+// the customer did not return from PayPal and the webhook was not received.
+func (p *Paypal) Reconcile() error {
+	ctx := context.Background()
+
+	orders, err := database.Q.ListGatewayOrdersByStatus(ctx, database.ListGatewayOrdersByStatusParams{
+		Gateway: "Paypal",
+		Status:  paypalOrderCreated,
+	})
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+
+	if len(orders) == 0 {
+		return nil
+	}
+
+	settings, err := getSettings(ctx, "Paypal")
+	if err != nil {
+		return err
+	}
+
+	paypalApi := p.apiBase(settings)
+
+	accessToken, err := p.getAccessToken(paypalApi, settings["client_id"], settings["client_secret"])
+	if err != nil {
+		return fmt.Errorf("get access token: %w", err)
+	}
+
+	for _, o := range orders {
+		status := ""
+
+		order, err := p.getOrder(paypalApi, accessToken, o.OrderID)
+		if err != nil && !errors.Is(err, errPaypalNotFound) {
+			slog.Error("paypal reconcile: get order", "err", err, "order_id", o.OrderID)
+			continue
 		}
 
-		if httpResp.StatusCode != http.StatusCreated {
-			body, err := io.ReadAll(httpResp.Body)
+		switch {
+		case order == nil:
+			status = paypalOrderExpired
+		case order.Status == "APPROVED":
+			slog.Info("paypal reconcile: capture approved order", "order_id", o.OrderID, "invoice_id", o.InvoiceID)
+			_, err = p.captureOrder(ctx, o.OrderID)
+			if err != nil && !errors.Is(err, errPaypalInvoiceNotPayable) {
+				slog.Error("paypal reconcile: capture order", "err", err, "order_id", o.OrderID)
+			}
+		case order.Status == "COMPLETED":
+			err = p.recordOrder(ctx, order)
 			if err != nil {
-				slog.Error("paypal capture", "err", err)
-				w.WriteHeader(http.StatusInternalServerError)
-				return
+				slog.Error("paypal reconcile: record order", "err", err, "order_id", o.OrderID)
 			}
+		case order.Status == "VOIDED":
+			status = paypalOrderVoided
+		case time.Since(o.CreatedAt.Time) > paypalOrderExpiry:
+			status = paypalOrderExpired
+		}
 
-			slog.Error("paypal capture", "order_id", orderId, "status_code", httpResp.Status, "body", string(body))
-			w.WriteHeader(http.StatusInternalServerError)
-			return
+		if status != "" {
+			err = database.Q.UpdateGatewayOrderStatus(ctx, database.UpdateGatewayOrderStatusParams{
+				Status:  status,
+				Gateway: "Paypal",
+				OrderID: o.OrderID,
+			})
+			if err != nil {
+				slog.Error("paypal reconcile: update order status", "err", err, "order_id", o.OrderID)
+			}
 		}
+	}
+
+	return nil
+}
 
-		slog.Info("paypal capture", "order_id", orderId)
+func (p *Paypal) Route(r chi.Router) error {
 
-		var resp respStruct
+	r.Get("/return", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusOK)
+		_ = p.returnTemplate.Execute(w, r.URL.Query().Get("token"))
+	})
 
-		err = json.NewDecoder(httpResp.Body).Decode(&resp)
+	r.Post("/capture", func(w http.ResponseWriter, r *http.Request) {
+		orderId := r.PostFormValue("order_id")
+
+		order, err := p.captureOrder(r.Context(), orderId)
+		if errors.Is(err, errPaypalInvoiceNotPayable) {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "The invoice is no longer payable, you have not been charged.")
+			return
+		}
 		if err != nil {
 			slog.Error("paypal capture", "err", err, "order_id", orderId)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		// add payment
-		if resp.Status != "COMPLETED" {
+		if order.Status != "COMPLETED" {
 			io.WriteString(w, "Payment incomplete")
 			return
 		}
 
-		invoiceId, err := strconv.Atoi(resp.PurchaseUnites[0].ReferenceId)
+		// redirect
+		http.Redirect(w, r, "/dashboard/invoice/"+order.PurchaseUnits[0].ReferenceId, http.StatusFound)
+	})
+
+	r.Post("/webhook", func(w http.ResponseWriter, r *http.Request) {
+		settings, err := getSettings(r.Context(), "Paypal")
 		if err != nil {
-			slog.Error("paypal capture", "err", "invalid invoice id", "invoice_id", resp.PurchaseUnites[0].ReferenceId)
+			slog.Error("paypal webhook", "err", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		amount, err := decimal.NewFromString(resp.PurchaseUnites[0].Amount.Value)
+		payload, err := io.ReadAll(io.LimitReader(r.Body, 1<<16))
 		if err != nil {
-			slog.Error("paypal capture", "err", "invalid amount", "amount", resp.PurchaseUnites[0].Amount.Value)
-			w.WriteHeader(http.StatusInternalServerError)
+			slog.Error("paypal webhook", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
-		err = service.InvoiceAddPayment(r.Context(), int32(invoiceId), "Paypal payment", amount, resp.Id, "Paypal")
+		err = p.verifyWebhook(settings, r.Header, payload)
 		if err != nil {
-			slog.Error("paypal capture", "err", err)
+			slog.Warn("paypal webhook: verification failed", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		type eventStruct struct {
+			Id        string          `json:"id"`
+			EventType string          `json:"event_type"`
+			Resource  json.RawMessage `json:"resource"`
+		}
+
+		var event eventStruct
+		err = json.Unmarshal(payload, &event)
+		if err != nil {
+			slog.Error("paypal webhook", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		slog.Info("paypal webhook", "event_id", event.Id, "event_type", event.EventType)
+
+		switch event.EventType {
+		case "CHECKOUT.ORDER.APPROVED":
+			var order paypalOrder
+			err = json.Unmarshal(event.Resource, &order)
+			if err == nil {
+				_, err = p.captureOrder(r.Context(), order.Id)
+			}
+			if errors.Is(err, errPaypalInvoiceNotPayable) {
+				// the order is voided, there is nothing to retry
+				err = nil
+			}
+		case "PAYMENT.CAPTURE.COMPLETED":
+			var capture paypalCapture
+			err = json.Unmarshal(event.Resource, &capture)
+			if err == nil {
+				err = p.handleCaptureCompleted(r.Context(), &capture)
+			}
+		case "PAYMENT.CAPTURE.REFUNDED":
+			type refundStruct struct {
+				Id     string       `json:"id"`
+				Amount paypalAmount `json:"amount"`
+				Links  []struct {
+					Href string `json:"href"`
+					Rel  string `json:"rel"`
+				} `json:"links"`
+			}
+
+			var refund refundStruct
+			err = json.Unmarshal(event.Resource, &refund)
+			if err == nil {
+				// the "up" link points to the refunded capture
+				captureId := ""
+				for _, link := range refund.Links {
+					if link.Rel == "up" {
+						captureId = link.Href[strings.LastIndex(link.Href, "/")+1:]
+					}
+				}
+				err = p.handleCaptureRefunded(r.Context(), refund.Id, captureId, refund.Amount.Value)
+			}
+		}
+		if err != nil {
+			// PayPal retries the event on non-2xx responses
+			slog.Error("paypal webhook", "err", err, "event_id", event.Id, "event_type", event.EventType)
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		// redirect
-		http.Redirect(w, r, fmt.Sprintf("/dashboard/invoice/%d", invoiceId), http.StatusFound)
+		w.WriteHeader(http.StatusOK)
 	})
+
 	return nil
 }
 
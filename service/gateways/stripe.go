@@ -0,0 +1,382 @@
+package gateways
+
+import (
+	"billing3/database"
+	"billing3/service"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+const stripeDefaultApi = "https://api.stripe.com"
+
+// webhook events with a timestamp older than this are rejected to prevent replay attacks
+const stripeSignatureTolerance = 5 * time.Minute
+
+type Stripe struct {
+	httpClient *http.Client
+}
+
+func (s *Stripe) Settings() []GatewaySetting {
+	return []GatewaySetting{
+		{DisplayName: "Secret Key", Name: "secret_key", Type: "string", Placeholder: "sk_live_...", Regex: "^.+$"},
+		{DisplayName: "Webhook Signing Secret", Name: "webhook_secret", Type: "string", Placeholder: "whsec_...", Regex: "^.+$",
+			Description: "Add a webhook endpoint for checkout.session.completed and checkout.session.async_payment_succeeded pointing to " + PUBLIC_DOMAIN + "/api/gateway/stripe/webhook"},
+		{DisplayName: "API Base URL", Name: "api_base", Type: "string", Placeholder: stripeDefaultApi, Regex: "^(https?://.+)?$",
+			Description: "Leave empty to use " + stripeDefaultApi},
+	}
+}
+
+func (s *Stripe) Currencies() []string {
+	return nil
+}
+
+// stripeDecimals returns the number of decimal places of amounts in the currency in Stripe API, which is the same as
+// service.CurrencyDecimals except for ISK. Stripe represents ISK with 2 decimal places for backward compatibility.
+func stripeDecimals(currency string) int32 {
+	if strings.ToUpper(currency) == "ISK" {
+		return 2
+	}
+	return service.CurrencyDecimals(currency)
+}
+
+// toStripeAmount converts amount to the smallest currency unit, which is used in Stripe API.
+func toStripeAmount(amount decimal.Decimal, currency string) string {
+	return amount.Shift(stripeDecimals(currency)).Round(0).String()
+}
+
+// fromStripeAmount converts amount in the smallest currency unit to a decimal.
+func fromStripeAmount(amount int64, currency string) decimal.Decimal {
+	return decimal.NewFromInt(amount).Shift(-stripeDecimals(currency))
+}
+
+func (s *Stripe) Pay(ctx context.Context, invoice *database.Invoice, user *database.User, total decimal.Decimal, currency string) (string, error) {
+
+	if total.LessThanOrEqual(decimal.Zero) {
+		err := service.InvoiceAddPayment(ctx, int32(invoice.ID), "Stripe payment (Free)", decimal.Zero, "", "Stripe")
+		if err != nil {
+			return "", fmt.Errorf("stripe free: invoice add payment: %w", err)
+		}
+		return "/dashboard/invoice/" + strconv.Itoa(int(invoice.ID)), nil
+	}
+
+	settings, err := getSettings(ctx, "Stripe")
+	if err != nil {
+		return "", err
+	}
+
+	// create checkout session
+
+	invoiceId := strconv.Itoa(int(invoice.ID))
+
+	form := url.Values{}
+	form.Set("mode", "payment")
+	form.Set("success_url", fmt.Sprintf("%s/dashboard/invoice/%d", PUBLIC_DOMAIN, invoice.ID))
+	form.Set("cancel_url", fmt.Sprintf("%s/dashboard/invoice/%d", PUBLIC_DOMAIN, invoice.ID))
+	form.Set("client_reference_id", invoiceId)
+	form.Set("customer_email", user.Email)
+	form.Set("metadata[invoice_id]", invoiceId)
+	form.Set("payment_intent_data[metadata][invoice_id]", invoiceId)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("line_items[0][price_data][currency]", strings.ToLower(currency))
+	form.Set("line_items[0][price_data][unit_amount]", toStripeAmount(total, currency))
+	form.Set("line_items[0][price_data][product_data][name]", "Invoice #"+invoiceId)
+
+	type respStruct struct {
+		Id  string `json:"id"`
+		Url string `json:"url"`
+	}
+
+	var resp respStruct
+	err = s.request(settings, "/v1/checkout/sessions", form, &resp)
+	if err != nil {
+		return "", fmt.Errorf("create checkout session: %w", err)
+	}
+
+	slog.Info("stripe create checkout session", "session_id", resp.Id, "invoice_id", invoice.ID, "total", total.String(), "currency", currency, "user_id", user.ID)
+
+	return resp.Url, nil
+}
+
+// Refund refunds a payment intent, partially if amount is less than the paid amount.
+func (s *Stripe) Refund(payment *database.InvoicePayment, amount decimal.Decimal) (string, error) {
+	settings, err := getSettings(context.Background(), "Stripe")
+	if err != nil {
+		return "", err
+	}
+
+	invoice, err := database.Q.FindInvoiceById(context.Background(), payment.InvoiceID)
+	if err != nil {
+		return "", fmt.Errorf("find invoice: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("payment_intent", payment.ReferenceID)
+	form.Set("amount", toStripeAmount(amount, invoice.Currency))
+	form.Set("metadata[invoice_id]", strconv.Itoa(int(payment.InvoiceID)))
+
+	type respStruct struct {
+		Id     string `json:"id"`
+		Status string `json:"status"`
+	}
+
+	var resp respStruct
+	err = s.request(settings, "/v1/refunds", form, &resp)
+	if err != nil {
+		return "", fmt.Errorf("create refund: %w", err)
+	}
+
+	slog.Info("stripe refund", "payment_intent", payment.ReferenceID, "refund_id", resp.Id, "status", resp.Status, "amount", amount.String(), "payment_id", payment.ID)
+
+	return resp.Id, nil
+}
+
+// request sends a form encoded POST request to the Stripe API and decodes the response into resp.
+func (s *Stripe) request(settings map[string]string, path string, form url.Values, resp any) error {
+	stripeApi := strings.TrimSuffix(settings["api_base"], "/")
+	if stripeApi == "" {
+		stripeApi = stripeDefaultApi
+	}
+
+	httpReq, err := http.NewRequest(http.MethodPost, stripeApi+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("http: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	httpReq.Header.Set("Authorization", "Bearer "+settings["secret_key"])
+
+	httpResp, err := s.httpClient.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("http: %w", err)
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return fmt.Errorf("http: %w", err)
+	}
+
+	if httpResp.StatusCode != http.StatusOK {
+		type errStruct struct {
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+
+		var e errStruct
+		_ = json.Unmarshal(body, &e)
+		return fmt.Errorf("http: %s %s %s", httpResp.Status, e.Error.Type, e.Error.Message)
+	}
+
+	err = json.Unmarshal(body, resp)
+	if err != nil {
+		return fmt.Errorf("http: %w", err)
+	}
+
+	return nil
+}
+
+// verifySignature verifies the Stripe-Signature header of a webhook request.
+// The header looks like "t=1492774577,v1=5257a869...,v1=...", where each v1 is a hex encoded
+// HMAC-SHA256 of "{t}.{payload}" using the webhook signing secret.
+func (s *Stripe) verifySignature(header string, payload []byte, secret string) error {
+	if secret == "" {
+		return fmt.Errorf("webhook secret is not set")
+	}
+
+	var timestamp string
+	var signatures []string
+
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	if timestamp == "" || len(signatures) == 0 {
+		return fmt.Errorf("malformed signature header")
+	}
+
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %w", err)
+	}
+	if time.Since(time.Unix(t, 0)).Abs() > stripeSignatureTolerance {
+		return fmt.Errorf("timestamp outside tolerance")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	for _, signature := range signatures {
+		sig, err := hex.DecodeString(signature)
+		if err != nil {
+			continue
+		}
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("no matching signature")
+}
+
+func (s *Stripe) Route(r chi.Router) error {
+
+	r.Post("/webhook", func(w http.ResponseWriter, r *http.Request) {
+		gateway, err := database.Q.FindGatewayByName(r.Context(), "Stripe")
+		if err != nil {
+			slog.Error("stripe webhook", "err", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// anyone can sign an event with an empty secret
+		secret := gateway.Settings["webhook_secret"]
+		if !gateway.Enabled || secret == "" {
+			slog.Warn("stripe webhook: gateway is disabled or webhook secret is not set")
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		payload, err := io.ReadAll(io.LimitReader(r.Body, 1<<16))
+		if err != nil {
+			slog.Error("stripe webhook", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		err = s.verifySignature(r.Header.Get("Stripe-Signature"), payload, secret)
+		if err != nil {
+			slog.Warn("stripe webhook: invalid signature", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		type sessionStruct struct {
+			Id                string `json:"id"`
+			PaymentStatus     string `json:"payment_status"`
+			PaymentIntent     string `json:"payment_intent"`
+			AmountTotal       int64  `json:"amount_total"`
+			Currency          string `json:"currency"`
+			ClientReferenceId string `json:"client_reference_id"` // invoice id
+		}
+		type eventStruct struct {
+			Id   string `json:"id"`
+			Type string `json:"type"`
+			Data struct {
+				Object json.RawMessage `json:"object"`
+			} `json:"data"`
+		}
+
+		var event eventStruct
+		err = json.Unmarshal(payload, &event)
+		if err != nil {
+			slog.Error("stripe webhook", "err", err)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		slog.Info("stripe webhook", "event_id", event.Id, "type", event.Type)
+
+		// checkout.session.async_payment_succeeded is sent for delayed payment methods,
+		// in which case payment_status is "unpaid" in checkout.session.completed
+		if event.Type != "checkout.session.completed" && event.Type != "checkout.session.async_payment_succeeded" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		var session sessionStruct
+		err = json.Unmarshal(event.Data.Object, &session)
+		if err != nil {
+			slog.Error("stripe webhook", "err", err, "event_id", event.Id)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if session.PaymentStatus != "paid" {
+			slog.Info("stripe webhook: session not paid", "session_id", session.Id, "payment_status", session.PaymentStatus)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		invoiceId, err := strconv.Atoi(session.ClientReferenceId)
+		if err != nil {
+			slog.Error("stripe webhook", "err", "invalid invoice id", "invoice_id", session.ClientReferenceId, "session_id", session.Id)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		invoice, err := database.Q.FindInvoiceById(r.Context(), int32(invoiceId))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				slog.Error("stripe webhook", "err", "invoice not found", "invoice_id", invoiceId, "session_id", session.Id)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			slog.Error("stripe webhook", "err", err, "invoice_id", invoiceId)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// the payment is recorded in the currency of the invoice, so it must have been made in that currency
+		if !strings.EqualFold(session.Currency, invoice.Currency) {
+			slog.Error("stripe webhook: currency does not match the invoice, payment not recorded", "session_id", session.Id, "payment_intent", session.PaymentIntent, "invoice_id", invoiceId, "currency", session.Currency, "invoice_currency", invoice.Currency, "amount_total", session.AmountTotal)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		amount := fromStripeAmount(session.AmountTotal, session.Currency)
+
+		err = service.InvoiceAddPayment(r.Context(), int32(invoiceId), "Stripe payment", amount, session.PaymentIntent, "Stripe")
+		if errors.Is(err, service.ErrPaymentAlreadyRecorded) {
+			// Stripe may deliver the same event more than once
+			slog.Info("stripe webhook: payment already recorded", "payment_intent", session.PaymentIntent, "invoice_id", invoiceId)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if err != nil {
+			slog.Error("stripe webhook", "err", err, "invoice_id", invoiceId, "payment_intent", session.PaymentIntent)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return nil
+}
+
+func init() {
+	s := Stripe{}
+	s.httpClient = &http.Client{
+		Timeout: time.Second * 10,
+	}
+	registerGateway("Stripe", &s)
+}
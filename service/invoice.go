@@ -3,13 +3,14 @@ package service
 import (
 	"billing3/database"
 	"billing3/database/types"
-	"billing3/service/extension"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
 	"log/slog"
 	"math"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -18,12 +19,15 @@ import (
 )
 
 const (
-	InvoiceUnpaid    = "UNPAID"
-	InvoicePaid      = "PAID"
-	InvoiceCancelled = "CANCELLED"
-
-	InvoiceItemService = "service"
-	InvoiceItemNone    = ""
+	InvoiceUnpaid            = "UNPAID"
+	InvoicePaid              = "PAID"
+	InvoiceCancelled         = "CANCELLED"
+	InvoiceRefunded          = "REFUNDED"
+	InvoicePartiallyRefunded = "PARTIALLY_REFUNDED"
+
+	InvoiceItemService  = "service"
+	InvoiceItemDiscount = "discount"
+	InvoiceItemNone     = ""
 )
 
 // SearchInvoice returns a list of invoice matching the searching criteria.
@@ -61,7 +65,7 @@ func SearchInvoice(ctx context.Context, status string, userId int, page int, ite
 // qtx should be a transaction. qtx is not commited.
 //
 // Due date is determined by the following rules:
-// - if the service is UNPAID, due date is 24 hours later. This is for newly created services that have not been paid yet.
+// - if the service is UNPAID, due date is SettingUnpaidServiceDueHours later. This is for newly created services that have not been paid yet.
 // - if the service is not UNPAID, due date is the expiry time of the service.
 func CreateRenewalInvoice(ctx context.Context, qtx *database.Queries, serviceId int32, setupFee decimal.Decimal) (int32, error) {
 	if setupFee.LessThan(decimal.Zero) {
@@ -70,109 +74,425 @@ func CreateRenewalInvoice(ctx context.Context, qtx *database.Queries, serviceId
 
 	slog.Debug("begin create renewal invoice", "service", serviceId, "setup fee", setupFee)
 
-	// lock the service row
+	service, err := lockServiceForRenewal(ctx, qtx, serviceId)
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Debug("create renewal invoice pass", "service", serviceId)
+
+	var dueAt time.Time
+
+	if service.Status == "UNPAID" {
+		dueAt = UnpaidServiceDueTime(ctx)
+	} else {
+		if service.ExpiresAt.Valid {
+			dueAt = service.ExpiresAt.Time
+		} else {
+			return 0, fmt.Errorf("service %d has no expiry time", serviceId)
+		}
+	}
+
+	invoiceId, tax, err := createUnpaidInvoice(ctx, qtx, service.UserID, service.Currency, dueAt)
+	if err != nil {
+		return 0, err
+	}
+
+	err = addRenewalItems(ctx, qtx, invoiceId, &service, setupFee)
+	if err != nil {
+		return 0, err
+	}
+
+	err = RecalculateInvoiceAmount(ctx, qtx, invoiceId)
+	if err != nil {
+		return 0, err
+	}
+
+	err = assignInvoiceNumberOnIssue(ctx, qtx, invoiceId)
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Info("create renewal invoice", "service", serviceId, "setup fee", setupFee, "service price", service.Price, "discount", service.Discount, "user", service.UserID, "label", service.Label, "service status", service.Status, "service expire", service.ExpiresAt.Time, "service billing cycle", service.BillingCycle, "tax", tax.Name, "tax rate", tax.Rate)
+
+	return invoiceId, nil
+}
+
+// CreateOrderInvoice creates a single invoice for several newly ordered services, with the first billing cycle and the
+// setup fee of each service. setupFees are the setup fees of the services at the same index. The services must be
+// UNPAID, belong to the same user, and be charged in the same currency.
+//
+// qtx should be a transaction. qtx is not commited.
+func CreateOrderInvoice(ctx context.Context, qtx *database.Queries, serviceIds []int32, setupFees []decimal.Decimal) (int32, error) {
+	if len(serviceIds) == 0 {
+		return 0, fmt.Errorf("no services to invoice")
+	}
+	if len(setupFees) != len(serviceIds) {
+		return 0, fmt.Errorf("setup fees do not match services")
+	}
+
+	services := make([]database.Service, 0, len(serviceIds))
+	for i, serviceId := range serviceIds {
+		if setupFees[i].LessThan(decimal.Zero) {
+			return 0, fmt.Errorf("setup fee must not be negative")
+		}
+
+		service, err := lockServiceForRenewal(ctx, qtx, serviceId)
+		if err != nil {
+			return 0, err
+		}
+
+		if service.Status != ServiceUnpaid {
+			return 0, fmt.Errorf("service %d is not UNPAID", serviceId)
+		}
+		if len(services) > 0 && (service.UserID != services[0].UserID || service.Currency != services[0].Currency) {
+			return 0, fmt.Errorf("service %d has a different user or currency", serviceId)
+		}
+
+		services = append(services, service)
+	}
+
+	invoiceId, tax, err := createUnpaidInvoice(ctx, qtx, services[0].UserID, services[0].Currency, UnpaidServiceDueTime(ctx))
+	if err != nil {
+		return 0, err
+	}
+
+	for i, service := range services {
+		err = addRenewalItems(ctx, qtx, invoiceId, &service, setupFees[i])
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = RecalculateInvoiceAmount(ctx, qtx, invoiceId)
+	if err != nil {
+		return 0, err
+	}
+
+	err = assignInvoiceNumberOnIssue(ctx, qtx, invoiceId)
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Info("create order invoice", "services", serviceIds, "setup fees", setupFees, "user", services[0].UserID, "currency", services[0].Currency, "tax", tax.Name, "tax rate", tax.Rate, "invoice", invoiceId)
+
+	return invoiceId, nil
+}
+
+// CreateConsolidatedRenewalInvoice creates a single renewal invoice for several services, with one item per service.
+// The services must belong to the same user, be charged in the same currency, and must not be UNPAID.
+// Due date is the earliest expiry time of the services.
+//
+// qtx should be a transaction. qtx is not commited.
+func CreateConsolidatedRenewalInvoice(ctx context.Context, qtx *database.Queries, serviceIds []int32) (int32, error) {
+	if len(serviceIds) == 0 {
+		return 0, fmt.Errorf("no services to renew")
+	}
+
+	services := make([]database.Service, 0, len(serviceIds))
+	for _, serviceId := range serviceIds {
+		service, err := lockServiceForRenewal(ctx, qtx, serviceId)
+		if err != nil {
+			return 0, err
+		}
+
+		if service.Status == ServiceUnpaid || !service.ExpiresAt.Valid {
+			return 0, fmt.Errorf("service %d is not due for renewal", serviceId)
+		}
+		if len(services) > 0 && (service.UserID != services[0].UserID || service.Currency != services[0].Currency) {
+			return 0, fmt.Errorf("service %d has a different user or currency", serviceId)
+		}
+
+		services = append(services, service)
+	}
+
+	dueAt := services[0].ExpiresAt.Time
+	for _, service := range services {
+		if service.ExpiresAt.Time.Before(dueAt) {
+			dueAt = service.ExpiresAt.Time
+		}
+	}
+
+	invoiceId, tax, err := createUnpaidInvoice(ctx, qtx, services[0].UserID, services[0].Currency, dueAt)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, service := range services {
+		err = addRenewalItems(ctx, qtx, invoiceId, &service, decimal.Zero)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = RecalculateInvoiceAmount(ctx, qtx, invoiceId)
+	if err != nil {
+		return 0, err
+	}
+
+	err = assignInvoiceNumberOnIssue(ctx, qtx, invoiceId)
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Info("create consolidated renewal invoice", "services", serviceIds, "user", services[0].UserID, "currency", services[0].Currency, "due", dueAt, "tax", tax.Name, "tax rate", tax.Rate, "invoice", invoiceId)
+
+	return invoiceId, nil
+}
+
+// MergeInvoices moves the items of unpaid invoices of the same user into the invoice with the lowest id, and cancels
+// the other invoices. The merged invoice is due at the earliest due date of the invoices. Invoices with payments, or
+// with different currencies or taxes, cannot be merged.
+//
+// qtx should be a transaction. qtx is not commited.
+func MergeInvoices(ctx context.Context, qtx *database.Queries, invoiceIds []int32) (int32, error) {
+	ids := slices.Clone(invoiceIds)
+	slices.Sort(ids)
+	ids = slices.Compact(ids)
+	if len(ids) < 2 {
+		return 0, fmt.Errorf("%w: at least two invoices are required", ErrInvoicesNotMergeable)
+	}
+
+	// invoices are locked in the order of their ids to avoid deadlocks
+	invoices := make([]database.Invoice, 0, len(ids))
+	for _, id := range ids {
+		invoice, err := qtx.SelectInvoiceForUpdate(ctx, id)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return 0, ErrNotFound
+			}
+			return 0, fmt.Errorf("db: %w", err)
+		}
+
+		if invoice.Status != InvoiceUnpaid {
+			return 0, fmt.Errorf("%w: invoice %d is not unpaid", ErrInvoicesNotMergeable, id)
+		}
+
+		paid, err := qtx.TotalInvoicePayment(ctx, id)
+		if err != nil {
+			return 0, fmt.Errorf("db: %w", err)
+		}
+		if !paid.IsZero() {
+			return 0, fmt.Errorf("%w: invoice %d has payments", ErrInvoicesNotMergeable, id)
+		}
+
+		invoices = append(invoices, invoice)
+	}
+
+	target := invoices[0]
+	dueAt := target.DueAt
+	for _, invoice := range invoices[1:] {
+		if invoice.UserID != target.UserID {
+			return 0, fmt.Errorf("%w: invoices belong to different users", ErrInvoicesNotMergeable)
+		}
+		if invoice.Currency != target.Currency {
+			return 0, fmt.Errorf("%w: invoices have different currencies", ErrInvoicesNotMergeable)
+		}
+		if !invoice.TaxRate.Equal(target.TaxRate) || invoice.TaxInclusive != target.TaxInclusive || invoice.ReverseCharge != target.ReverseCharge {
+			return 0, fmt.Errorf("%w: invoices have different taxes", ErrInvoicesNotMergeable)
+		}
+		if invoice.DueAt.Time.Before(dueAt.Time) {
+			dueAt = invoice.DueAt
+		}
+	}
+
+	slog.Info("merge invoices", "invoices", ids, "target", target.ID)
+
+	for _, invoice := range invoices[1:] {
+		err := qtx.MoveInvoiceItems(ctx, database.MoveInvoiceItemsParams{
+			InvoiceID:   target.ID,
+			InvoiceID_2: invoice.ID,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("db: %w", err)
+		}
+
+		err = qtx.UpdateInvoiceCancelled(ctx, database.UpdateInvoiceCancelledParams{
+			CancellationReason: pgtype.Text{Valid: true, String: fmt.Sprintf("merged into invoice %s", InvoiceNumber(&target))},
+			ID:                 invoice.ID,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("db: %w", err)
+		}
+	}
+
+	err := qtx.UpdateInvoiceDueAt(ctx, database.UpdateInvoiceDueAtParams{
+		DueAt: dueAt,
+		ID:    target.ID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("db: %w", err)
+	}
+
+	err = RecalculateInvoiceAmount(ctx, qtx, target.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	return target.ID, nil
+}
+
+// lockServiceForRenewal locks the service row, and checks that the service is not cancelled and has no unpaid invoice.
+func lockServiceForRenewal(ctx context.Context, qtx *database.Queries, serviceId int32) (database.Service, error) {
 	service, err := qtx.FindServiceByIdForUpdate(ctx, serviceId)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return 0, fmt.Errorf("service %d does not exist", serviceId)
+			return service, fmt.Errorf("service %d does not exist", serviceId)
 		}
-		return 0, fmt.Errorf("find service: %w", err)
+		return service, fmt.Errorf("find service: %w", err)
 	}
 
 	// service must not be cancelled
 	if service.Status == ServiceCancelled {
 		slog.Debug("abort create renewal invoice", "err", ErrServiceCancelled, "service", serviceId)
-		return 0, ErrServiceCancelled
+		return service, ErrServiceCancelled
 	}
 
 	// there must not be unpaid invoice for the service
 	existingInvoices, err := qtx.CountUnpaidInvoiceForService(ctx, pgtype.Int4{Valid: true, Int32: serviceId})
 	if err != nil {
-		return 0, fmt.Errorf("count unpaid invoices: %w", err)
+		return service, fmt.Errorf("count unpaid invoices: %w", err)
 	}
 
 	if existingInvoices > 0 {
 		slog.Debug("abort create renewal invoice", "err", ErrUnpaidInvoiceExists, "service", serviceId)
-		return 0, ErrUnpaidInvoiceExists
+		return service, ErrUnpaidInvoiceExists
 	}
 
-	slog.Debug("create renewal invoice pass", "service", serviceId)
-
-	var dueAt time.Time
+	return service, nil
+}
 
-	if service.Status == "UNPAID" {
-		dueAt = time.Now().Add(time.Hour * 24)
-	} else {
-		if service.ExpiresAt.Valid {
-			dueAt = service.ExpiresAt.Time
-		} else {
-			return 0, fmt.Errorf("service %d has no expiry time", serviceId)
-		}
+// createUnpaidInvoice creates an empty UNPAID invoice for the user. Tax is determined when the invoice is created.
+// The amount of the invoice should be updated by RecalculateInvoiceAmount after items are added.
+func createUnpaidInvoice(ctx context.Context, qtx *database.Queries, userId int32, currency string, dueAt time.Time) (int32, Tax, error) {
+	user, err := qtx.FindUserById(ctx, userId)
+	if err != nil {
+		return 0, Tax{}, fmt.Errorf("find user: %w", err)
+	}
+	tax, err := FindTax(ctx, qtx, &user)
+	if err != nil {
+		return 0, Tax{}, err
 	}
 
-	// create the invoice
 	invoiceId, err := qtx.CreateInvoice(ctx, database.CreateInvoiceParams{
-		UserID:             service.UserID,
+		UserID:             userId,
 		Status:             InvoiceUnpaid,
 		CancellationReason: pgtype.Text{Valid: false},
 		PaidAt:             types.Timestamp{Timestamp: pgtype.Timestamp{Valid: false}},
 		DueAt:              types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: dueAt}},
-		Amount:             decimal.Sum(service.Price, setupFee),
+		Amount:             decimal.Zero,
+		Currency:           currency,
+		TaxRate:            tax.Rate,
+		TaxName:            tax.Name,
+		TaxInclusive:       tax.Inclusive,
+		ReverseCharge:      tax.ReverseCharge,
 	})
 	if err != nil {
-		return 0, fmt.Errorf("create invoice: %w", err)
+		return 0, Tax{}, fmt.Errorf("create invoice: %w", err)
 	}
 
-	// create invoice items
+	return invoiceId, tax, nil
+}
+
+// addRenewalItems adds the renewal of the service for one billing cycle to the invoice, together with the recurring
+// discount of the service and the setup fee.
+func addRenewalItems(ctx context.Context, qtx *database.Queries, invoiceId int32, service *database.Service, setupFee decimal.Decimal) error {
 	description := fmt.Sprintf(
 		"#%d - %s (%s - %s)",
-		serviceId,
+		service.ID,
 		service.Label,
 		service.ExpiresAt.Time.Format("2006-01-02 MST"),
-		service.ExpiresAt.Time.Add(time.Duration(service.BillingCycle)*time.Second).Format("2006-01-02 MST"),
+		ServiceBillingCycle(service).Next(service.ExpiresAt.Time).Format("2006-01-02 MST"),
 	)
-	err = qtx.CreateInvoiceItem(ctx, database.CreateInvoiceItemParams{
+	err := qtx.CreateInvoiceItem(ctx, database.CreateInvoiceItemParams{
 		InvoiceID:   invoiceId,
 		Description: description,
 		Amount:      service.Price,
 		Type:        InvoiceItemService,
-		ItemID:      pgtype.Int4{Valid: true, Int32: serviceId},
+		ItemID:      pgtype.Int4{Valid: true, Int32: service.ID},
 	})
 	if err != nil {
-		return 0, fmt.Errorf("create invoice item: %w", err)
+		return fmt.Errorf("create invoice item: %w", err)
+	}
+
+	// recurring discount of the service, e.g. from a coupon
+	if discount := ServiceDiscount(service); discount.GreaterThan(decimal.Zero) {
+		err = qtx.CreateInvoiceItem(ctx, database.CreateInvoiceItemParams{
+			InvoiceID:   invoiceId,
+			Description: fmt.Sprintf("#%d - %s - Discount", service.ID, service.Label),
+			Amount:      discount.Neg(),
+			Type:        InvoiceItemDiscount,
+			ItemID:      pgtype.Int4{Valid: true, Int32: service.ID},
+		})
+		if err != nil {
+			return fmt.Errorf("create invoice item: %w", err)
+		}
 	}
 
 	// create invoice item for setup fee
 	if setupFee.GreaterThan(decimal.Zero) {
 		err = qtx.CreateInvoiceItem(ctx, database.CreateInvoiceItemParams{
 			InvoiceID:   invoiceId,
-			Description: fmt.Sprintf("#%d - %s - Setup Fee", serviceId, service.Label),
+			Description: fmt.Sprintf("#%d - %s - Setup Fee", service.ID, service.Label),
 			Amount:      setupFee,
 			Type:        InvoiceItemNone,
 			ItemID:      pgtype.Int4{Valid: false},
 		})
 		if err != nil {
-			return 0, fmt.Errorf("create invoice item: %w", err)
+			return fmt.Errorf("create invoice item: %w", err)
 		}
 	}
 
-	slog.Info("create renewal invoice", "service", serviceId, "setup fee", setupFee, "service price", service.Price, "user", service.UserID, "label", service.Label, "service status", service.Status, "service expire", service.ExpiresAt.Time, "service billing cycle", service.BillingCycle)
-
-	return invoiceId, nil
+	// usage of metered resources in the billing periods that have ended
+	return addUsageItems(ctx, qtx, invoiceId, service)
 }
 
 // InvoiceAddPayment adds payment to invoice. The invoice is marked as PAID if total payment exceeds invoice amount.
+// Any amount paid in excess of the invoice amount is added to the user's credit balance.
+//
+// Payments are unique by gateway and referenceId (unless referenceId is empty). ErrPaymentAlreadyRecorded is
+// returned if the payment has been recorded before, e.g. when a webhook is delivered more than once.
 func InvoiceAddPayment(ctx context.Context, invoiceId int32, description string, amount decimal.Decimal, referenceId string, gateway string) error {
+	tx, err := database.Conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	paid, err := InvoiceAddPaymentTx(ctx, database.Q.WithTx(tx), invoiceId, description, amount, referenceId, gateway)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+
+	if paid {
+		OnInvoicePaid(invoiceId)
+	}
+
+	return nil
+}
+
+// InvoiceAddPaymentTx is the same as InvoiceAddPayment, but runs in the transaction qtx, in which the invoice row is locked.
+// It returns true if the invoice is marked as PAID, in which case the caller should call
+// OnInvoicePaid after the transaction is commited.
+//
+// qtx should be a transaction. qtx is not commited.
+func InvoiceAddPaymentTx(ctx context.Context, qtx *database.Queries, invoiceId int32, description string, amount decimal.Decimal, referenceId string, gateway string) (bool, error) {
 	slog.Info("add payment", "invoice_id", invoiceId, "description", description, "amount", amount, "reference_id", referenceId, "gateway", gateway)
 
-	invoice, err := database.Q.FindInvoiceById(ctx, invoiceId)
+	// lock the invoice, so that concurrent payments don't both mark it as PAID or miss each other in the total
+	invoice, err := qtx.SelectInvoiceForUpdate(ctx, invoiceId)
 	if err != nil {
-		return fmt.Errorf("db: %w", err)
+		return false, fmt.Errorf("db: %w", err)
 	}
 
 	invoiceAmount := invoice.Amount
 
-	_, err = database.Q.AddInvoicePayment(ctx, database.AddInvoicePaymentParams{
+	paymentId, err := qtx.AddInvoicePayment(ctx, database.AddInvoicePaymentParams{
 		InvoiceID:   invoiceId,
 		Description: description,
 		Amount:      amount,
@@ -180,32 +500,114 @@ func InvoiceAddPayment(ctx context.Context, invoiceId int32, description string,
 		Gateway:     gateway,
 	})
 	if err != nil {
-		return fmt.Errorf("db: %w", err)
+		if errors.Is(err, pgx.ErrNoRows) {
+			slog.Info("payment already recorded", "invoice_id", invoiceId, "reference_id", referenceId, "gateway", gateway)
+			return false, ErrPaymentAlreadyRecorded
+		}
+		return false, fmt.Errorf("db: %w", err)
 	}
 
-	totalPayment, err := database.Q.TotalInvoicePayment(ctx, invoiceId)
+	totalPayment, err := qtx.TotalInvoicePayment(ctx, invoiceId)
 	if err != nil {
-		return fmt.Errorf("db: %w", err)
+		return false, fmt.Errorf("db: %w", err)
 	}
 
-	// mark the invoice is PAID if the invoice is UNPAID and not overdue
-	if totalPayment.GreaterThanOrEqual(invoiceAmount) && invoice.Status == "UNPAID" && invoice.DueAt.Time.After(time.Now()) {
-		err := database.Q.UpdateInvoicePaid(ctx, invoiceId)
+	paid := false
+	overpayment := decimal.Zero
+
+	// mark the invoice is PAID if the invoice is UNPAID. Overdue invoices remain payable until they are cancelled,
+	// see CloseOverdueInvoices and ProcessOverdueServices.
+	if totalPayment.GreaterThanOrEqual(invoiceAmount) && invoice.Status == "UNPAID" {
+		err := qtx.UpdateInvoicePaid(ctx, invoiceId)
 		if err != nil {
-			return fmt.Errorf("db: %w", err)
+			return false, fmt.Errorf("db: %w", err)
 		}
 		slog.Info("updated invoice paid", "invoice_id", invoiceId, "amount", amount.String(), "total_payment", totalPayment.String())
 
-		OnInvoicePaid(invoiceId)
+		err = AssignInvoiceNumber(ctx, qtx, invoiceId)
+		if err != nil {
+			return false, err
+		}
+
+		paid = true
+
+		// the gateway fee paid on top of the outstanding amount is not an overpayment
+		expected := invoiceAmount
+		g, err := qtx.FindGatewayByName(ctx, gateway)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return false, fmt.Errorf("db: %w", err)
+		}
+		if err == nil && g.Fee.Valid {
+			paidBefore := totalPayment.Sub(amount)
+			expected, err = GatewayTotal(ctx, invoiceAmount.Sub(paidBefore), g.Fee.String, invoice.Currency)
+			if err != nil {
+				return false, err
+			}
+			expected = expected.Add(paidBefore)
+		}
+		overpayment = totalPayment.Sub(expected)
+	} else if invoice.Status != InvoiceUnpaid {
+		// the invoice has been paid or cancelled already, so the whole payment is surplus
+		overpayment = amount
 	}
 
-	return nil
+	// carry the overpayment over to the user's credit balance, which is in the default currency
+	if overpayment.GreaterThan(decimal.Zero) {
+		credit, err := ConvertCurrency(ctx, overpayment, invoice.Currency, DefaultCurrency(ctx))
+		if err != nil {
+			// the payment must still be recorded, the overpayment can be credited manually
+			slog.Error("convert overpayment", "err", err, "invoice_id", invoiceId, "overpayment", overpayment, "currency", invoice.Currency)
+			return paid, nil
+		}
+
+		_, err = AddCredit(ctx, qtx, invoice.UserID, credit, CreditOverpayment, fmt.Sprintf("Overpayment of invoice #%d (%s %s)", invoiceId, overpayment.StringFixed(2), invoice.Currency), pgtype.Int4{Valid: true, Int32: invoiceId})
+		if err != nil {
+			return false, err
+		}
+
+		// the overpayment is part of this payment, and is no longer refundable through the gateway once credited
+		err = qtx.UpdateInvoicePaymentCredited(ctx, database.UpdateInvoicePaymentCreditedParams{
+			Credited: overpayment,
+			ID:       paymentId,
+		})
+		if err != nil {
+			return false, fmt.Errorf("db: %w", err)
+		}
+	}
+
+	return paid, nil
+}
+
+// GatewayTotal returns the amount in currency to be paid through a gateway, including the gateway fee.
+// fee is either a fixed amount in the default currency (e.g. "0.30"), which is converted to currency, or a
+// percentage of amount (e.g. "2.9%"). The total is rounded up to the decimal places of currency.
+func GatewayTotal(ctx context.Context, amount decimal.Decimal, fee string, currency string) (decimal.Decimal, error) {
+	percentage := strings.HasSuffix(fee, "%")
+	f, err := decimal.NewFromString(strings.TrimSuffix(fee, "%"))
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("invalid gateway fee \"%s\": %w", fee, err)
+	}
+
+	total := amount
+	if !percentage {
+		f, err = ConvertCurrency(ctx, f, DefaultCurrency(ctx), currency)
+		if err != nil {
+			return decimal.Zero, fmt.Errorf("convert gateway fee: %w", err)
+		}
+		total = total.Add(f)
+	} else {
+		total = total.Add(total.Mul(f.Div(decimal.NewFromInt(100))))
+	}
+	return total.RoundUp(CurrencyDecimals(currency)), nil
 }
 
 // OnInvoicePaid does the following things to services in the invoice:
 // - extend expiry date by billing cycle
 // - mark the service as PENDING if the service is previously UNPAID
 // - call the extension's create action if the service is previously UNPAID
+// - unsuspend the service if it was suspended because of the overdue invoice
+//
+// All changes are made in one transaction, the services are provisioned and unsuspended after it is commited.
 func OnInvoicePaid(invoiceId int32) {
 	slog.Info("on invoice paid", "invoice_id", invoiceId)
 
@@ -218,7 +620,9 @@ func OnInvoicePaid(invoiceId int32) {
 	}
 	defer tx.Rollback(ctx)
 
-	invoice, err := database.Q.SelectInvoiceForUpdate(ctx, invoiceId)
+	qtx := database.Q.WithTx(tx)
+
+	invoice, err := qtx.SelectInvoiceForUpdate(ctx, invoiceId)
 	if err != nil {
 		slog.Error("on invoice paid", "err", err)
 		return
@@ -228,19 +632,31 @@ func OnInvoicePaid(invoiceId int32) {
 		return
 	}
 
-	items, err := database.Q.ListInvoiceItems(ctx, invoiceId)
+	items, err := qtx.ListInvoiceItems(ctx, invoiceId)
 	if err != nil {
 		slog.Error("on invoice paid", "err", err)
 		return
 	}
 
+	var unsuspend, provision []database.Service
+
 	for _, item := range items {
+		if item.Type == InvoiceItemUpgrade && item.ItemID.Valid {
+			slog.Info("on invoice paid", "invoice_id", invoiceId, "upgrade_id", item.ItemID.Int32, "description", item.Description)
+
+			err = ApplyServiceUpgrade(ctx, tx, item.ItemID.Int32)
+			if err != nil {
+				slog.Error("on invoice paid", "err", err)
+			}
+			continue
+		}
+
 		if item.Type == InvoiceItemService && item.ItemID.Valid {
 
 			itemId := item.ItemID.Int32
 			slog.Info("on invoice paid", "invoice_id", invoiceId, "service_id", itemId, "description", item.Description)
 
-			s, err := database.Q.FindServiceById(ctx, itemId)
+			s, err := qtx.FindServiceById(ctx, itemId)
 			if err != nil {
 				slog.Error("on invoice paid", "err", err)
 				continue
@@ -250,11 +666,31 @@ func OnInvoicePaid(invoiceId int32) {
 				continue
 			}
 
+			// new orders are screened before their paid period starts, orders held for review are extended when
+			// they are approved
+			if s.Status == ServiceUnpaid {
+				held, err := ScreenOrder(ctx, qtx, &s)
+				if err != nil {
+					slog.Error("screen order", "err", err, "service_id", itemId)
+
+					// the service is paid, it is held for a manual review instead of being left UNPAID
+					err = HoldService(ctx, qtx, itemId, "screening failed")
+					if err != nil {
+						slog.Error("hold service", "err", err, "service_id", itemId)
+						continue
+					}
+					held = true
+				}
+				if held {
+					continue
+				}
+			}
+
 			// extend expiry time when invoice is paid
-			slog.Info("extend service expiry time", "service_id", itemId, "expires_at", s.ExpiresAt, "billing_cycle", s.BillingCycle)
+			slog.Info("extend service expiry time", "service_id", itemId, "expires_at", s.ExpiresAt, "billing_cycle", s.BillingCycle, "billing_cycle_months", s.BillingCycleMonths)
 
-			expiryTime := s.ExpiresAt.Time.Add(time.Duration(s.BillingCycle) * time.Second)
-			err = database.Q.UpdateServiceExpiryTime(ctx, database.UpdateServiceExpiryTimeParams{
+			expiryTime := ServiceBillingCycle(&s).Next(s.ExpiresAt.Time)
+			err = qtx.UpdateServiceExpiryTime(ctx, database.UpdateServiceExpiryTimeParams{
 				ID:        itemId,
 				ExpiresAt: types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: expiryTime}},
 			})
@@ -263,10 +699,15 @@ func OnInvoicePaid(invoiceId int32) {
 				continue
 			}
 
+			// unsuspend the service if it was suspended for not paying this invoice
+			if s.Status == ServiceSuspended && s.SuspensionReason.String == SuspensionReasonOverdue && expiryTime.After(time.Now()) {
+				unsuspend = append(unsuspend, s)
+			}
+
 			// change status to PENDING
 			if s.Status == ServiceUnpaid {
 				slog.Info("service pending", "service_id", itemId)
-				err = database.Q.UpdateServiceStatus(ctx, database.UpdateServiceStatusParams{
+				err = qtx.UpdateServiceStatus(ctx, database.UpdateServiceStatusParams{
 					Status: ServicePending,
 					ID:     itemId,
 				})
@@ -275,41 +716,60 @@ func OnInvoicePaid(invoiceId int32) {
 					continue
 				}
 
-				// create service
-				ext, ok := extension.Extensions[s.Extension]
-				if !ok {
-					slog.Error("invalid extension", "service id", itemId, "extension", s.Extension)
-					continue
-				}
-
-				actions, err := ext.AdminActions(itemId)
-				if err != nil {
-					slog.Error("extension admin actions", "err", err, "service_id", itemId, "extension", s.Extension)
-					continue
-				}
-
-				if !slices.Contains(actions, "create") {
-					continue
-				}
-
-				slog.Info("create service", "service_id", itemId)
-
-				err = extension.DoActionAsync(ctx, s.Extension, itemId, "create", ServiceActive)
-				if err != nil {
-					slog.Error("do action async", "err", err)
-				}
+				provision = append(provision, s)
 			}
 
 		}
 	}
 
+	// commissions are accrued in a savepoint, so that a failure does not undo the changes to the services
+	err = accrueCommissionsInSavepoint(ctx, tx, &invoice)
+	if err != nil {
+		slog.Error("accrue commissions", "err", err, "invoice_id", invoiceId)
+	}
+
 	err = tx.Commit(ctx)
 	if err != nil {
 		slog.Error("commit tx", "err", err)
 		return
 	}
+
+	for _, s := range unsuspend {
+		err = unsuspendPaidService(ctx, &s)
+		if err != nil {
+			slog.Error("unsuspend paid service", "err", err, "service_id", s.ID)
+		}
+	}
+
+	// create services
+	for _, s := range provision {
+		err = ProvisionService(ctx, &s)
+		if err != nil {
+			slog.Error("provision service", "err", err, "service_id", s.ID, "extension", s.Extension)
+		}
+	}
+}
+
+// accrueCommissionsInSavepoint runs AccrueCommissions in a savepoint of tx. The savepoint is rolled back if it fails,
+// tx can still be commited.
+func accrueCommissionsInSavepoint(ctx context.Context, tx pgx.Tx, invoice *database.Invoice) error {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("savepoint: %w", err)
+	}
+	defer sp.Rollback(ctx)
+
+	err = AccrueCommissions(ctx, database.Q.WithTx(sp), invoice)
+	if err != nil {
+		return err
+	}
+
+	return sp.Commit(ctx)
 }
 
+// CloseOverdueInvoices cancels overdue invoices, and cancels the UNPAID services in them.
+// Renewal invoices of services that are not cancelled are skipped, they remain payable until the service is
+// terminated by ProcessOverdueServices.
 func CloseOverdueInvoices() error {
 	ctx := context.Background()
 	invoices, err := database.Q.FindOverdueInvoices(ctx)
@@ -318,10 +778,39 @@ func CloseOverdueInvoices() error {
 	}
 
 	for _, invoice := range invoices {
+		items, err := database.Q.ListInvoiceItems(ctx, invoice.ID)
+		if err != nil {
+			return fmt.Errorf("db: %w", err)
+		}
+
+		unpaidServices := make([]int32, 0)
+		renewal := false
+		for _, item := range items {
+			if item.Type != InvoiceItemService || !item.ItemID.Valid {
+				continue
+			}
+
+			service, err := database.Q.FindServiceById(ctx, item.ItemID.Int32)
+			if err != nil {
+				return fmt.Errorf("db: %w", err)
+			}
+
+			switch service.Status {
+			case ServiceUnpaid:
+				unpaidServices = append(unpaidServices, service.ID)
+			case ServiceActive, ServiceSuspended, ServicePending:
+				renewal = true
+			}
+		}
+
+		if renewal {
+			continue
+		}
+
 		slog.Info("cancel overdue invoice", "id", invoice.ID)
 
 		// cancel the invoice
-		err := database.Q.UpdateInvoiceCancelled(ctx, database.UpdateInvoiceCancelledParams{
+		err = database.Q.UpdateInvoiceCancelled(ctx, database.UpdateInvoiceCancelledParams{
 			CancellationReason: pgtype.Text{Valid: true, String: "overdue"},
 			ID:                 invoice.ID,
 		})
@@ -329,37 +818,19 @@ func CloseOverdueInvoices() error {
 			return fmt.Errorf("db: %w", err)
 		}
 
-		// cancel the service if the service is unpaid
-		items, err := database.Q.ListInvoiceItems(ctx, invoice.ID)
-		if err != nil {
-			return fmt.Errorf("db: %w", err)
-		}
-
-		for _, item := range items {
-			if item.Type == InvoiceItemService && item.ItemID.Valid {
-
-				service, err := database.Q.FindServiceById(ctx, item.ItemID.Int32)
-				if err != nil {
-					return fmt.Errorf("db: %w", err)
-				}
+		// cancel the services that are unpaid
+		for _, serviceId := range unpaidServices {
+			slog.Info("cancel overdue unpaid service", "id", serviceId, "invoice id", invoice.ID)
 
-				if service.Status != ServiceUnpaid {
-					continue
-				}
-
-				slog.Info("cancel overdue unpaid service", "id", item.ID, "invoice id", invoice.ID)
-
-				err = database.Q.UpdateServiceCancelled(ctx, database.UpdateServiceCancelledParams{
-					CancellationReason: pgtype.Text{Valid: true, String: "invoice overdue"},
-					ID:                 item.ItemID.Int32,
-					CancelledAt:        types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: time.Now()}},
-				})
-				if err != nil {
-					return fmt.Errorf("db: %w", err)
-				}
+			err = database.Q.UpdateServiceCancelled(ctx, database.UpdateServiceCancelledParams{
+				CancellationReason: pgtype.Text{Valid: true, String: "invoice overdue"},
+				ID:                 serviceId,
+				CancelledAt:        types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: time.Now()}},
+			})
+			if err != nil {
+				return fmt.Errorf("db: %w", err)
 			}
 		}
-
 	}
 
 	return nil
@@ -368,38 +839,98 @@ func CloseOverdueInvoices() error {
 // GenerateRenewalInvoices generates renewal invoices for all services that are due for renewal.
 // Due for renewal includes that fowllowing conditions:
 // - service status is ACTIVE or SUSPENDED or PENDING
-// - current time < service expiry date <= current time + 7 days
+// - current time < service expiry date <= current time + invoice days before expiry of the lifecycle policy
 // - there is no existing unpaid invoice for the service
+//
+// If SettingInvoiceConsolidation is enabled, services of the same user and currency that expire within
+// SettingInvoiceConsolidationWindowDays of each other are renewed in a single invoice.
+//
+// If SettingCreditAutoApply is enabled, the user's credit balance is applied to the new invoices.
 func GenerateRenewalInvoices() error {
 	ctx := context.Background()
 
-	services, err := database.Q.FindServicesForRenewal(ctx)
+	services, err := database.Q.FindServicesForRenewal(ctx, int32(DefaultLifecyclePolicy(ctx).InvoiceDaysBeforeExpiry))
 	if err != nil {
 		return fmt.Errorf("find services for renewal: %w", err)
 	}
 
-	for _, service := range services {
-		slog.Info("generating renewal invoice", "service_id", service.ID)
+	var groups [][]int32
+	if SettingInvoiceConsolidation.Get(ctx) == "true" {
+		groups = groupServicesForRenewal(services, time.Duration(intSetting(ctx, SettingInvoiceConsolidationWindowDays))*24*time.Hour)
+	} else {
+		for _, service := range services {
+			groups = append(groups, []int32{service.ID})
+		}
+	}
+
+	for _, serviceIds := range groups {
+		slog.Info("generating renewal invoice", "service_ids", serviceIds)
 
 		tx, err := database.Conn.Begin(ctx)
 		if err != nil {
-			slog.Error("begin tx", "err", err, "service_id", service.ID)
+			slog.Error("begin tx", "err", err, "service_ids", serviceIds)
 			continue
 		}
 
 		qtx := database.Q.WithTx(tx)
 
-		_, err = CreateRenewalInvoice(ctx, qtx, service.ID, decimal.Zero)
+		var invoiceId int32
+		if len(serviceIds) == 1 {
+			invoiceId, err = CreateRenewalInvoice(ctx, qtx, serviceIds[0], decimal.Zero)
+		} else {
+			invoiceId, err = CreateConsolidatedRenewalInvoice(ctx, qtx, serviceIds)
+		}
 		if err != nil {
-			slog.Error("create renewal invoice", "err", err, "service_id", service.ID)
+			slog.Error("create renewal invoice", "err", err, "service_ids", serviceIds)
+			tx.Rollback(ctx)
+			continue
+		}
+
+		// pay the invoice with the user's credit balance
+		paid, err := AutoApplyCredit(ctx, qtx, invoiceId)
+		if err != nil {
+			slog.Error("apply credit to invoice", "err", err, "service_ids", serviceIds, "invoice_id", invoiceId)
 			tx.Rollback(ctx)
 			continue
 		}
 
 		if err := tx.Commit(ctx); err != nil {
-			slog.Error("commit tx", "err", err, "service_id", service.ID)
+			slog.Error("commit tx", "err", err, "service_ids", serviceIds)
+			continue
+		}
+
+		if paid {
+			OnInvoicePaid(invoiceId)
 		}
 	}
 
 	return nil
 }
+
+// groupServicesForRenewal groups services of the same user and currency whose expiry times are within window
+// of the earliest expiry time in the group.
+func groupServicesForRenewal(services []database.Service, window time.Duration) [][]int32 {
+	sorted := slices.Clone(services)
+	slices.SortFunc(sorted, func(a, b database.Service) int {
+		if a.UserID != b.UserID {
+			return cmp.Compare(a.UserID, b.UserID)
+		}
+		if a.Currency != b.Currency {
+			return strings.Compare(a.Currency, b.Currency)
+		}
+		return a.ExpiresAt.Time.Compare(b.ExpiresAt.Time)
+	})
+
+	groups := make([][]int32, 0)
+	var first *database.Service
+	for i := range sorted {
+		s := &sorted[i]
+		if first == nil || s.UserID != first.UserID || s.Currency != first.Currency || s.ExpiresAt.Time.Sub(first.ExpiresAt.Time) > window {
+			groups = append(groups, []int32{})
+			first = s
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], s.ID)
+	}
+
+	return groups
+}
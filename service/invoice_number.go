@@ -0,0 +1,116 @@
+package service
+
+import (
+	"billing3/database"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+const (
+	InvoiceNumberOnPaid  = "paid"
+	InvoiceNumberOnIssue = "issue"
+)
+
+// AssignInvoiceNumber assigns the next sequential invoice number to the invoice, unless it already has one.
+// Numbers are taken from a counter row that stays locked until qtx is committed, so numbers are gap-free:
+// if the transaction is rolled back, the number is given to the next invoice.
+//
+// qtx should be a transaction. qtx is not commited.
+func AssignInvoiceNumber(ctx context.Context, qtx *database.Queries, invoiceId int32) error {
+	invoice, err := qtx.SelectInvoiceForUpdate(ctx, invoiceId)
+	if err != nil {
+		return fmt.Errorf("find invoice: %w", err)
+	}
+	if invoice.Number != "" {
+		return nil
+	}
+
+	number, err := nextDocumentNumber(ctx, SettingInvoiceNumberPrefix.Get(ctx), qtx.NextInvoiceNumber)
+	if err != nil {
+		return fmt.Errorf("next invoice number: %w", err)
+	}
+
+	err = qtx.UpdateInvoiceNumber(ctx, database.UpdateInvoiceNumberParams{
+		Number: number,
+		ID:     invoiceId,
+	})
+	if err != nil {
+		return fmt.Errorf("update invoice number: %w", err)
+	}
+
+	slog.Info("assign invoice number", "invoice_id", invoiceId, "number", number)
+
+	return nil
+}
+
+// nextDocumentNumber formats the next number of a numbered document such as an invoice, e.g. INV-2026-000123.
+// next increments the counter of the numbering period and returns its new value.
+func nextDocumentNumber(ctx context.Context, prefix string, next func(ctx context.Context, period int32) (int32, error)) (string, error) {
+	now := time.Now().UTC()
+	yearlyReset := SettingInvoiceNumberYearlyReset.Get(ctx) == "true"
+
+	var period int32
+	if yearlyReset {
+		period = int32(now.Year())
+	}
+
+	seq, err := next(ctx, period)
+	if err != nil {
+		return "", err
+	}
+
+	padding, err := strconv.Atoi(SettingInvoiceNumberPadding.Get(ctx))
+	if err != nil {
+		padding = 0
+	}
+
+	number := prefix
+	if yearlyReset {
+		number += strconv.Itoa(now.Year()) + "-"
+	}
+	number += fmt.Sprintf("%0*d", padding, seq)
+
+	return number, nil
+}
+
+// assignInvoiceNumberOnIssue assigns the invoice number to a newly created invoice, if numbers are assigned at issue.
+func assignInvoiceNumberOnIssue(ctx context.Context, qtx *database.Queries, invoiceId int32) error {
+	if SettingInvoiceNumberAssign.Get(ctx) != InvoiceNumberOnIssue {
+		return nil
+	}
+	return AssignInvoiceNumber(ctx, qtx, invoiceId)
+}
+
+// InvoiceNumber returns the number of the invoice for display, which is the id if it has no number yet.
+func InvoiceNumber(invoice *database.Invoice) string {
+	if invoice.Number != "" {
+		return invoice.Number
+	}
+	return "#" + strconv.Itoa(int(invoice.ID))
+}
+
+func validateBool(value string) error {
+	if value != "true" && value != "false" {
+		return errors.New("must be true or false")
+	}
+	return nil
+}
+
+func validateInvoiceNumberPadding(value string) error {
+	padding, err := strconv.Atoi(value)
+	if err != nil || padding < 0 || padding > 20 {
+		return errors.New("must be a number between 0 and 20")
+	}
+	return nil
+}
+
+func validateInvoiceNumberAssign(value string) error {
+	if value != InvoiceNumberOnPaid && value != InvoiceNumberOnIssue {
+		return fmt.Errorf("must be \"%s\" or \"%s\"", InvoiceNumberOnPaid, InvoiceNumberOnIssue)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"billing3/database"
+	"billing3/database/types"
+	"billing3/service/pdf"
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+// DefaultInvoiceTemplate is the default value of SettingInvoiceTemplate. The template is a text/template that
+// produces the markup described in pdf.Render, and is executed with an InvoiceDocument.
+const DefaultInvoiceTemplate = `# {{if .Company.Name}}{{.Company.Name}}{{else}}{{.SiteName}}{{end}}
+{{range lines .Company.Address}}> {{.}}
+{{end}}{{if .Company.VatID}}> VAT ID: {{.Company.VatID}}
+{{end}}{{if .Company.Email}}> {{.Company.Email}}
+{{end}}
+## Invoice {{invoiceNumber .Invoice}}
+Status: {{.Invoice.Status}}
+Invoice date: {{date .Invoice.CreatedAt}}
+Due date: {{date .Invoice.DueAt}}
+{{if .Invoice.PaidAt.Valid}}Paid on: {{date .Invoice.PaidAt}}
+{{end}}
+## Bill To
+{{.User.Name}}
+{{if .User.Address.Valid}}{{.User.Address.String}}
+{{end}}{{if or .User.City.Valid .User.State.Valid .User.ZipCode.Valid}}{{.User.City.String}} {{.User.State.String}} {{.User.ZipCode.String}}
+{{end}}{{if .User.Country.Valid}}{{.User.Country.String}}
+{{end}}{{if .User.VatID}}VAT ID: {{.User.VatID}}
+{{end}}{{.User.Email}}
+
+**Description | Amount ({{.Invoice.Currency}})
+---
+{{range .Items}}{{.Description}} | {{money .Amount}}
+{{end}}---
+Subtotal | {{money .Invoice.Subtotal}}
+{{if .Invoice.TaxName}}{{.Invoice.TaxName}} {{.Invoice.TaxRate}}%{{if .Invoice.TaxInclusive}} (included){{end}} | {{money .Invoice.Tax}}
+{{end}}**Total | {{money .Invoice.Amount}} {{.Invoice.Currency}}
+{{if .Invoice.ReverseCharge}}
+Reverse charge: VAT to be accounted for by the recipient.
+{{end}}{{if .Payments}}
+## Payments
+**Date | Gateway | Reference | Amount
+---
+{{range .Payments}}{{date .CreatedAt}} | {{.Gateway}} | {{.ReferenceID}} | {{money .Amount}}
+{{end}}{{end}}`
+
+// InvoiceDocument is the data used to render invoice PDFs.
+type InvoiceDocument struct {
+	SiteName string
+	Company  Company
+	Invoice  database.Invoice
+	Items    []database.InvoiceItem
+	Payments []database.InvoicePayment
+	User     TemplateUser
+}
+
+// TemplateUser is the contact and billing details of a user available to templates. Templates are edited by admins
+// and must not see other fields of database.User, such as the password hash.
+type TemplateUser struct {
+	Name    string
+	Email   string
+	Address pgtype.Text
+	City    pgtype.Text
+	State   pgtype.Text
+	ZipCode pgtype.Text
+	Country pgtype.Text
+	VatID   string
+}
+
+// NewTemplateUser returns the fields of user available to templates.
+func NewTemplateUser(user *database.User) TemplateUser {
+	return TemplateUser{
+		Name:    user.Name,
+		Email:   user.Email,
+		Address: user.Address,
+		City:    user.City,
+		State:   user.State,
+		ZipCode: user.ZipCode,
+		Country: user.Country,
+		VatID:   user.VatID,
+	}
+}
+
+// Company is the company issuing invoices.
+type Company struct {
+	Name    string
+	Address string
+	VatID   string
+	Email   string
+}
+
+var invoiceTemplateFuncs = template.FuncMap{
+	"date": func(t types.Timestamp) string {
+		if !t.Valid {
+			return ""
+		}
+		return t.Time.Format("2006-01-02")
+	},
+	"money": func(d decimal.Decimal) string {
+		return d.StringFixed(2)
+	},
+	"invoiceNumber": func(invoice database.Invoice) string {
+		return InvoiceNumber(&invoice)
+	},
+	"lines": func(s string) []string {
+		var lines []string
+		for _, line := range strings.Split(s, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		return lines
+	},
+}
+
+func parseInvoiceTemplate(text string) (*template.Template, error) {
+	return template.New("invoice").Funcs(invoiceTemplateFuncs).Parse(text)
+}
+
+func validateInvoiceTemplate(value string) error {
+	_, err := parseInvoiceTemplate(value)
+	if err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	return nil
+}
+
+// RenderInvoicePDF renders the invoice with SettingInvoiceTemplate and returns the PDF file.
+func RenderInvoicePDF(ctx context.Context, invoiceId int32) ([]byte, error) {
+	invoice, err := database.Q.FindInvoiceById(ctx, invoiceId)
+	if err != nil {
+		return nil, fmt.Errorf("find invoice: %w", err)
+	}
+
+	items, err := database.Q.ListInvoiceItems(ctx, invoiceId)
+	if err != nil {
+		return nil, fmt.Errorf("list invoice items: %w", err)
+	}
+
+	payments, err := database.Q.ListInvoicePayments(ctx, invoiceId)
+	if err != nil {
+		return nil, fmt.Errorf("list invoice payments: %w", err)
+	}
+
+	user, err := database.Q.FindUserById(ctx, invoice.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("find user: %w", err)
+	}
+
+	doc := InvoiceDocument{
+		SiteName: SettingSiteName.Get(ctx),
+		Company: Company{
+			Name:    SettingCompanyName.Get(ctx),
+			Address: SettingCompanyAddress.Get(ctx),
+			VatID:   SettingCompanyVatID.Get(ctx),
+			Email:   SettingCompanyEmail.Get(ctx),
+		},
+		Invoice:  invoice,
+		Items:    items,
+		Payments: payments,
+		User:     NewTemplateUser(&user),
+	}
+
+	tmpl, err := parseInvoiceTemplate(SettingInvoiceTemplate.Get(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("parse invoice template: %w", err)
+	}
+
+	var markup bytes.Buffer
+	err = tmpl.Execute(&markup, doc)
+	if err != nil {
+		return nil, fmt.Errorf("execute invoice template: %w", err)
+	}
+
+	var buf bytes.Buffer
+	_, err = pdf.Render(markup.String()).WriteTo(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("write pdf: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
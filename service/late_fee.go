@@ -0,0 +1,132 @@
+package service
+
+import (
+	"billing3/database"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+const InvoiceItemLateFee = "late_fee"
+
+// ApplyLateFees adds a late fee to unpaid renewal invoices that are overdue by more than the grace period of
+// SettingLateFeeGraceDays. The late fee is added at most once per invoice. Users that are exempt from late fees
+// are skipped. Invoices of new orders are not renewal invoices, as their services are still UNPAID or PENDING.
+func ApplyLateFees() error {
+	ctx := context.Background()
+
+	fee := SettingLateFee.Get(ctx)
+	if fee == "" {
+		return nil
+	}
+
+	invoices, err := database.Q.FindInvoicesForLateFee(ctx, int32(intSetting(ctx, SettingLateFeeGraceDays)))
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+
+	for _, invoice := range invoices {
+		tx, err := database.Conn.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("begin tx: %w", err)
+		}
+
+		err = addLateFee(ctx, database.Q.WithTx(tx), invoice.ID, fee)
+		if err != nil {
+			slog.Error("add late fee", "err", err, "invoice_id", invoice.ID)
+			tx.Rollback(ctx)
+			continue
+		}
+
+		err = tx.Commit(ctx)
+		if err != nil {
+			slog.Error("commit tx", "err", err, "invoice_id", invoice.ID)
+		}
+	}
+
+	return nil
+}
+
+// addLateFee adds a late fee item to the invoice and updates the invoice amount.
+// fee is either a fixed amount in the default currency (e.g. "5.00") or a percentage of the invoice (e.g. "10%").
+//
+// qtx should be a transaction. qtx is not commited.
+func addLateFee(ctx context.Context, qtx *database.Queries, invoiceId int32, fee string) error {
+	// lock the invoice, and check again that it has no late fee
+	invoice, err := qtx.SelectInvoiceForUpdate(ctx, invoiceId)
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+	if invoice.Status != InvoiceUnpaid {
+		return nil
+	}
+
+	count, err := qtx.CountInvoiceItemsByType(ctx, database.CountInvoiceItemsByTypeParams{
+		InvoiceID: invoiceId,
+		Type:      InvoiceItemLateFee,
+	})
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	var amount decimal.Decimal
+	if strings.HasSuffix(fee, "%") {
+		percentage, err := decimal.NewFromString(strings.TrimSuffix(fee, "%"))
+		if err != nil {
+			return fmt.Errorf("invalid late fee \"%s\": %w", fee, err)
+		}
+		sum, err := qtx.SumInvoiceItems(ctx, invoiceId)
+		if err != nil {
+			return fmt.Errorf("db: %w", err)
+		}
+		amount = sum.Mul(percentage).Div(decimal.NewFromInt(100))
+	} else {
+		fixed, err := decimal.NewFromString(fee)
+		if err != nil {
+			return fmt.Errorf("invalid late fee \"%s\": %w", fee, err)
+		}
+		amount, err = ConvertCurrency(ctx, fixed, DefaultCurrency(ctx), invoice.Currency)
+		if err != nil {
+			return fmt.Errorf("convert late fee: %w", err)
+		}
+	}
+	amount = amount.RoundUp(CurrencyDecimals(invoice.Currency))
+
+	if !amount.GreaterThan(decimal.Zero) {
+		return nil
+	}
+
+	slog.Info("add late fee", "invoice_id", invoiceId, "fee", fee, "amount", amount, "currency", invoice.Currency)
+
+	err = qtx.CreateInvoiceItem(ctx, database.CreateInvoiceItemParams{
+		InvoiceID:   invoiceId,
+		Description: "Late fee",
+		Amount:      amount,
+		Type:        InvoiceItemLateFee,
+		ItemID:      pgtype.Int4{Valid: false},
+	})
+	if err != nil {
+		return fmt.Errorf("create invoice item: %w", err)
+	}
+
+	return RecalculateInvoiceAmount(ctx, qtx, invoiceId)
+}
+
+func validateLateFee(value string) error {
+	if value == "" {
+		return nil
+	}
+	fee, err := decimal.NewFromString(strings.TrimSuffix(value, "%"))
+	if err != nil || fee.LessThan(decimal.Zero) {
+		return errors.New("must be empty, a fixed amount (e.g. 5.00) or a percentage (e.g. 10%)")
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"billing3/database"
+	"billing3/database/types"
+	"billing3/service/extension"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	SuspensionReasonOverdue   = "overdue"
+	CancellationReasonOverdue = "overdue" // terminated because the renewal invoice was not paid
+)
+
+// LifecyclePolicy determines when renewal invoices are created, and when services with unpaid
+// renewal invoices are suspended and terminated.
+type LifecyclePolicy struct {
+	InvoiceDaysBeforeExpiry      int // renewal invoices are created this many days before the service expires
+	SuspendDaysAfterDue          int // services are suspended this many days after the renewal invoice is due
+	TerminateDaysAfterSuspension int // suspended services are terminated this many days after the suspension
+}
+
+// DefaultLifecyclePolicy returns the lifecycle policy from the settings.
+func DefaultLifecyclePolicy(ctx context.Context) LifecyclePolicy {
+	return LifecyclePolicy{
+		InvoiceDaysBeforeExpiry:      intSetting(ctx, SettingInvoiceDaysBeforeExpiry),
+		SuspendDaysAfterDue:          intSetting(ctx, SettingSuspendDaysAfterDue),
+		TerminateDaysAfterSuspension: intSetting(ctx, SettingTerminateDaysAfterSuspension),
+	}
+}
+
+// WithProduct returns the policy with the product's overrides applied.
+func (p LifecyclePolicy) WithProduct(product *database.Product) LifecyclePolicy {
+	if product.InvoiceDaysBeforeExpiry.Valid {
+		p.InvoiceDaysBeforeExpiry = int(product.InvoiceDaysBeforeExpiry.Int32)
+	}
+	if product.SuspendDaysAfterDue.Valid {
+		p.SuspendDaysAfterDue = int(product.SuspendDaysAfterDue.Int32)
+	}
+	if product.TerminateDaysAfterSuspension.Valid {
+		p.TerminateDaysAfterSuspension = int(product.TerminateDaysAfterSuspension.Int32)
+	}
+	return p
+}
+
+// SuspendAt returns the time at which a service that expires at expiresAt is suspended if the renewal invoice is not paid.
+func (p LifecyclePolicy) SuspendAt(expiresAt time.Time) time.Time {
+	return expiresAt.AddDate(0, 0, p.SuspendDaysAfterDue)
+}
+
+// TerminateAt returns the time at which a service that expires at expiresAt is terminated if the renewal invoice is not paid.
+func (p LifecyclePolicy) TerminateAt(expiresAt time.Time) time.Time {
+	return p.SuspendAt(expiresAt).AddDate(0, 0, p.TerminateDaysAfterSuspension)
+}
+
+// UnpaidServiceDueTime returns the due date of invoices for newly ordered services and upgrades.
+func UnpaidServiceDueTime(ctx context.Context) time.Time {
+	return time.Now().Add(time.Hour * time.Duration(intSetting(ctx, SettingUnpaidServiceDueHours)))
+}
+
+// ProcessOverdueServices suspends and terminates services that have expired without their renewal invoice being paid,
+// according to the lifecycle policy of their products.
+//
+// The renewal invoices of services are kept payable until the service is terminated. Services suspended by
+// ProcessOverdueServices are unsuspended when the renewal invoice is paid.
+func ProcessOverdueServices() error {
+	ctx := context.Background()
+
+	services, err := database.Q.FindOverdueServices(ctx)
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+
+	defaultPolicy := DefaultLifecyclePolicy(ctx)
+	policies := make(map[int32]LifecyclePolicy)
+
+	for _, service := range services {
+		policy := defaultPolicy
+		if service.ProductID.Valid {
+			p, ok := policies[service.ProductID.Int32]
+			if !ok {
+				product, err := database.Q.FindProductById(ctx, service.ProductID.Int32)
+				if err != nil {
+					return fmt.Errorf("db: %w", err)
+				}
+				p = defaultPolicy.WithProduct(&product)
+				policies[service.ProductID.Int32] = p
+			}
+			policy = p
+		}
+
+		now := time.Now()
+
+		if !now.Before(policy.TerminateAt(service.ExpiresAt.Time)) {
+			slog.Info("terminate overdue service", "id", service.ID, "expires_at", service.ExpiresAt.Time)
+
+			err := database.Q.CancelUnpaidInvoicesForService(ctx, database.CancelUnpaidInvoicesForServiceParams{
+				CancellationReason: pgtype.Text{Valid: true, String: "service terminated"},
+				ServiceID:          pgtype.Int4{Valid: true, Int32: service.ID},
+			})
+			if err != nil {
+				return fmt.Errorf("db: %w", err)
+			}
+
+			// keep the time of the first attempt if the termination is retried
+			if !service.CancelledAt.Valid {
+				err = database.Q.UpdateServiceCancelled(ctx, database.UpdateServiceCancelledParams{
+					CancellationReason: pgtype.Text{Valid: true, String: CancellationReasonOverdue},
+					CancelledAt:        types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: now}},
+					ID:                 service.ID,
+				})
+				if err != nil {
+					return fmt.Errorf("db: %w", err)
+				}
+			}
+
+			err = extension.DoActionAsync(ctx, service.Extension, service.ID, "terminate", ServiceCancelled)
+			if err != nil {
+				slog.Error("terminate overdue service", "id", service.ID, "err", err, "extension", service.Extension)
+			}
+			continue
+		}
+
+		if service.Status == ServiceActive && !now.Before(policy.SuspendAt(service.ExpiresAt.Time)) {
+			slog.Info("suspend overdue service", "id", service.ID, "expires_at", service.ExpiresAt.Time)
+
+			err := database.Q.UpdateServiceSuspensionReason(ctx, database.UpdateServiceSuspensionReasonParams{
+				SuspensionReason: pgtype.Text{Valid: true, String: SuspensionReasonOverdue},
+				ID:               service.ID,
+			})
+			if err != nil {
+				return fmt.Errorf("db: %w", err)
+			}
+
+			err = changeServiceStatus(ctx, service.Extension, service.ID, "suspend", ServiceSuspended)
+			if err != nil {
+				slog.Error("suspend overdue service", "id", service.ID, "err", err, "extension", service.Extension)
+			}
+		}
+	}
+
+	return nil
+}
+
+// unsuspendPaidService unsuspends a service that was suspended by ProcessOverdueServices.
+func unsuspendPaidService(ctx context.Context, service *database.Service) error {
+	slog.Info("unsuspend paid service", "id", service.ID)
+
+	err := database.Q.UpdateServiceSuspensionReason(ctx, database.UpdateServiceSuspensionReasonParams{
+		SuspensionReason: pgtype.Text{Valid: false},
+		ID:               service.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+
+	return changeServiceStatus(ctx, service.Extension, service.ID, "unsuspend", ServiceActive)
+}
+
+// changeServiceStatus performs the action through the extension and changes the status of the service when the
+// action succeeds. If the extension does not offer the action, e.g. because the service is not provisioned, only
+// the status is changed.
+func changeServiceStatus(ctx context.Context, ext string, serviceId int32, action string, status string) error {
+	e, ok := extension.Extensions[ext]
+	if !ok {
+		return fmt.Errorf("extension %s not found", ext)
+	}
+
+	actions, err := e.AdminActions(serviceId)
+	if err != nil {
+		return fmt.Errorf("extension admin actions: %w", err)
+	}
+
+	if !slices.Contains(actions, action) {
+		err = database.Q.UpdateServiceStatus(ctx, database.UpdateServiceStatusParams{
+			Status: status,
+			ID:     serviceId,
+		})
+		if err != nil {
+			return fmt.Errorf("db: %w", err)
+		}
+		return nil
+	}
+
+	err = extension.DoActionAsync(ctx, ext, serviceId, action, status)
+	if err != nil && !errors.Is(err, extension.ErrActionRunning) {
+		return err
+	}
+	return nil
+}
+
+// intSetting returns the value of a setting that is validated by validateNonNegativeInt.
+func intSetting(ctx context.Context, s Setting) int {
+	i, err := strconv.Atoi(s.Get(ctx))
+	if err != nil {
+		i, _ = strconv.Atoi(s.defaultValue)
+	}
+	return i
+}
+
+func validateNonNegativeInt(value string) error {
+	i, err := strconv.Atoi(value)
+	if err != nil || i < 0 {
+		return errors.New("must be a non-negative number")
+	}
+	return nil
+}
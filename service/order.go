@@ -2,25 +2,57 @@ package service
 
 import (
 	"billing3/database"
+	"billing3/database/types"
 	"context"
 	"fmt"
 	"github.com/shopspring/decimal"
 	"log/slog"
 	"regexp"
+	"slices"
+	"time"
 )
 
 type OrderRequest struct {
 	ProductID int               `json:"product_id" validate:"required"`
 	Duration  int               `json:"duration" validate:"min=0"`
 	Options   map[string]string `json:"options"`
+	Currency  string            `json:"currency"` // empty for the default currency
+	Coupon    string            `json:"coupon"`
+	Trial     bool              `json:"trial"` // order a free trial of the product
 }
 
 type Pricing struct {
 	Duration     int             `json:"duration"`
 	BillingCycle string          `json:"billing_cycle"`
+	Months       int32           `json:"months"`      // calendar months of the billing cycle, see BillingCycle
+	BillingDay   int32           `json:"billing_day"` // day of month on which calendar billing cycles renew
+	Currency     string          `json:"currency"`
 	RecurringFee decimal.Decimal `json:"recurring_fee"`
 	SetupFee     decimal.Decimal `json:"setup_fee"`
 	Items        []PricingItem   `json:"items"`
+
+	// coupon discount on the first invoice, and on renewals if the coupon is recurring
+	CouponID          int32           `json:"-"`
+	Coupon            string          `json:"coupon"`
+	Discount          decimal.Decimal `json:"discount"`
+	RecurringDiscount decimal.Decimal `json:"recurring_discount"`
+	// percentage of the price discounted on renewals by percentage coupons, 0 for fixed discounts
+	RecurringDiscountRate decimal.Decimal `json:"-"`
+
+	// free trials have no setup fee, the first invoice is created before the trial ends
+	Trial       bool       `json:"trial"`
+	TrialEndsAt *time.Time `json:"trial_ends_at"`
+
+	// if the service renews on a billing anchor day, the recurring fee of the first invoice is prorated until
+	// FirstPeriodEnd. Proration is the (negative) adjustment of the first invoice.
+	FirstPeriodEnd *time.Time      `json:"first_period_end"`
+	Proration      decimal.Decimal `json:"proration"`
+
+	// tax of the first invoice, which includes the setup fee unless it is a trial
+	Tax       Tax             `json:"tax"`
+	Subtotal  decimal.Decimal `json:"subtotal"`
+	TaxAmount decimal.Decimal `json:"tax_amount"`
+	Total     decimal.Decimal `json:"total"`
 }
 
 type PricingItem struct {
@@ -29,10 +61,14 @@ type PricingItem struct {
 }
 
 // CalculatePricing calculates price for given billing cycle, and configurable options.
+// The order is charged in the requested currency if the product has a price in it, otherwise
+// in the default currency. Options without a price in that currency are converted from their
+// price in the default currency using the exchange rates.
+// Tax is calculated from the user's address, no tax is applied if user is nil.
 // CalculatePricing returns error if product is disabled or out of stock.
 // CalculatePricing returns (product, cleaned options, redacted options(with password
 // removed, used for logging), pricing, error)
-func CalculatePricing(ctx context.Context, req OrderRequest) (*database.Product, map[string]string, map[string]string, *Pricing, error) {
+func CalculatePricing(ctx context.Context, req OrderRequest, user *database.User) (*database.Product, map[string]string, map[string]string, *Pricing, error) {
 	product, err := database.Q.FindProductById(ctx, int32(req.ProductID))
 	if err != nil {
 		slog.Error("find product", "err", err, "id", req.ProductID)
@@ -49,18 +85,55 @@ func CalculatePricing(ctx context.Context, req OrderRequest) (*database.Product,
 		return nil, nil, nil, nil, fmt.Errorf("product is out of stock")
 	}
 
+	if req.Trial {
+		if product.TrialDays <= 0 {
+			return nil, nil, nil, nil, ErrTrialNotAvailable
+		}
+		if req.Coupon != "" {
+			return nil, nil, nil, nil, fmt.Errorf("coupons cannot be used with free trials")
+		}
+	}
+
 	pricing := Pricing{
 		RecurringFee: decimal.NewFromInt(0),
 		SetupFee:     decimal.NewFromInt(0),
 		Items:        make([]PricingItem, 0),
 		Duration:     req.Duration,
+		Discount:     decimal.NewFromInt(0),
+		Proration:    decimal.NewFromInt(0),
+
+		RecurringDiscount: decimal.NewFromInt(0),
+	}
+
+	// currency
+
+	defaultCurrency := DefaultCurrency(ctx)
+	currency := req.Currency
+	if currency == "" {
+		currency = defaultCurrency
+	}
+
+	currencies, err := Currencies(ctx)
+	if err != nil {
+		slog.Error("get currencies", "err", err)
+		return nil, nil, nil, nil, ErrInternalError
+	}
+	if !slices.Contains(currencies, currency) {
+		return nil, nil, nil, nil, fmt.Errorf("unsupported currency")
+	}
+
+	if !slices.ContainsFunc(product.Pricing, func(price types.ProductPrice) bool {
+		return price.Duration == int32(req.Duration) && priceCurrency(price.Currency, defaultCurrency) == currency
+	}) {
+		currency = defaultCurrency
 	}
+	pricing.Currency = currency
 
 	// product pricing
 
 	found := false
 	for _, price := range product.Pricing {
-		if price.Duration == int32(req.Duration) {
+		if price.Duration == int32(req.Duration) && priceCurrency(price.Currency, defaultCurrency) == currency {
 			found = true
 
 			pricing.RecurringFee = pricing.RecurringFee.Add(price.Price)
@@ -69,7 +142,7 @@ func CalculatePricing(ctx context.Context, req OrderRequest) (*database.Product,
 				Price:       price.Price,
 			})
 
-			if price.SetupFee.GreaterThan(decimal.Zero) {
+			if price.SetupFee.GreaterThan(decimal.Zero) && !req.Trial {
 				pricing.SetupFee = pricing.SetupFee.Add(price.SetupFee)
 				pricing.Items = append(pricing.Items, PricingItem{
 					Description: product.Name + " Setup Fee",
@@ -78,6 +151,7 @@ func CalculatePricing(ctx context.Context, req OrderRequest) (*database.Product,
 			}
 
 			pricing.BillingCycle = price.DisplayName
+			pricing.Months = price.Months
 
 			break
 		}
@@ -129,36 +203,32 @@ func CalculatePricing(ctx context.Context, req OrderRequest) (*database.Product,
 				found = true
 
 				// find pricing for selected billing cycle
-				pricingFound := false
-				for _, price := range optionValue.Prices {
-					if price.Duration != int32(req.Duration) {
-						continue
-					}
-
-					if price.Price.GreaterThan(decimal.Zero) {
-						pricing.Items = append(pricing.Items, PricingItem{
-							Description: "\u00BB " + option.DisplayName + ": " + optionValue.DisplayName,
-							Price:       price.Price,
-						})
-						pricing.RecurringFee = pricing.RecurringFee.Add(price.Price)
-					}
-
-					if price.SetupFee.GreaterThan(decimal.Zero) {
-						pricing.Items = append(pricing.Items, PricingItem{
-							Description: "\u00BB " + option.DisplayName + ": " + optionValue.DisplayName + " Setup Fee",
-							Price:       price.SetupFee,
-						})
-						pricing.SetupFee = pricing.SetupFee.Add(price.SetupFee)
-					}
-
-					pricingFound = true
-					break
+				price, pricingFound, err := findOptionPrice(ctx, optionValue.Prices, int32(req.Duration), currency, defaultCurrency)
+				if err != nil {
+					slog.Error("find option price", "err", err, "product", req.ProductID, "option", option.Name, "currency", currency)
+					return nil, nil, nil, nil, ErrInternalError
 				}
 
 				if !pricingFound {
 					return nil, nil, nil, nil, fmt.Errorf("option \"%s\" is not available for the selected billing cycle", option.DisplayName)
 				}
 
+				if price.Price.GreaterThan(decimal.Zero) {
+					pricing.Items = append(pricing.Items, PricingItem{
+						Description: "\u00BB " + option.DisplayName + ": " + optionValue.DisplayName,
+						Price:       price.Price,
+					})
+					pricing.RecurringFee = pricing.RecurringFee.Add(price.Price)
+				}
+
+				if price.SetupFee.GreaterThan(decimal.Zero) && !req.Trial {
+					pricing.Items = append(pricing.Items, PricingItem{
+						Description: "\u00BB " + option.DisplayName + ": " + optionValue.DisplayName + " Setup Fee",
+						Price:       price.SetupFee,
+					})
+					pricing.SetupFee = pricing.SetupFee.Add(price.SetupFee)
+				}
+
 				break
 			}
 
@@ -192,5 +262,136 @@ func CalculatePricing(ctx context.Context, req OrderRequest) (*database.Product,
 		}
 	}
 
+	// coupon
+
+	if req.Coupon != "" {
+		coupon, err := FindCoupon(ctx, database.Q, req.Coupon, int32(req.ProductID), int32(req.Duration), user)
+		if err != nil {
+			if IsCouponError(err) {
+				return nil, nil, nil, nil, err
+			}
+			slog.Error("find coupon", "err", err, "coupon", req.Coupon)
+			return nil, nil, nil, nil, ErrInternalError
+		}
+
+		recurring, setup, err := CouponDiscount(ctx, coupon, pricing.RecurringFee, pricing.SetupFee, currency)
+		if err != nil {
+			slog.Error("coupon discount", "err", err, "coupon", coupon.Code, "currency", currency)
+			return nil, nil, nil, nil, ErrInternalError
+		}
+
+		pricing.CouponID = coupon.ID
+		pricing.Coupon = coupon.Code
+		pricing.Discount = recurring.Add(setup)
+		if coupon.Recurring {
+			pricing.RecurringDiscount = recurring
+			if coupon.Type == CouponPercentage {
+				pricing.RecurringDiscountRate = decimal.Min(coupon.Value, decimal.NewFromInt(100))
+			}
+		}
+
+		if pricing.Discount.GreaterThan(decimal.Zero) {
+			pricing.Items = append(pricing.Items, PricingItem{
+				Description: "Coupon " + coupon.Code,
+				Price:       pricing.Discount.Neg(),
+			})
+		}
+	}
+
+	// free trial
+
+	if req.Trial {
+		trialEnd := time.Now().UTC().AddDate(0, 0, int(product.TrialDays))
+		pricing.Trial = true
+		pricing.TrialEndsAt = &trialEnd
+	}
+
+	// calendar billing cycles renew on the billing anchor day, or on the day of the order.
+	// trials renew on the day the trial ends.
+
+	if pricing.Months > 0 {
+		now := time.Now()
+		pricing.BillingDay = BillingAnchorDay(user, &product)
+
+		if pricing.Trial {
+			pricing.BillingDay = int32(pricing.TrialEndsAt.Day())
+		} else if pricing.BillingDay == 0 {
+			pricing.BillingDay = int32(now.UTC().Day())
+		} else {
+			cycle := BillingCycle{Seconds: int32(req.Duration), Months: pricing.Months, Day: pricing.BillingDay}
+			end, fraction := FirstBillingPeriod(cycle, pricing.BillingDay, now)
+
+			recurring := pricing.RecurringFee.Sub(pricing.RecurringDiscount)
+			pricing.FirstPeriodEnd = &end
+			pricing.Proration = RoundCurrency(recurring.Mul(fraction), pricing.Currency).Sub(recurring)
+
+			if pricing.Proration.LessThan(decimal.Zero) {
+				pricing.Items = append(pricing.Items, PricingItem{
+					Description: "Proration until " + end.Format("2006-01-02"),
+					Price:       pricing.Proration,
+				})
+			}
+		}
+	}
+
+	// tax
+
+	if user != nil {
+		pricing.Tax, err = FindTax(ctx, database.Q, user)
+		if err != nil {
+			slog.Error("find tax", "err", err, "user", user.ID)
+			return nil, nil, nil, nil, ErrInternalError
+		}
+	}
+	pricing.Subtotal, pricing.TaxAmount, pricing.Total = pricing.Tax.Apply(pricing.RecurringFee.Add(pricing.SetupFee).Sub(pricing.Discount).Add(pricing.Proration))
+
 	return &product, cleanedOptions, redactedOptions, &pricing, nil
 }
+
+// priceCurrency returns the currency of a price, which is the default currency if not set.
+func priceCurrency(currency string, defaultCurrency string) string {
+	if currency == "" {
+		return defaultCurrency
+	}
+	return currency
+}
+
+// findOptionPrice returns the price of an option value for the billing cycle in currency.
+// If the option value has no price in currency, its price in the default currency is converted.
+func findOptionPrice(ctx context.Context, prices []types.ProductOptionValuePrice, duration int32, currency string, defaultCurrency string) (*types.ProductOptionValuePrice, bool, error) {
+	var defaultPrice *types.ProductOptionValuePrice
+
+	for i, price := range prices {
+		if price.Duration != duration {
+			continue
+		}
+
+		c := priceCurrency(price.Currency, defaultCurrency)
+		if c == currency {
+			return &prices[i], true, nil
+		}
+		if c == defaultCurrency {
+			defaultPrice = &prices[i]
+		}
+	}
+
+	if defaultPrice == nil {
+		return nil, false, nil
+	}
+
+	p, err := ConvertCurrency(ctx, defaultPrice.Price, defaultCurrency, currency)
+	if err != nil {
+		return nil, false, err
+	}
+	setupFee, err := ConvertCurrency(ctx, defaultPrice.SetupFee, defaultCurrency, currency)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &types.ProductOptionValuePrice{
+		Duration: duration,
+		Price:    p,
+		SetupFee: setupFee,
+		Currency: currency,
+	}, true, nil
+}
@@ -0,0 +1,108 @@
+package pdf
+
+import (
+	"strings"
+)
+
+const (
+	margin     = 50
+	lineHeight = 1.4
+	columnGap  = 10
+)
+
+// Render renders a document written in a simple line based markup:
+//
+//	# Title             large bold text
+//	## Heading          bold text
+//	> text              right aligned text
+//	**text              bold text, can be combined with the other formats
+//	a | b | c           table row, the first column is left aligned and the others are right aligned
+//	---                 horizontal line
+//	(empty line)        vertical space
+//
+// Other lines are rendered as normal text and wrapped to the page width. Pages are added as needed.
+func Render(markup string) *Document {
+	d := New()
+	d.AddPage()
+
+	y := float64(margin)
+	right := PageWidth - margin
+	width := right - margin
+
+	// newLine moves y down by one line of the current font, starting a new page if needed
+	newLine := func() {
+		y += d.FontSize() * lineHeight
+		if y > PageHeight-margin {
+			d.AddPage()
+			y = margin + d.FontSize()
+		}
+	}
+
+	for _, line := range strings.Split(strings.ReplaceAll(markup, "\r\n", "\n"), "\n") {
+		line = strings.TrimRight(line, " \t")
+
+		bold := false
+		if strings.HasPrefix(line, "**") {
+			bold = true
+			line = strings.TrimPrefix(line, "**")
+		}
+
+		switch {
+		case line == "":
+			y += 6
+
+		case line == "---":
+			y += 4
+			d.Line(margin, y, right, y)
+			y += 4
+
+		case strings.HasPrefix(line, "# "):
+			d.SetFont(true, 18)
+			newLine()
+			d.Text(margin, y, strings.TrimPrefix(line, "# "))
+			y += 4
+
+		case strings.HasPrefix(line, "## "):
+			d.SetFont(true, 11)
+			newLine()
+			d.Text(margin, y, strings.TrimPrefix(line, "## "))
+
+		case strings.HasPrefix(line, "> "):
+			d.SetFont(bold, 10)
+			newLine()
+			d.TextRight(right, y, strings.TrimPrefix(line, "> "))
+
+		case strings.Contains(line, " | "):
+			d.SetFont(bold, 10)
+			columns := strings.Split(line, " | ")
+
+			// right aligned columns have a fixed width, the first column takes the remaining space
+			columnWidth := 90.0
+			if len(columns) > 4 {
+				columnWidth = 70
+			}
+			firstWidth := width - float64(len(columns)-1)*(columnWidth+columnGap)
+
+			wrapped := d.WrapText(strings.TrimSpace(columns[0]), firstWidth)
+			for i, text := range wrapped {
+				newLine()
+				d.Text(margin, y, text)
+				if i == 0 {
+					for j, column := range columns[1:] {
+						x := right - float64(len(columns)-2-j)*(columnWidth+columnGap)
+						d.TextRight(x, y, strings.TrimSpace(column))
+					}
+				}
+			}
+
+		default:
+			d.SetFont(bold, 10)
+			for _, text := range d.WrapText(line, width) {
+				newLine()
+				d.Text(margin, y, text)
+			}
+		}
+	}
+
+	return d
+}
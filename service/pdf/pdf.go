@@ -0,0 +1,219 @@
+// Package pdf is a minimal PDF writer for simple text documents such as invoices.
+// It only supports the standard Helvetica fonts, which do not need to be embedded.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+type page struct {
+	content bytes.Buffer
+}
+
+type Document struct {
+	pages    []*page
+	bold     bool
+	fontSize float64
+}
+
+func New() *Document {
+	return &Document{
+		fontSize: 10,
+	}
+}
+
+// AddPage starts a new page. All drawing operations apply to the last page.
+func (d *Document) AddPage() {
+	d.pages = append(d.pages, &page{})
+}
+
+func (d *Document) current() *page {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// SetFont sets the font used by following text operations.
+func (d *Document) SetFont(bold bool, size float64) {
+	d.bold = bold
+	d.fontSize = size
+}
+
+func (d *Document) FontSize() float64 {
+	return d.fontSize
+}
+
+// Text draws s with its baseline starting at (x, y). Coordinates start at the top left corner of the page.
+func (d *Document) Text(x, y float64, s string) {
+	font := "F1"
+	if d.bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&d.current().content, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, d.fontSize, x, PageHeight-y, escape(encode(s)))
+}
+
+// TextRight draws s so that it ends at x.
+func (d *Document) TextRight(x, y float64, s string) {
+	d.Text(x-d.StringWidth(s), y, s)
+}
+
+// Line draws a line from (x1, y1) to (x2, y2).
+func (d *Document) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&d.current().content, "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, PageHeight-y1, x2, PageHeight-y2)
+}
+
+// StringWidth returns the width of s in points, using the current font.
+func (d *Document) StringWidth(s string) float64 {
+	widths := &helveticaWidths
+	if d.bold {
+		widths = &helveticaBoldWidths
+	}
+
+	total := 0
+	for _, c := range encode(s) {
+		if c >= 32 && c <= 126 {
+			total += widths[c-32]
+		} else {
+			total += 556
+		}
+	}
+	return float64(total) * d.fontSize / 1000
+}
+
+// WrapText splits s into lines no wider than width, using the current font.
+func (d *Document) WrapText(s string, width float64) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && d.StringWidth(candidate) > width {
+			lines = append(lines, line)
+			line = word
+		} else {
+			line = candidate
+		}
+	}
+	if line != "" || len(lines) == 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// WriteTo writes the PDF file to w.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	d.current()
+
+	var buf bytes.Buffer
+	var offsets []int
+
+	addObject := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	// objects 1-4 are catalog, page tree and fonts, followed by a page and its content stream for each page
+	pageIds := make([]string, len(d.pages))
+	for i := range d.pages {
+		pageIds[i] = fmt.Sprintf("%d 0 R", 5+i*2)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	addObject("<< /Type /Catalog /Pages 2 0 R >>")
+	addObject(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(pageIds, " "), len(d.pages)))
+	addObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	addObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, p := range d.pages {
+		addObject(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", PageWidth, PageHeight, 6+i*2))
+		addObject(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	n, err := w.Write(buf.Bytes())
+	return int64(n), err
+}
+
+// encode converts s to WinAnsiEncoding. Characters that cannot be encoded are replaced with '?'.
+func encode(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r < 0x80 || (r >= 0xA0 && r <= 0xFF):
+			b = append(b, byte(r))
+		case r == '€':
+			b = append(b, 0x80)
+		case r == '‘':
+			b = append(b, 0x91)
+		case r == '’':
+			b = append(b, 0x92)
+		case r == '“':
+			b = append(b, 0x93)
+		case r == '”':
+			b = append(b, 0x94)
+		case r == '•':
+			b = append(b, 0x95)
+		case r == '–':
+			b = append(b, 0x96)
+		case r == '—':
+			b = append(b, 0x97)
+		case r == '»':
+			b = append(b, 0xBB)
+		default:
+			b = append(b, '?')
+		}
+	}
+	return b
+}
+
+func escape(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		switch c {
+		case '\\', '(', ')':
+			sb.WriteByte('\\')
+			sb.WriteByte(c)
+		case '\n', '\r', '\t':
+			sb.WriteByte(' ')
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+// character widths of printable ASCII characters (32-126), in 1/1000 of the font size
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [95]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"billing3/database"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+// statuses of gateway refunds
+const (
+	GatewayRefundPending   = "PENDING"
+	GatewayRefundCompleted = "COMPLETED"
+	GatewayRefundFailed    = "FAILED"
+)
+
+// RefundableAmount returns the amount of the payment that has not been refunded yet. The overpayment carried over
+// to the credit balance and refunds pending at the gateway are not refundable.
+func RefundableAmount(ctx context.Context, qtx *database.Queries, payment *database.InvoicePayment) (decimal.Decimal, error) {
+	if payment.RefundOf.Valid || payment.Amount.LessThanOrEqual(decimal.Zero) {
+		return decimal.Zero, nil
+	}
+
+	refunded, err := qtx.TotalPaymentRefund(ctx, pgtype.Int4{Valid: true, Int32: payment.ID})
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("total payment refund: %w", err)
+	}
+
+	pending, err := qtx.TotalPendingGatewayRefund(ctx, payment.ID)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("total pending gateway refund: %w", err)
+	}
+
+	refundable := payment.Amount.Sub(payment.Credited).Sub(refunded).Sub(pending)
+	if refundable.LessThan(decimal.Zero) {
+		return decimal.Zero, nil
+	}
+	return refundable, nil
+}
+
+// StartGatewayRefund records a PENDING refund of the payment, before the refund is sent through the gateway of the
+// payment. The pending refund is not refundable again, and should be completed with CompleteGatewayRefund once the
+// gateway has carried it out, or marked as FAILED with FailGatewayRefund.
+//
+// ErrRefundExceedsPayment is returned if amount exceeds the refundable amount of the payment.
+//
+// qtx should be a transaction, in which the invoice row is locked. qtx is not commited.
+func StartGatewayRefund(ctx context.Context, qtx *database.Queries, payment *database.InvoicePayment, amount decimal.Decimal, description string) (int32, error) {
+	refundable, err := RefundableAmount(ctx, qtx, payment)
+	if err != nil {
+		return 0, err
+	}
+
+	if amount.LessThanOrEqual(decimal.Zero) || amount.GreaterThan(refundable) {
+		return 0, ErrRefundExceedsPayment
+	}
+
+	id, err := qtx.CreateGatewayRefund(ctx, database.CreateGatewayRefundParams{
+		PaymentID:   payment.ID,
+		Amount:      amount,
+		Description: description,
+		Status:      GatewayRefundPending,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("create gateway refund: %w", err)
+	}
+
+	slog.Info("gateway refund started", "invoice_id", payment.InvoiceID, "payment_id", payment.ID, "gateway_refund_id", id, "amount", amount, "gateway", payment.Gateway)
+
+	return id, nil
+}
+
+// CompleteGatewayRefund records the PENDING gateway refund with RecordRefund and marks it as COMPLETED. The refund
+// must have been carried out by the gateway, and referenceId identifies the refund at the gateway. The id of the
+// recorded refund is returned.
+//
+// ErrGatewayRefundNotPending is returned if the gateway refund is not PENDING.
+//
+// qtx should be a transaction. qtx is not commited.
+func CompleteGatewayRefund(ctx context.Context, qtx *database.Queries, invoiceId int32, gatewayRefundId int32, referenceId string) (int32, error) {
+	// lock the invoice, as required by RecordRefund
+	_, err := qtx.SelectInvoiceForUpdate(ctx, invoiceId)
+	if err != nil {
+		return 0, fmt.Errorf("select invoice for update: %w", err)
+	}
+
+	refund, err := qtx.FindGatewayRefund(ctx, database.FindGatewayRefundParams{
+		ID:        gatewayRefundId,
+		InvoiceID: invoiceId,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("find gateway refund: %w", err)
+	}
+	if refund.Status != GatewayRefundPending {
+		return 0, ErrGatewayRefundNotPending
+	}
+
+	payment, err := qtx.FindInvoicePayment(ctx, database.FindInvoicePaymentParams{
+		ID:        refund.PaymentID,
+		InvoiceID: invoiceId,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("find invoice payment: %w", err)
+	}
+
+	// no longer pending, so that its amount is refundable by RecordRefund
+	err = qtx.UpdateGatewayRefund(ctx, database.UpdateGatewayRefundParams{
+		Status:      GatewayRefundCompleted,
+		ReferenceID: referenceId,
+		ID:          refund.ID,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("update gateway refund: %w", err)
+	}
+
+	id, err := RecordRefund(ctx, qtx, &payment, refund.Amount, refund.Description, referenceId, payment.Gateway)
+	if errors.Is(err, ErrPaymentAlreadyRecorded) {
+		// the refund notification of the gateway has been processed first
+		recorded, err := qtx.FindInvoicePaymentByReference(ctx, database.FindInvoicePaymentByReferenceParams{
+			Gateway:     payment.Gateway,
+			ReferenceID: referenceId,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("find invoice payment by reference: %w", err)
+		}
+		return recorded.ID, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	slog.Info("gateway refund completed", "invoice_id", payment.InvoiceID, "payment_id", payment.ID, "gateway_refund_id", refund.ID, "refund_id", id)
+
+	return id, nil
+}
+
+// FailGatewayRefund marks the PENDING gateway refund as FAILED, so that its amount becomes refundable again. It must
+// only be used if the gateway has not carried out the refund. msg describes the failure.
+func FailGatewayRefund(ctx context.Context, q *database.Queries, gatewayRefundId int32, msg string) error {
+	err := q.UpdateGatewayRefund(ctx, database.UpdateGatewayRefundParams{
+		Status: GatewayRefundFailed,
+		Error:  msg,
+		ID:     gatewayRefundId,
+	})
+	if err != nil {
+		return fmt.Errorf("update gateway refund: %w", err)
+	}
+
+	slog.Info("gateway refund failed", "gateway_refund_id", gatewayRefundId, "error", msg)
+
+	return nil
+}
+
+// RecordRefund records a refund of the payment as a negative payment linked to it, issues a credit
+// note if the invoice has been paid, and updates the status of the invoice. The refund must have been carried out already, e.g.
+// through the payment gateway, and referenceId identifies the refund at the gateway.
+//
+// ErrRefundExceedsPayment is returned if amount exceeds the refundable amount of the payment, and
+// ErrPaymentAlreadyRecorded if a refund with the same gateway and referenceId exists.
+//
+// qtx should be a transaction, in which the invoice row is locked. qtx is not commited.
+func RecordRefund(ctx context.Context, qtx *database.Queries, payment *database.InvoicePayment, amount decimal.Decimal, description string, referenceId string, gateway string) (int32, error) {
+	refundable, err := RefundableAmount(ctx, qtx, payment)
+	if err != nil {
+		return 0, err
+	}
+
+	if amount.LessThanOrEqual(decimal.Zero) || amount.GreaterThan(refundable) {
+		return 0, ErrRefundExceedsPayment
+	}
+
+	id, err := qtx.AddInvoiceRefund(ctx, database.AddInvoiceRefundParams{
+		InvoiceID:   payment.InvoiceID,
+		Description: description,
+		Amount:      amount.Neg(),
+		ReferenceID: referenceId,
+		Gateway:     gateway,
+		RefundOf:    pgtype.Int4{Valid: true, Int32: payment.ID},
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrPaymentAlreadyRecorded
+		}
+		return 0, fmt.Errorf("add invoice refund: %w", err)
+	}
+
+	slog.Info("refund recorded", "invoice_id", payment.InvoiceID, "payment_id", payment.ID, "refund_id", id, "amount", amount, "reference_id", referenceId, "gateway", gateway)
+
+	// refunds of paid invoices are documented by a credit note
+	invoice, err := qtx.FindInvoiceById(ctx, payment.InvoiceID)
+	if err != nil {
+		return 0, fmt.Errorf("find invoice: %w", err)
+	}
+	if InvoiceIsPaid(invoice.Status) {
+		_, err = createRefundCreditNote(ctx, qtx, &invoice, payment, amount, description)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = updateInvoiceRefundStatus(ctx, qtx, payment.InvoiceID)
+	if err != nil {
+		return 0, err
+	}
+
+	err = reverseCommissions(ctx, qtx, payment.InvoiceID, amount)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// RefundToCredit refunds the payment to the invoice owner's credit balance instead of
+// the payment gateway. amount is in the currency of the invoice, and is converted to the
+// default currency.
+//
+// qtx should be a transaction, in which the invoice row is locked. qtx is not commited.
+func RefundToCredit(ctx context.Context, qtx *database.Queries, payment *database.InvoicePayment, amount decimal.Decimal, description string) (int32, error) {
+	invoice, err := qtx.FindInvoiceById(ctx, payment.InvoiceID)
+	if err != nil {
+		return 0, fmt.Errorf("find invoice: %w", err)
+	}
+
+	refundable, err := RefundableAmount(ctx, qtx, payment)
+	if err != nil {
+		return 0, err
+	}
+
+	if amount.LessThanOrEqual(decimal.Zero) || amount.GreaterThan(refundable) {
+		return 0, ErrRefundExceedsPayment
+	}
+
+	credit, err := ConvertCurrency(ctx, amount, invoice.Currency, DefaultCurrency(ctx))
+	if err != nil {
+		return 0, fmt.Errorf("convert refund: %w", err)
+	}
+
+	transactionId, err := AddCredit(ctx, qtx, invoice.UserID, credit, CreditRefund, description, pgtype.Int4{Valid: true, Int32: invoice.ID})
+	if err != nil {
+		return 0, err
+	}
+
+	return RecordRefund(ctx, qtx, payment, amount, description, strconv.Itoa(int(transactionId)), GatewayCredit)
+}
+
+// updateInvoiceRefundStatus marks a paid invoice as REFUNDED if all payments have been
+// refunded, or PARTIALLY_REFUNDED if some have. Overpayments carried over to the credit balance
+// are not refundable, and do not count as unrefunded.
+func updateInvoiceRefundStatus(ctx context.Context, qtx *database.Queries, invoiceId int32) error {
+	invoice, err := qtx.FindInvoiceById(ctx, invoiceId)
+	if err != nil {
+		return fmt.Errorf("find invoice: %w", err)
+	}
+
+	if invoice.Status != InvoicePaid && invoice.Status != InvoicePartiallyRefunded && invoice.Status != InvoiceRefunded {
+		return nil
+	}
+
+	sum, err := qtx.SumInvoicePaymentsAndRefunds(ctx, invoiceId)
+	if err != nil {
+		return fmt.Errorf("sum invoice payments: %w", err)
+	}
+
+	status := InvoicePaid
+	if sum.Refunded.GreaterThan(decimal.Zero) {
+		status = InvoicePartiallyRefunded
+		if sum.Paid.Sub(sum.Credited).Sub(sum.Refunded).LessThanOrEqual(decimal.Zero) {
+			status = InvoiceRefunded
+		}
+	}
+
+	if status == invoice.Status {
+		return nil
+	}
+
+	slog.Info("update invoice refund status", "invoice_id", invoiceId, "status", status, "paid", sum.Paid, "credited", sum.Credited, "refunded", sum.Refunded)
+
+	err = qtx.UpdateInvoiceStatus(ctx, database.UpdateInvoiceStatusParams{
+		Status: status,
+		ID:     invoiceId,
+	})
+	if err != nil {
+		return fmt.Errorf("update invoice status: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"billing3/database"
+	"billing3/service/email"
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"log/slog"
+	"strconv"
+	"text/template"
+)
+
+// Stages of invoice reminders. Each reminder is sent at most once per invoice.
+const (
+	ReminderCreated   = "created"   // the invoice is created
+	ReminderUpcoming  = "upcoming"  // SettingReminderDaysBeforeDue days before the invoice is due
+	ReminderDue       = "due"       // the invoice is due
+	ReminderSuspended = "suspended" // the service in the invoice is suspended, see ProcessOverdueServices
+)
+
+const (
+	DefaultReminderSubjectCreated   = "New invoice {{.InvoiceNumber}}"
+	DefaultReminderSubjectUpcoming  = "Invoice {{.InvoiceNumber}} is due on {{.DueAt}}"
+	DefaultReminderSubjectDue       = "Invoice {{.InvoiceNumber}} is due today"
+	DefaultReminderSubjectSuspended = "Service suspended: invoice {{.InvoiceNumber}} is overdue"
+
+	DefaultReminderTemplateCreated = `<p>Dear {{.User.Name}},</p>
+<p>A new invoice {{.InvoiceNumber}} of {{.Amount}} has been created, and is due on {{.DueAt}}.</p>
+<p><a href="{{.Link}}">View and pay the invoice</a></p>
+<p>{{.SiteName}}</p>`
+	DefaultReminderTemplateUpcoming = `<p>Dear {{.User.Name}},</p>
+<p>This is a reminder that invoice {{.InvoiceNumber}} of {{.Amount}} is due on {{.DueAt}}.</p>
+<p><a href="{{.Link}}">View and pay the invoice</a></p>
+<p>{{.SiteName}}</p>`
+	DefaultReminderTemplateDue = `<p>Dear {{.User.Name}},</p>
+<p>Invoice {{.InvoiceNumber}} of {{.Amount}} is due today. Services in the invoice will be suspended if it is not paid.</p>
+<p><a href="{{.Link}}">View and pay the invoice</a></p>
+<p>{{.SiteName}}</p>`
+	DefaultReminderTemplateSuspended = `<p>Dear {{.User.Name}},</p>
+<p>Your service has been suspended because invoice {{.InvoiceNumber}} of {{.Amount}} is overdue. The service will be unsuspended once the invoice is paid, and terminated if it remains unpaid.</p>
+<p><a href="{{.Link}}">View and pay the invoice</a></p>
+<p>{{.SiteName}}</p>`
+)
+
+// ReminderData is the data used to render the subject and the body of reminder emails.
+type ReminderData struct {
+	SiteName      string
+	User          TemplateUser
+	Invoice       database.Invoice
+	InvoiceNumber string
+	Amount        string // amount with currency, e.g. "10.00 USD"
+	DueAt         string
+	Link          string // link to the invoice
+}
+
+type reminderStage struct {
+	subject  Setting
+	template Setting
+	critical bool // critical reminders are sent even if the user opted out of reminders
+}
+
+var reminderStages = map[string]reminderStage{
+	ReminderCreated:   {subject: SettingReminderSubjectCreated, template: SettingReminderTemplateCreated, critical: false},
+	ReminderUpcoming:  {subject: SettingReminderSubjectUpcoming, template: SettingReminderTemplateUpcoming, critical: false},
+	ReminderDue:       {subject: SettingReminderSubjectDue, template: SettingReminderTemplateDue, critical: true},
+	ReminderSuspended: {subject: SettingReminderSubjectSuspended, template: SettingReminderTemplateSuspended, critical: true},
+}
+
+// SendInvoiceReminders emails the owners of unpaid invoices that reached a reminder stage.
+func SendInvoiceReminders() error {
+	ctx := context.Background()
+
+	if SettingInvoiceReminders.Get(ctx) != "true" {
+		return nil
+	}
+
+	days := intSetting(ctx, SettingReminderDaysBeforeDue)
+
+	type batch struct {
+		stage string
+		find  func() ([]database.Invoice, error)
+	}
+	batches := []batch{
+		{ReminderCreated, func() ([]database.Invoice, error) { return database.Q.FindNewInvoicesWithoutReminder(ctx) }},
+		{ReminderUpcoming, func() ([]database.Invoice, error) {
+			return database.Q.FindUpcomingInvoicesWithoutReminder(ctx, int32(days))
+		}},
+		{ReminderDue, func() ([]database.Invoice, error) { return database.Q.FindDueInvoicesWithoutReminder(ctx) }},
+		{ReminderSuspended, func() ([]database.Invoice, error) { return database.Q.FindSuspendedInvoicesWithoutReminder(ctx) }},
+	}
+
+	for _, b := range batches {
+		invoices, err := b.find()
+		if err != nil {
+			return fmt.Errorf("db: %w", err)
+		}
+
+		for _, invoice := range invoices {
+			err = sendInvoiceReminder(ctx, b.stage, &invoice)
+			if err != nil {
+				slog.Error("send invoice reminder", "err", err, "invoice_id", invoice.ID, "stage", b.stage)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sendInvoiceReminder records the reminder for the invoice and emails the invoice owner, unless the reminder has
+// been sent before, or the reminder is not critical and the user opted out of reminders.
+func sendInvoiceReminder(ctx context.Context, stage string, invoice *database.Invoice) error {
+	s, ok := reminderStages[stage]
+	if !ok {
+		return fmt.Errorf("unknown reminder stage: %s", stage)
+	}
+
+	user, err := database.Q.FindUserById(ctx, invoice.UserID)
+	if err != nil {
+		return fmt.Errorf("find user: %w", err)
+	}
+
+	if !s.critical && !user.EmailReminders {
+		return nil
+	}
+
+	data := ReminderData{
+		SiteName:      SettingSiteName.Get(ctx),
+		User:          NewTemplateUser(&user),
+		Invoice:       *invoice,
+		InvoiceNumber: InvoiceNumber(invoice),
+		Amount:        invoice.Amount.StringFixed(2) + " " + invoice.Currency,
+		DueAt:         invoice.DueAt.Time.Format("2006-01-02"),
+		Link:          PUBLIC_DOMAIN + "/dashboard/invoice/" + strconv.Itoa(int(invoice.ID)),
+	}
+
+	subject, body, err := renderReminder(s.subject.Get(ctx), s.template.Get(ctx), &data)
+	if err != nil {
+		return err
+	}
+
+	// the reminder is recorded before it is sent, so that it is never sent twice
+	rows, err := database.Q.CreateInvoiceReminder(ctx, database.CreateInvoiceReminderParams{
+		InvoiceID: invoice.ID,
+		Stage:     stage,
+	})
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+	if rows == 0 {
+		return nil
+	}
+
+	slog.Info("send invoice reminder", "invoice_id", invoice.ID, "stage", stage, "user", user.ID)
+
+	return email.SendMailAsync(ctx, user.Email, subject, body)
+}
+
+func renderReminder(subjectTemplate string, bodyTemplate string, data *ReminderData) (string, string, error) {
+	st, err := template.New("subject").Parse(subjectTemplate)
+	if err != nil {
+		return "", "", fmt.Errorf("parse subject template: %w", err)
+	}
+	bt, err := htmltemplate.New("body").Parse(bodyTemplate)
+	if err != nil {
+		return "", "", fmt.Errorf("parse body template: %w", err)
+	}
+
+	var subject, body bytes.Buffer
+	err = st.Execute(&subject, data)
+	if err != nil {
+		return "", "", fmt.Errorf("execute subject template: %w", err)
+	}
+	err = bt.Execute(&body, data)
+	if err != nil {
+		return "", "", fmt.Errorf("execute body template: %w", err)
+	}
+
+	return subject.String(), body.String(), nil
+}
+
+func validateReminderSubject(value string) error {
+	_, err := template.New("subject").Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	return nil
+}
+
+func validateReminderTemplate(value string) error {
+	_, err := htmltemplate.New("body").Parse(value)
+	if err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,270 @@
+package service
+
+import (
+	"billing3/database"
+	"billing3/database/types"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	ReportGroupDay   = "day"
+	ReportGroupMonth = "month"
+
+	StatementInvoice    = "invoice"
+	StatementPayment    = "payment"
+	StatementRefund     = "refund"
+	StatementCreditNote = "credit_note"
+)
+
+// RecurringRevenue is the monthly and annual recurring revenue of active services in a currency.
+type RecurringRevenue struct {
+	Currency string          `json:"currency"`
+	Services int64           `json:"services"`
+	MRR      decimal.Decimal `json:"mrr"`
+	ARR      decimal.Decimal `json:"arr"`
+}
+
+// ChurnPeriod is the number of services cancelled in a month, and the recurring revenue lost by the cancellations.
+type ChurnPeriod struct {
+	Period        types.Timestamp            `json:"period"`
+	ActiveAtStart int64                      `json:"active_at_start"`
+	Cancellations int64                      `json:"cancellations"`
+	Rate          decimal.Decimal            `json:"rate"`     // cancellations divided by active_at_start
+	LostMRR       map[string]decimal.Decimal `json:"lost_mrr"` // by currency
+}
+
+// StatementEntry is an invoice, payment, refund or credit note on an account statement. Amount is positive if it
+// increases the amount owed by the user. Balance is the balance in the currency of the entry after the entry.
+type StatementEntry struct {
+	Date        types.Timestamp `json:"date"`
+	Type        string          `json:"type"`
+	Reference   string          `json:"reference"`
+	Description string          `json:"description"`
+	Currency    string          `json:"currency"`
+	Amount      decimal.Decimal `json:"amount"`
+	Balance     decimal.Decimal `json:"balance"`
+}
+
+// Statement is the account statement of a user from From (inclusive) to To (exclusive). Balances are by currency,
+// and positive if the user owes money.
+type Statement struct {
+	UserID         int32                      `json:"user_id"`
+	From           types.Timestamp            `json:"from"`
+	To             types.Timestamp            `json:"to"`
+	OpeningBalance map[string]decimal.Decimal `json:"opening_balance"`
+	ClosingBalance map[string]decimal.Decimal `json:"closing_balance"`
+	Entries        []StatementEntry           `json:"entries"`
+}
+
+// Timestamp returns t as a database timestamp.
+func Timestamp(t time.Time) types.Timestamp {
+	return types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: t}}
+}
+
+// RevenueByPeriod returns the payments received from from (inclusive) to to (exclusive) by day or month and currency,
+// net of refunds. Payments with account credit are not counted, as the credit was counted when it was deposited.
+func RevenueByPeriod(ctx context.Context, group string, from time.Time, to time.Time) ([]database.RevenueByPeriodRow, error) {
+	if group != ReportGroupDay && group != ReportGroupMonth {
+		return nil, errors.New("invalid group")
+	}
+
+	rows, err := database.Q.RevenueByPeriod(ctx, database.RevenueByPeriodParams{
+		Period:  group,
+		StartAt: Timestamp(from),
+		EndAt:   Timestamp(to),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+	return rows, nil
+}
+
+// MonthlyRecurringRevenue returns the recurring revenue of active services by currency. The price of services with
+// billing cycles that are not calendar months is normalized to an average month.
+func MonthlyRecurringRevenue(ctx context.Context) ([]RecurringRevenue, error) {
+	rows, err := database.Q.MonthlyRecurringRevenue(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	revenue := make([]RecurringRevenue, 0, len(rows))
+	for _, row := range rows {
+		mrr := row.Mrr.Round(2)
+		revenue = append(revenue, RecurringRevenue{
+			Currency: row.Currency,
+			Services: row.Services,
+			MRR:      mrr,
+			ARR:      mrr.Mul(decimal.NewFromInt(12)),
+		})
+	}
+	return revenue, nil
+}
+
+// Churn returns the services cancelled in each month from the month of from to the month before to, including services
+// terminated for non-payment by ProcessOverdueServices. Services that were cancelled because their first invoice was
+// not paid are not counted, as they were never active.
+func Churn(ctx context.Context, from time.Time, to time.Time) ([]ChurnPeriod, error) {
+	from = time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	rows, err := database.Q.ChurnByMonth(ctx, database.ChurnByMonthParams{
+		StartAt: Timestamp(from),
+		EndAt:   Timestamp(to),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	periods := make([]ChurnPeriod, 0)
+	for month := from; month.Before(to); month = month.AddDate(0, 1, 0) {
+		active, err := database.Q.CountServicesActiveAt(ctx, Timestamp(month))
+		if err != nil {
+			return nil, fmt.Errorf("db: %w", err)
+		}
+
+		period := ChurnPeriod{
+			Period:        Timestamp(month),
+			ActiveAtStart: active,
+			Rate:          decimal.Zero,
+			LostMRR:       make(map[string]decimal.Decimal),
+		}
+		for _, row := range rows {
+			if !row.Period.Time.Equal(month) {
+				continue
+			}
+			period.Cancellations += row.Cancellations
+			period.LostMRR[row.Currency] = row.LostMrr.Round(2)
+		}
+		if active > 0 {
+			period.Rate = decimal.NewFromInt(period.Cancellations).Div(decimal.NewFromInt(active)).Round(4)
+		}
+
+		periods = append(periods, period)
+	}
+
+	return periods, nil
+}
+
+// AccountStatement returns the account statement of the user from from (inclusive) to to (exclusive).
+//
+// Invoices that were cancelled before being paid are left out. Payments with account credit are included, as they
+// settle invoices.
+func AccountStatement(ctx context.Context, userId int32, from time.Time, to time.Time) (*Statement, error) {
+	opening, err := statementBalance(ctx, userId, from)
+	if err != nil {
+		return nil, err
+	}
+
+	invoices, err := database.Q.ListStatementInvoices(ctx, database.ListStatementInvoicesParams{
+		UserID:  userId,
+		StartAt: Timestamp(from),
+		EndAt:   Timestamp(to),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	payments, err := database.Q.ListStatementPayments(ctx, database.ListStatementPaymentsParams{
+		UserID:  userId,
+		StartAt: Timestamp(from),
+		EndAt:   Timestamp(to),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	creditNotes, err := database.Q.ListStatementCreditNotes(ctx, database.ListStatementCreditNotesParams{
+		UserID:  userId,
+		StartAt: Timestamp(from),
+		EndAt:   Timestamp(to),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	entries := make([]StatementEntry, 0, len(invoices)+len(payments)+len(creditNotes))
+	for _, invoice := range invoices {
+		entries = append(entries, StatementEntry{
+			Date:        invoice.CreatedAt,
+			Type:        StatementInvoice,
+			Reference:   InvoiceNumber(&invoice),
+			Description: "Invoice " + InvoiceNumber(&invoice),
+			Currency:    invoice.Currency,
+			Amount:      invoice.Amount,
+		})
+	}
+	for _, payment := range payments {
+		typ := StatementPayment
+		if payment.RefundOf.Valid {
+			typ = StatementRefund
+		}
+		number := payment.Number
+		if number == "" {
+			number = "#" + strconv.Itoa(int(payment.InvoiceID))
+		}
+		entries = append(entries, StatementEntry{
+			Date:        payment.CreatedAt,
+			Type:        typ,
+			Reference:   number,
+			Description: payment.Gateway + ": " + payment.Description,
+			Currency:    payment.Currency,
+			Amount:      payment.Amount.Neg(),
+		})
+	}
+	for _, creditNote := range creditNotes {
+		entries = append(entries, StatementEntry{
+			Date:        creditNote.CreatedAt,
+			Type:        StatementCreditNote,
+			Reference:   creditNote.Number,
+			Description: "Credit note " + creditNote.Number + ": " + creditNote.Reason,
+			Currency:    creditNote.Currency,
+			Amount:      creditNote.Amount.Neg(),
+		})
+	}
+
+	slices.SortStableFunc(entries, func(a, b StatementEntry) int {
+		return a.Date.Time.Compare(b.Date.Time)
+	})
+
+	closing := make(map[string]decimal.Decimal, len(opening))
+	for currency, balance := range opening {
+		closing[currency] = balance
+	}
+	for i := range entries {
+		closing[entries[i].Currency] = closing[entries[i].Currency].Add(entries[i].Amount)
+		entries[i].Balance = closing[entries[i].Currency]
+	}
+
+	return &Statement{
+		UserID:         userId,
+		From:           Timestamp(from),
+		To:             Timestamp(to),
+		OpeningBalance: opening,
+		ClosingBalance: closing,
+		Entries:        entries,
+	}, nil
+}
+
+// statementBalance returns the balance of the user by currency before at.
+func statementBalance(ctx context.Context, userId int32, at time.Time) (map[string]decimal.Decimal, error) {
+	rows, err := database.Q.StatementBalance(ctx, database.StatementBalanceParams{
+		UserID: userId,
+		At:     Timestamp(at),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	balance := make(map[string]decimal.Decimal, len(rows))
+	for _, row := range rows {
+		balance[row.Currency] = row.Balance
+	}
+	return balance, nil
+}
@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 
 	"github.com/jackc/pgx/v5"
 )
@@ -17,6 +18,8 @@ const (
 	ServiceCancelled = "CANCELLED"
 	ServiceSuspended = "SUSPENDED"
 	ServiceUnpaid    = "UNPAID"
+
+	ServicePendingReview = "PENDING_REVIEW" // held by the fraud checks until approved or rejected by an admin
 )
 
 // ServiceAdminActions returns a list of action that can be preformed on this service, by an admin
@@ -75,31 +78,32 @@ func ServiceClientActions(ctx context.Context, serviceId int32) ([]string, error
 	return actions, nil
 }
 
-// CancelOverdueServices terminates overdue services
-func CancelOverdueServices() error {
-	ctx := context.Background()
-
-	services, err := database.Q.FindOverdueServices(ctx)
+func IsServiceOwner(ctx context.Context, userId int32, serviceId int32) (bool, error) {
+	s, err := database.Q.FindServiceById(ctx, serviceId)
 	if err != nil {
-		return fmt.Errorf("db: %w", err)
+		return false, fmt.Errorf("db: %w", err)
 	}
+	return s.UserID == userId, nil
+}
 
-	for _, service := range services {
-		slog.Info("terminate overdue service", "id", service.ID)
-
-		err := extension.DoActionAsync(ctx, service.Extension, service.ID, "terminate", ServiceCancelled)
-		if err != nil {
-			slog.Error("terminate overdue service", "id", service.ID, "err", err, "extension", service.Extension)
-		}
+// ProvisionService creates a PENDING service through its extension, if the extension supports the "create" action.
+// The status of the service is changed to ACTIVE once it is created.
+func ProvisionService(ctx context.Context, s *database.Service) error {
+	ext, ok := extension.Extensions[s.Extension]
+	if !ok {
+		return fmt.Errorf("extension %s not found", s.Extension)
 	}
 
-	return nil
-}
-
-func IsServiceOwner(ctx context.Context, userId int32, serviceId int32) (bool, error) {
-	s, err := database.Q.FindServiceById(ctx, serviceId)
+	actions, err := ext.AdminActions(s.ID)
 	if err != nil {
-		return false, fmt.Errorf("db: %w", err)
+		return fmt.Errorf("extension admin actions: %w", err)
 	}
-	return s.UserID == userId, nil
+
+	if !slices.Contains(actions, "create") {
+		return nil
+	}
+
+	slog.Info("create service", "service_id", s.ID)
+
+	return extension.DoActionAsync(ctx, s.Extension, s.ID, "create", ServiceActive)
 }
@@ -14,12 +14,107 @@ var (
 	SettingTurnstileSiteKey = newSetting("cf_turnstile_site_key", "", true)
 	SettingTurnstileSecret  = newSetting("cf_turnstile_secret", "", false)
 	SettingIndexMarkdown    = newSetting("index_markdown", "# Welcome to billing3", true)
+	SettingCreditAutoApply  = newSetting("credit_auto_apply", "false", false)
+	SettingDefaultCurrency  = newSetting("default_currency", "USD", true).withValidator(validateDefaultCurrency)
+	SettingExchangeRates    = newSetting("exchange_rates", "{}", true).withValidator(validateExchangeRates)
+	SettingCompanyName      = newSetting("company_name", "", false)
+	SettingCompanyAddress   = newSetting("company_address", "", false)
+	SettingCompanyVatID     = newSetting("company_vat_id", "", false)
+	SettingCompanyEmail     = newSetting("company_email", "", false)
+	SettingInvoiceTemplate  = newSetting("invoice_template", DefaultInvoiceTemplate, false).withValidator(validateInvoiceTemplate)
+
+	SettingInvoiceNumberPrefix      = newSetting("invoice_number_prefix", "INV-", false)
+	SettingInvoiceNumberYearlyReset = newSetting("invoice_number_yearly_reset", "true", false).withValidator(validateBool)
+	SettingInvoiceNumberPadding     = newSetting("invoice_number_padding", "6", false).withValidator(validateInvoiceNumberPadding)
+	SettingInvoiceNumberAssign      = newSetting("invoice_number_assign", InvoiceNumberOnPaid, false).withValidator(validateInvoiceNumberAssign)
+	SettingCreditNoteNumberPrefix   = newSetting("credit_note_number_prefix", "CN-", false)
+
+	SettingUnpaidServiceDueHours        = newSetting("unpaid_service_due_hours", "24", false).withValidator(validateNonNegativeInt)
+	SettingInvoiceDaysBeforeExpiry      = newSetting("invoice_days_before_expiry", "7", false).withValidator(validateNonNegativeInt)
+	SettingSuspendDaysAfterDue          = newSetting("suspend_days_after_due", "0", false).withValidator(validateNonNegativeInt)
+	SettingTerminateDaysAfterSuspension = newSetting("terminate_days_after_suspension", "7", false).withValidator(validateNonNegativeInt)
+
+	SettingInvoiceConsolidation           = newSetting("invoice_consolidation", "false", false).withValidator(validateBool)
+	SettingInvoiceConsolidationWindowDays = newSetting("invoice_consolidation_window_days", "7", false).withValidator(validateNonNegativeInt)
+
+	SettingLateFee          = newSetting("late_fee", "", false).withValidator(validateLateFee)
+	SettingLateFeeGraceDays = newSetting("late_fee_grace_days", "0", false).withValidator(validateNonNegativeInt)
+
+	SettingInvoiceReminders          = newSetting("invoice_reminders", "true", false).withValidator(validateBool)
+	SettingReminderDaysBeforeDue     = newSetting("reminder_days_before_due", "3", false).withValidator(validateNonNegativeInt)
+	SettingReminderSubjectCreated    = newSetting("reminder_subject_created", DefaultReminderSubjectCreated, false).withValidator(validateReminderSubject)
+	SettingReminderSubjectUpcoming   = newSetting("reminder_subject_upcoming", DefaultReminderSubjectUpcoming, false).withValidator(validateReminderSubject)
+	SettingReminderSubjectDue        = newSetting("reminder_subject_due", DefaultReminderSubjectDue, false).withValidator(validateReminderSubject)
+	SettingReminderSubjectSuspended  = newSetting("reminder_subject_suspended", DefaultReminderSubjectSuspended, false).withValidator(validateReminderSubject)
+	SettingReminderTemplateCreated   = newSetting("reminder_template_created", DefaultReminderTemplateCreated, false).withValidator(validateReminderTemplate)
+	SettingReminderTemplateUpcoming  = newSetting("reminder_template_upcoming", DefaultReminderTemplateUpcoming, false).withValidator(validateReminderTemplate)
+	SettingReminderTemplateDue       = newSetting("reminder_template_due", DefaultReminderTemplateDue, false).withValidator(validateReminderTemplate)
+	SettingReminderTemplateSuspended = newSetting("reminder_template_suspended", DefaultReminderTemplateSuspended, false).withValidator(validateReminderTemplate)
+
+	SettingAffiliateHoldDays  = newSetting("affiliate_commission_hold_days", "30", false).withValidator(validateNonNegativeInt)
+	SettingAffiliateMinPayout = newSetting("affiliate_min_payout", "0", false).withValidator(validateNonNegativeDecimal)
+
+	SettingAccountingReceivableAccount = newSetting("accounting_receivable_account", "Accounts Receivable", false)
+	SettingAccountingSalesAccount      = newSetting("accounting_sales_account", "Sales", false)
+	SettingAccountingTaxAccount        = newSetting("accounting_tax_account", "Sales Tax Payable", false)
+	SettingAccountingBankAccount       = newSetting("accounting_bank_account", "Undeposited Funds", false)
+	SettingAccountingCreditAccount     = newSetting("accounting_credit_account", "Customer Credit", false)
+
+	SettingFraudMaxOrdersPerDay      = newSetting("fraud_max_orders_per_day", "0", false).withValidator(validateNonNegativeInt)
+	SettingFraudEmailDomainBlocklist = newSetting("fraud_email_domain_blocklist", "", false)
+	SettingFraudCountryMismatch      = newSetting("fraud_country_mismatch", "false", false).withValidator(validateBool)
+
+	// the CF-Connecting-IP and CF-IPCountry headers can be set by anyone unless the site is only reachable
+	// through Cloudflare, they are ignored if this is false
+	SettingBehindCloudflare = newSetting("behind_cloudflare", "false", false).withValidator(validateBool)
 
 	Settings = []Setting{
 		SettingSiteName,
 		SettingTurnstileSiteKey,
 		SettingTurnstileSecret,
 		SettingIndexMarkdown,
+		SettingCreditAutoApply,
+		SettingDefaultCurrency,
+		SettingExchangeRates,
+		SettingCompanyName,
+		SettingCompanyAddress,
+		SettingCompanyVatID,
+		SettingCompanyEmail,
+		SettingInvoiceTemplate,
+		SettingInvoiceNumberPrefix,
+		SettingInvoiceNumberYearlyReset,
+		SettingInvoiceNumberPadding,
+		SettingInvoiceNumberAssign,
+		SettingCreditNoteNumberPrefix,
+		SettingUnpaidServiceDueHours,
+		SettingInvoiceDaysBeforeExpiry,
+		SettingSuspendDaysAfterDue,
+		SettingTerminateDaysAfterSuspension,
+		SettingInvoiceConsolidation,
+		SettingInvoiceConsolidationWindowDays,
+		SettingLateFee,
+		SettingLateFeeGraceDays,
+		SettingInvoiceReminders,
+		SettingReminderDaysBeforeDue,
+		SettingReminderSubjectCreated,
+		SettingReminderSubjectUpcoming,
+		SettingReminderSubjectDue,
+		SettingReminderSubjectSuspended,
+		SettingReminderTemplateCreated,
+		SettingReminderTemplateUpcoming,
+		SettingReminderTemplateDue,
+		SettingReminderTemplateSuspended,
+		SettingAffiliateHoldDays,
+		SettingAffiliateMinPayout,
+		SettingAccountingReceivableAccount,
+		SettingAccountingSalesAccount,
+		SettingAccountingTaxAccount,
+		SettingAccountingBankAccount,
+		SettingAccountingCreditAccount,
+		SettingFraudMaxOrdersPerDay,
+		SettingFraudEmailDomainBlocklist,
+		SettingFraudCountryMismatch,
+		SettingBehindCloudflare,
 	}
 )
 
@@ -35,6 +130,13 @@ type Setting struct {
 	key          string
 	defaultValue string
 	public       bool
+	validator    func(string) error
+}
+
+// withValidator sets a function that validates new values of the setting.
+func (s Setting) withValidator(validator func(string) error) Setting {
+	s.validator = validator
+	return s
 }
 
 func (s Setting) Key() string {
@@ -45,6 +147,14 @@ func (s Setting) IsPublic() bool {
 	return s.public
 }
 
+// Validate returns an error if value is not a valid value of the setting.
+func (s Setting) Validate(value string) error {
+	if s.validator == nil {
+		return nil
+	}
+	return s.validator(value)
+}
+
 func (s Setting) Get(ctx context.Context) string {
 	ss, err := database.Q.FindSettingByKey(ctx, s.key)
 	if err != nil {
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"billing3/database"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+// Tax is the tax applied to an order or invoice. A snapshot of it is stored on every invoice,
+// so that changing tax rules does not affect existing invoices.
+type Tax struct {
+	Name          string          `json:"tax_name"`
+	Rate          decimal.Decimal `json:"tax_rate"` // percentage, e.g. 20 for 20%
+	Inclusive     bool            `json:"tax_inclusive"`
+	ReverseCharge bool            `json:"reverse_charge"`
+}
+
+// FindTax returns the tax applicable to the user according to the country and state of their
+// address. A zero Tax is returned if no tax rule matches.
+func FindTax(ctx context.Context, qtx *database.Queries, user *database.User) (Tax, error) {
+	if !user.Country.Valid || user.Country.String == "" {
+		return Tax{}, nil
+	}
+
+	rule, err := qtx.FindTaxRule(ctx, database.FindTaxRuleParams{
+		Country: user.Country.String,
+		State:   user.State.String,
+	})
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Tax{}, nil
+		}
+		return Tax{}, fmt.Errorf("find tax rule: %w", err)
+	}
+
+	return Tax{
+		Name:      rule.Name,
+		Rate:      rule.Rate,
+		Inclusive: rule.Inclusive,
+		// businesses with a validated VAT ID account for the tax themselves
+		ReverseCharge: rule.ReverseCharge && user.VatIDValid,
+	}, nil
+}
+
+// TaxFromInvoice returns the tax snapshot stored on the invoice.
+func TaxFromInvoice(invoice *database.Invoice) Tax {
+	return Tax{
+		Name:          invoice.TaxName,
+		Rate:          invoice.TaxRate,
+		Inclusive:     invoice.TaxInclusive,
+		ReverseCharge: invoice.ReverseCharge,
+	}
+}
+
+// Apply calculates the tax of amount, which is the sum of the items of an order or invoice.
+// It returns the subtotal excluding tax, the tax and the total to be paid.
+//
+// Item prices include the tax if the tax is inclusive. If reverse charge applies, no tax is
+// charged, and inclusive prices are reduced to their net amount.
+func (t Tax) Apply(amount decimal.Decimal) (subtotal decimal.Decimal, tax decimal.Decimal, total decimal.Decimal) {
+	if t.Rate.LessThanOrEqual(decimal.Zero) {
+		return amount, decimal.Zero, amount
+	}
+
+	rate := t.Rate.Div(decimal.NewFromInt(100))
+
+	if t.Inclusive {
+		subtotal = amount.Div(rate.Add(decimal.NewFromInt(1))).Round(2)
+		if t.ReverseCharge {
+			return subtotal, decimal.Zero, subtotal
+		}
+		return subtotal, amount.Sub(subtotal), amount
+	}
+
+	if t.ReverseCharge {
+		return amount, decimal.Zero, amount
+	}
+	tax = amount.Mul(rate).Round(2)
+	return amount, tax, amount.Add(tax)
+}
+
+// RecalculateInvoiceAmount updates the subtotal, tax and amount of the invoice from its items,
+// using the tax snapshot of the invoice. It must be called whenever invoice items change.
+func RecalculateInvoiceAmount(ctx context.Context, qtx *database.Queries, invoiceId int32) error {
+	invoice, err := qtx.FindInvoiceById(ctx, invoiceId)
+	if err != nil {
+		return fmt.Errorf("find invoice: %w", err)
+	}
+
+	sum, err := qtx.SumInvoiceItems(ctx, invoiceId)
+	if err != nil {
+		return fmt.Errorf("sum invoice items: %w", err)
+	}
+
+	subtotal, tax, total := TaxFromInvoice(&invoice).Apply(sum)
+
+	err = qtx.UpdateInvoiceTotals(ctx, database.UpdateInvoiceTotalsParams{
+		Subtotal: subtotal,
+		Tax:      tax,
+		Amount:   total,
+		ID:       invoiceId,
+	})
+	if err != nil {
+		return fmt.Errorf("update invoice totals: %w", err)
+	}
+
+	return nil
+}
+
+const viesApi = "https://ec.europa.eu/taxation_customs/vies/rest-api/ms/%s/vat/%s"
+
+var vatIdRegex = regexp.MustCompile(`^([A-Z]{2})([0-9A-Z+*]{2,12})$`)
+
+var viesClient = &http.Client{Timeout: 10 * time.Second}
+
+// NormalizeVatID removes spaces and punctuation from a VAT ID, and converts it to upper case.
+func NormalizeVatID(vatId string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '.', '-':
+			return -1
+		}
+		return r
+	}, strings.ToUpper(vatId))
+}
+
+// ValidateVatID checks an EU VAT ID (e.g. DE123456789) against the VIES service of the European Commission.
+// ErrInvalidVatID is returned if the VAT ID is not valid, and ErrVatIDValidationUnavailable if
+// VIES could not be reached.
+func ValidateVatID(ctx context.Context, vatId string) error {
+	matches := vatIdRegex.FindStringSubmatch(NormalizeVatID(vatId))
+	if matches == nil {
+		return ErrInvalidVatID
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(viesApi, matches[1], matches[2]), nil)
+	if err != nil {
+		return fmt.Errorf("new request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := viesClient.Do(req)
+	if err != nil {
+		slog.Error("vies request", "err", err, "vat id", vatId)
+		return ErrVatIDValidationUnavailable
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		IsValid   bool   `json:"isValid"`
+		UserError string `json:"userError"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		slog.Error("vies response", "err", err, "status", resp.StatusCode, "vat id", vatId)
+		return ErrVatIDValidationUnavailable
+	}
+
+	if result.IsValid {
+		return nil
+	}
+	if result.UserError != "" && result.UserError != "VALID" && result.UserError != "INVALID" {
+		// e.g. MS_UNAVAILABLE, TIMEOUT
+		slog.Warn("vies unavailable", "err", result.UserError, "vat id", vatId)
+		return ErrVatIDValidationUnavailable
+	}
+	return ErrInvalidVatID
+}
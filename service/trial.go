@@ -0,0 +1,71 @@
+package service
+
+import (
+	"billing3/database"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// CheckTrialEligibility returns an error if the user may not start a free trial of the product.
+//
+// If the product allows one trial per user, the user must not have had a trial of the product, either with the
+// same account or with the same email address. If the product requires a payment method, the user must have paid
+// through a payment gateway before, as payment methods are not stored.
+//
+// qtx should be a transaction. The user is locked until the transaction ends, so that trials are not started
+// concurrently. qtx is not commited.
+func CheckTrialEligibility(ctx context.Context, qtx *database.Queries, user *database.User, product *database.Product) error {
+	if product.TrialDays <= 0 {
+		return ErrTrialNotAvailable
+	}
+
+	_, err := qtx.FindUserByIdForUpdate(ctx, user.ID)
+	if err != nil {
+		return fmt.Errorf("lock user: %w", err)
+	}
+
+	if product.TrialOncePerUser {
+		count, err := qtx.CountTrials(ctx, database.CountTrialsParams{
+			ProductID: product.ID,
+			UserID:    pgtype.Int4{Valid: true, Int32: user.ID},
+			Email:     strings.ToLower(user.Email),
+		})
+		if err != nil {
+			return fmt.Errorf("db: %w", err)
+		}
+		if count > 0 {
+			return ErrTrialUsed
+		}
+	}
+
+	if product.TrialRequiresPaymentMethod {
+		count, err := qtx.CountUserGatewayPayments(ctx, user.ID)
+		if err != nil {
+			return fmt.Errorf("db: %w", err)
+		}
+		if count == 0 {
+			return ErrTrialPaymentMethodRequired
+		}
+	}
+
+	return nil
+}
+
+// RecordTrial records that the user started a free trial of the product with the service.
+//
+// qtx should be a transaction. qtx is not commited.
+func RecordTrial(ctx context.Context, qtx *database.Queries, user *database.User, product *database.Product, serviceId int32) error {
+	err := qtx.CreateTrial(ctx, database.CreateTrialParams{
+		ProductID: product.ID,
+		UserID:    pgtype.Int4{Valid: true, Int32: user.ID},
+		Email:     strings.ToLower(user.Email),
+		ServiceID: pgtype.Int4{Valid: true, Int32: serviceId},
+	})
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,417 @@
+package service
+
+import (
+	"billing3/database"
+	"billing3/database/types"
+	"billing3/service/extension"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	ServiceUpgradePending   = "PENDING"
+	ServiceUpgradeApplied   = "APPLIED"
+	ServiceUpgradeCancelled = "CANCELLED"
+
+	InvoiceItemUpgrade = "upgrade"
+
+	CreditDowngrade = "DOWNGRADE"
+)
+
+type UpgradeRequest struct {
+	ProductID int               `json:"product_id" validate:"required"`
+	Options   map[string]string `json:"options"` // options that are not specified are kept unchanged
+}
+
+// UpgradeQuote is the prorated price of changing the product or options of a service.
+type UpgradeQuote struct {
+	ProductID    int32           `json:"product_id"`
+	Currency     string          `json:"currency"`
+	CurrentPrice decimal.Decimal `json:"current_price"`
+	NewPrice     decimal.Decimal `json:"new_price"`
+	Remaining    int64           `json:"remaining"` // seconds until the service expires
+	Amount       decimal.Decimal `json:"amount"`    // positive if charged, negative if credited
+
+	product         *database.Product
+	settings        types.ServiceSettings
+	redactedOptions map[string]string
+}
+
+// UpgradeTargets returns the products a service can be upgraded or downgraded to.
+// These are the enabled products in the same category as the service's product, that use the same
+// extension and are available for the service's billing cycle. The current product is included
+// so that its options can be changed.
+func UpgradeTargets(ctx context.Context, s *database.Service) ([]database.Product, error) {
+	if !s.ProductID.Valid {
+		return nil, ErrUpgradeNotAvailable
+	}
+
+	current, err := database.Q.FindProductById(ctx, s.ProductID.Int32)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrUpgradeNotAvailable
+		}
+		return nil, fmt.Errorf("find product: %w", err)
+	}
+
+	products, err := database.Q.FindEnabledProductsByCategory(ctx, current.CategoryID)
+	if err != nil {
+		return nil, fmt.Errorf("find products: %w", err)
+	}
+
+	targets := make([]database.Product, 0)
+	for _, p := range products {
+		if p.Extension != s.Extension {
+			continue
+		}
+		if !slices.ContainsFunc(p.Pricing, func(price types.ProductPrice) bool {
+			return price.Duration == s.BillingCycle && price.Months == s.BillingCycleMonths
+		}) {
+			continue
+		}
+		targets = append(targets, p)
+	}
+
+	return targets, nil
+}
+
+// CalculateUpgrade calculates the prorated price of changing the service to the requested product
+// and options, for the time remaining until the service expires.
+func CalculateUpgrade(ctx context.Context, s *database.Service, req UpgradeRequest, user *database.User) (*UpgradeQuote, error) {
+	if s.Status != ServiceActive {
+		return nil, ErrUpgradeNotAvailable
+	}
+
+	targets, err := UpgradeTargets(ctx, s)
+	if err != nil {
+		if errors.Is(err, ErrUpgradeNotAvailable) {
+			return nil, err
+		}
+		slog.Error("upgrade targets", "err", err, "service", s.ID)
+		return nil, ErrInternalError
+	}
+	if !slices.ContainsFunc(targets, func(p database.Product) bool { return p.ID == int32(req.ProductID) }) {
+		return nil, fmt.Errorf("the service cannot be changed to this product")
+	}
+
+	if s.BillingCycle <= 0 || !s.ExpiresAt.Valid {
+		return nil, ErrUpgradeNotAvailable
+	}
+	remaining := time.Until(s.ExpiresAt.Time)
+	if remaining <= 0 {
+		return nil, ErrUpgradeNotAvailable
+	}
+
+	// options that are not specified keep their current value
+	options := make(map[string]string)
+	for k, v := range s.Settings {
+		options[k] = v
+	}
+	for k, v := range req.Options {
+		options[k] = v
+	}
+
+	product, cleanedOptions, redactedOptions, pricing, err := CalculatePricing(ctx, OrderRequest{
+		ProductID: req.ProductID,
+		Duration:  int(s.BillingCycle),
+		Options:   options,
+		Currency:  s.Currency,
+	}, user)
+	if err != nil {
+		return nil, err
+	}
+
+	if pricing.Currency != s.Currency {
+		return nil, fmt.Errorf("the product is not available in %s", s.Currency)
+	}
+
+	// options overwrite product settings, which overwrite the current settings
+	settings := make(types.ServiceSettings)
+	for k, v := range s.Settings {
+		settings[k] = v
+	}
+	for k, v := range product.Settings {
+		settings[k] = v
+	}
+	for k, v := range cleanedOptions {
+		settings[k] = v
+	}
+
+	if product.ID == s.ProductID.Int32 && maps.Equal(settings, s.Settings) {
+		return nil, fmt.Errorf("nothing to change")
+	}
+
+	cycleLength := s.ExpiresAt.Time.Sub(ServiceBillingCycle(s).Previous(s.ExpiresAt.Time))
+	fraction := decimal.NewFromInt(int64(remaining / time.Second)).Div(decimal.NewFromInt(int64(cycleLength / time.Second)))
+	if fraction.GreaterThan(decimal.NewFromInt(1)) {
+		fraction = decimal.NewFromInt(1)
+	}
+
+	return &UpgradeQuote{
+		ProductID:    product.ID,
+		Currency:     s.Currency,
+		CurrentPrice: s.Price,
+		NewPrice:     pricing.RecurringFee,
+		Remaining:    int64(remaining / time.Second),
+		Amount:       RoundCurrency(pricing.RecurringFee.Sub(s.Price).Mul(fraction), s.Currency),
+
+		product:         product,
+		settings:        settings,
+		redactedOptions: redactedOptions,
+	}, nil
+}
+
+// UpgradeService changes the product or options of a service.
+//
+// If the prorated amount is positive, an upgrade invoice is created and the change is applied
+// when the invoice is paid. Otherwise, the change is applied immediately and the prorated amount
+// is added to the user's credit.
+//
+// tx is not commited.
+//
+// UpgradeService returns the id of the upgrade invoice (0 if no invoice is created), and the
+// amount credited to the user in the default currency. Errors other than ErrInternalError are
+// caused by an invalid request.
+func UpgradeService(ctx context.Context, tx pgx.Tx, serviceId int32, req UpgradeRequest, user *database.User) (int32, decimal.Decimal, error) {
+	qtx := database.Q.WithTx(tx)
+
+	// lock the service row
+	s, err := qtx.FindServiceByIdForUpdate(ctx, serviceId)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, decimal.Zero, ErrNotFound
+		}
+		slog.Error("upgrade service: find service", "err", err, "service", serviceId)
+		return 0, decimal.Zero, ErrInternalError
+	}
+
+	// renewal and upgrade invoices must be paid first
+	unpaid, err := qtx.CountUnpaidInvoiceForService(ctx, pgtype.Int4{Valid: true, Int32: serviceId})
+	if err != nil {
+		slog.Error("upgrade service: count unpaid invoices", "err", err, "service", serviceId)
+		return 0, decimal.Zero, ErrInternalError
+	}
+	if unpaid > 0 {
+		return 0, decimal.Zero, ErrUnpaidInvoiceExists
+	}
+
+	pending, err := qtx.CountPendingServiceUpgrades(ctx, serviceId)
+	if err != nil {
+		slog.Error("upgrade service: count pending upgrades", "err", err, "service", serviceId)
+		return 0, decimal.Zero, ErrInternalError
+	}
+	if pending > 0 {
+		return 0, decimal.Zero, ErrUpgradePending
+	}
+
+	quote, err := CalculateUpgrade(ctx, &s, req, user)
+	if err != nil {
+		return 0, decimal.Zero, err
+	}
+
+	slog.Info("upgrade service", "service", serviceId, "product", quote.ProductID, "options", quote.redactedOptions, "current price", quote.CurrentPrice, "new price", quote.NewPrice, "amount", quote.Amount, "currency", quote.Currency, "user", user.ID)
+
+	if quote.Amount.LessThanOrEqual(decimal.Zero) {
+		// downgrade, or an upgrade that costs nothing for the remaining time
+		upgradeId, err := qtx.CreateServiceUpgrade(ctx, database.CreateServiceUpgradeParams{
+			ServiceID: serviceId,
+			InvoiceID: pgtype.Int4{Valid: false},
+			ProductID: quote.ProductID,
+			Settings:  quote.settings,
+			Price:     quote.NewPrice,
+			Amount:    quote.Amount,
+			Status:    ServiceUpgradePending,
+		})
+		if err != nil {
+			slog.Error("upgrade service: create service upgrade", "err", err, "service", serviceId)
+			return 0, decimal.Zero, ErrInternalError
+		}
+
+		err = ApplyServiceUpgrade(ctx, tx, upgradeId)
+		if err != nil {
+			slog.Error("upgrade service", "err", err, "service", serviceId)
+			return 0, decimal.Zero, ErrInternalError
+		}
+
+		if quote.Amount.IsZero() {
+			return 0, decimal.Zero, nil
+		}
+
+		credit, err := ConvertCurrency(ctx, quote.Amount.Neg(), s.Currency, DefaultCurrency(ctx))
+		if err != nil {
+			slog.Error("upgrade service: convert currency", "err", err, "service", serviceId)
+			return 0, decimal.Zero, ErrInternalError
+		}
+		_, err = AddCredit(ctx, qtx, s.UserID, credit, CreditDowngrade, fmt.Sprintf("Downgrade of service #%d (%s %s)", serviceId, quote.Amount.Neg().StringFixed(2), s.Currency), pgtype.Int4{Valid: false})
+		if err != nil {
+			slog.Error("upgrade service", "err", err, "service", serviceId)
+			return 0, decimal.Zero, ErrInternalError
+		}
+
+		return 0, credit, nil
+	}
+
+	// upgrade invoice
+	tax, err := FindTax(ctx, qtx, user)
+	if err != nil {
+		slog.Error("upgrade service", "err", err, "service", serviceId)
+		return 0, decimal.Zero, ErrInternalError
+	}
+
+	invoiceId, err := qtx.CreateInvoice(ctx, database.CreateInvoiceParams{
+		UserID:             s.UserID,
+		Status:             InvoiceUnpaid,
+		CancellationReason: pgtype.Text{Valid: false},
+		PaidAt:             types.Timestamp{Timestamp: pgtype.Timestamp{Valid: false}},
+		DueAt:              types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: UnpaidServiceDueTime(ctx)}},
+		Amount:             quote.Amount,
+		Currency:           s.Currency,
+		TaxRate:            tax.Rate,
+		TaxName:            tax.Name,
+		TaxInclusive:       tax.Inclusive,
+		ReverseCharge:      tax.ReverseCharge,
+	})
+	if err != nil {
+		slog.Error("upgrade service: create invoice", "err", err, "service", serviceId)
+		return 0, decimal.Zero, ErrInternalError
+	}
+
+	upgradeId, err := qtx.CreateServiceUpgrade(ctx, database.CreateServiceUpgradeParams{
+		ServiceID: serviceId,
+		InvoiceID: pgtype.Int4{Valid: true, Int32: invoiceId},
+		ProductID: quote.ProductID,
+		Settings:  quote.settings,
+		Price:     quote.NewPrice,
+		Amount:    quote.Amount,
+		Status:    ServiceUpgradePending,
+	})
+	if err != nil {
+		slog.Error("upgrade service: create service upgrade", "err", err, "service", serviceId)
+		return 0, decimal.Zero, ErrInternalError
+	}
+
+	err = qtx.CreateInvoiceItem(ctx, database.CreateInvoiceItemParams{
+		InvoiceID:   invoiceId,
+		Description: fmt.Sprintf("#%d - %s - Upgrade to %s (until %s)", serviceId, s.Label, quote.product.Name, s.ExpiresAt.Time.Format("2006-01-02 MST")),
+		Amount:      quote.Amount,
+		Type:        InvoiceItemUpgrade,
+		ItemID:      pgtype.Int4{Valid: true, Int32: upgradeId},
+	})
+	if err != nil {
+		slog.Error("upgrade service: create invoice item", "err", err, "service", serviceId)
+		return 0, decimal.Zero, ErrInternalError
+	}
+
+	err = RecalculateInvoiceAmount(ctx, qtx, invoiceId)
+	if err != nil {
+		slog.Error("upgrade service", "err", err, "service", serviceId)
+		return 0, decimal.Zero, ErrInternalError
+	}
+
+	err = assignInvoiceNumberOnIssue(ctx, qtx, invoiceId)
+	if err != nil {
+		slog.Error("upgrade service", "err", err, "service", serviceId)
+		return 0, decimal.Zero, ErrInternalError
+	}
+
+	return invoiceId, decimal.Zero, nil
+}
+
+// ApplyServiceUpgrade updates the product, price and settings of the service to the ones of a pending
+// upgrade, and resizes the provisioned service if the extension supports it. The resize is enqueued in tx.
+//
+// tx is not commited.
+func ApplyServiceUpgrade(ctx context.Context, tx pgx.Tx, upgradeId int32) error {
+	qtx := database.Q.WithTx(tx)
+
+	upgrade, err := qtx.FindServiceUpgradeByIdForUpdate(ctx, upgradeId)
+	if err != nil {
+		return fmt.Errorf("find service upgrade: %w", err)
+	}
+
+	if upgrade.Status != ServiceUpgradePending {
+		return nil
+	}
+
+	s, err := qtx.FindServiceByIdForUpdate(ctx, upgrade.ServiceID)
+	if err != nil {
+		return fmt.Errorf("find service: %w", err)
+	}
+
+	if s.Status == ServiceCancelled {
+		slog.Info("service upgrade cancelled", "upgrade", upgradeId, "service", s.ID, "err", ErrServiceCancelled)
+		return qtx.UpdateServiceUpgradeStatus(ctx, database.UpdateServiceUpgradeStatusParams{
+			Status: ServiceUpgradeCancelled,
+			ID:     upgradeId,
+		})
+	}
+
+	product, err := qtx.FindProductById(ctx, upgrade.ProductID)
+	if err != nil {
+		return fmt.Errorf("find product: %w", err)
+	}
+
+	// the label follows the product name unless it was changed
+	label := s.Label
+	if s.ProductID.Valid {
+		current, err := qtx.FindProductById(ctx, s.ProductID.Int32)
+		if err == nil && current.Name == s.Label {
+			label = product.Name
+		}
+	}
+
+	err = qtx.UpdateServicePlan(ctx, database.UpdateServicePlanParams{
+		ProductID: pgtype.Int4{Valid: true, Int32: product.ID},
+		Label:     label,
+		Price:     upgrade.Price,
+		Settings:  upgrade.Settings,
+		ID:        s.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("update service plan: %w", err)
+	}
+
+	err = qtx.UpdateServiceUpgradeStatus(ctx, database.UpdateServiceUpgradeStatusParams{
+		Status: ServiceUpgradeApplied,
+		ID:     upgradeId,
+	})
+	if err != nil {
+		return fmt.Errorf("update service upgrade status: %w", err)
+	}
+
+	slog.Info("service upgrade applied", "upgrade", upgradeId, "service", s.ID, "product", product.ID, "price", upgrade.Price)
+
+	// resize the provisioned service
+	ext, ok := extension.Extensions[s.Extension]
+	if !ok {
+		slog.Error("invalid extension", "service id", s.ID, "extension", s.Extension)
+		return nil
+	}
+
+	actions, err := ext.AdminActions(s.ID)
+	if err != nil {
+		slog.Error("extension admin actions", "err", err, "service_id", s.ID, "extension", s.Extension)
+		return nil
+	}
+
+	if !slices.Contains(actions, "resize") {
+		return nil
+	}
+
+	// the resize is enqueued in the transaction, so that it runs with the new settings once they are commited
+	err = extension.DoActionAsyncTx(ctx, tx, s.Extension, s.ID, "resize", "")
+	if err != nil {
+		slog.Error("do action async", "err", err, "service_id", s.ID, "action", "resize")
+	}
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"billing3/database"
+	"billing3/database/types"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/shopspring/decimal"
+)
+
+const InvoiceItemUsage = "usage"
+
+// MeteredUsage is the usage of a metered resource by a service in a billing period, and its price.
+type MeteredUsage struct {
+	Metric      string          `json:"metric"`
+	DisplayName string          `json:"display_name"`
+	Unit        string          `json:"unit"`
+	Quantity    decimal.Decimal `json:"quantity"`
+	Amount      decimal.Decimal `json:"amount"` // zero if the product has no price for the metric
+	Currency    string          `json:"currency"`
+}
+
+// ServiceUsage returns the usage of the service recorded from from (inclusive) to to (exclusive), priced by the
+// metered pricing of the product in the currency of the service. If the product has no metered price in the
+// currency of the service, the price in the default currency is converted.
+func ServiceUsage(ctx context.Context, qtx *database.Queries, s *database.Service, from time.Time, to time.Time) ([]MeteredUsage, error) {
+	var prices types.MeteredPrices
+	if s.ProductID.Valid {
+		product, err := qtx.FindProductById(ctx, s.ProductID.Int32)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("find product: %w", err)
+		}
+		prices = product.MeteredPricing
+	}
+
+	rows, err := qtx.SumServiceUsage(ctx, database.SumServiceUsageParams{
+		ServiceID:    s.ID,
+		RecordedAt:   types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: from}},
+		RecordedAt_2: types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: to}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+
+	defaultCurrency := DefaultCurrency(ctx)
+
+	usage := make([]MeteredUsage, 0, len(rows))
+	for _, row := range rows {
+		u := MeteredUsage{
+			Metric:      row.Metric,
+			DisplayName: row.Metric,
+			Quantity:    row.Quantity,
+			Amount:      decimal.Zero,
+			Currency:    s.Currency,
+		}
+
+		price := findMeteredPrice(prices, row.Metric, s.Currency, defaultCurrency)
+		if price != nil {
+			u.DisplayName = price.DisplayName
+			u.Unit = price.Unit
+			u.Amount, err = ConvertCurrency(ctx, TieredAmount(price.Tiers, row.Quantity), priceCurrency(price.Currency, defaultCurrency), s.Currency)
+			if err != nil {
+				return nil, fmt.Errorf("convert usage amount: %w", err)
+			}
+			u.Amount = RoundCurrency(u.Amount, s.Currency)
+		}
+
+		usage = append(usage, u)
+	}
+
+	return usage, nil
+}
+
+// CurrentUsagePeriod returns the current billing period of the service. The usage of the current billing period is
+// charged on the first renewal invoice that is created after the period ends. ok is false if the service has no
+// billing period, e.g. because it has not been paid yet.
+func CurrentUsagePeriod(s *database.Service) (from time.Time, to time.Time, ok bool) {
+	if s.Status == ServiceUnpaid || !s.ExpiresAt.Valid {
+		return time.Time{}, time.Time{}, false
+	}
+	return ServiceBillingCycle(s).Previous(s.ExpiresAt.Time), s.ExpiresAt.Time, true
+}
+
+// TieredAmount returns the price of quantity units charged by graduated tiers, where each unit is charged at the
+// price of the tier it falls in.
+func TieredAmount(tiers []types.MeteredPriceTier, quantity decimal.Decimal) decimal.Decimal {
+	amount := decimal.Zero
+	lower := decimal.Zero
+
+	for _, tier := range tiers {
+		if !quantity.GreaterThan(lower) {
+			break
+		}
+
+		upper := quantity
+		if tier.UpTo.GreaterThan(decimal.Zero) && tier.UpTo.LessThan(quantity) {
+			upper = tier.UpTo
+		}
+
+		amount = amount.Add(upper.Sub(lower).Mul(tier.UnitPrice))
+		lower = upper
+	}
+
+	return amount
+}
+
+// findMeteredPrice returns the metered price of the metric in currency, or in the default currency if there is no
+// price in currency. findMeteredPrice returns nil if the metric has no price.
+func findMeteredPrice(prices types.MeteredPrices, metric string, currency string, defaultCurrency string) *types.MeteredPrice {
+	var defaultPrice *types.MeteredPrice
+
+	for i, price := range prices {
+		if price.Metric != metric {
+			continue
+		}
+
+		c := priceCurrency(price.Currency, defaultCurrency)
+		if c == currency {
+			return &prices[i]
+		}
+		if c == defaultCurrency {
+			defaultPrice = &prices[i]
+		}
+	}
+
+	return defaultPrice
+}
+
+// addUsageItems adds the usage of the service that has not been charged yet to the invoice, and marks it as charged.
+// Renewal invoices are created before the current billing period ends, so only the usage until the start of the
+// current billing period is charged.
+//
+// qtx should be a transaction. qtx is not commited.
+func addUsageItems(ctx context.Context, qtx *database.Queries, invoiceId int32, s *database.Service) error {
+	if !s.ExpiresAt.Valid {
+		return nil
+	}
+
+	from := s.CreatedAt.Time
+	if s.UsageBilledUntil.Valid {
+		from = s.UsageBilledUntil.Time
+	}
+	to := ServiceBillingCycle(s).Previous(s.ExpiresAt.Time)
+	if !to.After(from) {
+		return nil
+	}
+
+	usage, err := ServiceUsage(ctx, qtx, s, from, to)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range usage {
+		if !u.Amount.GreaterThan(decimal.Zero) {
+			continue
+		}
+
+		slog.Info("add usage item", "invoice_id", invoiceId, "service_id", s.ID, "metric", u.Metric, "quantity", u.Quantity, "amount", u.Amount)
+
+		err = qtx.CreateInvoiceItem(ctx, database.CreateInvoiceItemParams{
+			InvoiceID: invoiceId,
+			Description: fmt.Sprintf(
+				"#%d - %s: %s %s %s (%s - %s)",
+				s.ID,
+				s.Label,
+				u.DisplayName,
+				u.Quantity.String(),
+				u.Unit,
+				from.Format("2006-01-02 MST"),
+				to.Format("2006-01-02 MST"),
+			),
+			Amount: u.Amount,
+			Type:   InvoiceItemUsage,
+			ItemID: pgtype.Int4{Valid: true, Int32: s.ID},
+		})
+		if err != nil {
+			return fmt.Errorf("create invoice item: %w", err)
+		}
+	}
+
+	err = qtx.UpdateServiceUsageBilledUntil(ctx, database.UpdateServiceUsageBilledUntilParams{
+		UsageBilledUntil: types.Timestamp{Timestamp: pgtype.Timestamp{Valid: true, Time: to}},
+		ID:               s.ID,
+	})
+	if err != nil {
+		return fmt.Errorf("db: %w", err)
+	}
+
+	return nil
+}
+
+// ValidateMeteredPrices validates the metered pricing of a product.
+func ValidateMeteredPrices(prices types.MeteredPrices) error {
+	type metricCurrency struct {
+		metric   string
+		currency string
+	}
+	seen := make(map[metricCurrency]bool)
+
+	for _, price := range prices {
+		if price.Metric == "" {
+			return errors.New("metered price metric is required")
+		}
+		if price.DisplayName == "" {
+			return errors.New("metered price display name is required")
+		}
+		if price.Currency != "" && !ValidCurrency(price.Currency) {
+			return fmt.Errorf("invalid currency: %s", price.Currency)
+		}
+		if seen[metricCurrency{price.Metric, price.Currency}] {
+			return fmt.Errorf("duplicated metered price: %s", price.Metric)
+		}
+		seen[metricCurrency{price.Metric, price.Currency}] = true
+
+		if len(price.Tiers) == 0 {
+			return fmt.Errorf("metered price %s has no tiers", price.Metric)
+		}
+		lower := decimal.Zero
+		for i, tier := range price.Tiers {
+			if tier.UnitPrice.LessThan(decimal.Zero) {
+				return fmt.Errorf("metered price %s: unit price must not be negative", price.Metric)
+			}
+			last := i == len(price.Tiers)-1
+			if last && !tier.UpTo.IsZero() {
+				return fmt.Errorf("metered price %s: the last tier must have no upper bound", price.Metric)
+			}
+			if !last && !tier.UpTo.GreaterThan(lower) {
+				return fmt.Errorf("metered price %s: tier upper bounds must be increasing", price.Metric)
+			}
+			lower = tier.UpTo
+		}
+	}
+
+	return nil
+}